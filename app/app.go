@@ -0,0 +1,865 @@
+// Package app is the comproc command, for programs that build comproc with
+// additional log drivers registered through the logsink package:
+//
+//	package main
+//
+//	import (
+//		"github.com/ryym/comproc/app"
+//		"github.com/ryym/comproc/logsink"
+//	)
+//
+//	func main() {
+//		logsink.Register("kafka", newKafkaSink)
+//		app.Main()
+//	}
+//
+// The daemon runs from the same executable, so it knows the drivers too.
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/cli"
+	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/process"
+	"github.com/ryym/comproc/internal/suggest"
+)
+
+// Main runs comproc with the command line arguments of the process, and
+// exits with comproc's exit status.
+func Main() {
+	// Internal command: the init process of a service with isolate, which
+	// runs before anything else, such as loading the config
+	if len(os.Args) > 1 && os.Args[1] == process.IsolateInitCommand {
+		os.Exit(process.RunIsolateInit(os.Args[2:]))
+	}
+	if err := run(); err != nil {
+		cli.PrintError(os.Stderr, err)
+		os.Exit(cli.ExitCode(err))
+	}
+}
+
+func run() error {
+	// Global flags
+	var configFiles fileList
+	flag.Var(&configFiles, "f", "Path to config file; repeat to merge more files onto it")
+	flag.Var(&configFiles, "file", "Path to config file; repeat to merge more files onto it")
+	flag.DurationVar(&cli.RequestTimeout, "timeout", cli.RequestTimeout, "Time to wait for the daemon to respond (0 disables)")
+	defaultStart, err := durationFromEnv("COMPROC_START_TIMEOUT", defaultStartTimeout)
+	if err != nil {
+		return err
+	}
+	var startTimeout time.Duration
+	flag.DurationVar(&startTimeout, "start-timeout", defaultStart, "Time to wait for a spawned daemon to start")
+	defaultGraceful, err := durationFromEnv("COMPROC_GRACEFUL_TIMEOUT", 0)
+	if err != nil {
+		return err
+	}
+	if spec := os.Getenv("COMPROC_COLORS"); spec != "" {
+		if cli.Colors, err = cli.ParsePalette(spec); err != nil {
+			return cli.UsageErrorf("invalid COMPROC_COLORS: %w", err)
+		}
+	}
+	var gracefulTimeout time.Duration
+	flag.DurationVar(&gracefulTimeout, "graceful-timeout", defaultGraceful, "Time stopped services may take to exit before they are killed (overrides graceful_timeout)")
+	flag.StringVar(&cli.Env, "env", os.Getenv("COMPROC_ENV"), "Name of the config overlay to merge onto the config file, e.g. staging for comproc.staging.yaml")
+	socketFlag := flag.String("socket", "", "Path to the daemon socket (overrides COMPROC_SOCKET)")
+	listen := flag.String("listen", os.Getenv("COMPROC_LISTEN"), "TCP address a daemon started by this command also listens on (overrides socket.listen)")
+	flag.StringVar(&cli.Host, "host", os.Getenv("COMPROC_HOST"), "TCP address of a daemon to connect to instead of the socket")
+	flag.StringVar(&cli.Token, "token", os.Getenv("COMPROC_TOKEN"), "Token to authenticate with on a daemon's TCP address, and which a daemon started by this command requires (overrides socket.token_file); insecure, as other users can see it in the process list, so prefer COMPROC_TOKEN")
+	defaultTLS, err := boolFromEnv("COMPROC_TLS")
+	if err != nil {
+		return err
+	}
+	flag.BoolVar(&cli.TLS, "tls", defaultTLS, "Connect to --host with TLS")
+	flag.StringVar(&cli.TLSCA, "tls-ca", os.Getenv("COMPROC_TLS_CA"), "CA certificates to verify the daemon at --host with, implying --tls")
+	flag.StringVar(&cli.Output, "output", cli.OutputText, "Format of results and errors: text or json")
+	flag.Usage = printUsage
+
+	// Parse to find the subcommand
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) == 0 {
+		printUsage()
+		return nil
+	}
+
+	if len(configFiles) == 0 {
+		configFiles = fileList{defaultConfigPath()}
+	}
+	absConfigPath, err := filepath.Abs(configFiles[0])
+	if err != nil {
+		return fmt.Errorf("invalid config path: %w", err)
+	}
+	for _, path := range configFiles[1:] {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid config path: %w", err)
+		}
+		cli.Overrides = append(cli.Overrides, absPath)
+	}
+
+	if *socketFlag != "" {
+		// Set the variable so that a spawned daemon uses the same socket
+		path, err := filepath.Abs(*socketFlag)
+		if err != nil {
+			return fmt.Errorf("invalid socket path: %w", err)
+		}
+		os.Setenv("COMPROC_SOCKET", path)
+	}
+	if cli.Output != cli.OutputText && cli.Output != cli.OutputJSON {
+		output := cli.Output
+		cli.Output = cli.OutputText
+		return cli.UsageErrorf("invalid output format: %s (expected %s or %s)", output, cli.OutputText, cli.OutputJSON)
+	}
+	if gracefulTimeout < 0 {
+		return cli.UsageErrorf("invalid graceful timeout: %s", gracefulTimeout)
+	}
+	if gracefulTimeout > 0 {
+		// Set the variable so that a spawned daemon uses the same timeout
+		os.Setenv("COMPROC_GRACEFUL_TIMEOUT", gracefulTimeout.String())
+	}
+	if *listen != "" {
+		if err := config.ValidateListenAddress(*listen); err != nil {
+			return cli.UsageErrorf("%v", err)
+		}
+		// Set the variable so that a spawned daemon listens on the address
+		os.Setenv("COMPROC_LISTEN", *listen)
+	}
+	if cli.Token != "" {
+		// Set the variable so that a spawned daemon requires the token
+		os.Setenv("COMPROC_TOKEN", cli.Token)
+	}
+	if cli.Env != "" {
+		if err := config.ValidateOverlayName(cli.Env); err != nil {
+			return cli.UsageErrorf("%v", err)
+		}
+		// Set the variable so that a spawned daemon uses the same overlay
+		os.Setenv("COMPROC_ENV", cli.Env)
+	}
+	cmd, err := resolveCommand(args[0])
+	if err != nil {
+		return err
+	}
+	socketPath, err := daemon.SocketPath(absConfigPath, cli.Overrides, cli.Env)
+	if err != nil && cli.Host == "" && usesSocket(cmd) {
+		return cli.ConfigErrorf("failed to load config: %w", err)
+	}
+	cmdArgs := args[1:]
+
+	if usesDaemon(cmd) {
+		cli.WarnVersionMismatch(socketPath)
+	}
+
+	switch cmd {
+	case "up":
+		return runUp(socketPath, absConfigPath, startTimeout, gracefulTimeout, cmdArgs)
+	case "down":
+		return cli.RunDown(socketPath)
+	case "stop":
+		return runStop(socketPath, absConfigPath, cmdArgs)
+	case "status", "ps":
+		return runStatus(socketPath, absConfigPath, cmdArgs)
+	case "restart":
+		return runRestart(socketPath, absConfigPath, cmdArgs)
+	case "reload":
+		if len(cmdArgs) > 0 {
+			return cli.UsageErrorf("reload takes no arguments")
+		}
+		return cli.RunReload(socketPath, absConfigPath)
+	case "scale":
+		return runScale(socketPath, absConfigPath, cmdArgs)
+	case "logs":
+		return runLogs(socketPath, absConfigPath, cmdArgs)
+	case "attach":
+		return runAttach(socketPath, absConfigPath, cmdArgs)
+	case "history":
+		return runHistory(socketPath, absConfigPath, cmdArgs)
+	case "inspect":
+		return runInspect(socketPath, absConfigPath, cmdArgs)
+	case "debug-bundle":
+		return runDebugBundle(socketPath, absConfigPath, cmdArgs)
+	case "stdin":
+		return runStdin(socketPath, absConfigPath, cmdArgs)
+	case "run":
+		return runRun(socketPath, absConfigPath, cmdArgs)
+	case "exec":
+		return runExec(socketPath, absConfigPath, cmdArgs)
+	case "env":
+		return runEnv(socketPath, absConfigPath, cmdArgs)
+	case "lint":
+		return cli.RunLint(absConfigPath)
+	case "tmux":
+		return runTmux(socketPath, absConfigPath, cmdArgs)
+	case "export":
+		return runExport(absConfigPath, cmdArgs)
+	case "version":
+		return cli.RunVersion(socketPath)
+	case "ping":
+		return runPing(socketPath, cmdArgs)
+	case "daemon":
+		return runDaemonCommand(socketPath, cmdArgs)
+	case "__daemon":
+		// Internal command: runs the daemon process
+		return runDaemon(socketPath, absConfigPath, gracefulTimeout, *listen)
+	case "__watchdog":
+		// Internal command: runs the daemon process and restarts it on crashes
+		return cli.RunDaemonWatchdog(socketPath, absConfigPath)
+	case "help", "-h", "--help":
+		printUsage()
+		return nil
+	default:
+		return cli.UsageErrorf("unknown command: %s", cmd)
+	}
+}
+
+// commands are the subcommands shown in the usage, which may be
+// abbreviated and are suggested for mistyped commands.
+var commands = []string{
+	"up", "down", "stop", "status", "ps", "restart", "reload", "scale", "logs", "attach", "stdin", "run", "exec",
+	"history", "inspect", "debug-bundle", "env", "lint", "export", "tmux", "version", "ping", "daemon", "help",
+}
+
+// usageHint is shown after errors for unknown commands.
+const usageHint = "Usage: comproc [options] <command> [args] (see 'comproc help')"
+
+// resolveCommand returns the subcommand that cmd names, which may be
+// abbreviated to any prefix that matches only one command. Otherwise the
+// error suggests similar commands.
+func resolveCommand(cmd string) (string, error) {
+	if slices.Contains(commands, cmd) || strings.HasPrefix(cmd, "__") || strings.HasPrefix(cmd, "-") {
+		return cmd, nil
+	}
+	switch matches := suggest.Prefixed(cmd, commands); len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		msg := "unknown command: " + cmd
+		if similar := suggest.Similar(cmd, commands); len(similar) > 0 {
+			msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(similar[:min(len(similar), 3)], " or "))
+		}
+		return "", cli.UsageErrorf("%s\n%s", msg, usageHint)
+	default:
+		return "", cli.UsageErrorf("command %s is ambiguous (matches %s)\n%s", cmd, strings.Join(matches, ", "), usageHint)
+	}
+}
+
+// fileList is a flag that may be given several times, collecting its values
+// in order.
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *fileList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// usesDaemon reports whether the command talks to a running daemon, in which
+// case the daemon's version is checked first.
+func usesDaemon(cmd string) bool {
+	switch cmd {
+	case "up", "stop", "status", "ps", "restart", "reload", "scale", "logs", "attach", "stdin", "run", "exec", "history", "inspect", "tmux":
+		return true
+	default:
+		return false
+	}
+}
+
+// usesSocket reports whether the command needs the path of the daemon's
+// socket, which may be set in the config.
+func usesSocket(cmd string) bool {
+	switch cmd {
+	case "lint", "export", "help", "-h", "--help":
+		return false
+	default:
+		return true
+	}
+}
+
+// defaultConfigPath returns the config path used when -f is not given.
+// COMPROC_FILE takes precedence, then the default config file in the
+// COMPROC_PROJECT directory, then the default config file in the current
+// directory.
+func defaultConfigPath() string {
+	if path := os.Getenv("COMPROC_FILE"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("COMPROC_PROJECT"); dir != "" {
+		return config.FindDefault(dir)
+	}
+	return config.FindDefault(".")
+}
+
+func runUp(socketPath, configPath string, startTimeout, gracefulTimeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("up", flag.ExitOnError)
+	follow := fs.Bool("f", false, "Follow log output after starting")
+	wait := fs.Bool("wait", false, "Wait until services are ready")
+	noDaemon := fs.Bool("no-daemon", false, "Run services in the foreground without a daemon")
+	exitCodeFrom := fs.String("exit-code-from", "", "Exit with the exit code of the given service (implies --no-daemon)")
+	respawn := fs.Bool("respawn-daemon", false, "Restart the spawned daemon if it crashes while services are running")
+	removeOrphans := fs.Bool("remove-orphans", false, "Stop and remove services that are no longer in the config file")
+	fs.Parse(args)
+
+	if *noDaemon || *exitCodeFrom != "" {
+		return cli.RunForeground(configPath, fs.Args(), cli.ForegroundOptions{
+			ExitCodeFrom:    *exitCodeFrom,
+			GracefulTimeout: gracefulTimeout,
+		})
+	}
+
+	// Ensure daemon is running (spawn if needed, wait for socket)
+	if err := ensureDaemon(configPath, socketPath, startTimeout, *respawn); err != nil {
+		return err
+	}
+
+	return cli.RunUp(socketPath, configPath, fs.Args(), cli.UpOptions{
+		Follow:        *follow,
+		Wait:          *wait,
+		RemoveOrphans: *removeOrphans,
+	})
+}
+
+// defaultStartTimeout is how long to wait for a spawned daemon to accept
+// connections unless overridden by --start-timeout or COMPROC_START_TIMEOUT.
+const defaultStartTimeout = 10 * time.Second
+
+// durationFromEnv returns the duration set by an environment variable, or
+// def if it is not set.
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, cli.UsageErrorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+func boolFromEnv(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, cli.UsageErrorf("invalid %s: %s (expected true or false)", name, v)
+	}
+	return b, nil
+}
+
+// ensureDaemon ensures a daemon process is running and its socket is ready.
+// If no daemon is running, it validates the config, spawns a background
+// daemon process, and waits up to timeout for the socket to become available,
+// polling with exponential backoff. If the daemon exits or does not come up
+// in time, the error includes the tail of the daemon's output. With respawn,
+// the daemon runs under a watchdog process that restarts it after a crash.
+// A daemon on another machine, given by --host, is never spawned.
+func ensureDaemon(configPath, socketPath string, timeout time.Duration, respawn bool) error {
+	// Check if daemon is already running
+	if cli.DaemonReachable(socketPath) {
+		return nil
+	}
+	if cli.Host != "" {
+		return cli.DaemonErrorf("no daemon is listening on %s; start one there with --listen", cli.Host)
+	}
+
+	// Validate config before spawning to catch errors immediately
+	if _, err := config.LoadOverrides(configPath, cli.Overrides, cli.Env); err != nil {
+		return cli.ConfigErrorf("failed to load config: %w", err)
+	}
+
+	// Start daemon process
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	// Keep the daemon's output so startup failures can be reported
+	outputPath := daemon.OutputPath(socketPath)
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create daemon output file: %w", err)
+	}
+	defer output.Close()
+
+	internalCmd := "__daemon"
+	if respawn {
+		internalCmd = "__watchdog"
+	}
+	cmd := exec.Command(exe, append(cli.ConfigArgs(configPath), internalCmd)...)
+	// Detach the daemon into a session of its own, so that neither Ctrl-C
+	// (SIGINT sent to the foreground process group) nor the terminal closing
+	// (SIGHUP sent to the session) reaches it. It runs in "/" so that it
+	// doesn't keep the directory it was started from busy; paths it uses
+	// are absolute.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Dir = "/"
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Stdin = nil
+
+	if err := cmd.Start(); err != nil {
+		return cli.DaemonErrorf("failed to start daemon: %w", err)
+	}
+
+	// The daemon keeps running after the CLI exits; waiting only lets us
+	// notice if it dies during startup
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	// Wait for socket to be ready
+	deadline := time.Now().Add(timeout)
+	delay := 10 * time.Millisecond
+	for {
+		if cli.DaemonReachable(socketPath) {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return daemonStartError(fmt.Sprintf("timed out after %s waiting for daemon to start (see --start-timeout)", timeout), outputPath)
+		}
+
+		select {
+		case err := <-exited:
+			return daemonStartError(fmt.Sprintf("daemon exited during startup (%v)", err), outputPath)
+		case <-time.After(min(delay, remaining)):
+		}
+		delay = min(delay*2, 500*time.Millisecond)
+	}
+}
+
+// daemonStartError builds an error for a failed daemon startup, including
+// the last lines the daemon wrote to its output file.
+func daemonStartError(msg, outputPath string) error {
+	data, _ := os.ReadFile(outputPath)
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return cli.DaemonErrorf("%s; no output in %s", msg, outputPath)
+	}
+
+	const maxLines = 20
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return cli.DaemonErrorf("%s; last daemon output (%s):\n  %s", msg, outputPath, strings.Join(lines, "\n  "))
+}
+
+// runDaemon runs as the background daemon process.
+func runDaemon(socketPath, configPath string, gracefulTimeout time.Duration, listen string) error {
+	return cli.RunDaemon(socketPath, configPath, cli.DaemonOptions{
+		GracefulTimeout: gracefulTimeout,
+		Listen:          listen,
+		Token:           cli.Token,
+	})
+}
+
+// runDaemonCommand runs subcommands that inspect the daemon itself.
+func runDaemonCommand(socketPath string, args []string) error {
+	if len(args) == 0 {
+		return cli.UsageErrorf("daemon requires a subcommand: stats or stop")
+	}
+	switch args[0] {
+	case "stats":
+		return cli.RunDaemonStats(socketPath)
+	case "stop":
+		return cli.RunDaemonStop(socketPath)
+	default:
+		return cli.UsageErrorf("unknown daemon subcommand: %s", args[0])
+	}
+}
+
+func runStop(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	fs.Parse(args)
+
+	return cli.RunStop(socketPath, configPath, fs.Args())
+}
+
+func runStatus(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	wide := fs.Bool("wide", false, "Also show restart policy, working directory, and command")
+	tree := fs.Bool("tree", false, "Show services as a dependency tree")
+	format := fs.String("format", cli.StatusFormatTable, "Output format: table, json, or yaml")
+	fs.Parse(args)
+
+	switch *format {
+	case cli.StatusFormatTable, cli.StatusFormatJSON, cli.StatusFormatYAML:
+	default:
+		return cli.UsageErrorf("invalid status format: %s (expected %s, %s, or %s)", *format, cli.StatusFormatTable, cli.StatusFormatJSON, cli.StatusFormatYAML)
+	}
+	return cli.RunStatus(socketPath, configPath, cli.StatusOptions{Wide: *wide, Tree: *tree, Format: *format})
+}
+
+func runRestart(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("restart", flag.ExitOnError)
+	var opts cli.RestartOptions
+	fs.BoolVar(&opts.Rolling, "rolling", false, "Restart services one at a time, each after the previous one is ready")
+	fs.Parse(args)
+
+	return cli.RunRestart(socketPath, configPath, fs.Args(), opts)
+}
+
+func runScale(socketPath, configPath string, args []string) error {
+	if len(args) == 0 {
+		return cli.UsageErrorf("scale requires at least one service=count")
+	}
+	replicas := make(map[string]int)
+	for _, arg := range args {
+		name, count, ok := strings.Cut(arg, "=")
+		n, err := strconv.Atoi(count)
+		if !ok || name == "" || err != nil {
+			return cli.UsageErrorf("invalid scale argument: %s (expected service=count)", arg)
+		}
+		replicas[name] = n
+	}
+	return cli.RunScale(socketPath, configPath, replicas)
+}
+
+func runAttach(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	var opts cli.AttachOptions
+	fs.BoolVar(&opts.ReadOnly, "read-only", false, "Watch the output without sending input")
+	fs.StringVar(&opts.Record, "record", "", "Save the session's input and output with timestamps to a file")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return cli.UsageErrorf("attach requires exactly one service name")
+	}
+	return cli.RunAttach(socketPath, configPath, fs.Arg(0), opts)
+}
+
+func runStdin(socketPath, configPath string, args []string) error {
+	if len(args) != 1 {
+		return cli.UsageErrorf("stdin requires exactly one service name")
+	}
+	return cli.RunStdin(socketPath, configPath, args[0], os.Stdin)
+}
+
+func runRun(socketPath, configPath string, args []string) error {
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return cli.UsageErrorf("run requires a service name and a command")
+	}
+	return cli.RunRun(socketPath, configPath, args[0], args[1:])
+}
+
+func runExec(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	var opts cli.ExecOptions
+	fs.BoolVar(&opts.NoTTY, "T", false, "Don't allocate a terminal")
+	fs.Parse(args)
+
+	args = fs.Args()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return cli.UsageErrorf("exec requires a service name and a command")
+	}
+	return cli.RunExec(socketPath, configPath, args[0], args[1:], opts)
+}
+
+func runHistory(socketPath, configPath string, args []string) error {
+	if len(args) != 1 {
+		return cli.UsageErrorf("history requires exactly one service name")
+	}
+	return cli.RunHistory(socketPath, configPath, args[0])
+}
+
+func runInspect(socketPath, configPath string, args []string) error {
+	if len(args) != 1 {
+		return cli.UsageErrorf("inspect requires exactly one service name")
+	}
+	return cli.RunInspect(socketPath, configPath, args[0])
+}
+
+func runDebugBundle(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("debug-bundle", flag.ExitOnError)
+	var opts cli.DebugBundleOptions
+	fs.StringVar(&opts.Output, "o", "", "Output file (default: comproc-debug-<time>.tar.gz)")
+	fs.IntVar(&opts.Lines, "n", 1000, "Number of recent log lines per service")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return cli.UsageErrorf("debug-bundle takes no arguments")
+	}
+	return cli.RunDebugBundle(socketPath, configPath, opts)
+}
+
+func runTmux(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("tmux", flag.ExitOnError)
+	var opts cli.TmuxOptions
+	fs.StringVar(&opts.Session, "session", "", "Session name (default: comproc-<project>)")
+	fs.BoolVar(&opts.Panes, "panes", false, "Show services as panes of one window")
+	fs.BoolVar(&opts.Attach, "attach", false, "Attach to services instead of following their logs")
+	fs.BoolVar(&opts.Detach, "d", false, "Create the session without attaching to it")
+	fs.BoolVar(&opts.Detach, "detach", false, "Create the session without attaching to it")
+	fs.Parse(args)
+
+	return cli.RunTmux(socketPath, configPath, fs.Args(), opts)
+}
+
+func runExport(configPath string, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cli.UsageErrorf("export requires a format: %s or %s", cli.ExportFormatVSCode, cli.ExportFormatLaunchd)
+	}
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var opts cli.ExportOptions
+	fs.StringVar(&opts.Output, "o", "", "Output file or directory, or - for stdout")
+	fs.BoolVar(&opts.Force, "force", false, "Overwrite existing files that can't be merged")
+	fs.Parse(args[1:])
+
+	return cli.RunExport(configPath, args[0], opts)
+}
+
+func runEnv(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	format := fs.String("format", cli.EnvFormatPlain, "Output format: plain, dotenv, or export")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return cli.UsageErrorf("env requires exactly one service name")
+	}
+	return cli.RunEnv(socketPath, configPath, fs.Arg(0), *format)
+}
+
+func runPing(socketPath string, args []string) error {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	count := fs.Int("c", 1, "Number of pings to send")
+	interval := fs.Duration("i", time.Second, "Time between pings")
+	fs.Parse(args)
+
+	if *count < 1 {
+		return cli.UsageErrorf("ping count must be at least 1")
+	}
+	return cli.RunPing(socketPath, *count, *interval)
+}
+
+func runLogs(socketPath, configPath string, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	var opts cli.LogsOptions
+	fs.BoolVar(&opts.Follow, "f", false, "Follow log output")
+	fs.IntVar(&opts.Lines, "n", 100, "Number of lines to show")
+	fs.StringVar(&opts.Since, "since", "", "Show lines written after a time (RFC 3339) or a duration ago (e.g. 2h)")
+	fs.BoolVar(&opts.Raw, "raw", false, "Print lines without service prefixes or colors")
+	fs.BoolVar(&opts.Dedup, "dedup", false, "Collapse identical consecutive lines of a service")
+	fs.StringVar(&opts.Output, "o", "", "Also write lines to a file ({service} in the path splits it per service)")
+	fs.StringVar(&opts.Output, "output", "", "Also write lines to a file ({service} in the path splits it per service)")
+	stdout := fs.Bool("stdout", false, "Only show lines written to stdout")
+	stderr := fs.Bool("stderr", false, "Only show lines written to stderr")
+	fs.StringVar(&opts.Grep, "grep", "", "Only show lines matching a regular expression")
+	fs.Parse(args)
+
+	switch {
+	case *stdout && *stderr:
+		return cli.UsageErrorf("--stdout and --stderr cannot be used together")
+	case *stdout:
+		opts.Stream = "stdout"
+	case *stderr:
+		opts.Stream = "stderr"
+	}
+
+	return cli.RunLogs(socketPath, configPath, fs.Args(), opts)
+}
+
+func printUsage() {
+	fmt.Println(`comproc - Process manager
+
+Usage:
+  comproc [options] <command> [args]
+
+Options:
+  -f, --file <path>   Path to config file (default: comproc.yaml, .yml,
+                      .toml, or .json, whichever exists first); repeat to
+                      merge more files onto it, later ones taking precedence
+  --timeout <dur>     Time to wait for the daemon to respond
+                      (default: 60s, 0 disables)
+  --start-timeout <dur>
+                      Time to wait for a spawned daemon to start
+                      (default: 10s)
+  --socket <path>     Path to the daemon socket
+  --listen <addr>     TCP address, such as 127.0.0.1:7007, on which a daemon
+                      started by this command also accepts clients
+  --host <addr>       TCP address of a daemon to connect to instead of the
+                      socket, e.g. one in a VM started with --listen
+  --token <token>     Token to authenticate with on a daemon's TCP address,
+                      and which a daemon started by this command requires;
+                      insecure, as other users can see it in the process
+                      list, so prefer COMPROC_TOKEN
+  --tls               Connect to --host with TLS
+  --tls-ca <path>     CA certificates to verify the daemon at --host with,
+                      implying --tls
+  --env <name>        Merge the overlay file <name> onto the config file,
+                      e.g. comproc.staging.yaml for staging
+  --output <format>   Format of results and errors: text (default) or json
+  --graceful-timeout <dur>
+                      Time stopped services may take to exit before they
+                      are killed (default: graceful_timeout in the config,
+                      or 10s)
+
+Environment:
+  COMPROC_FILE        Config file to use when -f is not given
+  COMPROC_PROJECT     Project directory containing the config file
+  COMPROC_SOCKET      Path to the daemon socket (same as --socket)
+  COMPROC_LISTEN      Default for --listen
+  COMPROC_HOST        Default for --host
+  COMPROC_TOKEN       Default for --token
+  COMPROC_TLS         Default for --tls: true or false
+  COMPROC_TLS_CA      Default for --tls-ca
+  COMPROC_START_TIMEOUT
+                      Default for --start-timeout
+  COMPROC_GRACEFUL_TIMEOUT
+                      Default for --graceful-timeout
+  COMPROC_ENV         Default for --env
+  COMPROC_COLORS      Colors of service names in logs, e.g. colorblind,
+                      light, or cyan,208,#ff8800,api=red
+
+Commands:
+  up [services...]      Start services (daemon runs in background)
+    -f                  Follow log output after starting
+    --wait              Wait until services are ready
+    --no-daemon         Run in the foreground without a daemon (Ctrl-C stops all)
+    --exit-code-from <service>
+                        Stop all services when <service> exits and use its
+                        exit code (implies --no-daemon)
+    --respawn-daemon    Restart the spawned daemon if it crashes while
+                        services are running
+    --remove-orphans    Stop and remove services that are no longer in the
+                        config file
+
+  down                  Stop all services and shut down
+
+  stop [services...]    Stop services (without shutting down)
+
+  status, ps            Show service status
+    --wide              Also show restart policy, working directory, and command
+    --tree              Show services as a dependency tree
+    --format <fmt>      Output format: table, json, yaml (default: table)
+
+  restart [services...] Restart services
+    --rolling           Restart services one at a time, each after the
+                        previous one is ready
+
+  reload                Apply changes to the config file: start added services,
+                        remove removed ones, and restart changed ones
+
+  scale <service=count...>
+                        Run count replicas of each service, named
+                        <service>-1, <service>-2, ...: start added replicas
+                        and remove others (the counts last until the daemon
+                        stops)
+
+  logs [services...]    Show service logs
+    -f                  Follow log output
+    -n <lines>          Number of lines to show (default: 100)
+    --since <time>      Show lines written after a time (RFC 3339) or a
+                        duration ago (e.g. 2h)
+    --raw               Print lines as written, without service prefixes or colors
+    --dedup             Collapse identical consecutive lines of a service
+    --stdout, --stderr  Only show lines written to stdout or stderr
+    --grep <regexp>     Only show lines matching a regular expression
+    -o, --output <path> Also write lines to a file, without colors; {service}
+                        in the path writes each service to its own file
+
+  attach <service>      Attach to a service (forward stdin, stream logs)
+    --read-only         Watch the output without sending input
+    --record <path>     Save the session's input and output with timestamps
+
+  stdin <service>       Write this command's input to a service's stdin
+
+  run <service> <command...>
+                        Run a one-off command in a service's working directory
+                        and environment, and exit with its exit code
+
+  exec <service> <command...>
+                        Run a command in a running service's environment, in a
+                        terminal of its own when stdin is a terminal
+    -T                  Don't allocate a terminal
+
+  history <service>     Show recent runs of a service (start, exit, reason)
+
+  inspect <service>     Print the config, state, history, log buffer, and
+                        environment of a service as JSON (secrets masked)
+
+  debug-bundle          Package the resolved config (secrets masked), status,
+                        recent logs, daemon output, and events into a tarball
+                        for bug reports
+    -o <path>           Output file (default: comproc-debug-<time>.tar.gz)
+    -n <lines>          Number of recent log lines per service (default: 1000)
+
+  env <service>         Print a service's resolved environment
+    --format <fmt>      Output format: plain, dotenv, export (default: plain)
+
+  lint                  Warn about config practices that are likely to cause
+                        trouble, such as secrets in env
+
+  export <format>       Generate files for other tools from the config
+    -o <path>           Output file or directory, or - for stdout
+    --force             Overwrite existing files that can't be merged
+                        Formats: vscode (.vscode/tasks.json),
+                        launchd (~/Library/LaunchAgents/*.plist)
+
+  tmux [services...]    Open a tmux session following each service's logs
+    --session <name>    Session name (default: comproc-<project>)
+    --panes             Show services as panes of one window
+    --attach            Attach to services instead of following their logs
+    -d, --detach        Create the session without attaching to it
+
+  version               Show CLI and daemon versions
+
+  ping                  Check that the daemon responds and show latency
+    -c <count>          Number of pings to send (default: 1)
+    -i <dur>            Time between pings (default: 1s)
+
+  daemon stats          Show daemon uptime, connections, and memory usage
+  daemon stop           Stop all services and the daemon, using its pidfile
+                        if it doesn't respond
+
+Examples:
+  comproc up                    Start all services
+  comproc up api db             Start specific services
+  comproc up -f                 Start all services and follow logs
+  comproc up --wait             Start all services and wait until they are ready
+  comproc up --no-daemon        Run all services in the foreground
+  comproc up --exit-code-from tests
+                                Run tests against the stack, exit with their code
+  comproc stop api              Stop specific services
+  comproc down                  Stop all services and shut down
+  comproc status                Show status of all services
+  comproc logs -f api           Follow logs for api service
+  comproc restart api           Restart api service
+  comproc restart --rolling 'web-*'
+                                Restart the web services one at a time
+  comproc reload                Apply changes to the config file
+  comproc scale worker=3        Run three replicas of the worker service
+  comproc stdin repl < setup.txt
+                                Send the lines of setup.txt to the repl service
+  comproc exec db psql          Open a psql shell in the running db service
+  comproc env --format export api
+                                Print api's environment as export statements
+  comproc lint                  Check the config for common mistakes
+  comproc export vscode         Generate VS Code tasks for all services
+  comproc tmux --panes          Follow all services' logs in tiled tmux panes
+  comproc ping                  Check whether the daemon is running`)
+}
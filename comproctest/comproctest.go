@@ -0,0 +1,398 @@
+// Package comproctest runs comproc stacks from Go tests.
+//
+// A Fixture runs the comproc CLI against a config file with its own daemon
+// socket, so tests can run in parallel without interfering with each other
+// or with a daemon the developer is using:
+//
+//	func TestAPI(t *testing.T) {
+//		f := comproctest.NewFixture(t)
+//		f.UseConfig("comproc.yaml")
+//		f.Up("api")
+//		if err := f.WaitForState("api", "running", 10*time.Second); err != nil {
+//			t.Fatal(err)
+//		}
+//		// ... exercise the api ...
+//	}
+//
+// All services are stopped and the daemon is shut down when the test ends.
+// The fixture runs a comproc binary, which is found through Binary.
+package comproctest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Binary is the path of the comproc executable run by fixtures. If empty,
+// the COMPROC_BIN environment variable is used, then comproc from PATH.
+var Binary string
+
+// CommandTimeout limits how long a single command run by Fixture.Run may take.
+var CommandTimeout = 30 * time.Second
+
+// Fixture provides an isolated comproc environment for a test.
+type Fixture struct {
+	t          testing.TB
+	binary     string
+	TempDir    string // Removed when the test ends
+	SocketPath string // Daemon socket, passed to comproc as COMPROC_SOCKET
+	ConfigPath string // Passed to comproc with -f, if set
+
+	asyncCmd *exec.Cmd
+}
+
+// NewFixture creates a fixture with a temporary directory and its own daemon
+// socket. When the test ends, it runs `comproc down`, interrupts the last
+// command started by RunAsync, and removes the temporary directory.
+func NewFixture(t testing.TB) *Fixture {
+	t.Helper()
+
+	binary, err := findBinary()
+	if err != nil {
+		t.Fatalf("comproctest: %v", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "comproc-fixture-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	f := &Fixture{
+		t:          t,
+		binary:     binary,
+		TempDir:    tmpDir,
+		SocketPath: filepath.Join(tmpDir, "comproc.sock"),
+	}
+
+	t.Cleanup(func() {
+		f.Run("down")
+		if f.asyncCmd != nil && f.asyncCmd.Process != nil {
+			InterruptAndWait(f.asyncCmd)
+		}
+		os.RemoveAll(tmpDir)
+	})
+
+	return f
+}
+
+// findBinary resolves the comproc executable to run.
+func findBinary() (string, error) {
+	if Binary != "" {
+		return Binary, nil
+	}
+	if path := os.Getenv("COMPROC_BIN"); path != "" {
+		return path, nil
+	}
+	path, err := exec.LookPath("comproc")
+	if err != nil {
+		return "", fmt.Errorf("comproc binary not found; set comproctest.Binary or COMPROC_BIN: %w", err)
+	}
+	return path, nil
+}
+
+// WriteConfig writes a YAML config file to the temp directory and uses it.
+func (f *Fixture) WriteConfig(yaml string) {
+	f.t.Helper()
+
+	configPath := filepath.Join(f.TempDir, "comproc.yaml")
+	if err := os.WriteFile(configPath, []byte(yaml), 0644); err != nil {
+		f.t.Fatalf("failed to write config: %v", err)
+	}
+	f.ConfigPath = configPath
+}
+
+// UseConfig uses an existing config file. Relative paths are resolved from
+// the current directory, which is the package directory in `go test`.
+func (f *Fixture) UseConfig(path string) {
+	f.t.Helper()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		f.t.Fatalf("invalid config path: %v", err)
+	}
+	f.ConfigPath = abs
+}
+
+// Up runs `comproc up` with the given arguments and fails the test if it fails.
+func (f *Fixture) Up(args ...string) {
+	f.t.Helper()
+
+	if _, stderr, err := f.Run(append([]string{"up"}, args...)...); err != nil {
+		f.t.Fatalf("comproc up failed: %v\n%s", err, stderr)
+	}
+}
+
+// Run executes `comproc [-f <configPath>] <args...>` and waits for it to complete.
+// The -f flag is prepended automatically when a config has been set.
+func (f *Fixture) Run(args ...string) (stdout, stderr string, err error) {
+	f.t.Helper()
+	return f.RunWithEnv(nil, args...)
+}
+
+// RunWithEnv is like Run but adds the given "KEY=value" entries to the environment.
+func (f *Fixture) RunWithEnv(env []string, args ...string) (stdout, stderr string, err error) {
+	f.t.Helper()
+	return f.run(env, nil, args...)
+}
+
+// RunWithInput is like Run but feeds input to the command's stdin.
+func (f *Fixture) RunWithInput(input string, args ...string) (stdout, stderr string, err error) {
+	f.t.Helper()
+	return f.run(nil, strings.NewReader(input), args...)
+}
+
+func (f *Fixture) run(env []string, stdin io.Reader, args ...string) (stdout, stderr string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, f.binary, f.buildArgs(args...)...)
+	cmd.Env = append(os.Environ(), "COMPROC_SOCKET="+f.SocketPath)
+	cmd.Env = append(cmd.Env, env...)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// RunAsync starts `comproc [-f <configPath>] <args...>` without waiting for completion.
+// The command runs in its own process group so InterruptAndWait can simulate Ctrl-C.
+// Returns the running command and a thread-safe output buffer.
+func (f *Fixture) RunAsync(args ...string) (*exec.Cmd, *SyncBuffer, error) {
+	f.t.Helper()
+
+	cmd := exec.Command(f.binary, f.buildArgs(args...)...)
+	cmd.Env = append(os.Environ(), "COMPROC_SOCKET="+f.SocketPath)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	outBuf := &SyncBuffer{}
+	cmd.Stdout = outBuf
+	cmd.Stderr = outBuf
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	f.asyncCmd = cmd
+	return cmd, outBuf, nil
+}
+
+// buildArgs prepends `-f <configPath>` when a config has been set.
+func (f *Fixture) buildArgs(args ...string) []string {
+	if f.ConfigPath != "" {
+		return append([]string{"-f", f.ConfigPath}, args...)
+	}
+	return args
+}
+
+// InterruptAndWait simulates Ctrl-C by sending SIGINT to the process group
+// of the given command, then waits for it to exit. This requires the command
+// to have been started with SysProcAttr.Setpgid = true.
+func InterruptAndWait(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGINT); err != nil {
+		return fmt.Errorf("failed to send SIGINT to process group: %w", err)
+	}
+	return cmd.Wait()
+}
+
+// WaitForSocket waits until the daemon socket is available.
+func (f *Fixture) WaitForSocket(timeout time.Duration) error {
+	f.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("unix", f.SocketPath, 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for socket %s", f.SocketPath)
+}
+
+// WaitForSocketGone waits until the daemon socket is removed.
+func (f *Fixture) WaitForSocketGone(timeout time.Duration) error {
+	f.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(f.SocketPath); os.IsNotExist(err) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for socket %s to be removed", f.SocketPath)
+}
+
+// ServiceStatus represents parsed status of a single service.
+type ServiceStatus struct {
+	Name     string
+	State    string
+	PID      int
+	Restarts int
+	Started  string
+}
+
+// GetStatus runs the status command and parses the output.
+func (f *Fixture) GetStatus() ([]ServiceStatus, error) {
+	f.t.Helper()
+
+	stdout, _, err := f.Run("status")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseStatus(stdout), nil
+}
+
+// ParseStatus parses the tabular output of `comproc status`.
+func ParseStatus(output string) []ServiceStatus {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+
+	// Skip header line
+	var statuses []ServiceStatus
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		pid := 0
+		if fields[2] != "-" {
+			pid, _ = strconv.Atoi(fields[2])
+		}
+		restarts, _ := strconv.Atoi(fields[3])
+
+		statuses = append(statuses, ServiceStatus{
+			Name:     fields[0],
+			State:    fields[1],
+			PID:      pid,
+			Restarts: restarts,
+			Started:  fields[4],
+		})
+	}
+
+	return statuses
+}
+
+// WaitForState polls until the service reaches the specified state.
+func (f *Fixture) WaitForState(service, state string, timeout time.Duration) error {
+	f.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		statuses, err := f.GetStatus()
+		if err != nil {
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+
+		for _, s := range statuses {
+			if s.Name == service && s.State == state {
+				return nil
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// Get final status for error message
+	statuses, _ := f.GetStatus()
+	var currentState string
+	for _, s := range statuses {
+		if s.Name == service {
+			currentState = s.State
+			break
+		}
+	}
+
+	return fmt.Errorf("timeout waiting for %s to reach state %s (current: %s)", service, state, currentState)
+}
+
+// GetServiceStatus returns the status of a specific service.
+func (f *Fixture) GetServiceStatus(service string) (*ServiceStatus, error) {
+	f.t.Helper()
+
+	statuses, err := f.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range statuses {
+		if s.Name == service {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s not found", service)
+}
+
+// DaemonPID returns the PID reported by `daemon stats`.
+func (f *Fixture) DaemonPID() int {
+	f.t.Helper()
+
+	stdout, stderr, err := f.Run("daemon", "stats")
+	if err != nil {
+		f.t.Fatalf("daemon stats failed: %v\n%s", err, stderr)
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if rest, ok := strings.CutPrefix(line, "PID:"); ok {
+			pid, err := strconv.Atoi(strings.TrimSpace(rest))
+			if err != nil {
+				f.t.Fatalf("invalid PID line %q", line)
+			}
+			return pid
+		}
+	}
+	f.t.Fatalf("no PID in daemon stats output:\n%s", stdout)
+	return 0
+}
+
+// WaitForContent polls the buffer until it contains the expected substring.
+func WaitForContent(buf *SyncBuffer, substr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if strings.Contains(buf.String(), substr) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for %q in output (got: %s)", substr, buf.String())
+}
+
+// SyncBuffer is a thread-safe buffer for capturing command output.
+type SyncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (b *SyncBuffer) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the buffer contents as a string.
+func (b *SyncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,54 @@
+package comproctest
+
+import (
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	output := `NAME  STATE    PID    RESTARTS  STARTED
+api   running  12345  2         2024-01-15 10:30:00
+db    stopped  -      0         -
+`
+
+	statuses := ParseStatus(output)
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(statuses))
+	}
+
+	api := statuses[0]
+	if api.Name != "api" || api.State != "running" || api.PID != 12345 || api.Restarts != 2 || api.Started != "2024-01-15" {
+		t.Errorf("unexpected api status: %+v", api)
+	}
+	db := statuses[1]
+	if db.Name != "db" || db.State != "stopped" || db.PID != 0 || db.Started != "-" {
+		t.Errorf("unexpected db status: %+v", db)
+	}
+}
+
+func TestParseStatus_NoServices(t *testing.T) {
+	if statuses := ParseStatus("No services\n"); statuses != nil {
+		t.Errorf("expected no statuses, got %+v", statuses)
+	}
+}
+
+func TestFindBinary(t *testing.T) {
+	orig := Binary
+	t.Cleanup(func() { Binary = orig })
+
+	Binary = "/opt/comproc"
+	t.Setenv("COMPROC_BIN", "/usr/local/bin/comproc")
+	if got, err := findBinary(); err != nil || got != "/opt/comproc" {
+		t.Errorf("expected Binary to take precedence, got %q (%v)", got, err)
+	}
+
+	Binary = ""
+	if got, err := findBinary(); err != nil || got != "/usr/local/bin/comproc" {
+		t.Errorf("expected COMPROC_BIN, got %q (%v)", got, err)
+	}
+
+	t.Setenv("COMPROC_BIN", "")
+	t.Setenv("PATH", t.TempDir())
+	if _, err := findBinary(); err == nil {
+		t.Error("expected an error when comproc is not in PATH")
+	}
+}
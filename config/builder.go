@@ -0,0 +1,268 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Builder constructs a Config in code. Services keep the order in which they
+// are added. Errors are collected and reported by Build, so calls can be
+// chained:
+//
+//	cfg, err := config.NewBuilder().
+//		Name("shop").
+//		Service("db", config.NewService("postgres -D ./data").
+//			WithHealthcheck("pg_isready", time.Second)).
+//		Service("api", config.NewService("go run ./cmd/api").
+//			WithEnv("PORT", "8080").
+//			WithDependsOn("db").
+//			WithRestart(config.RestartOnFailure)).
+//		Build()
+type Builder struct {
+	cfg  Config
+	errs []error
+}
+
+// NewBuilder returns a Builder for an empty config.
+func NewBuilder() *Builder {
+	return &Builder{
+		cfg: Config{Services: make(map[string]*Service)},
+	}
+}
+
+// Name sets the project name.
+func (b *Builder) Name(name string) *Builder {
+	b.cfg.Name = name
+	return b
+}
+
+// PortBase assigns each service a PORT, starting from base and increasing by
+// step (or DefaultPortStep if step is 0) in the order services are added.
+func (b *Builder) PortBase(base, step int) *Builder {
+	b.cfg.PortBase = base
+	b.cfg.PortStep = step
+	return b
+}
+
+// GracefulTimeout sets how long stopped services may take to exit before
+// they are killed.
+func (b *Builder) GracefulTimeout(timeout time.Duration) *Builder {
+	b.cfg.GracefulTimeout = Duration(timeout)
+	return b
+}
+
+// LogMemoryLimit caps the size of the log lines kept in memory across all
+// services, as a size such as "64MiB".
+func (b *Builder) LogMemoryLimit(size string) *Builder {
+	b.cfg.LogMemoryLimit = size
+	return b
+}
+
+// Service adds a service. Adding two services with the same name is an error.
+func (b *Builder) Service(name string, svc *Service) *Builder {
+	if _, ok := b.cfg.Services[name]; ok {
+		b.errs = append(b.errs, fmt.Errorf("duplicate service: %q", name))
+		return b
+	}
+	if svc == nil {
+		svc = &Service{}
+	}
+	svc.Name = name
+	b.cfg.Services[name] = svc
+	b.cfg.ServiceOrder = append(b.cfg.ServiceOrder, name)
+	return b
+}
+
+// Plugin adds a plugin command that receives the given events, or all
+// events if none are given.
+func (b *Builder) Plugin(command string, events ...string) *Builder {
+	b.cfg.Plugins = append(b.cfg.Plugins, Plugin{Command: command, Events: events})
+	return b
+}
+
+// Build resolves `extends` and validates the config with the same rules as
+// config files, and returns it. Base files are resolved relative to the
+// current directory. The builder should not be used afterwards.
+func (b *Builder) Build() (*Config, error) {
+	if len(b.errs) > 0 {
+		return nil, b.errs[0]
+	}
+	cfg := b.cfg
+	return finish(&cfg, "")
+}
+
+// NewService returns a service that runs command. Use the With methods to
+// set optional fields, and Builder.Service to add it to a config.
+func NewService(command string) *Service {
+	return &Service{Command: command}
+}
+
+// NewExecService returns a service that runs a program with arguments
+// directly, without a shell (the exec form of command).
+func NewExecService(program string, args ...string) *Service {
+	argv := append([]string{program}, args...)
+	return &Service{Command: quoteArgs(argv), Args: argv}
+}
+
+// NewExternal returns a service for a dependency that comproc does not run,
+// reachable at address (a TCP address or an HTTP(S) URL).
+func NewExternal(address string) *Service {
+	return &Service{External: address}
+}
+
+// WithExtends inherits the fields the service does not set from the service
+// of the given config file, or of the same config if file is empty.
+func (s *Service) WithExtends(file, service string) *Service {
+	s.Extends = &Extends{File: file, Service: service}
+	return s
+}
+
+// WithPrepare sets a command run to completion before each start.
+func (s *Service) WithPrepare(command string) *Service {
+	s.Prepare = command
+	return s
+}
+
+// WithWorkingDir sets the working directory. Relative paths are resolved
+// from the config file's directory.
+func (s *Service) WithWorkingDir(dir string) *Service {
+	s.WorkingDir = dir
+	return s
+}
+
+// WithEnv sets an environment variable.
+func (s *Service) WithEnv(key, value string) *Service {
+	if s.Env == nil {
+		s.Env = make(map[string]string)
+	}
+	s.Env[key] = value
+	return s
+}
+
+// WithRestart sets the restart policy.
+func (s *Service) WithRestart(policy RestartPolicy) *Service {
+	s.Restart = policy
+	return s
+}
+
+// WithMaxRetries sets how many consecutive failed runs are restarted before
+// the service is left failed. It requires the on-failure restart policy.
+func (s *Service) WithMaxRetries(n int) *Service {
+	s.MaxRetries = n
+	return s
+}
+
+// WithReplicas sets how many instances of the service are run, named
+// <name>-1, <name>-2, and so on.
+func (s *Service) WithReplicas(n int) *Service {
+	s.Replicas = n
+	return s
+}
+
+// WithDependsOn adds services that must be started first.
+func (s *Service) WithDependsOn(services ...string) *Service {
+	for _, name := range services {
+		s.DependsOn = append(s.DependsOn, Dependency{Service: name})
+	}
+	return s
+}
+
+// WithDependency adds a service that must be started first, with options.
+func (s *Service) WithDependency(dep Dependency) *Service {
+	s.DependsOn = append(s.DependsOn, dep)
+	return s
+}
+
+// WithStopMode sets which processes receive the stop signal.
+func (s *Service) WithStopMode(mode StopMode) *Service {
+	s.StopMode = mode
+	return s
+}
+
+// WithPorts sets the ports the service listens on: numbers, or PortAuto
+// for a free port picked when it starts.
+func (s *Service) WithPorts(ports ...string) *Service {
+	s.Ports = append(s.Ports, ports...)
+	return s
+}
+
+// WithAttachStdin sets whose input reaches the service when several clients
+// are attached to it.
+func (s *Service) WithAttachStdin(policy AttachStdin) *Service {
+	s.AttachStdin = policy
+	return s
+}
+
+// WithLoginShell runs the command and prepare command with the user's login
+// shell instead of sh.
+func (s *Service) WithLoginShell() *Service {
+	s.LoginShell = true
+	return s
+}
+
+// WithUmask sets the file mode creation mask of the service's processes.
+func (s *Service) WithUmask(mask os.FileMode) *Service {
+	s.Umask = fmt.Sprintf("%04o", mask)
+	return s
+}
+
+// WithIsolate runs the service in new Linux namespaces.
+func (s *Service) WithIsolate(namespaces ...Namespace) *Service {
+	s.Isolate = append(s.Isolate, namespaces...)
+	return s
+}
+
+// WithRequires adds prerequisites checked before the service starts.
+func (s *Service) WithRequires(reqs ...Requirement) *Service {
+	s.Requires = append(s.Requires, reqs...)
+	return s
+}
+
+// WithMemLimit restarts the service when its memory use exceeds size, such
+// as "512MB".
+func (s *Service) WithMemLimit(size string) *Service {
+	s.MemLimit = size
+	return s
+}
+
+// WithLogging adds a log sink.
+func (s *Service) WithLogging(sink LogSinkConfig) *Service {
+	s.Logging = append(s.Logging, sink)
+	return s
+}
+
+// WithLogFile writes the service's log history to path instead of the log
+// store. LogFileDiscard keeps no history.
+func (s *Service) WithLogFile(path string) *Service {
+	s.LogFile = path
+	return s
+}
+
+// WithHealthcheck sets a readiness check run at the given interval, using the
+// default timeout and retries. Set Healthcheck directly for full control.
+func (s *Service) WithHealthcheck(command string, interval time.Duration) *Service {
+	s.Healthcheck = &Healthcheck{
+		Command:  command,
+		Interval: Duration(interval),
+	}
+	return s
+}
+
+// WithWaitForFile sets a readiness check that passes once path exists,
+// checked at the given interval. Relative paths are resolved against the
+// working directory.
+func (s *Service) WithWaitForFile(path string, interval time.Duration) *Service {
+	s.Healthcheck = &Healthcheck{
+		WaitForFile: path,
+		Interval:    Duration(interval),
+	}
+	return s
+}
+
+// WithReadyLogPattern marks the service ready once a line of its output
+// matches the regular expression pattern.
+func (s *Service) WithReadyLogPattern(pattern string) *Service {
+	s.ReadyLogPattern = pattern
+	return s
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	cfg, err := NewBuilder().
+		Name("shop").
+		Service("db", NewService("postgres").
+			WithHealthcheck("pg_isready", time.Second)).
+		Service("api", NewService("go run ./cmd/api").
+			WithPrepare("go generate ./...").
+			WithWorkingDir("./backend").
+			WithEnv("PORT", "8080").
+			WithEnv("DEBUG", "true").
+			WithDependsOn("db").
+			WithRestart(RestartOnFailure).
+			WithMaxRetries(3).
+			WithStopMode(StopModeLeader).
+			WithUmask(0002).
+			WithIsolate(NamespacePID).
+			WithLogging(LogSinkConfig{Driver: LogDriverFile, Path: "api.log"})).
+		Plugin("./notify.sh", PluginEventServiceFailed).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Name != "shop" {
+		t.Errorf("expected name 'shop', got %q", cfg.Name)
+	}
+	if want := []string{"db", "api"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Errorf("expected service order %v, got %v", want, cfg.ServiceNames())
+	}
+
+	api := cfg.Services["api"]
+	if api.Name != "api" || api.Command != "go run ./cmd/api" || api.Prepare != "go generate ./..." {
+		t.Errorf("unexpected api service: %+v", api)
+	}
+	if api.WorkingDir != "./backend" || api.Env["PORT"] != "8080" || api.Env["DEBUG"] != "true" {
+		t.Errorf("unexpected api service: %+v", api)
+	}
+	if !slices.Equal(api.DependencyNames(), []string{"db"}) || api.Restart != RestartOnFailure || api.MaxRetries != 3 || api.StopMode != StopModeLeader || api.Umask != "0002" || !api.Isolate.Has(NamespacePID) {
+		t.Errorf("unexpected api service: %+v", api)
+	}
+	if len(api.Logging) != 1 || api.Logging[0].Path != "api.log" {
+		t.Errorf("unexpected api logging: %+v", api.Logging)
+	}
+
+	if len(cfg.Plugins) != 1 || cfg.Plugins[0].Command != "./notify.sh" || !slices.Equal(cfg.Plugins[0].Events, []string{PluginEventServiceFailed}) {
+		t.Errorf("unexpected plugins: %+v", cfg.Plugins)
+	}
+
+	hc := cfg.Services["db"].Healthcheck
+	if hc == nil || hc.Command != "pg_isready" || hc.GetInterval() != time.Second || hc.GetRetries() != DefaultHealthcheckRetries {
+		t.Errorf("unexpected db healthcheck: %+v", hc)
+	}
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		wantErr string
+	}{
+		{
+			name:    "no services",
+			builder: NewBuilder(),
+			wantErr: "no services defined",
+		},
+		{
+			name: "duplicate service",
+			builder: NewBuilder().
+				Service("api", NewService("a")).
+				Service("api", NewService("b")),
+			wantErr: `duplicate service: "api"`,
+		},
+		{
+			name:    "missing command",
+			builder: NewBuilder().Service("api", NewService("")),
+			wantErr: "command is required",
+		},
+		{
+			name:    "unknown dependency",
+			builder: NewBuilder().Service("api", NewService("a").WithDependsOn("db")),
+			wantErr: `unknown dependency: "db"`,
+		},
+		{
+			name: "circular dependency",
+			builder: NewBuilder().
+				Service("a", NewService("a").WithDependsOn("b")).
+				Service("b", NewService("b").WithDependsOn("a")),
+			wantErr: "circular dependency",
+		},
+		{
+			name: "unknown plugin event",
+			builder: NewBuilder().
+				Service("api", NewService("a")).
+				Plugin("./notify.sh", "service.crashed"),
+			wantErr: `plugins[0]: unknown event: "service.crashed"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBuilder_Extends(t *testing.T) {
+	cfg, err := NewBuilder().
+		Service("base", NewService("node server.js").WithEnv("PORT", "3000")).
+		Service("web", NewService("").WithExtends("", "base").WithEnv("DEBUG", "1")).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	web := cfg.Services["web"]
+	if web.Command != "node server.js" || web.Env["PORT"] != "3000" || web.Env["DEBUG"] != "1" {
+		t.Errorf("unexpected web service: %+v", web)
+	}
+}
+
+func TestBuilder_PortBase(t *testing.T) {
+	cfg, err := NewBuilder().
+		PortBase(4000, 10).
+		Service("web", NewService("node server.js")).
+		Service("api", NewService("go run ./cmd/api")).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Services["api"].ResolvedEnv()["PORT"]; got != "4010" {
+		t.Errorf("expected PORT=4010, got %q", got)
+	}
+}
+
+func TestBuilder_ExecService(t *testing.T) {
+	cfg, err := NewBuilder().
+		Service("api", NewExecService("./bin/api", "--port", "8080")).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api := cfg.Services["api"]; !slices.Equal(api.Args, []string{"./bin/api", "--port", "8080"}) || api.Command != "./bin/api --port 8080" {
+		t.Errorf("expected an exec-form command, got %q (%q)", api.Args, api.Command)
+	}
+}
+
+func TestBuilder_Replicas(t *testing.T) {
+	cfg, err := NewBuilder().
+		Service("worker", NewService("./worker").WithReplicas(2)).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"worker-1", "worker-2"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Errorf("expected services %v, got %v", want, cfg.ServiceNames())
+	}
+}
+
+func TestBuilder_External(t *testing.T) {
+	cfg, err := NewBuilder().
+		Service("db", NewExternal("localhost:5432")).
+		Service("api", NewService("go run ./cmd/api").WithDependsOn("db")).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Services["db"].IsExternal() {
+		t.Error("expected db to be external")
+	}
+}
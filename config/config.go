@@ -0,0 +1,1224 @@
+// Package config handles parsing, validation, and programmatic construction
+// of comproc configurations.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RestartPolicy defines when a service should be restarted.
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartNever     RestartPolicy = "never"
+)
+
+// StopMode defines which processes receive the stop signal.
+type StopMode string
+
+const (
+	// StopModeGroup sends stop signals to the whole process group.
+	StopModeGroup StopMode = "group"
+	// StopModeLeader sends stop signals only to the direct child process,
+	// leaving it to forward them to its own children.
+	StopModeLeader StopMode = "leader"
+)
+
+// DependencyCondition defines what a service waits for before it starts
+// after a dependency.
+type DependencyCondition string
+
+const (
+	// ConditionServiceStarted waits only until the dependency is started,
+	// even if it has a readiness check.
+	ConditionServiceStarted DependencyCondition = "service_started"
+	// ConditionServiceHealthy waits until the dependency's readiness check
+	// passes, which the dependency must have.
+	ConditionServiceHealthy DependencyCondition = "service_healthy"
+)
+
+// PortAuto is an entry of ports that is replaced with a free port when the
+// service starts.
+const PortAuto = "auto"
+
+// AttachStdin defines whose input reaches a service when several clients
+// are attached to it.
+type AttachStdin string
+
+const (
+	// AttachStdinShared forwards the input of every attached client.
+	AttachStdinShared AttachStdin = "shared"
+	// AttachStdinFirst forwards only the input of the client that attached
+	// first, passing stdin on to the next client when it detaches.
+	AttachStdinFirst AttachStdin = "first"
+)
+
+// Namespace is a Linux namespace a service can be isolated in.
+type Namespace string
+
+const (
+	// NamespacePID gives the service its own process IDs, so that all of
+	// its processes are killed when it exits, even those that left its
+	// process group.
+	NamespacePID Namespace = "pid"
+	// NamespaceMount gives the service its own mount table, with /proc
+	// showing only its own processes when combined with NamespacePID.
+	NamespaceMount Namespace = "mount"
+	// NamespaceNet gives the service its own network with only a loopback
+	// interface.
+	NamespaceNet Namespace = "net"
+)
+
+// Isolation is the list of namespaces of a service, written as a single
+// namespace or a list.
+type Isolation []Namespace
+
+// UnmarshalYAML decodes a namespace or a list of namespaces.
+func (i *Isolation) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var ns Namespace
+		if err := value.Decode(&ns); err != nil {
+			return err
+		}
+		*i = Isolation{ns}
+		return nil
+	}
+	return value.Decode((*[]Namespace)(i))
+}
+
+// Has reports whether the namespace is in the list.
+func (i Isolation) Has(ns Namespace) bool {
+	return slices.Contains(i, ns)
+}
+
+// Requirement is an entry of requires: a prerequisite checked before the
+// service starts. Exactly one of its fields is set.
+type Requirement struct {
+	Binary string `yaml:"binary"` // Command that must be found on PATH
+	File   string `yaml:"file"`   // File that must exist, relative to the working directory
+	Env    string `yaml:"env"`    // Environment variable that must be set and not empty
+	Port   int    `yaml:"port"`   // TCP port nothing may listen on
+}
+
+// Validate checks that exactly one kind of prerequisite is set.
+func (r *Requirement) Validate() error {
+	set := 0
+	for _, s := range []string{r.Binary, r.File, r.Env} {
+		if s != "" {
+			set++
+		}
+	}
+	if r.Port != 0 {
+		set++
+		if r.Port < 1 || r.Port > 65535 {
+			return fmt.Errorf("invalid port %d: expected a number from 1 to 65535", r.Port)
+		}
+	}
+	if set != 1 {
+		return errors.New("expected exactly one of binary, file, env, or port")
+	}
+	return nil
+}
+
+// String describes the prerequisite, e.g. `binary "node"`.
+func (r Requirement) String() string {
+	switch {
+	case r.Binary != "":
+		return fmt.Sprintf("binary %q", r.Binary)
+	case r.File != "":
+		return fmt.Sprintf("file %q", r.File)
+	case r.Env != "":
+		return "env " + r.Env
+	default:
+		return fmt.Sprintf("port %d", r.Port)
+	}
+}
+
+// Built-in log sink drivers.
+const (
+	LogDriverFile    = "file"
+	LogDriverSyslog  = "syslog"
+	LogDriverCommand = "command"
+	LogDriverLoki    = "loki"
+	LogDriverGELF    = "gelf"
+)
+
+// logDrivers holds the names of known log sink drivers.
+var logDrivers = map[string]bool{
+	LogDriverFile:    true,
+	LogDriverSyslog:  true,
+	LogDriverCommand: true,
+	LogDriverLoki:    true,
+	LogDriverGELF:    true,
+}
+
+// logLabelPattern matches label names accepted by Loki, which are also
+// valid GELF field names.
+var logLabelPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegisterLogDriver marks a log sink driver name as valid in configuration.
+// It is called by logsink.Register.
+func RegisterLogDriver(name string) {
+	logDrivers[name] = true
+}
+
+// LogSinkConfig defines an additional destination for a service's log output.
+type LogSinkConfig struct {
+	Driver  string            `yaml:"driver"`
+	Path    string            `yaml:"path"`    // file: destination file
+	Command string            `yaml:"command"` // command: receives lines on stdin
+	Tag     string            `yaml:"tag"`     // syslog: message tag
+	URL     string            `yaml:"url"`     // loki, gelf: endpoint lines are pushed to
+	Labels  map[string]string `yaml:"labels"`  // loki, gelf: labels added to each line
+	Options map[string]string `yaml:"options"` // Driver-specific options
+
+	// Project is the name of the project the service belongs to. It is set
+	// by the daemon, not read from the config.
+	Project string `yaml:"-"`
+}
+
+// Validate checks a single log sink configuration.
+func (l *LogSinkConfig) Validate() error {
+	if l.Driver == "" {
+		return errors.New("driver is required")
+	}
+	if !logDrivers[l.Driver] {
+		return fmt.Errorf("unknown driver: %q", l.Driver)
+	}
+
+	switch l.Driver {
+	case LogDriverFile:
+		if l.Path == "" {
+			return errors.New("path is required for file driver")
+		}
+	case LogDriverCommand:
+		if l.Command == "" {
+			return errors.New("command is required for command driver")
+		}
+	case LogDriverLoki, LogDriverGELF:
+		if l.URL == "" {
+			return fmt.Errorf("url is required for %s driver", l.Driver)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid url: %q", l.URL)
+		}
+		schemes := []string{"http", "https"}
+		if l.Driver == LogDriverGELF {
+			schemes = append(schemes, "udp", "tcp")
+		}
+		if !slices.Contains(schemes, u.Scheme) {
+			return fmt.Errorf("unsupported url scheme for %s driver: %q (expected %s)", l.Driver, u.Scheme, strings.Join(schemes, ", "))
+		}
+		for name := range l.Labels {
+			if !logLabelPattern.MatchString(name) {
+				return fmt.Errorf("invalid label name: %q", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration that is written as a Go duration string
+// ("500ms", "5s", "1m") in config files.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Default healthcheck settings.
+const (
+	DefaultHealthcheckInterval = 2 * time.Second
+	DefaultHealthcheckTimeout  = 5 * time.Second
+	DefaultHealthcheckRetries  = 3
+)
+
+// Healthcheck defines a command that determines whether a service is ready.
+// The service becomes ready when the command first exits with status 0 and
+// unhealthy after Retries consecutive failures. Instead of a command, the
+// check can wait for a file or Unix socket to exist.
+type Healthcheck struct {
+	Command     string   `yaml:"command"`
+	WaitForFile string   `yaml:"wait_for_file"` // Relative to the service's working directory
+	Interval    Duration `yaml:"interval"`
+	Timeout     Duration `yaml:"timeout"`
+	Retries     int      `yaml:"retries"`
+	// StartPeriod is the time after the start during which failures are not
+	// counted toward Retries, until the check first passes.
+	StartPeriod Duration `yaml:"start_period"`
+}
+
+// GetInterval returns the effective interval between checks.
+func (h *Healthcheck) GetInterval() time.Duration {
+	if h.Interval <= 0 {
+		return DefaultHealthcheckInterval
+	}
+	return time.Duration(h.Interval)
+}
+
+// GetTimeout returns the effective timeout of a single check.
+func (h *Healthcheck) GetTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultHealthcheckTimeout
+	}
+	return time.Duration(h.Timeout)
+}
+
+// GetRetries returns the number of consecutive failures before the service
+// is considered unhealthy.
+func (h *Healthcheck) GetRetries() int {
+	if h.Retries <= 0 {
+		return DefaultHealthcheckRetries
+	}
+	return h.Retries
+}
+
+// Default readiness check settings of external services.
+const (
+	DefaultExternalInterval = time.Second
+	DefaultExternalRetries  = 30
+)
+
+// ParseExternal parses the address of an external service: a TCP address
+// ("host:port" or "tcp://host:port") or an HTTP(S) URL. TCP addresses are
+// returned with the tcp scheme.
+func ParseExternal(address string) (*url.URL, error) {
+	if !strings.Contains(address, "://") {
+		address = "tcp://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil || u.Port() == "" {
+			return nil, fmt.Errorf("invalid TCP address %q: expected host:port", u.Host)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return nil, errors.New("URL has no host")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q (expected tcp, http, or https)", u.Scheme)
+	}
+	return u, nil
+}
+
+// Service defines a single service configuration.
+type Service struct {
+	Name        string            `yaml:"-"`
+	Extends     *Extends          `yaml:"extends"`
+	External    string            `yaml:"external"` // Address of a dependency comproc does not run
+	Command     string            `yaml:"-"`        // Command line run by a shell, or Args quoted for one (see UnmarshalYAML)
+	Args        []string          `yaml:"-"`        // Program and arguments of an exec-form command, run without a shell
+	Prepare     string            `yaml:"prepare"`
+	WorkingDir  string            `yaml:"working_dir"`
+	Env         map[string]string `yaml:"env"`
+	Restart     RestartPolicy     `yaml:"restart"`
+	MaxRetries  int               `yaml:"max_retries"` // Consecutive failed runs restarted under on-failure before giving up (0: no limit)
+	Replicas    int               `yaml:"replicas"`    // Number of instances, named <name>-1, <name>-2, ... (0: one named after the service)
+	DependsOn   []Dependency      `yaml:"depends_on"`
+	StopMode    StopMode          `yaml:"stop_mode"`
+	AttachStdin AttachStdin       `yaml:"attach_stdin"`
+	Ports       []string          `yaml:"ports"` // Port numbers, or PortAuto
+	LoginShell  bool              `yaml:"login_shell"`
+	Umask       string            `yaml:"umask"` // Octal file mode creation mask, e.g. 0002
+	Isolate     Isolation         `yaml:"isolate"`
+	Requires    []Requirement     `yaml:"requires"`          // Prerequisites checked before each start
+	MemLimit    string            `yaml:"mem_restart_limit"` // Size of memory use at which the service is restarted
+	Logging     []LogSinkConfig   `yaml:"logging"`
+	LogFile     string            `yaml:"log_file"` // Replaces the log store for the service; LogFileDiscard keeps no history
+	Healthcheck *Healthcheck      `yaml:"healthcheck"`
+
+	// ReadyLogPattern is a regular expression that marks the service ready
+	// once a line of its output matches, as an alternative to Healthcheck.
+	ReadyLogPattern string `yaml:"ready_log_pattern"`
+
+	// Port is the first of the service's ports, or the port assigned from
+	// the config's port_base, passed to the service as PORT unless its env
+	// sets PORT (0: none or picked when the service starts).
+	Port int `yaml:"-"`
+
+	// DependencyEnv holds the addresses of the service's dependencies,
+	// passed to it unless its env sets the same variables.
+	DependencyEnv map[string]string `yaml:"-"`
+
+	// Replica is the number of the instance, from 1, of a service defined
+	// with replicas, whose name is ReplicaOf (0: not a replica).
+	Replica   int    `yaml:"-"`
+	ReplicaOf string `yaml:"-"`
+}
+
+// UnmarshalYAML decodes a service, whose command is either a command line
+// or, in exec form, a list of the program and its arguments.
+func (s *Service) UnmarshalYAML(value *yaml.Node) error {
+	type rawService Service
+	var raw struct {
+		rawService `yaml:",inline"`
+		Command    yaml.Node `yaml:"command"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*s = Service(raw.rawService)
+	if raw.Command.Kind != yaml.SequenceNode {
+		return raw.Command.Decode(&s.Command)
+	}
+	if err := raw.Command.Decode(&s.Args); err != nil {
+		return err
+	}
+	if s.Args == nil {
+		s.Args = []string{}
+	}
+	s.Command = quoteArgs(s.Args)
+	return nil
+}
+
+// MarshalYAML encodes a service with its command as it is written: a
+// command line, or a list in exec form.
+func (s Service) MarshalYAML() (any, error) {
+	type rawService Service
+	var node yaml.Node
+	if err := node.Encode(rawService(s)); err != nil {
+		return nil, err
+	}
+	var command yaml.Node
+	var err error
+	if s.Args != nil {
+		err = command.Encode(s.Args)
+	} else {
+		err = command.Encode(s.Command)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The command goes after external, where the field is declared
+	i := 0
+	for ; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "external" {
+			i += 2
+			break
+		}
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "command"}
+	node.Content = slices.Insert(node.Content, i, key, &command)
+	return &node, nil
+}
+
+// quoteArgs returns a command line that runs args in a POSIX shell, with
+// the arguments that need it in single quotes.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=./:,@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// LogFileDiscard as a service's log_file keeps no history of its output.
+const LogFileDiscard = "/dev/null"
+
+// Dependency is an entry of depends_on, written as the name of the service
+// or as a mapping that also sets options for the dependency.
+type Dependency struct {
+	Service string `yaml:"service"`
+	// RestartDependents restarts the dependent service whenever the
+	// restart policy of the dependency restarts it
+	RestartDependents bool `yaml:"restart_dependents"`
+	// Condition is what to wait for before starting the dependent service.
+	// If empty, it waits until the dependency is ready if it has a
+	// readiness check, and until it is started otherwise.
+	Condition DependencyCondition `yaml:"condition"`
+}
+
+// WaitsReady reports whether the dependent service waits until the
+// dependency dep is ready rather than only started.
+func (d Dependency) WaitsReady(dep *Service) bool {
+	switch d.Condition {
+	case ConditionServiceStarted:
+		return false
+	case ConditionServiceHealthy:
+		return true
+	default:
+		return dep.HasReadinessCheck()
+	}
+}
+
+// UnmarshalYAML decodes a service name or a mapping.
+func (d *Dependency) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*d = Dependency{}
+		return value.Decode(&d.Service)
+	}
+	type plain Dependency
+	return value.Decode((*plain)(d))
+}
+
+// MarshalYAML implements yaml.Marshaler, writing a dependency without
+// options as the service name alone.
+func (d Dependency) MarshalYAML() (any, error) {
+	if !d.RestartDependents && d.Condition == "" {
+		return d.Service, nil
+	}
+	type plain Dependency
+	return plain(d), nil
+}
+
+// Plugin lifecycle events.
+const (
+	PluginEventDaemonUp          = "daemon.up"
+	PluginEventDaemonDown        = "daemon.down"
+	PluginEventServiceStarted    = "service.started"
+	PluginEventServiceStopped    = "service.stopped"
+	PluginEventServiceExited     = "service.exited"
+	PluginEventServiceFailed     = "service.failed"
+	PluginEventServiceRestarting = "service.restarting"
+	PluginEventServiceMemLimit   = "service.mem_limit"
+)
+
+// pluginEvents holds the names of events that plugins can subscribe to.
+var pluginEvents = map[string]bool{
+	PluginEventDaemonUp:          true,
+	PluginEventDaemonDown:        true,
+	PluginEventServiceStarted:    true,
+	PluginEventServiceStopped:    true,
+	PluginEventServiceExited:     true,
+	PluginEventServiceFailed:     true,
+	PluginEventServiceRestarting: true,
+	PluginEventServiceMemLimit:   true,
+}
+
+// Plugin defines an external command that receives lifecycle events as JSON
+// lines on its stdin for as long as the daemon runs.
+type Plugin struct {
+	Command string   `yaml:"command"`
+	Events  []string `yaml:"events"` // Events to receive (default: all)
+}
+
+// Validate checks a single plugin configuration.
+func (p *Plugin) Validate() error {
+	if p.Command == "" {
+		return errors.New("command is required")
+	}
+	for _, event := range p.Events {
+		if !pluginEvents[event] {
+			return fmt.Errorf("unknown event: %q", event)
+		}
+	}
+	return nil
+}
+
+// Subscribes reports whether the plugin receives the given event.
+func (p *Plugin) Subscribes(event string) bool {
+	return len(p.Events) == 0 || slices.Contains(p.Events, event)
+}
+
+// Config represents the entire comproc configuration.
+type Config struct {
+	Name         string              `yaml:"name"`    // Project name (default: config directory name)
+	Include      []string            `yaml:"include"` // Files whose services are added before this file's
+	Services     map[string]*Service `yaml:"services"`
+	Plugins      []Plugin            `yaml:"plugins"`
+	PortBase     int                 `yaml:"port_base"` // First port assigned as PORT (0: disabled)
+	PortStep     int                 `yaml:"port_step"` // Difference between assigned ports (default: 100)
+	Socket       *Socket             `yaml:"socket"`
+	LogStore     *LogStore           `yaml:"log_store"` // On-disk log history (default: in memory only)
+	ServiceOrder []string            `yaml:"-"`
+
+	// GracefulTimeout is how long stopped services may take to exit before
+	// they are killed (default: DefaultGracefulTimeout).
+	GracefulTimeout Duration `yaml:"graceful_timeout"`
+
+	// LogMemoryLimit caps the size of the log lines the daemon keeps in
+	// memory across all services (default: DefaultLogMemoryLimit).
+	LogMemoryLimit string `yaml:"log_memory_limit"`
+}
+
+// DefaultPortStep is the difference between the ports assigned to
+// consecutive services, as in foreman.
+const DefaultPortStep = 100
+
+// DefaultGracefulTimeout is how long stopped services may take to exit
+// before they are killed, unless the config sets graceful_timeout.
+const DefaultGracefulTimeout = 10 * time.Second
+
+// DefaultLogMemoryLimit is the default size of the log lines kept in memory
+// across all services.
+const DefaultLogMemoryLimit int64 = 64 << 20
+
+// GetLogMemoryLimit returns the effective log memory limit in bytes.
+func (c *Config) GetLogMemoryLimit() int64 {
+	limit, err := parseSizeOr(c.LogMemoryLimit, DefaultLogMemoryLimit)
+	if err != nil {
+		return DefaultLogMemoryLimit
+	}
+	return limit
+}
+
+// GetGracefulTimeout returns the effective graceful timeout.
+func (c *Config) GetGracefulTimeout() time.Duration {
+	if c.GracefulTimeout <= 0 {
+		return DefaultGracefulTimeout
+	}
+	return time.Duration(c.GracefulTimeout)
+}
+
+// GetPortStep returns the effective difference between assigned ports.
+func (c *Config) GetPortStep() int {
+	if c.PortStep <= 0 {
+		return DefaultPortStep
+	}
+	return c.PortStep
+}
+
+// assignPorts gives each service a port from port_base, in config order.
+func (c *Config) assignPorts() {
+	if c.PortBase == 0 {
+		return
+	}
+	for i, name := range c.ServiceOrder {
+		c.Services[name].Port = c.PortBase + i*c.GetPortStep()
+	}
+}
+
+// assignFixedPorts sets the port of services whose first entry of ports is
+// a number, which takes precedence over port_base.
+func (c *Config) assignFixedPorts() {
+	for _, svc := range c.Services {
+		if len(svc.Ports) > 0 {
+			svc.Port, _ = strconv.Atoi(svc.Ports[0]) // 0 for PortAuto
+		}
+	}
+}
+
+// assignDependencyEnv gives each service the addresses of its dependencies
+// as <NAME>_HOST and, if the port is known, <NAME>_PORT.
+func (c *Config) assignDependencyEnv() {
+	for _, svc := range c.Services {
+		svc.DependencyEnv = nil
+		for _, dep := range svc.DependencyNames() {
+			host, port := c.Services[dep].Address()
+			if svc.DependencyEnv == nil {
+				svc.DependencyEnv = make(map[string]string)
+			}
+			prefix := EnvName(dep)
+			svc.DependencyEnv[prefix+"_HOST"] = host
+			if port != "" {
+				svc.DependencyEnv[prefix+"_PORT"] = port
+			}
+		}
+	}
+}
+
+// EnvName returns the prefix of environment variables describing a
+// service: its name in upper case, with characters other than letters and
+// digits replaced by "_".
+func EnvName(service string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, service)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// ServiceNames returns service names in the order they appear in the config file.
+func (c *Config) ServiceNames() []string {
+	return c.ServiceOrder
+}
+
+// UnmarshalYAML implements custom unmarshaling to preserve service key order.
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	// value is a mapping node with keys like "services"
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("expected mapping node, got %d", value.Kind)
+	}
+
+	// Find the "services" key and extract ordered keys
+	for i := 0; i < len(value.Content)-1; i += 2 {
+		keyNode := value.Content[i]
+		valNode := value.Content[i+1]
+		if keyNode.Value == "services" && valNode.Kind == yaml.MappingNode {
+			for j := 0; j < len(valNode.Content)-1; j += 2 {
+				c.ServiceOrder = append(c.ServiceOrder, valNode.Content[j].Value)
+			}
+			break
+		}
+	}
+
+	// Use a temporary type to avoid infinite recursion
+	type rawConfig Config
+	var raw rawConfig
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	order := c.ServiceOrder
+	*c = Config(raw)
+	c.ServiceOrder = order
+	return nil
+}
+
+// Load reads and parses a configuration file.
+// The format (YAML, JSON, or TOML) is determined by the file extension.
+// Files referenced by `extends` are resolved relative to its directory.
+func Load(path string) (*Config, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute config path: %w", err)
+	}
+	cfg, err := decodeFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	return finish(cfg, absPath)
+}
+
+// decodeFile reads and decodes a configuration file without validating it.
+func decodeFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return decodeFormat(data, FormatFromPath(path))
+}
+
+// finish resolves `include` and `extends` in a decoded config and validates
+// it. path is the config file's path, or empty if it was not read from a
+// file.
+func finish(cfg *Config, path string) (*Config, error) {
+	if err := resolveIncludes(cfg, path); err != nil {
+		return nil, err
+	}
+	if err := resolveExtends(cfg, path); err != nil {
+		return nil, err
+	}
+	return validate(cfg)
+}
+
+// validate expands the replicas of a config whose `extends` are resolved,
+// validates it, and fills in the fields derived from others.
+func validate(cfg *Config) (*Config, error) {
+	if err := cfg.expandReplicas(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.assignPorts()
+	cfg.assignFixedPorts()
+	cfg.assignDependencyEnv()
+	return cfg, nil
+}
+
+// Parse parses configuration from YAML data.
+func Parse(data []byte) (*Config, error) {
+	return ParseFormat(data, FormatYAML)
+}
+
+// decodeNode decodes a parsed document into a Config.
+func decodeNode(node *yaml.Node) (*Config, error) {
+	var cfg Config
+	if err := node.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	// Set service names from map keys
+	for name, svc := range cfg.Services {
+		if svc == nil {
+			cfg.Services[name] = &Service{Name: name}
+		} else {
+			svc.Name = name
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks the configuration for errors.
+func (c *Config) Validate() error {
+	if len(c.Services) == 0 {
+		return errors.New("no services defined")
+	}
+
+	if strings.Contains(c.Name, "/") {
+		return fmt.Errorf("invalid project name %q: must not contain '/'", c.Name)
+	}
+
+	for _, name := range c.ServiceOrder {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("invalid service name %q: must not contain '/'", name)
+		}
+		if err := c.Services[name].Validate(c); err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+	}
+
+	if c.PortBase < 0 || c.PortStep < 0 {
+		return errors.New("port_base and port_step must not be negative")
+	}
+	if c.GracefulTimeout < 0 {
+		return errors.New("graceful_timeout must not be negative")
+	}
+	if c.PortBase > 0 {
+		if last := c.PortBase + (len(c.ServiceOrder)-1)*c.GetPortStep(); last > 65535 {
+			return fmt.Errorf("port_base: port %d assigned to the last service exceeds 65535", last)
+		}
+	}
+
+	if c.Socket != nil {
+		if err := c.Socket.Validate(); err != nil {
+			return fmt.Errorf("socket: %w", err)
+		}
+	}
+
+	if c.LogStore != nil {
+		if err := c.LogStore.Validate(); err != nil {
+			return fmt.Errorf("log_store: %w", err)
+		}
+	}
+	if _, err := parseSizeOr(c.LogMemoryLimit, DefaultLogMemoryLimit); err != nil {
+		return fmt.Errorf("log_memory_limit: %w", err)
+	}
+
+	for i := range c.Plugins {
+		if err := c.Plugins[i].Validate(); err != nil {
+			return fmt.Errorf("plugins[%d]: %w", i, err)
+		}
+	}
+
+	// Check for circular dependencies
+	if err := c.detectCycles(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks a single service configuration.
+func (s *Service) Validate(cfg *Config) error {
+	if s.IsExternal() {
+		if s.Command != "" || s.Prepare != "" {
+			return errors.New("external services must not have a command or prepare")
+		}
+		if _, err := ParseExternal(s.External); err != nil {
+			return fmt.Errorf("invalid external address: %w", err)
+		}
+		if s.Healthcheck != nil && s.Healthcheck.Command != "" {
+			return errors.New("healthcheck: command is not used by external services")
+		}
+		if s.ReadyLogPattern != "" {
+			return errors.New("ready_log_pattern is not used by external services")
+		}
+		if len(s.Isolate) > 0 {
+			return errors.New("isolate is not used by external services")
+		}
+		if len(s.Requires) > 0 {
+			return errors.New("requires is not used by external services")
+		}
+		if s.MemLimit != "" {
+			return errors.New("mem_restart_limit is not used by external services")
+		}
+	} else if s.Args != nil && (len(s.Args) == 0 || s.Args[0] == "") {
+		return errors.New("command must start with a program when it is a list")
+	} else if s.Command == "" {
+		return errors.New("command is required")
+	}
+
+	// Validate restart policy
+	switch s.Restart {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+		// Valid
+	default:
+		return fmt.Errorf("invalid restart policy: %q", s.Restart)
+	}
+	if s.MaxRetries < 0 {
+		return errors.New("max_retries must not be negative")
+	}
+	if s.MaxRetries > 0 && s.Restart != RestartOnFailure {
+		return errors.New("max_retries requires restart: on-failure")
+	}
+
+	// Validate stop mode
+	switch s.StopMode {
+	case "", StopModeGroup, StopModeLeader:
+		// Valid
+	default:
+		return fmt.Errorf("invalid stop mode: %q", s.StopMode)
+	}
+
+	// Validate ports
+	for _, port := range s.Ports {
+		if port == PortAuto {
+			continue
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q: expected a number from 1 to 65535 or %q", port, PortAuto)
+		}
+	}
+
+	// Validate umask
+	if s.Umask != "" {
+		if _, err := parseUmask(s.Umask); err != nil {
+			return err
+		}
+	}
+
+	// Validate memory limit
+	if s.MemLimit != "" {
+		if _, err := ParseSize(s.MemLimit); err != nil {
+			return fmt.Errorf("invalid mem_restart_limit: %w", err)
+		}
+	}
+
+	// Validate namespaces
+	for _, ns := range s.Isolate {
+		switch ns {
+		case NamespacePID, NamespaceMount, NamespaceNet:
+			// Valid
+		default:
+			return fmt.Errorf("invalid isolate: %q", ns)
+		}
+	}
+
+	// Validate prerequisites
+	for i := range s.Requires {
+		if err := s.Requires[i].Validate(); err != nil {
+			return fmt.Errorf("requires[%d]: %w", i, err)
+		}
+	}
+
+	// Validate attach stdin policy
+	switch s.AttachStdin {
+	case "", AttachStdinShared, AttachStdinFirst:
+		// Valid
+	default:
+		return fmt.Errorf("invalid attach_stdin: %q", s.AttachStdin)
+	}
+
+	// Validate log sinks
+	for i := range s.Logging {
+		if err := s.Logging[i].Validate(); err != nil {
+			return fmt.Errorf("logging[%d]: %w", i, err)
+		}
+	}
+
+	// Validate healthcheck
+	if s.Healthcheck != nil {
+		if s.Healthcheck.Command != "" && s.Healthcheck.WaitForFile != "" {
+			return errors.New("healthcheck: command and wait_for_file must not both be set")
+		}
+		if s.Healthcheck.Command == "" && s.Healthcheck.WaitForFile == "" && !s.IsExternal() {
+			return errors.New("healthcheck: command or wait_for_file is required")
+		}
+		if s.Healthcheck.Retries < 0 {
+			return errors.New("healthcheck: retries must not be negative")
+		}
+		if s.Healthcheck.StartPeriod < 0 {
+			return errors.New("healthcheck: start_period must not be negative")
+		}
+	}
+
+	// Validate ready log pattern
+	if s.ReadyLogPattern != "" {
+		if s.Healthcheck != nil {
+			return errors.New("healthcheck and ready_log_pattern must not both be set")
+		}
+		if _, err := regexp.Compile(s.ReadyLogPattern); err != nil {
+			return fmt.Errorf("invalid ready_log_pattern: %w", err)
+		}
+	}
+
+	// Validate dependencies exist
+	for i, dep := range s.DependsOn {
+		if dep.Service == "" {
+			return fmt.Errorf("depends_on[%d]: service is required", i)
+		}
+		depSvc, ok := cfg.Services[dep.Service]
+		if !ok {
+			return fmt.Errorf("unknown dependency: %q", dep.Service)
+		}
+		switch dep.Condition {
+		case "", ConditionServiceStarted:
+		case ConditionServiceHealthy:
+			if !depSvc.HasReadinessCheck() {
+				return fmt.Errorf("depends_on %q: condition %s requires the dependency to have a healthcheck or ready_log_pattern", dep.Service, dep.Condition)
+			}
+		default:
+			return fmt.Errorf("depends_on %q: invalid condition %q: expected %s or %s", dep.Service, dep.Condition, ConditionServiceStarted, ConditionServiceHealthy)
+		}
+	}
+
+	return nil
+}
+
+// GetUmask returns the file mode creation mask of the service's processes,
+// and false if it is not set and they inherit the daemon's.
+func (s *Service) GetUmask() (os.FileMode, bool) {
+	if s.Umask == "" {
+		return 0, false
+	}
+	mask, err := parseUmask(s.Umask)
+	if err != nil {
+		return 0, false
+	}
+	return mask, true
+}
+
+// GetMemLimit returns the memory use in bytes at which the service is
+// restarted, or 0 if it has no mem_restart_limit.
+func (s *Service) GetMemLimit() int64 {
+	limit, err := parseSizeOr(s.MemLimit, 0)
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+func parseUmask(umask string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid umask %q: expected an octal number from 0000 to 0777 such as 0002", umask)
+	}
+	return os.FileMode(m), nil
+}
+
+// DependencyNames returns the names of the services in depends_on.
+func (s *Service) DependencyNames() []string {
+	names := make([]string, len(s.DependsOn))
+	for i, dep := range s.DependsOn {
+		names[i] = dep.Service
+	}
+	return names
+}
+
+// IsExternal reports whether the service is a dependency that comproc does
+// not run but waits for.
+func (s *Service) IsExternal() bool {
+	return s.External != ""
+}
+
+// ReadinessCheck returns the settings of the service's readiness check, or
+// nil if it has none. External services are always checked, by connecting
+// to their address.
+func (s *Service) ReadinessCheck() *Healthcheck {
+	if s.IsExternal() && s.Healthcheck == nil {
+		return &Healthcheck{
+			Interval: Duration(DefaultExternalInterval),
+			Retries:  DefaultExternalRetries,
+		}
+	}
+	return s.Healthcheck
+}
+
+// HasReadinessCheck reports whether the service becomes ready only after a
+// check passes, rather than as soon as it is running.
+func (s *Service) HasReadinessCheck() bool {
+	return s.ReadinessCheck() != nil || s.ReadyLogPattern != ""
+}
+
+// GetRestartPolicy returns the effective restart policy, defaulting to "never".
+func (s *Service) GetRestartPolicy() RestartPolicy {
+	if s.Restart == "" {
+		return RestartNever
+	}
+	return s.Restart
+}
+
+// GetStopMode returns the effective stop mode, defaulting to "group".
+func (s *Service) GetStopMode() StopMode {
+	if s.StopMode == "" {
+		return StopModeGroup
+	}
+	return s.StopMode
+}
+
+// GetAttachStdin returns the effective attach stdin policy, defaulting to
+// "shared".
+func (s *Service) GetAttachStdin() AttachStdin {
+	if s.AttachStdin == "" {
+		return AttachStdinShared
+	}
+	return s.AttachStdin
+}
+
+// ResolvedEnv returns the environment variables defined for the service,
+// including PORT and the other fixed ports if ports were assigned, and the
+// addresses of its dependencies. Ports picked automatically are not
+// included. The returned map is a copy and can be modified by the
+// caller.
+func (s *Service) ResolvedEnv() map[string]string {
+	env := make(map[string]string, len(s.Env)+len(s.DependencyEnv)+1)
+	for k, v := range s.DependencyEnv {
+		env[k] = v
+	}
+	for k, v := range s.Env {
+		env[k] = v
+	}
+	if _, ok := s.Env["PORT"]; !ok && s.Port > 0 {
+		env["PORT"] = strconv.Itoa(s.Port)
+	}
+	for i, port := range s.Ports {
+		if _, ok := s.Env[PortEnvName(i)]; !ok && i > 0 && port != PortAuto {
+			env[PortEnvName(i)] = port
+		}
+	}
+	return env
+}
+
+// PortEnvName returns the environment variable of the i-th entry of ports:
+// PORT for the first, then PORT_2, PORT_3, and so on.
+func PortEnvName(i int) string {
+	if i == 0 {
+		return "PORT"
+	}
+	return "PORT_" + strconv.Itoa(i+1)
+}
+
+// Address returns the host and port where the service can be reached: the
+// host and port of an external service's address, or localhost and the
+// assigned port. The port is empty if it is not known.
+func (s *Service) Address() (host, port string) {
+	if !s.IsExternal() {
+		if s.Port > 0 {
+			return "localhost", strconv.Itoa(s.Port)
+		}
+		return "localhost", ""
+	}
+	u, err := ParseExternal(s.External)
+	if err != nil {
+		return "", ""
+	}
+	port = u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return u.Hostname(), port
+}
+
+// detectCycles checks for circular dependencies using DFS.
+func (c *Config) detectCycles() error {
+	// 0 = unvisited, 1 = in current path, 2 = fully visited
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if state[name] == 2 {
+			return nil
+		}
+		if state[name] == 1 {
+			// Found a cycle - find where it starts
+			cycleStart := 0
+			for i, n := range path {
+				if n == name {
+					cycleStart = i
+					break
+				}
+			}
+			cycle := append(path[cycleStart:], name)
+			return fmt.Errorf("circular dependency detected: %v", cycle)
+		}
+
+		state[name] = 1
+		path = append(path, name)
+
+		svc := c.Services[name]
+		for _, dep := range svc.DependencyNames() {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+
+		state[name] = 2
+		return nil
+	}
+
+	for _, name := range c.ServiceOrder {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TopologicalSort returns services in dependency order (dependencies first).
+func (c *Config) TopologicalSort() ([]*Service, error) {
+	var result []*Service
+	visited := make(map[string]bool)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+
+		svc := c.Services[name]
+		for _, dep := range svc.DependencyNames() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		result = append(result, svc)
+		return nil
+	}
+
+	for _, name := range c.ServiceOrder {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
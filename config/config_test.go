@@ -0,0 +1,1465 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParse_ValidConfig(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+    working_dir: ./backend
+    env:
+      PORT: "8080"
+    restart: on-failure
+    depends_on:
+      - db
+  db:
+    command: docker run postgres
+    restart: always
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Services) != 2 {
+		t.Errorf("expected 2 services, got %d", len(cfg.Services))
+	}
+
+	api := cfg.Services["api"]
+	if api == nil {
+		t.Fatal("api service not found")
+	}
+	if api.Name != "api" {
+		t.Errorf("expected name 'api', got %q", api.Name)
+	}
+	if api.Command != "go run ./cmd/api" {
+		t.Errorf("expected command 'go run ./cmd/api', got %q", api.Command)
+	}
+	if api.WorkingDir != "./backend" {
+		t.Errorf("expected working_dir './backend', got %q", api.WorkingDir)
+	}
+	if api.Env["PORT"] != "8080" {
+		t.Errorf("expected env PORT='8080', got %q", api.Env["PORT"])
+	}
+	if api.Restart != RestartOnFailure {
+		t.Errorf("expected restart 'on-failure', got %q", api.Restart)
+	}
+	if len(api.DependsOn) != 1 || api.DependsOn[0].Service != "db" {
+		t.Errorf("expected depends_on ['db'], got %v", api.DependsOn)
+	}
+
+	db := cfg.Services["db"]
+	if db == nil {
+		t.Fatal("db service not found")
+	}
+	if db.Restart != RestartAlways {
+		t.Errorf("expected restart 'always', got %q", db.Restart)
+	}
+}
+
+func TestParse_EmptyServices(t *testing.T) {
+	yaml := `services: {}`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for empty services")
+	}
+	if !strings.Contains(err.Error(), "no services defined") {
+		t.Errorf("expected 'no services defined' error, got: %v", err)
+	}
+}
+
+func TestParse_MissingCommand(t *testing.T) {
+	yaml := `
+services:
+  api:
+    working_dir: ./backend
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for missing command")
+	}
+	if !strings.Contains(err.Error(), "command is required") {
+		t.Errorf("expected 'command is required' error, got: %v", err)
+	}
+}
+
+func TestParse_InvalidRestartPolicy(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+    restart: invalid
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid restart policy")
+	}
+	if !strings.Contains(err.Error(), "invalid restart policy") {
+		t.Errorf("expected 'invalid restart policy' error, got: %v", err)
+	}
+}
+
+func TestParse_MaxRetries(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  api:
+    command: go run ./cmd/api
+    restart: on-failure
+    max_retries: 5
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Services["api"].MaxRetries; got != 5 {
+		t.Errorf("expected max_retries 5, got %d", got)
+	}
+
+	tests := []struct {
+		name    string
+		service string
+		wantErr string
+	}{
+		{"negative", "restart: on-failure\n    max_retries: -1", "max_retries must not be negative"},
+		{"without restart", "max_retries: 3", "max_retries requires restart: on-failure"},
+		{"always", "restart: always\n    max_retries: 3", "max_retries requires restart: on-failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte("services:\n  api:\n    command: ./api\n    " + tt.service + "\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_UnknownDependency(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+    depends_on:
+      - unknown
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for unknown dependency")
+	}
+	if !strings.Contains(err.Error(), "unknown dependency") {
+		t.Errorf("expected 'unknown dependency' error, got: %v", err)
+	}
+}
+
+func TestParse_CircularDependency(t *testing.T) {
+	yaml := `
+services:
+  a:
+    command: echo a
+    depends_on:
+      - b
+  b:
+    command: echo b
+    depends_on:
+      - c
+  c:
+    command: echo c
+    depends_on:
+      - a
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for circular dependency")
+	}
+	if !strings.Contains(err.Error(), "circular dependency") {
+		t.Errorf("expected 'circular dependency' error, got: %v", err)
+	}
+}
+
+func TestParse_SelfDependency(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: echo api
+    depends_on:
+      - api
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for self dependency")
+	}
+	if !strings.Contains(err.Error(), "circular dependency") {
+		t.Errorf("expected 'circular dependency' error, got: %v", err)
+	}
+}
+
+func TestParse_PreservesServiceOrder(t *testing.T) {
+	yaml := `
+services:
+  frontend:
+    command: npm run dev
+  api:
+    command: go run ./cmd/api
+  db:
+    command: docker run postgres
+  cache:
+    command: redis-server
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"frontend", "api", "db", "cache"}
+	names := cfg.ServiceNames()
+	if len(names) != len(expected) {
+		t.Fatalf("expected %d service names, got %d", len(expected), len(names))
+	}
+	for i, name := range names {
+		if name != expected[i] {
+			t.Errorf("ServiceNames()[%d] = %q, want %q", i, name, expected[i])
+		}
+	}
+}
+
+func TestParse_ProjectName(t *testing.T) {
+	yaml := `
+name: shop
+services:
+  api:
+    command: go run ./cmd/api
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Name != "shop" {
+		t.Errorf("expected name 'shop', got %q", cfg.Name)
+	}
+	if len(cfg.ServiceNames()) != 1 {
+		t.Errorf("expected 1 service, got %v", cfg.ServiceNames())
+	}
+}
+
+func TestParse_InvalidServiceName(t *testing.T) {
+	yaml := `
+services:
+  shop/api:
+    command: go run ./cmd/api
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for service name with '/'")
+	}
+	if !strings.Contains(err.Error(), "invalid service name") {
+		t.Errorf("expected 'invalid service name' error, got: %v", err)
+	}
+}
+
+func TestGetRestartPolicy_Default(t *testing.T) {
+	s := &Service{Command: "echo test"}
+	if s.GetRestartPolicy() != RestartNever {
+		t.Errorf("expected default restart policy 'never', got %q", s.GetRestartPolicy())
+	}
+}
+
+func TestParse_StopMode(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: npm run dev
+    stop_mode: leader
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Services["api"].GetStopMode() != StopModeLeader {
+		t.Errorf("expected stop mode 'leader', got %q", cfg.Services["api"].GetStopMode())
+	}
+}
+
+func TestParse_InvalidStopMode(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: npm run dev
+    stop_mode: parent
+`
+
+	_, err := Parse([]byte(yaml))
+	if err == nil {
+		t.Fatal("expected error for invalid stop mode")
+	}
+	if !strings.Contains(err.Error(), "invalid stop mode") {
+		t.Errorf("expected 'invalid stop mode' error, got: %v", err)
+	}
+}
+
+func TestParse_AttachStdin(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  repl:
+    command: python3 -i
+    attach_stdin: first
+  web:
+    command: npm run dev
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Services["repl"].GetAttachStdin(); got != AttachStdinFirst {
+		t.Errorf("expected attach_stdin 'first', got %q", got)
+	}
+	if got := cfg.Services["web"].GetAttachStdin(); got != AttachStdinShared {
+		t.Errorf("expected default attach_stdin 'shared', got %q", got)
+	}
+
+	_, err = Parse([]byte("services:\n  repl:\n    command: python3 -i\n    attach_stdin: last\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid attach_stdin") {
+		t.Errorf("expected 'invalid attach_stdin' error, got: %v", err)
+	}
+}
+
+func TestParse_LoginShell(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  web:
+    command: npm run dev
+    login_shell: true
+  db:
+    command: postgres
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Services["web"].LoginShell || cfg.Services["db"].LoginShell {
+		t.Error("expected login_shell only for web")
+	}
+}
+
+func TestParse_ExecFormCommand(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  api:
+    command: ["./bin/api", "--name", "it's me", ""]
+  base:
+    command: [sleep, 60]
+  web:
+    extends: {service: base}
+  db:
+    command: postgres -D data
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api := cfg.Services["api"]
+	if !slices.Equal(api.Args, []string{"./bin/api", "--name", "it's me", ""}) {
+		t.Errorf("expected the arguments of api, got %q", api.Args)
+	}
+	if want := `./bin/api --name 'it'\''s me' ''`; api.Command != want {
+		t.Errorf("expected api's command quoted as %q, got %q", want, api.Command)
+	}
+	if web := cfg.Services["web"]; !slices.Equal(web.Args, []string{"sleep", "60"}) || web.Command != "sleep 60" {
+		t.Errorf("expected web to inherit the exec form, got %q (%q)", web.Args, web.Command)
+	}
+	if db := cfg.Services["db"]; db.Args != nil || db.Command != "postgres -D data" {
+		t.Errorf("expected db to keep a command line, got %q (%q)", db.Args, db.Command)
+	}
+
+	// Encoding keeps the form of each command
+	for _, name := range []string{"api", "db"} {
+		data, err := yaml.Marshal(cfg.Services[name])
+		if err != nil {
+			t.Fatalf("failed to encode %s: %v", name, err)
+		}
+		var svc Service
+		if err := yaml.Unmarshal(data, &svc); err != nil {
+			t.Fatalf("failed to decode %s: %v", name, err)
+		}
+		if !slices.Equal(svc.Args, cfg.Services[name].Args) || svc.Command != cfg.Services[name].Command {
+			t.Errorf("expected %s to round-trip, got %q (%q) from:\n%s", name, svc.Args, svc.Command, data)
+		}
+	}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"{command: []}", "command must start with a program when it is a list"},
+		{`{command: ["", "x"]}`, "command must start with a program when it is a list"},
+		{"{command: [[sleep]]}", "cannot unmarshal"},
+		{"{external: localhost:5432, command: [sleep, 60]}", "external services must not have a command"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("services:\n  web: " + tt.service + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.service, tt.want, err)
+		}
+	}
+}
+
+func TestParse_Umask(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  web:
+    command: npm run dev
+    umask: 0002
+  api:
+    command: go run .
+    umask: "027"
+  db:
+    command: postgres
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mask, ok := cfg.Services["web"].GetUmask(); !ok || mask != 0002 {
+		t.Errorf("expected umask 0002 for web, got %04o, %v", mask, ok)
+	}
+	if mask, ok := cfg.Services["api"].GetUmask(); !ok || mask != 0027 {
+		t.Errorf("expected umask 0027 for api, got %04o, %v", mask, ok)
+	}
+	if _, ok := cfg.Services["db"].GetUmask(); ok {
+		t.Error("expected no umask for db")
+	}
+
+	for _, umask := range []string{"0008", "1777", "-1", "u=rwx"} {
+		_, err := Parse([]byte("services:\n  web:\n    command: npm run dev\n    umask: " + umask + "\n"))
+		if err == nil || !strings.Contains(err.Error(), "invalid umask") {
+			t.Errorf("%s: expected invalid umask error, got %v", umask, err)
+		}
+	}
+}
+
+func TestParse_Isolate(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  web:
+    command: npm run dev
+    isolate: pid
+  api:
+    command: go run .
+    isolate: [pid, mount, net]
+  db:
+    command: postgres
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Services["web"].Isolate; !slices.Equal(got, Isolation{NamespacePID}) {
+		t.Errorf("expected web to be isolated in a PID namespace, got %v", got)
+	}
+	api := cfg.Services["api"].Isolate
+	if !api.Has(NamespacePID) || !api.Has(NamespaceMount) || !api.Has(NamespaceNet) {
+		t.Errorf("expected api to be isolated in all namespaces, got %v", api)
+	}
+	if got := cfg.Services["db"].Isolate; len(got) != 0 {
+		t.Errorf("expected db not to be isolated, got %v", got)
+	}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"{command: npm run dev, isolate: user}", `invalid isolate: "user"`},
+		{"{command: npm run dev, isolate: [pid, ipc]}", `invalid isolate: "ipc"`},
+		{"{external: localhost:5432, isolate: net}", "isolate is not used by external services"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("services:\n  web: " + tt.service + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.service, tt.want, err)
+		}
+	}
+}
+
+func TestParse_Requires(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  web:
+    command: npm run dev
+    requires:
+      - binary: node
+      - file: .env
+      - env: API_KEY
+      - port: 3000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Requirement{{Binary: "node"}, {File: ".env"}, {Env: "API_KEY"}, {Port: 3000}}
+	if got := cfg.Services["web"].Requires; !slices.Equal(got, want) {
+		t.Errorf("expected requires %v, got %v", want, got)
+	}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"{command: npm run dev, requires: [{port: 70000}]}", "requires[0]: invalid port 70000"},
+		{"{command: npm run dev, requires: [{binary: node}, {}]}", "requires[1]: expected exactly one of"},
+		{"{command: npm run dev, requires: [{binary: node, env: PATH}]}", "requires[0]: expected exactly one of"},
+		{"{external: localhost:5432, requires: [{env: PGPASSWORD}]}", "requires is not used by external services"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("services:\n  web: " + tt.service + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.service, tt.want, err)
+		}
+	}
+}
+
+func TestParse_MemRestartLimit(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  web:
+    command: npm run dev
+    mem_restart_limit: 512MB
+  db:
+    command: postgres
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Services["web"].GetMemLimit(); got != 512<<20 {
+		t.Errorf("expected a limit of 512MB, got %d", got)
+	}
+	if got := cfg.Services["db"].GetMemLimit(); got != 0 {
+		t.Errorf("expected no limit, got %d", got)
+	}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"{command: npm run dev, mem_restart_limit: lots}", `invalid mem_restart_limit: invalid size "lots"`},
+		{"{command: npm run dev, mem_restart_limit: 0}", "invalid mem_restart_limit"},
+		{"{external: localhost:5432, mem_restart_limit: 1GB}", "mem_restart_limit is not used by external services"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("services:\n  web: " + tt.service + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.service, tt.want, err)
+		}
+	}
+}
+
+func TestGetStopMode_Default(t *testing.T) {
+	s := &Service{Command: "echo test"}
+	if s.GetStopMode() != StopModeGroup {
+		t.Errorf("expected default stop mode 'group', got %q", s.GetStopMode())
+	}
+}
+
+func TestParse_Healthcheck(t *testing.T) {
+	yaml := `
+services:
+  db:
+    command: postgres
+    healthcheck:
+      command: pg_isready
+      interval: 500ms
+      retries: 5
+      start_period: 30s
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hc := cfg.Services["db"].Healthcheck
+	if hc == nil {
+		t.Fatal("expected healthcheck to be set")
+	}
+	if hc.Command != "pg_isready" {
+		t.Errorf("expected command 'pg_isready', got %q", hc.Command)
+	}
+	if hc.GetInterval() != 500*time.Millisecond {
+		t.Errorf("expected interval 500ms, got %v", hc.GetInterval())
+	}
+	if hc.GetTimeout() != DefaultHealthcheckTimeout {
+		t.Errorf("expected default timeout, got %v", hc.GetTimeout())
+	}
+	if hc.GetRetries() != 5 {
+		t.Errorf("expected 5 retries, got %d", hc.GetRetries())
+	}
+	if time.Duration(hc.StartPeriod) != 30*time.Second {
+		t.Errorf("expected start period 30s, got %v", time.Duration(hc.StartPeriod))
+	}
+}
+
+func TestParse_InvalidHealthcheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthcheck string
+		wantErr     string
+	}{
+		{"missing command", "interval: 1s", "command or wait_for_file is required"},
+		{"command and file", "{command: 'true', wait_for_file: ready}", "must not both be set"},
+		{"invalid duration", "{command: 'true', interval: soon}", "invalid duration"},
+		{"negative retries", "{command: 'true', retries: -1}", "retries must not be negative"},
+		{"negative start period", "{command: 'true', start_period: -1s}", "start_period must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := "services:\n  db:\n    command: postgres\n    healthcheck:\n      " + tt.healthcheck + "\n"
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_DependsOnLongForm(t *testing.T) {
+	yaml := `
+services:
+  db:
+    command: postgres
+  cache:
+    command: redis-server
+  api:
+    command: go run .
+    depends_on:
+      - service: db
+        restart_dependents: true
+      - cache
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Dependency{{Service: "db", RestartDependents: true}, {Service: "cache"}}
+	if got := cfg.Services["api"].DependsOn; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	_, err = Parse([]byte("services:\n  api:\n    command: go run .\n    depends_on:\n      - restart_dependents: true\n"))
+	if err == nil || !strings.Contains(err.Error(), "depends_on[0]: service is required") {
+		t.Errorf("expected an error for a missing service, got %v", err)
+	}
+}
+
+func TestParse_DependsOnCondition(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  db:
+    command: postgres
+    healthcheck:
+      command: pg_isready
+  cache:
+    command: redis-server
+    ready_log_pattern: Ready to accept connections
+  api:
+    command: go run .
+    depends_on:
+      - service: db
+        condition: service_healthy
+      - service: cache
+        condition: service_started
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api, db, cache := cfg.Services["api"], cfg.Services["db"], cfg.Services["cache"]
+	if dep := api.DependsOn[0]; dep.Condition != ConditionServiceHealthy || !dep.WaitsReady(db) {
+		t.Errorf("expected api to wait until db is healthy, got %+v", dep)
+	}
+	if dep := api.DependsOn[1]; dep.Condition != ConditionServiceStarted || dep.WaitsReady(cache) {
+		t.Errorf("expected api to wait only until cache is started, got %+v", dep)
+	}
+	if dep := (Dependency{Service: "cache"}); !dep.WaitsReady(cache) {
+		t.Error("expected a dependency without a condition to wait for its readiness check")
+	}
+
+	tests := []struct {
+		condition string
+		want      string
+	}{
+		{"service_healthy", `depends_on "db": condition service_healthy requires the dependency to have a healthcheck or ready_log_pattern`},
+		{"service_completed", `depends_on "db": invalid condition "service_completed"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("services:\n  db:\n    command: postgres\n  api:\n    command: go run .\n    depends_on:\n      - service: db\n        condition: " + tt.condition + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.condition, tt.want, err)
+		}
+	}
+}
+
+func TestParse_ReadyLogPattern(t *testing.T) {
+	cfg, err := Parse([]byte("services:\n  web:\n    command: npm run dev\n    ready_log_pattern: 'Listening on \\d+'\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	web := cfg.Services["web"]
+	if web.ReadyLogPattern != `Listening on \d+` {
+		t.Errorf("expected the pattern to be set, got %q", web.ReadyLogPattern)
+	}
+	if !web.HasReadinessCheck() {
+		t.Error("expected a service with a ready log pattern to have a readiness check")
+	}
+
+	tests := []struct {
+		name    string
+		service string
+		wantErr string
+	}{
+		{"invalid pattern", "command: npm run dev\n    ready_log_pattern: '(ready'", "invalid ready_log_pattern"},
+		{"with healthcheck", "command: npm run dev\n    ready_log_pattern: ready\n    healthcheck: {command: 'true'}", "must not both be set"},
+		{"external", "external: localhost:5432\n    ready_log_pattern: ready", "not used by external services"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte("services:\n  web:\n    " + tt.service + "\n"))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_External(t *testing.T) {
+	yaml := `
+services:
+  postgres:
+    external: localhost:5432
+  api:
+    external: https://api.example.com/health
+    healthcheck:
+      retries: 3
+  web:
+    command: npm start
+    depends_on: [postgres, api]
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pg := cfg.Services["postgres"]
+	if !pg.IsExternal() {
+		t.Fatal("expected postgres to be external")
+	}
+	hc := pg.ReadinessCheck()
+	if hc == nil || hc.GetRetries() != DefaultExternalRetries || hc.GetInterval() != DefaultExternalInterval {
+		t.Errorf("expected default readiness check, got %+v", hc)
+	}
+	if got := cfg.Services["api"].ReadinessCheck().GetRetries(); got != 3 {
+		t.Errorf("expected 3 retries, got %d", got)
+	}
+	if cfg.Services["web"].IsExternal() || cfg.Services["web"].ReadinessCheck() != nil {
+		t.Error("expected web to be a regular service without a readiness check")
+	}
+}
+
+func TestParse_InvalidExternal(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		wantErr string
+	}{
+		{"with command", "{external: 'localhost:5432', command: postgres}", "must not have a command"},
+		{"missing port", "{external: localhost}", "invalid external address"},
+		{"unknown scheme", "{external: 'udp://localhost:53'}", "unsupported scheme"},
+		{"healthcheck command", "{external: 'localhost:5432', healthcheck: {command: 'true'}}", "not used by external services"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := "services:\n  db: " + tt.service + "\n"
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_Logging(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+    logging:
+      - driver: file
+        path: ./logs/api.log
+      - driver: syslog
+        tag: myapp
+      - driver: command
+        command: cat >> /tmp/out.log
+      - driver: loki
+        url: http://localhost:3100
+        labels:
+          env: dev
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logging := cfg.Services["api"].Logging
+	if len(logging) != 4 {
+		t.Fatalf("expected 4 log sinks, got %d", len(logging))
+	}
+	if logging[0].Driver != LogDriverFile || logging[0].Path != "./logs/api.log" {
+		t.Errorf("unexpected file sink: %+v", logging[0])
+	}
+	if logging[1].Driver != LogDriverSyslog || logging[1].Tag != "myapp" {
+		t.Errorf("unexpected syslog sink: %+v", logging[1])
+	}
+	if logging[2].Driver != LogDriverCommand || logging[2].Command != "cat >> /tmp/out.log" {
+		t.Errorf("unexpected command sink: %+v", logging[2])
+	}
+	if logging[3].Driver != LogDriverLoki || logging[3].URL != "http://localhost:3100" || logging[3].Labels["env"] != "dev" {
+		t.Errorf("unexpected loki sink: %+v", logging[3])
+	}
+}
+
+func TestParse_InvalidLogging(t *testing.T) {
+	tests := []struct {
+		name    string
+		sink    string
+		wantErr string
+	}{
+		{"missing driver", "path: x.log", "driver is required"},
+		{"unknown driver", "driver: kafka", "unknown driver"},
+		{"file without path", "driver: file", "path is required"},
+		{"command without command", "driver: command", "command is required"},
+		{"loki without url", "driver: loki", "url is required"},
+		{"loki with udp url", "{driver: loki, url: 'udp://localhost:3100'}", "unsupported url scheme"},
+		{"gelf without host", "{driver: gelf, url: 'udp://'}", "invalid url"},
+		{"invalid label name", "{driver: gelf, url: 'udp://localhost:12201', labels: {app-name: x}}", "invalid label name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+    logging:
+      - ` + tt.sink + `
+`
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_Plugins(t *testing.T) {
+	yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+plugins:
+  - command: ./notify.sh
+  - command: cat >> events.log
+    events: [service.failed, daemon.down]
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %d", len(cfg.Plugins))
+	}
+	if !cfg.Plugins[0].Subscribes(PluginEventServiceStarted) {
+		t.Error("plugin without events should receive all events")
+	}
+	if !cfg.Plugins[1].Subscribes(PluginEventServiceFailed) {
+		t.Error("expected plugin to receive service.failed")
+	}
+	if cfg.Plugins[1].Subscribes(PluginEventServiceStarted) {
+		t.Error("expected plugin not to receive service.started")
+	}
+}
+
+func TestParse_InvalidPlugins(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugin  string
+		wantErr string
+	}{
+		{"missing command", "events: [daemon.up]", "command is required"},
+		{"unknown event", "{command: ./notify.sh, events: [service.crashed]}", "unknown event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+services:
+  api:
+    command: go run ./cmd/api
+plugins:
+  - ` + tt.plugin + `
+`
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_PortBase(t *testing.T) {
+	yaml := `
+port_base: 5000
+services:
+  web:
+    command: node server.js
+  worker:
+    command: node worker.js
+  api:
+    command: go run ./cmd/api
+    env:
+      PORT: "8080"
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"web": "5000", "worker": "5100", "api": "8080"}
+	for name, port := range want {
+		if got := cfg.Services[name].ResolvedEnv()["PORT"]; got != port {
+			t.Errorf("%s: expected PORT=%s, got %q", name, port, got)
+		}
+	}
+}
+
+func TestParse_PortStep(t *testing.T) {
+	yaml := `
+port_base: 3000
+port_step: 1
+services:
+  a:
+    command: a
+  b:
+    command: b
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Services["b"].Port != 3001 {
+		t.Errorf("expected port 3001, got %d", cfg.Services["b"].Port)
+	}
+}
+
+func TestParse_NoPortBase(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  a:
+    command: a
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cfg.Services["a"].ResolvedEnv()["PORT"]; ok {
+		t.Error("expected no PORT without port_base")
+	}
+}
+
+func TestParse_DependencyEnv(t *testing.T) {
+	cfg, err := Parse([]byte(`
+port_base: 5000
+services:
+  db:
+    external: db.internal:5432
+  search-api:
+    command: node search.js
+  auth:
+    external: https://auth.example.com
+  web:
+    command: node server.js
+    depends_on: [db, search-api, auth]
+    env:
+      DB_HOST: 127.0.0.1
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := cfg.Services["web"].ResolvedEnv()
+	want := map[string]string{
+		"DB_HOST":         "127.0.0.1", // Set by the service's env
+		"DB_PORT":         "5432",
+		"SEARCH_API_HOST": "localhost",
+		"SEARCH_API_PORT": "5100",
+		"AUTH_HOST":       "auth.example.com",
+		"AUTH_PORT":       "443",
+		"PORT":            "5300",
+	}
+	if !maps.Equal(env, want) {
+		t.Errorf("expected %v, got %v", want, env)
+	}
+	if cfg.Services["db"].DependencyEnv != nil {
+		t.Error("expected no dependency env without depends_on")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"db":         "DB",
+		"search-api": "SEARCH_API",
+		"cache.v2":   "CACHE_V2",
+		"2fa":        "_2FA",
+	}
+	for name, want := range tests {
+		if got := EnvName(name); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParse_InvalidPortBase(t *testing.T) {
+	_, err := Parse([]byte(`
+port_base: 65500
+services:
+  a:
+    command: a
+  b:
+    command: b
+`))
+	if err == nil || !strings.Contains(err.Error(), "exceeds 65535") {
+		t.Errorf("expected port range error, got %v", err)
+	}
+}
+
+func TestParse_Ports(t *testing.T) {
+	cfg, err := Parse([]byte(`
+port_base: 5000
+services:
+  web:
+    command: node server.js
+    ports: ["8080", auto, "9229"]
+  api:
+    command: go run .
+    ports: [auto]
+  app:
+    command: node app.js
+    depends_on: [web, api]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := cfg.Services["web"].ResolvedEnv()
+	if env["PORT"] != "8080" || env["PORT_3"] != "9229" {
+		t.Errorf("expected the fixed ports, got %v", env)
+	}
+	if _, ok := env["PORT_2"]; ok {
+		t.Errorf("expected no env for the auto port, got %v", env)
+	}
+	if cfg.Services["api"].Port != 0 {
+		t.Errorf("expected no port assigned to api, got %d", cfg.Services["api"].Port)
+	}
+
+	env = cfg.Services["app"].ResolvedEnv()
+	if env["WEB_PORT"] != "8080" {
+		t.Errorf("expected WEB_PORT=8080, got %v", env)
+	}
+	if _, ok := env["API_PORT"]; ok {
+		t.Errorf("expected no API_PORT before api starts, got %v", env)
+	}
+}
+
+func TestParse_InvalidPorts(t *testing.T) {
+	for _, port := range []string{"0", "65536", "http", "-1"} {
+		_, err := Parse([]byte(fmt.Sprintf(`
+services:
+  web:
+    command: node server.js
+    ports: ["%s"]
+`, port)))
+		if err == nil || !strings.Contains(err.Error(), "invalid port") {
+			t.Errorf("%s: expected invalid port error, got %v", port, err)
+		}
+	}
+}
+
+func TestParse_GracefulTimeout(t *testing.T) {
+	cfg, err := Parse([]byte(`
+graceful_timeout: 1m
+services:
+  api:
+    command: java -jar api.jar
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.GetGracefulTimeout(); got != time.Minute {
+		t.Errorf("expected 1m, got %v", got)
+	}
+
+	cfg, _ = Parse([]byte("services:\n  api:\n    command: go run .\n"))
+	if got := cfg.GetGracefulTimeout(); got != DefaultGracefulTimeout {
+		t.Errorf("expected the default, got %v", got)
+	}
+
+	_, err = Parse([]byte("graceful_timeout: -1s\nservices:\n  api:\n    command: go run .\n"))
+	if err == nil || !strings.Contains(err.Error(), "graceful_timeout") {
+		t.Errorf("expected graceful_timeout error, got %v", err)
+	}
+}
+
+func TestParse_LogMemoryLimit(t *testing.T) {
+	cfg, err := Parse([]byte(`
+log_memory_limit: 16MiB
+services:
+  api:
+    command: go run .
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.GetLogMemoryLimit(); got != 16<<20 {
+		t.Errorf("expected 16MiB, got %d", got)
+	}
+
+	cfg, _ = Parse([]byte("services:\n  api:\n    command: go run .\n"))
+	if got := cfg.GetLogMemoryLimit(); got != DefaultLogMemoryLimit {
+		t.Errorf("expected the default, got %d", got)
+	}
+
+	_, err = Parse([]byte("log_memory_limit: lots\nservices:\n  api:\n    command: go run .\n"))
+	if err == nil || !strings.Contains(err.Error(), "log_memory_limit") {
+		t.Errorf("expected log_memory_limit error, got %v", err)
+	}
+}
+
+func TestParse_Socket(t *testing.T) {
+	yaml := `
+socket:
+  path: run/comproc.sock
+  mode: "0660"
+  group: developers
+services:
+  app:
+    command: sleep 60
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Socket.GetMode(); got != 0660 {
+		t.Errorf("expected mode 0660, got %o", got)
+	}
+	if got := cfg.Socket.ResolvePath("/srv/shop/comproc.yaml"); got != "/srv/shop/run/comproc.sock" {
+		t.Errorf("expected path relative to the config, got %q", got)
+	}
+	if cfg.Socket.Group != "developers" {
+		t.Errorf("expected group developers, got %q", cfg.Socket.Group)
+	}
+}
+
+func TestSocket_Defaults(t *testing.T) {
+	var s *Socket
+	if s.GetMode() != DefaultSocketMode {
+		t.Errorf("expected default mode, got %o", s.GetMode())
+	}
+	if s.ResolvePath("/srv/shop/comproc.yaml") != "" {
+		t.Error("expected no path")
+	}
+	if s.GetListen() != "" {
+		t.Error("expected no listen address")
+	}
+	if s.ResolveTokenFile("/srv/shop/comproc.yaml") != "" || s.GetTLS("/srv/shop/comproc.yaml") != nil {
+		t.Error("expected no token file or TLS")
+	}
+}
+
+func TestParse_InvalidSocketMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr string
+	}{
+		{"rw", "expected an octal number"},
+		{"01777", "only permission bits"},
+		{"0440", "owner to read and write"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			yaml := "socket:\n  mode: \"" + tt.mode + "\"\nservices:\n  app:\n    command: sleep 60\n"
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParse_InvalidReadOnlySocket(t *testing.T) {
+	yaml := "socket:\n  read_only:\n    mode: \"0666\"\nservices:\n  app:\n    command: sleep 60\n"
+	_, err := Parse([]byte(yaml))
+	if err == nil || !strings.Contains(err.Error(), "read_only: path or listen is required") {
+		t.Errorf("expected missing path error, got: %v", err)
+	}
+}
+
+func TestParse_SocketListen(t *testing.T) {
+	cfg, err := Parse([]byte("socket:\n  listen: 127.0.0.1:7007\nservices:\n  app:\n    command: sleep 60\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Socket.Listen != "127.0.0.1:7007" {
+		t.Errorf("expected listen address, got %q", cfg.Socket.Listen)
+	}
+
+	tests := []struct {
+		socket  string
+		wantErr string
+	}{
+		{"listen: 7007", "invalid listen address"},
+		{"listen: localhost:http", "invalid listen address"},
+		{"listen: :70000", "invalid listen address"},
+		{"read_only:\n    listen: :7008", "read_only: listen requires its own token_file"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("socket:\n  " + tt.socket + "\nservices:\n  app:\n    command: sleep 60\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected %q error, got: %v", tt.socket, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParse_SocketAuth(t *testing.T) {
+	yaml := `
+socket:
+  listen: :7007
+  token_file: secrets/token
+  tls:
+    cert: /etc/comproc/cert.pem
+    key: tls/key.pem
+services:
+  app:
+    command: sleep 60
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Socket.ResolveTokenFile("/srv/shop/comproc.yaml"); got != "/srv/shop/secrets/token" {
+		t.Errorf("expected token file relative to the config, got %q", got)
+	}
+	want := SocketTLS{Cert: "/etc/comproc/cert.pem", Key: "/srv/shop/tls/key.pem"}
+	if got := cfg.Socket.GetTLS("/srv/shop/comproc.yaml"); got == nil || *got != want {
+		t.Errorf("expected TLS %+v, got %+v", want, got)
+	}
+
+	tests := []struct {
+		socket  string
+		wantErr string
+	}{
+		{"tls:\n    cert: cert.pem", "tls: cert and key are required"},
+		{"read_only:\n    listen: :7008\n    token_file: token\n    tls:\n      cert: cert.pem", "read_only: tls: cert and key are required"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte("socket:\n  " + tt.socket + "\nservices:\n  app:\n    command: sleep 60\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected %q error, got: %v", tt.socket, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParse_LogStore(t *testing.T) {
+	yaml := `
+log_store:
+  dir: .comproc/logs
+  segment_size: 1MB
+  max_size: 64MiB
+services:
+  app:
+    command: sleep 60
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.LogStore.GetSegmentSize(); got != 1<<20 {
+		t.Errorf("expected segment size 1MiB, got %d", got)
+	}
+	if got := cfg.LogStore.GetMaxSize(); got != 64<<20 {
+		t.Errorf("expected max size 64MiB, got %d", got)
+	}
+	if got := cfg.LogStore.ResolveDir("/srv/shop/comproc.yaml"); got != "/srv/shop/.comproc/logs" {
+		t.Errorf("expected dir relative to the config, got %q", got)
+	}
+}
+
+func TestParse_InvalidLogStore(t *testing.T) {
+	tests := []struct {
+		store   string
+		wantErr string
+	}{
+		{"{segment_size: lots}", "segment_size: invalid size"},
+		{"{max_size: -1}", "max_size: invalid size"},
+		{"{segment_size: 8MB, max_size: 1MB}", "must not be smaller"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.store, func(t *testing.T) {
+			yaml := "log_store: " + tt.store + "\nservices:\n  app:\n    command: sleep 60\n"
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"512", 512},
+		{"512b", 512},
+		{"64KB", 64 << 10},
+		{"8MiB", 8 << 20},
+		{"1.5g", 3 << 29},
+		{" 2 mb ", 2 << 20},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "MB", "0", "10TB", "1.2.3k"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("ParseSize(%q): expected error", input)
+		}
+	}
+}
+
+func TestTopologicalSort(t *testing.T) {
+	yaml := `
+services:
+  frontend:
+    command: npm run dev
+    depends_on:
+      - api
+  api:
+    command: go run ./cmd/api
+    depends_on:
+      - db
+  db:
+    command: docker run postgres
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sorted, err := cfg.TopologicalSort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sorted) != 3 {
+		t.Fatalf("expected 3 services, got %d", len(sorted))
+	}
+
+	// Check order: db -> api -> frontend
+	indexOf := func(name string) int {
+		for i, s := range sorted {
+			if s.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	dbIdx := indexOf("db")
+	apiIdx := indexOf("api")
+	frontendIdx := indexOf("frontend")
+
+	if dbIdx > apiIdx {
+		t.Errorf("db should come before api, got db=%d, api=%d", dbIdx, apiIdx)
+	}
+	if apiIdx > frontendIdx {
+		t.Errorf("api should come before frontend, got api=%d, frontend=%d", apiIdx, frontendIdx)
+	}
+}
+
+func TestTopologicalSort_NoDependencies(t *testing.T) {
+	yaml := `
+services:
+  a:
+    command: echo a
+  b:
+    command: echo b
+  c:
+    command: echo c
+`
+
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sorted, err := cfg.TopologicalSort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sorted) != 3 {
+		t.Errorf("expected 3 services, got %d", len(sorted))
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+)
+
+// Extends refers to a service whose definition a service inherits.
+type Extends struct {
+	File    string `yaml:"file"`    // Config file of the base service (default: the same file)
+	Service string `yaml:"service"` // Name of the base service
+}
+
+// extendsResolver merges base services into the services that extend them.
+type extendsResolver struct {
+	files     map[string]*Config // Decoded config files by absolute path
+	resolving map[string]bool    // Services being resolved, to detect cycles
+}
+
+// resolveExtends replaces each service that has `extends` with its base
+// service merged with the fields it sets itself. Base files are resolved
+// relative to the directory of path, or the current directory if path is
+// empty.
+func resolveExtends(cfg *Config, path string) error {
+	r := &extendsResolver{
+		files:     make(map[string]*Config),
+		resolving: make(map[string]bool),
+	}
+	if path != "" {
+		r.files[path] = cfg
+	}
+	for _, name := range cfg.ServiceOrder {
+		if _, err := r.resolve(cfg, path, name); err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resolve resolves the extends chain of a service of cfg, which was read
+// from path, in place and returns the service.
+func (r *extendsResolver) resolve(cfg *Config, path, name string) (*Service, error) {
+	svc, ok := cfg.Services[name]
+	if !ok || svc == nil {
+		return nil, fmt.Errorf("unknown service: %q", name)
+	}
+	ext := svc.Extends
+	if ext == nil {
+		return svc, nil
+	}
+	if ext.Service == "" {
+		return nil, errors.New("extends: service is required")
+	}
+
+	key := path + "\x00" + name
+	if r.resolving[key] {
+		return nil, errors.New("extends: circular reference")
+	}
+	r.resolving[key] = true
+	defer delete(r.resolving, key)
+
+	baseCfg, basePath := cfg, path
+	if ext.File != "" {
+		basePath = ext.File
+		if !filepath.IsAbs(basePath) {
+			basePath = filepath.Join(filepath.Dir(path), basePath)
+		}
+		var err error
+		if basePath, err = filepath.Abs(basePath); err != nil {
+			return nil, fmt.Errorf("extends: %w", err)
+		}
+		if baseCfg, err = r.load(basePath); err != nil {
+			return nil, fmt.Errorf("extends: %w", err)
+		}
+	}
+
+	base, err := r.resolve(baseCfg, basePath, ext.Service)
+	if err != nil {
+		if ext.File != "" {
+			return nil, fmt.Errorf("extends %s: %w", ext.File, err)
+		}
+		return nil, fmt.Errorf("extends: %w", err)
+	}
+
+	inheritsDir := svc.WorkingDir == ""
+	merged := mergeService(base, svc)
+	if ext.File != "" && inheritsDir && merged.WorkingDir != "" && !filepath.IsAbs(merged.WorkingDir) {
+		// Keep an inherited working directory relative to the file that set it
+		merged.WorkingDir = filepath.Join(filepath.Dir(basePath), merged.WorkingDir)
+	}
+	*svc = merged
+	return svc, nil
+}
+
+// load decodes a config file referenced by `extends`. Base files are not
+// validated as a whole, so they may hold fragments that are not runnable
+// on their own.
+func (r *extendsResolver) load(path string) (*Config, error) {
+	if cfg, ok := r.files[path]; ok {
+		return cfg, nil
+	}
+	cfg, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r.files[path] = cfg
+	return cfg, nil
+}
+
+// mergeService returns local with unset fields taken from base. Environment
+// variables are merged, with local values taking precedence. Dependencies
+// are not inherited, as they refer to services of the base's config.
+func mergeService(base, local *Service) Service {
+	merged := *local
+	merged.Extends = nil
+
+	if merged.External == "" && merged.Command == "" {
+		merged.External = base.External
+	}
+	if merged.Command == "" && merged.Args == nil && merged.External == "" {
+		merged.Command = base.Command
+		merged.Args = base.Args
+	}
+	if merged.Prepare == "" {
+		merged.Prepare = base.Prepare
+	}
+	if merged.WorkingDir == "" {
+		merged.WorkingDir = base.WorkingDir
+	}
+	if merged.Restart == "" {
+		merged.Restart = base.Restart
+	}
+	if merged.MaxRetries == 0 {
+		merged.MaxRetries = base.MaxRetries
+	}
+	if merged.Replicas == 0 {
+		merged.Replicas = base.Replicas
+	}
+	if merged.StopMode == "" {
+		merged.StopMode = base.StopMode
+	}
+	if merged.AttachStdin == "" {
+		merged.AttachStdin = base.AttachStdin
+	}
+	if merged.Ports == nil {
+		merged.Ports = base.Ports
+	}
+	merged.LoginShell = local.LoginShell || base.LoginShell
+	if merged.Umask == "" {
+		merged.Umask = base.Umask
+	}
+	if merged.Isolate == nil {
+		merged.Isolate = base.Isolate
+	}
+	if merged.Requires == nil {
+		merged.Requires = base.Requires
+	}
+	if merged.MemLimit == "" {
+		merged.MemLimit = base.MemLimit
+	}
+	if merged.Logging == nil {
+		merged.Logging = base.Logging
+	}
+	if merged.LogFile == "" {
+		merged.LogFile = base.LogFile
+	}
+	// A healthcheck and a ready log pattern are alternatives, so neither
+	// is inherited by a service that sets one of them
+	if merged.Healthcheck == nil && merged.ReadyLogPattern == "" {
+		if base.Healthcheck != nil {
+			hc := *base.Healthcheck
+			merged.Healthcheck = &hc
+		}
+		merged.ReadyLogPattern = base.ReadyLogPattern
+	}
+	if len(base.Env) > 0 {
+		env := maps.Clone(base.Env)
+		maps.Copy(env, local.Env)
+		merged.Env = env
+	}
+	return merged
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file under dir, creating parent directories.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_ExtendsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "shared/comproc.base.yaml", `
+services:
+  api:
+    command: go run ./cmd/api
+    working_dir: ./api
+    restart: on-failure
+    env:
+      PORT: "8080"
+      LOG_LEVEL: info
+    depends_on: [db]
+    healthcheck:
+      command: curl -f localhost:8080/health
+`)
+	path := writeFile(t, dir, "app/comproc.yaml", `
+services:
+  api:
+    extends:
+      file: ../shared/comproc.base.yaml
+      service: api
+    env:
+      LOG_LEVEL: debug
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api := cfg.Services["api"]
+	if api.Extends != nil {
+		t.Error("expected extends to be resolved")
+	}
+	if api.Command != "go run ./cmd/api" || api.Restart != RestartOnFailure {
+		t.Errorf("expected fields from base, got %+v", api)
+	}
+	if api.Env["PORT"] != "8080" || api.Env["LOG_LEVEL"] != "debug" {
+		t.Errorf("expected merged env, got %v", api.Env)
+	}
+	if want := filepath.Join(dir, "shared", "api"); api.WorkingDir != want {
+		t.Errorf("expected working dir %q, got %q", want, api.WorkingDir)
+	}
+	if api.Healthcheck == nil || api.Healthcheck.Command != "curl -f localhost:8080/health" {
+		t.Errorf("expected healthcheck from base, got %+v", api.Healthcheck)
+	}
+	if len(api.DependsOn) != 0 {
+		t.Errorf("expected dependencies not to be inherited, got %v", api.DependsOn)
+	}
+}
+
+func TestLoad_ExtendsSameFileChain(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "comproc.yaml", `
+services:
+  base:
+    command: node server.js
+    working_dir: ./web
+    stop_mode: leader
+    umask: "0002"
+  web:
+    extends: {service: base}
+    env:
+      PORT: "3000"
+  admin:
+    extends: {service: web}
+    command: node admin.js
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	admin := cfg.Services["admin"]
+	if admin.Command != "node admin.js" || admin.StopMode != StopModeLeader || admin.Umask != "0002" || admin.Env["PORT"] != "3000" {
+		t.Errorf("unexpected admin service: %+v", admin)
+	}
+	if admin.WorkingDir != "./web" {
+		t.Errorf("expected working dir from the same file to stay relative, got %q", admin.WorkingDir)
+	}
+	if want := []string{"base", "web", "admin"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Errorf("expected service order %v, got %v", want, cfg.ServiceNames())
+	}
+}
+
+func TestLoad_ExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "missing service",
+			config: `
+services:
+  api:
+    extends: {file: base.yaml}`,
+			wantErr: "extends: service is required",
+		},
+		{
+			name: "unknown service",
+			config: `
+services:
+  api:
+    extends: {file: base.yaml, service: web}`,
+			wantErr: `extends base.yaml: unknown service: "web"`,
+		},
+		{
+			name: "missing file",
+			config: `
+services:
+  api:
+    extends: {file: missing.yaml, service: api}`,
+			wantErr: "failed to read config file",
+		},
+		{
+			name: "circular",
+			config: `
+services:
+  a:
+    extends: {service: b}
+  b:
+    extends: {service: a}`,
+			wantErr: "circular reference",
+		},
+		{
+			name: "base without command",
+			config: `
+services:
+  api:
+    extends: {file: base.yaml, service: empty}`,
+			wantErr: "command is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "base.yaml", `
+services:
+  empty:
+    env: {A: "1"}
+`)
+			_, err := Load(writeFile(t, dir, "comproc.yaml", tt.config))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
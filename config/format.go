@@ -0,0 +1,198 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the syntax of a config file.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// DefaultFileNames lists the config file names looked up in a project
+// directory, in order of preference.
+var DefaultFileNames = []string{"comproc.yaml", "comproc.yml", "comproc.toml", "comproc.json"}
+
+// FindDefault returns the path of the first default config file that exists
+// in dir. If none exists, the path of the first candidate is returned so that
+// the resulting "not found" error mentions the conventional name.
+func FindDefault(dir string) string {
+	for _, name := range DefaultFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, DefaultFileNames[0])
+}
+
+// FormatFromPath returns the format implied by the file extension.
+// Unknown extensions are treated as YAML.
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// ParseFormat parses configuration data in the given format.
+// JSON and TOML documents are converted to a YAML node tree first, so all
+// formats share the same field names, decoding rules, and validation.
+// Files referenced by `extends` are resolved relative to the current directory.
+func ParseFormat(data []byte, format Format) (*Config, error) {
+	cfg, err := decodeFormat(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return finish(cfg, "")
+}
+
+// decodeFormat decodes configuration data in the given format without
+// validating it.
+func decodeFormat(data []byte, format Format) (*Config, error) {
+	node, err := parseNode(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNode(node)
+}
+
+// parseNode parses configuration data in the given format into a YAML node
+// tree.
+func parseNode(data []byte, format Format) (*yaml.Node, error) {
+	var node *yaml.Node
+	switch format {
+	case FormatYAML:
+		node = &yaml.Node{}
+		if err := yaml.Unmarshal(data, node); err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+	case FormatJSON:
+		// JSON is a subset of YAML, so the YAML parser preserves key order.
+		// Validate first to reject YAML-only syntax in .json files.
+		if !json.Valid(data) {
+			var v any
+			err := json.Unmarshal(data, &v)
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+		node = &yaml.Node{}
+		if err := yaml.Unmarshal(data, node); err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+	case FormatTOML:
+		var err error
+		node, err = tomlToNode(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %q", format)
+	}
+	return node, nil
+}
+
+// tomlToNode decodes a TOML document into a YAML mapping node, keeping keys
+// in the order they appear in the document.
+func tomlToNode(data []byte) (*yaml.Node, error) {
+	var raw map[string]any
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make(map[string]int)
+	for i, key := range md.Keys() {
+		order[strings.Join(key, "\x00")] = i
+	}
+
+	return valueToNode(raw, nil, order)
+}
+
+// valueToNode converts a decoded TOML value to a YAML node.
+// path is the key path of the value, used to look up key order.
+func valueToNode(v any, path []string, order map[string]int) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		pos := func(k string) int {
+			if i, ok := order[strings.Join(append(slices.Clip(path), k), "\x00")]; ok {
+				return i
+			}
+			return len(order)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			if pi, pj := pos(keys[i]), pos(keys[j]); pi != pj {
+				return pi < pj
+			}
+			return keys[i] < keys[j]
+		})
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, k := range keys {
+			child, err := valueToNode(v[k], append(slices.Clip(path), k), order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalarNode("!!str", k), child)
+		}
+		return node, nil
+	case []map[string]any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := valueToNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := valueToNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case string:
+		return scalarNode("!!str", v), nil
+	case int64:
+		return scalarNode("!!int", strconv.FormatInt(v, 10)), nil
+	case float64:
+		return scalarNode("!!float", strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case bool:
+		return scalarNode("!!bool", strconv.FormatBool(v)), nil
+	case time.Time:
+		return scalarNode("!!str", v.Format(time.RFC3339Nano)), nil
+	default:
+		return nil, fmt.Errorf("unsupported TOML value type %T", v)
+	}
+}
+
+func scalarNode(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFormat_JSON(t *testing.T) {
+	data := `{
+  "services": {
+    "web": {"command": "npm run dev", "depends_on": ["api"]},
+    "api": {"command": "go run ./cmd/api", "env": {"PORT": "8080"}, "restart": "always"}
+  }
+}`
+
+	cfg, err := ParseFormat([]byte(data), FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := cfg.ServiceNames()
+	if len(names) != 2 || names[0] != "web" || names[1] != "api" {
+		t.Errorf("expected service order [web api], got %v", names)
+	}
+	api := cfg.Services["api"]
+	if api.Env["PORT"] != "8080" || api.Restart != RestartAlways {
+		t.Errorf("unexpected api service: %+v", api)
+	}
+}
+
+func TestParseFormat_JSONRejectsYAML(t *testing.T) {
+	data := `
+services:
+  api:
+    command: go run ./cmd/api
+`
+
+	if _, err := ParseFormat([]byte(data), FormatJSON); err == nil {
+		t.Error("expected error for YAML content in JSON format")
+	}
+}
+
+func TestParseFormat_TOML(t *testing.T) {
+	data := `
+[services.web]
+command = ["npm", "run", "dev"]
+depends_on = ["api"]
+
+[services.api]
+command = "go run ./cmd/api"
+restart = "on-failure"
+
+[services.api.env]
+PORT = "8080"
+
+[[services.api.logging]]
+driver = "file"
+path = "api.log"
+`
+
+	cfg, err := ParseFormat([]byte(data), FormatTOML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := cfg.ServiceNames()
+	if len(names) != 2 || names[0] != "web" || names[1] != "api" {
+		t.Errorf("expected service order [web api], got %v", names)
+	}
+
+	api := cfg.Services["api"]
+	if api.Name != "api" || api.Command != "go run ./cmd/api" {
+		t.Errorf("unexpected api service: %+v", api)
+	}
+	if api.Env["PORT"] != "8080" {
+		t.Errorf("expected env PORT='8080', got %q", api.Env["PORT"])
+	}
+	if api.Restart != RestartOnFailure {
+		t.Errorf("expected restart 'on-failure', got %q", api.Restart)
+	}
+	if len(api.Logging) != 1 || api.Logging[0].Path != "api.log" {
+		t.Errorf("unexpected logging: %+v", api.Logging)
+	}
+	if web := cfg.Services["web"]; len(web.DependsOn) != 1 || web.DependsOn[0].Service != "api" {
+		t.Errorf("expected web depends_on [api], got %v", web.DependsOn)
+	}
+	if web := cfg.Services["web"]; len(web.Args) != 3 || web.Command != "npm run dev" {
+		t.Errorf("expected an exec-form command for web, got %q (%q)", web.Args, web.Command)
+	}
+}
+
+func TestParseFormat_TOMLValidation(t *testing.T) {
+	data := `
+[services.api]
+working_dir = "./backend"
+`
+
+	if _, err := ParseFormat([]byte(data), FormatTOML); err == nil {
+		t.Error("expected validation error for missing command")
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Format
+	}{
+		{"comproc.yaml", FormatYAML},
+		{"comproc.yml", FormatYAML},
+		{"/a/b/comproc.json", FormatJSON},
+		{"comproc.TOML", FormatTOML},
+		{"comproc", FormatYAML},
+	}
+
+	for _, tt := range tests {
+		if got := FormatFromPath(tt.path); got != tt.expected {
+			t.Errorf("FormatFromPath(%q) = %q, want %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestLoad_DispatchesOnExtension(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "comproc.toml")
+	if err := os.WriteFile(path, []byte("[services.api]\ncommand = \"echo hi\"\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Services["api"].Command != "echo hi" {
+		t.Errorf("unexpected command: %q", cfg.Services["api"].Command)
+	}
+}
+
+func TestFindDefault(t *testing.T) {
+	dir := t.TempDir()
+
+	if got := FindDefault(dir); got != filepath.Join(dir, "comproc.yaml") {
+		t.Errorf("expected comproc.yaml fallback, got %s", got)
+	}
+
+	jsonPath := filepath.Join(dir, "comproc.json")
+	if err := os.WriteFile(jsonPath, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if got := FindDefault(dir); got != jsonPath {
+		t.Errorf("expected %s, got %s", jsonPath, got)
+	}
+}
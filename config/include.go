@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// resolveIncludes adds the services of the files listed in `include` of cfg,
+// which was read from path, before its own services. Included files are
+// resolved relative to the directory of path, or the current directory if
+// path is empty, and may include other files themselves.
+func resolveIncludes(cfg *Config, path string) error {
+	return includeFiles(cfg, path, map[string]bool{path: true})
+}
+
+// includeFiles resolves the includes of cfg. including holds the files
+// being included, to detect cycles.
+func includeFiles(cfg *Config, path string, including map[string]bool) error {
+	if len(cfg.Include) == 0 {
+		return nil
+	}
+
+	var order []string
+	services := make(map[string]*Service)
+	for _, include := range cfg.Include {
+		incPath := include
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(filepath.Dir(path), incPath)
+		}
+		incPath, err := filepath.Abs(incPath)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+		if including[incPath] {
+			return fmt.Errorf("include %s: circular reference", include)
+		}
+
+		inc, err := decodeFile(incPath)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+		including[incPath] = true
+		err = includeFiles(inc, incPath, including)
+		delete(including, incPath)
+		if err == nil {
+			err = resolveExtends(inc, incPath)
+		}
+		if err != nil {
+			return fmt.Errorf("include %s: %w", include, err)
+		}
+
+		for _, name := range inc.ServiceOrder {
+			if _, ok := services[name]; ok {
+				return fmt.Errorf("include %s: service %q is already defined by another included file", include, name)
+			}
+			if _, ok := cfg.Services[name]; ok {
+				return fmt.Errorf("include %s: service %q is already defined", include, name)
+			}
+			svc := inc.Services[name]
+			if svc == nil {
+				return fmt.Errorf("include %s: service %q is empty", include, name)
+			}
+			// Services run in the directory of the file that defines them
+			switch {
+			case svc.WorkingDir == "":
+				svc.WorkingDir = filepath.Dir(incPath)
+			case !filepath.IsAbs(svc.WorkingDir):
+				svc.WorkingDir = filepath.Join(filepath.Dir(incPath), svc.WorkingDir)
+			}
+			services[name] = svc
+			order = append(order, name)
+		}
+	}
+	if cfg.Services == nil {
+		cfg.Services = make(map[string]*Service)
+	}
+	for name, svc := range services {
+		cfg.Services[name] = svc
+	}
+	cfg.ServiceOrder = append(order, slices.Clone(cfg.ServiceOrder)...)
+	cfg.Include = nil
+	return nil
+}
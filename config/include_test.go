@@ -0,0 +1,90 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoad_Include(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "comproc.yaml", `
+include:
+  - services/api/comproc.yaml
+  - services/web/comproc.yaml
+services:
+  proxy:
+    command: ./proxy
+    depends_on: [api, web]
+`)
+	writeFile(t, dir, "services/api/comproc.yaml", `
+include:
+  - ../db/comproc.yaml
+services:
+  api:
+    command: ./api
+    depends_on: [db]
+`)
+	writeFile(t, dir, "services/db/comproc.yaml", `
+services:
+  db:
+    command: postgres
+    working_dir: data
+`)
+	writeFile(t, dir, "services/web/comproc.yaml", `
+services:
+  web-base:
+    command: npm start
+  web:
+    extends:
+      service: web-base
+    working_dir: /srv/web
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"db", "api", "web-base", "web", "proxy"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Errorf("expected included services before the file's own, got %v", cfg.ServiceNames())
+	}
+	for name, want := range map[string]string{
+		"db":    filepath.Join(dir, "services/db/data"),
+		"api":   filepath.Join(dir, "services/api"),
+		"web":   "/srv/web",
+		"proxy": "",
+	} {
+		if got := cfg.Services[name].WorkingDir; got != want {
+			t.Errorf("%s: expected working_dir %q, got %q", name, want, got)
+		}
+	}
+	if cfg.Services["web"].Command != "npm start" {
+		t.Errorf("expected extends to be resolved in the included file, got %q", cfg.Services["web"].Command)
+	}
+}
+
+func TestLoad_IncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "api.yaml", "services:\n  api:\n    command: ./api\n")
+	writeFile(t, dir, "api2.yaml", "services:\n  api:\n    command: ./api2\n")
+	writeFile(t, dir, "loop.yaml", "include: [comproc.yaml]\nservices:\n  a:\n    command: a\n")
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing", "include: [missing.yaml]\nservices:\n  app:\n    command: app\n", "include missing.yaml: failed to read config file"},
+		{"duplicate", "include: [api.yaml]\nservices:\n  api:\n    command: app\n", `include api.yaml: service "api" is already defined`},
+		{"duplicate include", "include: [api.yaml, api2.yaml]\n", `service "api" is already defined by another included file`},
+		{"circular", "include: [loop.yaml]\nservices:\n  app:\n    command: app\n", "include comproc.yaml: circular reference"},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, dir, "comproc.yaml", tt.content)
+		_, err := Load(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
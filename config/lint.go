@@ -0,0 +1,242 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ryym/comproc/internal/suggest"
+)
+
+// LintWarning is a problem found by Lint in a valid configuration.
+type LintWarning struct {
+	Path    string // Location in the config, e.g. "services.api.env.TOKEN"
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return w.Path + ": " + w.Message
+}
+
+// longRunningWords are words in commands that usually start servers or
+// watchers, which are expected to keep running.
+var longRunningWords = []string{"serve", "server", "dev", "start", "watch", "daemon", "listen", "worker"}
+
+// secretNameWords are parts of environment variable names that hold
+// credentials.
+var secretNameWords = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "API_KEY", "APIKEY", "PRIVATE_KEY", "ACCESS_KEY", "CREDENTIAL"}
+
+// secretValuePattern matches well-known formats of credentials.
+var secretValuePattern = regexp.MustCompile(`^(sk_live_|sk-|ghp_|github_pat_|xox[abpr]-|AKIA[0-9A-Z]{16}$|-----BEGIN )`)
+
+// Lint loads a configuration file and checks it for practices that are
+// valid but likely to cause trouble. Invalid configurations return an
+// error like Load. Warnings are ordered by service in config order.
+func Lint(path string) ([]LintWarning, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute config path: %w", err)
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	node, err := parseNode(data, FormatFromPath(absPath))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep services as written in this file, as extends fills in fields
+	// from other files that are checked when those files are linted
+	written := make(map[string]Service, len(cfg.Services))
+	for name, svc := range cfg.Services {
+		written[name] = *svc
+	}
+	if cfg, err = finish(cfg, absPath); err != nil {
+		return nil, err
+	}
+
+	warnings := unusedKeys(node)
+	dependents := make(map[string]bool)
+	for _, svc := range cfg.Services {
+		for _, dep := range svc.DependencyNames() {
+			dependents[dep] = true
+		}
+	}
+	for _, name := range cfg.ServiceNames() {
+		svc := cfg.Services[name]
+		raw := written[name]
+		prefix := "services." + name
+
+		if svc.Restart == "" && !svc.IsExternal() && (dependents[name] || svc.HasReadinessCheck() || len(svc.Ports) > 0 || looksLongRunning(svc.Command)) {
+			warnings = append(warnings, LintWarning{prefix, "no restart policy for a long-running service; it stays down after a crash (set restart: on-failure)"})
+		}
+		if filepath.IsAbs(raw.WorkingDir) {
+			warnings = append(warnings, LintWarning{prefix + ".working_dir", fmt.Sprintf("absolute path %s may not exist on other machines; use a path relative to the config file", raw.WorkingDir)})
+		}
+		for _, key := range slices.Sorted(maps.Keys(raw.Env)) {
+			if looksSecret(key, raw.Env[key]) {
+				warnings = append(warnings, LintWarning{prefix + ".env." + key, "value looks like a secret; pass it through the environment comproc runs in instead of committing it"})
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// unusedKeys returns warnings for top-level keys of a config document that
+// comproc doesn't use. Keys starting with "x-" are left alone, as they are
+// commonly used to hold YAML anchors.
+func unusedKeys(node *yaml.Node) []LintWarning {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var known []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name != "" && name != "-" {
+			known = append(known, name)
+		}
+	}
+
+	var warnings []LintWarning
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		key := node.Content[i].Value
+		if slices.Contains(known, key) || strings.HasPrefix(key, "x-") {
+			continue
+		}
+		msg := "unknown key, ignored by comproc"
+		if s := suggest.Closest(key, known); s != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", s)
+		}
+		warnings = append(warnings, LintWarning{key, msg})
+	}
+	return warnings
+}
+
+// looksLongRunning reports whether a command appears to start a server or
+// watcher.
+func looksLongRunning(command string) bool {
+	words := strings.FieldsFunc(strings.ToLower(command), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, w := range words {
+		if slices.Contains(longRunningWords, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksSecret reports whether an environment variable appears to hold a
+// credential, by its name or by the format of its value. Short values are
+// taken as local defaults such as "postgres".
+func looksSecret(key, value string) bool {
+	if secretValuePattern.MatchString(value) {
+		return true
+	}
+	if len(value) < 12 || strings.ContainsAny(value, " $") {
+		return false
+	}
+	return secretName(key)
+}
+
+// secretName reports whether the name of an environment variable suggests
+// that it holds a credential.
+func secretName(key string) bool {
+	name := strings.ToUpper(key)
+	for _, w := range secretNameWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretMask replaces credentials in values masked by MaskSecrets.
+const SecretMask = "********"
+
+// MaskSecrets returns a copy of env in which the values that appear to hold
+// credentials are replaced by SecretMask, and so are the passwords of URLs.
+// Unlike Lint, it goes by the name regardless of the value, as showing a
+// local default is not worth the risk of showing a credential.
+func MaskSecrets(env map[string]string) map[string]string {
+	masked := make(map[string]string, len(env))
+	for key, value := range env {
+		switch {
+		case value == "":
+			masked[key] = value
+		case secretName(key) || secretValuePattern.MatchString(value):
+			masked[key] = SecretMask
+		default:
+			masked[key] = MaskURL(value)
+		}
+	}
+	return masked
+}
+
+// secretQueryNames are names of query parameters that hold credentials,
+// besides those matching secretNameWords.
+var secretQueryNames = []string{"KEY", "AUTH", "SIG", "SIGNATURE"}
+
+// MaskURL returns value with the credentials of a URL replaced by
+// SecretMask: the password of its user info, or the user name if there is
+// no password, as tokens are often passed that way, and the values of query
+// parameters whose names suggest credentials, such as ?token=. Values other
+// than URLs are returned as is.
+func MaskURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return value
+	}
+	if user := u.User; user != nil {
+		// Add the mask after formatting, which would escape it
+		mask := SecretMask
+		if _, ok := user.Password(); ok {
+			mask = url.User(user.Username()).String() + ":" + SecretMask
+		}
+		u.User = nil
+		value = u.Scheme + "://" + mask + "@" + strings.TrimPrefix(u.String(), u.Scheme+"://")
+	}
+
+	base, query, ok := strings.Cut(value, "?")
+	if !ok {
+		return value
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, ok := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if ok && err == nil && secretQueryName(name) {
+			params[i] = key + "=" + SecretMask
+		}
+	}
+	value = base + "?" + strings.Join(params, "&")
+	if hasFragment {
+		value += "#" + fragment
+	}
+	return value
+}
+
+// secretQueryName reports whether the name of a query parameter suggests
+// that it holds a credential.
+func secretQueryName(name string) bool {
+	name = strings.ReplaceAll(name, "-", "_")
+	return secretName(name) || slices.Contains(secretQueryNames, strings.ToUpper(name))
+}
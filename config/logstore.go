@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the on-disk log store.
+const (
+	DefaultLogSegmentSize int64 = 8 << 20
+	DefaultLogMaxSize     int64 = 256 << 20
+)
+
+// LogStore configures an on-disk store of the services' log history, which
+// lets `logs` go further back than the lines kept in memory.
+type LogStore struct {
+	Dir         string `yaml:"dir"`          // Directory of the store, relative to the config file (default: next to the socket)
+	SegmentSize string `yaml:"segment_size"` // Size at which a new segment file is started (default: 8MiB)
+	MaxSize     string `yaml:"max_size"`     // Size of the history kept per service (default: 256MiB)
+}
+
+// Validate checks the log store configuration.
+func (s *LogStore) Validate() error {
+	segment, err := parseSizeOr(s.SegmentSize, DefaultLogSegmentSize)
+	if err != nil {
+		return fmt.Errorf("segment_size: %w", err)
+	}
+	max, err := parseSizeOr(s.MaxSize, DefaultLogMaxSize)
+	if err != nil {
+		return fmt.Errorf("max_size: %w", err)
+	}
+	if max < segment {
+		return errors.New("max_size must not be smaller than segment_size")
+	}
+	return nil
+}
+
+// GetSegmentSize returns the effective segment size in bytes.
+func (s *LogStore) GetSegmentSize() int64 {
+	size, err := parseSizeOr(s.SegmentSize, DefaultLogSegmentSize)
+	if err != nil {
+		return DefaultLogSegmentSize
+	}
+	return size
+}
+
+// GetMaxSize returns the effective size limit per service in bytes.
+func (s *LogStore) GetMaxSize() int64 {
+	size, err := parseSizeOr(s.MaxSize, DefaultLogMaxSize)
+	if err != nil {
+		return DefaultLogMaxSize
+	}
+	return size
+}
+
+// ResolveDir returns the store directory, resolved relative to the
+// directory of configPath, or "" if no directory is configured.
+func (s *LogStore) ResolveDir(configPath string) string {
+	if s == nil || s.Dir == "" {
+		return ""
+	}
+	if filepath.IsAbs(s.Dir) {
+		return s.Dir
+	}
+	return filepath.Join(filepath.Dir(configPath), s.Dir)
+}
+
+func parseSizeOr(size string, def int64) (int64, error) {
+	if size == "" {
+		return def, nil
+	}
+	return ParseSize(size)
+}
+
+// sizeUnits maps size suffixes to their multipliers. Units are powers of
+// 1024 with or without the "i", as with memory limits in other tools.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+}
+
+// ParseSize parses a positive byte size such as "512", "64KB", or "8MiB".
+func ParseSize(size string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes such as 512, 64KB, or 8MiB", size)
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// overlayNamePattern matches valid overlay names, which become part of a
+// file name.
+var overlayNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateOverlayName checks that name can select an overlay file.
+func ValidateOverlayName(name string) error {
+	if !overlayNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid env %q: expected letters, digits, '-', and '_'", name)
+	}
+	return nil
+}
+
+// OverlayPath returns the path of the overlay file named name for the config
+// file at path: comproc.yaml with "staging" is comproc.staging.yaml.
+func OverlayPath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// LoadOverlay reads the config file at path with the overlay file named name
+// (see OverlayPath) merged onto it. If name is empty, it is the same as Load.
+//
+// Services of the overlay are merged field by field onto the base services
+// of the same name, as with `extends`, and other services are added. The
+// overlay's top-level settings replace those of the base, except `name` and
+// `socket`, which identify the project and its daemon.
+func LoadOverlay(path, name string) (*Config, error) {
+	return LoadOverrides(path, nil, name)
+}
+
+// LoadOverrides reads the config file at path like LoadOverlay, and then
+// merges the override files onto it in order, the same way as the overlay,
+// so that later files take precedence. Files referenced by `extends` are
+// resolved relative to the file that references them, but working
+// directories are relative to the config file at path, as if the services
+// had been defined there.
+func LoadOverrides(path string, overrides []string, name string) (*Config, error) {
+	return LoadScaled(path, overrides, name, nil)
+}
+
+// LoadScaled reads the config file at path like LoadOverrides, with the
+// replicas of the services in replicas, by name, set to the given counts
+// (see `comproc scale`).
+func LoadScaled(path string, overrides []string, name string, replicas map[string]int) (*Config, error) {
+	if name == "" && len(overrides) == 0 && len(replicas) == 0 {
+		return Load(path)
+	}
+	if name != "" {
+		if err := ValidateOverlayName(name); err != nil {
+			return nil, err
+		}
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute config path: %w", err)
+	}
+
+	base, err := decodeFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveIncludes(base, absPath); err != nil {
+		return nil, err
+	}
+	if err := resolveExtends(base, absPath); err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		if err := mergeFile(base, OverlayPath(absPath, name)); err != nil {
+			return nil, fmt.Errorf("env %q: %w", name, err)
+		}
+	}
+	for _, override := range overrides {
+		overridePath, err := filepath.Abs(override)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute config path: %w", err)
+		}
+		if err := mergeFile(base, overridePath); err != nil {
+			return nil, fmt.Errorf("%s: %w", override, err)
+		}
+	}
+	for svc, count := range replicas {
+		s, ok := base.Services[svc]
+		if !ok {
+			return nil, fmt.Errorf("service not found: %s", svc)
+		}
+		s.Replicas = count
+	}
+	return validate(base)
+}
+
+// mergeFile reads the config file at path and merges it onto base as an
+// overlay.
+func mergeFile(base *Config, path string) error {
+	overlay, err := decodeFile(path)
+	if err != nil {
+		return err
+	}
+	if err := resolveIncludes(overlay, path); err != nil {
+		return err
+	}
+	if err := resolveExtends(overlay, path); err != nil {
+		return err
+	}
+	return applyOverlay(base, overlay)
+}
+
+// applyOverlay merges the decoded overlay config onto base in place.
+func applyOverlay(base, overlay *Config) error {
+	if overlay.Name != "" && overlay.Name != base.Name {
+		return errors.New("name can't be changed by an overlay")
+	}
+	if overlay.Socket != nil {
+		return errors.New("socket can't be changed by an overlay")
+	}
+
+	if base.Services == nil && len(overlay.Services) > 0 {
+		base.Services = make(map[string]*Service)
+	}
+	for _, name := range overlay.ServiceOrder {
+		svc := overlay.Services[name]
+		if orig, ok := base.Services[name]; ok {
+			merged := mergeService(orig, svc)
+			if merged.DependsOn == nil {
+				merged.DependsOn = orig.DependsOn
+			}
+			*orig = merged
+			continue
+		}
+		base.Services[name] = svc
+		base.ServiceOrder = append(base.ServiceOrder, name)
+	}
+
+	base.Plugins = append(base.Plugins, overlay.Plugins...)
+	if overlay.PortBase != 0 {
+		base.PortBase = overlay.PortBase
+	}
+	if overlay.PortStep != 0 {
+		base.PortStep = overlay.PortStep
+	}
+	if overlay.LogStore != nil {
+		base.LogStore = overlay.LogStore
+	}
+	if overlay.GracefulTimeout != 0 {
+		base.GracefulTimeout = overlay.GracefulTimeout
+	}
+	if overlay.LogMemoryLimit != "" {
+		base.LogMemoryLimit = overlay.LogMemoryLimit
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverlayPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/src/comproc.yaml", "/src/comproc.staging.yaml"},
+		{"/src/dev.toml", "/src/dev.staging.toml"},
+		{"/src/comproc", "/src/comproc.staging"},
+	}
+	for _, tt := range tests {
+		if got := OverlayPath(tt.path, "staging"); got != tt.want {
+			t.Errorf("OverlayPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "comproc.yaml", `
+graceful_timeout: 5s
+services:
+  db:
+    command: postgres
+  api:
+    command: ./api
+    restart: on-failure
+    env:
+      LOG_LEVEL: debug
+      DATABASE_URL: postgres://localhost/app
+    depends_on: [db]
+`)
+	writeFile(t, dir, "comproc.staging.yaml", `
+graceful_timeout: 30s
+services:
+  api:
+    env:
+      DATABASE_URL: postgres://staging/app
+  worker:
+    command: ./worker
+`)
+
+	cfg, err := LoadOverlay(path, "staging")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api := cfg.Services["api"]
+	if api.Command != "./api" || api.Restart != RestartOnFailure {
+		t.Errorf("expected fields from the base config, got %+v", api)
+	}
+	if api.Env["LOG_LEVEL"] != "debug" || api.Env["DATABASE_URL"] != "postgres://staging/app" {
+		t.Errorf("expected env merged with the overlay winning, got %v", api.Env)
+	}
+	if !slices.Equal(api.DependencyNames(), []string{"db"}) {
+		t.Errorf("expected depends_on to be kept, got %v", api.DependencyNames())
+	}
+	if !slices.Equal(cfg.ServiceNames(), []string{"db", "api", "worker"}) {
+		t.Errorf("expected the overlay's service after the base's, got %v", cfg.ServiceNames())
+	}
+	if cfg.GetGracefulTimeout() != 30*time.Second {
+		t.Errorf("expected graceful_timeout from the overlay, got %s", cfg.GetGracefulTimeout())
+	}
+
+	// Without a name, the overlay is not read
+	cfg, err = LoadOverlay(path, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cfg.Services["worker"]; ok {
+		t.Error("expected no overlay without a name")
+	}
+}
+
+func TestLoadOverlay_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "comproc.yaml", `
+name: app
+services:
+  api:
+    command: ./api
+`)
+	writeFile(t, dir, "comproc.renamed.yaml", "name: other\n")
+	writeFile(t, dir, "comproc.socket.yaml", "socket:\n  path: /tmp/other.sock\n")
+	writeFile(t, dir, "comproc.invalid.yaml", "services:\n  api:\n    restart: sometimes\n")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"missing", `env "missing": failed to read config file`},
+		{"renamed", "name can't be changed"},
+		{"socket", "socket can't be changed"},
+		{"invalid", "invalid restart policy"},
+		{"../comproc", "invalid env"},
+	}
+	for _, tt := range tests {
+		_, err := LoadOverlay(path, tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "comproc.yaml", `
+services:
+  api:
+    command: ./api
+    env:
+      LOG_LEVEL: info
+      PORT: "8080"
+`)
+	writeFile(t, dir, "comproc.staging.yaml", `
+services:
+  api:
+    env:
+      LOG_LEVEL: warn
+`)
+	team := writeFile(t, dir, "team.yaml", `
+services:
+  api:
+    env:
+      LOG_LEVEL: debug
+      PORT: "9090"
+  worker:
+    command: ./worker
+`)
+	personal := writeFile(t, dir, "personal/override.yaml", `
+services:
+  api:
+    env:
+      PORT: "3000"
+`)
+
+	// Override files are merged after the overlay, later ones winning
+	cfg, err := LoadOverrides(path, []string{team, personal}, "staging")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api := cfg.Services["api"]
+	if api.Command != "./api" || api.Env["LOG_LEVEL"] != "debug" || api.Env["PORT"] != "3000" {
+		t.Errorf("expected later files to win, got %+v", api)
+	}
+	if !slices.Equal(cfg.ServiceNames(), []string{"api", "worker"}) {
+		t.Errorf("expected the override's service after the base's, got %v", cfg.ServiceNames())
+	}
+
+	_, err = LoadOverrides(path, []string{filepath.Join(dir, "missing.yaml")}, "")
+	if err == nil || !strings.Contains(err.Error(), "missing.yaml: failed to read config file") {
+		t.Errorf("expected an error naming the missing file, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+)
+
+// expandReplicas replaces each service with replicas by that many copies of
+// it, named <name>-1, <name>-2, and so on, at its position in the service
+// order. Dependencies on such a service become dependencies on all of its
+// replicas.
+func (c *Config) expandReplicas() error {
+	replicas := make(map[string][]string)
+	for _, name := range c.ServiceOrder {
+		svc := c.Services[name]
+		if svc.Replicas == 0 {
+			continue
+		}
+		if svc.Replicas < 0 {
+			return fmt.Errorf("service %q: replicas must not be negative", name)
+		}
+		if svc.IsExternal() {
+			return fmt.Errorf("service %q: replicas can't be set on an external service", name)
+		}
+		for _, port := range svc.Ports {
+			if port != PortAuto {
+				return fmt.Errorf("service %q: replicas can't share the fixed port %s; use auto", name, port)
+			}
+		}
+		for i := 1; i <= svc.Replicas; i++ {
+			replica := fmt.Sprintf("%s-%d", name, i)
+			if _, ok := c.Services[replica]; ok {
+				return fmt.Errorf("service %q: replica %s has the name of another service", name, replica)
+			}
+			replicas[name] = append(replicas[name], replica)
+		}
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+
+	var order []string
+	for _, name := range c.ServiceOrder {
+		names, ok := replicas[name]
+		if !ok {
+			order = append(order, name)
+			continue
+		}
+		svc := c.Services[name]
+		delete(c.Services, name)
+		for i, replica := range names {
+			r := *svc
+			r.Name = replica
+			r.Replicas = 0
+			r.Replica = i + 1
+			r.ReplicaOf = name
+			r.Env = maps.Clone(svc.Env)
+			c.Services[replica] = &r
+		}
+		order = append(order, names...)
+	}
+	c.ServiceOrder = order
+
+	// Each service gets its own list, as the replicas of a service would
+	// share one otherwise
+	for _, svc := range c.Services {
+		var deps []Dependency
+		for _, dep := range svc.DependsOn {
+			names, ok := replicas[dep.Service]
+			if !ok {
+				deps = append(deps, dep)
+				continue
+			}
+			for _, replica := range names {
+				dep.Service = replica
+				deps = append(deps, dep)
+			}
+		}
+		svc.DependsOn = deps
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse_Replicas(t *testing.T) {
+	cfg, err := Parse([]byte(`
+port_base: 5000
+services:
+  db:
+    command: postgres
+  web:
+    command: ./web
+    replicas: 2
+    env:
+      LOG_LEVEL: debug
+    depends_on: [db]
+  proxy:
+    command: ./proxy
+    depends_on: [web]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"db", "web-1", "web-2", "proxy"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Fatalf("expected services %v, got %v", want, cfg.ServiceNames())
+	}
+	if _, ok := cfg.Services["web"]; ok {
+		t.Error("expected web to be replaced by its replicas")
+	}
+	for i, name := range []string{"web-1", "web-2"} {
+		svc := cfg.Services[name]
+		if svc.Name != name || svc.Replica != i+1 || svc.ReplicaOf != "web" || svc.Replicas != 0 {
+			t.Errorf("unexpected replica %s: %+v", name, svc)
+		}
+		if svc.Command != "./web" || svc.Env["LOG_LEVEL"] != "debug" || !slices.Equal(svc.DependencyNames(), []string{"db"}) {
+			t.Errorf("expected %s to be a copy of web, got %+v", name, svc)
+		}
+		if want := 5000 + (i+1)*100; svc.Port != want {
+			t.Errorf("expected %s to get port %d, got %d", name, want, svc.Port)
+		}
+	}
+	if got := cfg.Services["proxy"].DependencyNames(); !slices.Equal(got, []string{"web-1", "web-2"}) {
+		t.Errorf("expected proxy to depend on the replicas, got %v", got)
+	}
+	if env := cfg.Services["proxy"].DependencyEnv; env["WEB_2_PORT"] != "5200" {
+		t.Errorf("expected the address of web-2, got %v", env)
+	}
+
+	// The replicas don't share maps or lists
+	cfg.Services["web-1"].Env["LOG_LEVEL"] = "info"
+	cfg.Services["web-1"].DependsOn[0].Service = "other"
+	if svc := cfg.Services["web-2"]; svc.Env["LOG_LEVEL"] != "debug" || svc.DependsOn[0].Service != "db" {
+		t.Errorf("expected web-2 to be unchanged, got %+v", svc)
+	}
+}
+
+func TestParse_ReplicasErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "negative",
+			config:  "services:\n  web:\n    command: ./web\n    replicas: -1\n",
+			wantErr: "replicas must not be negative",
+		},
+		{
+			name:    "external",
+			config:  "services:\n  db:\n    external: localhost:5432\n    replicas: 2\n",
+			wantErr: "replicas can't be set on an external service",
+		},
+		{
+			name:    "fixed port",
+			config:  "services:\n  web:\n    command: ./web\n    replicas: 2\n    ports: [auto, 9000]\n",
+			wantErr: "replicas can't share the fixed port 9000",
+		},
+		{
+			name:    "name clash",
+			config:  "services:\n  web:\n    command: ./web\n    replicas: 2\n  web-2:\n    command: ./other\n",
+			wantErr: "replica web-2 has the name of another service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q error, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadScaled(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "comproc.yaml", `
+services:
+  web:
+    command: ./web
+    replicas: 2
+  worker:
+    command: ./worker
+`)
+
+	cfg, err := LoadScaled(path, nil, "", map[string]int{"web": 3, "worker": 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"web-1", "web-2", "web-3", "worker-1", "worker-2"}; !slices.Equal(cfg.ServiceNames(), want) {
+		t.Errorf("expected services %v, got %v", want, cfg.ServiceNames())
+	}
+
+	_, err = LoadScaled(path, nil, "", map[string]int{"api": 2})
+	if err == nil || !strings.Contains(err.Error(), "service not found: api") {
+		t.Errorf("expected an error for an unknown service, got: %v", err)
+	}
+}
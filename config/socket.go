@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultSocketMode is the file mode of the daemon socket, which only lets
+// the user who started the daemon connect.
+const DefaultSocketMode os.FileMode = 0600
+
+// Socket configures the Unix socket the daemon listens on.
+type Socket struct {
+	Path  string `yaml:"path"`  // Socket file, relative to the config file (default: derived from the config path)
+	Mode  string `yaml:"mode"`  // Octal file mode (default: 0600)
+	Group string `yaml:"group"` // Group that owns the socket, by name or ID (default: the user's group)
+
+	// Listen is a TCP address, such as 127.0.0.1:7007, on which the daemon
+	// also accepts clients, e.g. from the host of a VM.
+	Listen string `yaml:"listen"`
+
+	// TokenFile is a file, relative to the config file, holding the token
+	// that clients must authenticate with on the listen address.
+	TokenFile string `yaml:"token_file"`
+
+	// TLS makes clients on the listen address connect with TLS.
+	TLS *SocketTLS `yaml:"tls"`
+
+	// ReadOnly is an additional socket, TCP listener, or both, that only
+	// allow requests that don't change anything, such as status and logs.
+	ReadOnly *Socket `yaml:"read_only"`
+}
+
+// SocketTLS is the certificate the daemon presents to TCP clients.
+type SocketTLS struct {
+	Cert string `yaml:"cert"` // PEM certificate file, relative to the config file
+	Key  string `yaml:"key"`  // PEM private key file, relative to the config file
+}
+
+// Validate checks the socket configuration.
+func (s *Socket) Validate() error {
+	if s.Mode != "" {
+		if _, err := parseSocketMode(s.Mode); err != nil {
+			return err
+		}
+	}
+	if s.Listen != "" {
+		if err := ValidateListenAddress(s.Listen); err != nil {
+			return err
+		}
+	}
+	if s.TLS != nil && (s.TLS.Cert == "" || s.TLS.Key == "") {
+		return errors.New("tls: cert and key are required")
+	}
+	if ro := s.ReadOnly; ro != nil {
+		if ro.Path == "" && ro.Listen == "" {
+			return errors.New("read_only: path or listen is required")
+		}
+		if ro.Listen != "" && ro.TokenFile == "" {
+			return errors.New("read_only: listen requires its own token_file")
+		}
+		if ro.ReadOnly != nil {
+			return errors.New("read_only: must not have its own read_only socket")
+		}
+		if err := ro.Validate(); err != nil {
+			return fmt.Errorf("read_only: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetMode returns the effective file mode of the socket.
+func (s *Socket) GetMode() os.FileMode {
+	if s == nil || s.Mode == "" {
+		return DefaultSocketMode
+	}
+	mode, err := parseSocketMode(s.Mode)
+	if err != nil {
+		return DefaultSocketMode
+	}
+	return mode
+}
+
+// GetListen returns the TCP address to listen on, or "" for none.
+func (s *Socket) GetListen() string {
+	if s == nil {
+		return ""
+	}
+	return s.Listen
+}
+
+// ResolvePath returns the socket path, resolved relative to the directory
+// of configPath, or "" if no path is configured.
+func (s *Socket) ResolvePath(configPath string) string {
+	if s == nil {
+		return ""
+	}
+	return resolveSocketFile(configPath, s.Path)
+}
+
+// ResolveTokenFile returns the token file, resolved relative to the
+// directory of configPath, or "" if none is configured.
+func (s *Socket) ResolveTokenFile(configPath string) string {
+	if s == nil {
+		return ""
+	}
+	return resolveSocketFile(configPath, s.TokenFile)
+}
+
+// GetTLS returns the TLS config with its files resolved relative to the
+// directory of configPath, or nil if TLS is not configured.
+func (s *Socket) GetTLS(configPath string) *SocketTLS {
+	if s == nil || s.TLS == nil {
+		return nil
+	}
+	return &SocketTLS{
+		Cert: resolveSocketFile(configPath, s.TLS.Cert),
+		Key:  resolveSocketFile(configPath, s.TLS.Key),
+	}
+}
+
+func resolveSocketFile(configPath, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(configPath), path)
+}
+
+// ValidateListenAddress checks that addr is a TCP address the daemon can
+// listen on: a host, which may be empty for all interfaces, and a port.
+func ValidateListenAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		var n int
+		n, err = strconv.Atoi(port)
+		if err == nil && (n < 1 || n > 65535) {
+			err = errors.New("port out of range")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: expected host:port, such as 127.0.0.1:7007", addr)
+	}
+	return nil
+}
+
+func parseSocketMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q: expected an octal number such as 0660", mode)
+	}
+	if m > 0777 {
+		return 0, fmt.Errorf("invalid mode %q: only permission bits are allowed", mode)
+	}
+	if m&0600 != 0600 {
+		return 0, errors.New("mode must allow the owner to read and write")
+	}
+	return os.FileMode(m), nil
+}
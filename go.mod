@@ -2,4 +2,7 @@ module github.com/ryym/comproc
 
 go 1.25.6
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/version"
+)
+
+// DebugBundleOptions configures the 'debug-bundle' command.
+type DebugBundleOptions struct {
+	// Output is the tarball to write. If empty, a file named after the
+	// current time is written to the current directory.
+	Output string
+	// Lines is the number of recent log lines included per service.
+	Lines int
+}
+
+// RunDebugBundle executes the 'debug-bundle' command — packages what is
+// needed to look into a problem into a tarball for bug reports: the
+// resolved config with secrets masked, the status and recent logs of the
+// services, the daemon's output, and the events file. What can't be
+// collected, such as the status without a running daemon, is left out.
+func RunDebugBundle(socketPath, configPath string, opts DebugBundleOptions) error {
+	now := time.Now()
+	name := "comproc-debug-" + now.Format("20060102-150405")
+	output := opts.Output
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	b := newBundle(file, name, now)
+
+	versions := fmt.Sprintf("Client: %s\n", version.String())
+	if cfg, err := loadConfig(configPath); err != nil {
+		b.add("config-error.txt", []byte(err.Error()+"\n"))
+	} else {
+		b.add("config.yaml", maskedConfig(cfg))
+	}
+
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, "Daemon is not running; the bundle has no status or logs")
+		versions += "Daemon: not running\n"
+	} else {
+		defer client.Close()
+		if daemonVersion, err := fetchDaemonVersion(client); err == nil {
+			versions += fmt.Sprintf("Daemon: %s\n", daemonVersion)
+		}
+		if err := addDaemonState(b, client, opts.Lines); err != nil {
+			b.close()
+			return err
+		}
+	}
+	b.add("version.txt", []byte(versions))
+
+	// The daemon's files are read directly, as they are kept after it exits
+	b.addFile("daemon.log", daemon.OutputPath(socketPath))
+	events := daemon.EventsPath(socketPath)
+	b.addFile("events.jsonl", events)
+	for i := 1; ; i++ {
+		if !b.addFile(fmt.Sprintf("events.jsonl.%d", i), fmt.Sprintf("%s.%d", events, i)) {
+			break
+		}
+	}
+
+	if err := b.close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	fmt.Printf("Wrote %s\n", output)
+	return nil
+}
+
+// addDaemonState adds the status of the services and their recent logs,
+// one file per service.
+func addDaemonState(b *bundle, client *Client, lines int) error {
+	status, err := client.Status()
+	if err != nil {
+		return fmt.Errorf("status failed: %w", err)
+	}
+	data, _ := json.MarshalIndent(status, "", "  ")
+	b.add("status.json", append(data, '\n'))
+
+	for _, svc := range status.Services {
+		if svc.External != "" {
+			continue
+		}
+		result, err := client.Logs([]string{svc.Name}, time.Time{}, lines, "", "", false)
+		if err != nil {
+			return fmt.Errorf("logs failed: %w", err)
+		}
+		var buf bytes.Buffer
+		for _, entry := range result.Lines {
+			fmt.Fprintf(&buf, "%s %-6s %s\n", entry.Timestamp, entry.Stream, entry.RawLine())
+		}
+		b.add("logs/"+svc.Name+".log", buf.Bytes())
+	}
+	return nil
+}
+
+// maskedConfig returns the resolved config as YAML, with the values of
+// environment variables that look like secrets masked and empty fields
+// left out.
+func maskedConfig(cfg *config.Config) []byte {
+	for _, svc := range cfg.Services {
+		svc.Env = config.MaskSecrets(svc.Env)
+		for i := range svc.Logging {
+			sink := &svc.Logging[i]
+			sink.URL = config.MaskURL(sink.URL)
+			sink.Options = config.MaskSecrets(sink.Options)
+		}
+	}
+	var node yaml.Node
+	if err := node.Encode(cfg); err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	pruneEmpty(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	return buf.Bytes()
+}
+
+// pruneEmpty removes the mapping entries of node whose values are unset,
+// such as "", 0, false, null, and empty lists, recursively. Environment
+// variables are kept as they are, as an empty value is a value.
+func pruneEmpty(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			pruneEmpty(child)
+		}
+		return
+	}
+	var content []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != "env" {
+			pruneEmpty(value)
+		}
+		if !isEmptyNode(value) {
+			content = append(content, key, value)
+		}
+	}
+	node.Content = content
+}
+
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.Value {
+		case "", "0", "0s", "false", "null":
+			return true
+		}
+		return false
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
+
+// bundle writes files into a gzipped tarball under a top-level directory.
+// The first error is kept and returned by close.
+type bundle struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+	dir  string
+	time time.Time
+	err  error
+}
+
+func newBundle(file *os.File, dir string, t time.Time) *bundle {
+	gz := gzip.NewWriter(file)
+	return &bundle{file: file, gz: gz, tw: tar.NewWriter(gz), dir: dir, time: t}
+}
+
+// add adds a file with the given contents.
+func (b *bundle) add(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+	hdr := &tar.Header{
+		Name:    path.Join(b.dir, name),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: b.time,
+	}
+	if b.err = b.tw.WriteHeader(hdr); b.err == nil {
+		_, b.err = b.tw.Write(data)
+	}
+}
+
+// addFile adds the contents of the file at src, if it exists, and reports
+// whether it did.
+func (b *bundle) addFile(name, src string) bool {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return false
+	}
+	b.add(name, data)
+	return true
+}
+
+func (b *bundle) close() error {
+	for _, c := range []interface{ Close() error }{b.tw, b.gz, b.file} {
+		if err := c.Close(); err != nil && b.err == nil {
+			b.err = err
+		}
+	}
+	if b.err != nil {
+		os.Remove(b.file.Name())
+	}
+	return b.err
+}
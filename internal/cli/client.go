@@ -3,52 +3,210 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ryym/comproc/internal/protocol"
 )
 
+// RequestTimeout is the default time a client waits for the daemon to answer
+// a request. Zero means no timeout. It is set from the global --timeout flag.
+var RequestTimeout = 60 * time.Second
+
+// Host is the TCP address of a daemon to connect to instead of the socket,
+// such as a daemon in a VM started with --listen. It is set from the global
+// --host flag.
+var Host string
+
+// Token is sent to a daemon reached through Host to authenticate. It is set
+// from the global --token flag.
+var Token string
+
+// TLS makes the client connect to Host with TLS, verifying the daemon's
+// certificate against the system's CAs, or the CA certificates in the PEM
+// file TLSCA if it is set, which implies TLS. They are set from the global
+// --tls and --tls-ca flags.
+var (
+	TLS   bool
+	TLSCA string
+)
+
+// ErrDaemonShutdown is returned when the daemon announces that it is
+// shutting down instead of answering.
+var ErrDaemonShutdown = errors.New("daemon is shutting down")
+
 // Client communicates with the comproc daemon.
 type Client struct {
 	socketPath string
+	configPath string
+	timeout    time.Duration
 	conn       net.Conn
 	reader     *bufio.Reader
 	encoder    *json.Encoder
+	streams    *protocol.StreamMux
 	nextID     atomic.Int32
+	authOnce   sync.Once
+	authErr    error
 }
 
 // NewClient creates a new client.
 func NewClient(socketPath string) *Client {
 	return &Client{
 		socketPath: socketPath,
+		timeout:    RequestTimeout,
+	}
+}
+
+// SetTimeout sets how long the client waits for the daemon to connect and
+// answer each request. Zero means no timeout. Streamed notifications that
+// follow a response (logs, attach) are not subject to the timeout.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetConfigPath sets the absolute config path of the client's project.
+// It is sent with service-related requests so that a daemon hosting several
+// projects interprets service names relative to this project. A daemon
+// reached through Host gets no path, as it names a file on this machine, so
+// requests apply to its primary project.
+func (c *Client) SetConfigPath(path string) {
+	if Host == "" {
+		c.configPath = path
 	}
 }
 
-// Connect connects to the daemon.
+// Connect connects to the daemon, over TCP if Host is set, in which case it
+// also uses TLS as configured. The TLS handshake and authentication with
+// Token happen with the first request, so that their failures are reported
+// as errors of the request rather than as the daemon not running.
 func (c *Client) Connect() error {
-	conn, err := net.Dial("unix", c.socketPath)
+	conn, err := dialDaemon(c.socketPath, c.timeout)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
+	if Host != "" && (TLS || TLSCA != "") {
+		tlsConfig, err := clientTLSConfig()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
 	c.conn = conn
 	c.reader = bufio.NewReader(conn)
 	c.encoder = json.NewEncoder(conn)
+	c.streams = protocol.NewStreamMux(conn, true, nil)
 	return nil
 }
 
+// clientTLSConfig returns the TLS config to connect to Host with.
+func clientTLSConfig() (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(Host)
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if TLSCA != "" {
+		data, err := os.ReadFile(TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no CA certificates found in %s", TLSCA)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// authenticate sends Token to a daemon reached through Host, once before
+// anything else is sent.
+func (c *Client) authenticate() error {
+	c.authOnce.Do(func() {
+		if Host == "" || Token == "" {
+			return
+		}
+		if _, err := c.call(protocol.MethodAuth, protocol.AuthParams{Token: Token}); err != nil {
+			c.authErr = fmt.Errorf("failed to authenticate: %w", err)
+		}
+	})
+	return c.authErr
+}
+
+// dialDaemon connects to the daemon at Host, or else at socketPath.
+func dialDaemon(socketPath string, timeout time.Duration) (net.Conn, error) {
+	if Host != "" {
+		return net.DialTimeout("tcp", Host, timeout)
+	}
+	return net.DialTimeout("unix", socketPath, timeout)
+}
+
+// DaemonReachable reports whether a daemon accepts connections at Host, or
+// else at socketPath. It doesn't check TLS or the token, which Connect
+// reports on.
+func DaemonReachable(socketPath string) bool {
+	conn, err := dialDaemon(socketPath, 100*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
 // Close closes the connection.
 func (c *Client) Close() error {
 	if c.conn != nil {
+		c.streams.Close()
 		return c.conn.Close()
 	}
 	return nil
 }
 
-// Call sends a request and waits for a response.
+// Call sends a request and waits for a response, giving up after the
+// client's timeout.
 func (c *Client) Call(method string, params any) (*protocol.Response, error) {
+	return c.CallContext(context.Background(), method, params)
+}
+
+// CallContext is like Call but also gives up when ctx is done.
+func (c *Client) CallContext(ctx context.Context, method string, params any) (*protocol.Response, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// Interrupt blocking reads and writes when the context is done
+	defer c.conn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	var resp *protocol.Response
+	err := c.authenticate()
+	if err == nil {
+		resp, err = c.call(method, params)
+	}
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if c.timeout > 0 {
+				return nil, DaemonErrorf("timed out after %s waiting for the daemon to respond to %q", c.timeout, method)
+			}
+			return nil, DaemonErrorf("timed out waiting for the daemon to respond to %q", method)
+		}
+		return nil, ctx.Err()
+	}
+	return resp, err
+}
+
+func (c *Client) call(method string, params any) (*protocol.Response, error) {
 	id := int(c.nextID.Add(1))
 	req, err := protocol.NewRequest(method, params, id)
 	if err != nil {
@@ -59,7 +217,7 @@ func (c *Client) Call(method string, params any) (*protocol.Response, error) {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	line, err := c.reader.ReadBytes('\n')
+	line, err := c.readLine()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
@@ -68,6 +226,9 @@ func (c *Client) Call(method string, params any) (*protocol.Response, error) {
 	if err := json.Unmarshal(line, &resp); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	if isShutdownNotification(line) {
+		return nil, ErrDaemonShutdown
+	}
 
 	if resp.Error != nil {
 		return nil, resp.Error
@@ -76,9 +237,10 @@ func (c *Client) Call(method string, params any) (*protocol.Response, error) {
 	return &resp, nil
 }
 
-// ReadNotification reads a notification from the connection.
+// ReadNotification reads a notification from the connection. It returns
+// ErrDaemonShutdown when the daemon announces that it is shutting down.
 func (c *Client) ReadNotification() (*protocol.Request, error) {
-	line, err := c.reader.ReadBytes('\n')
+	line, err := c.readLine()
 	if err != nil {
 		return nil, err
 	}
@@ -87,13 +249,76 @@ func (c *Client) ReadNotification() (*protocol.Request, error) {
 	if err := json.Unmarshal(line, &req); err != nil {
 		return nil, fmt.Errorf("failed to parse notification: %w", err)
 	}
+	if req.Method == protocol.MethodShutdown {
+		return nil, ErrDaemonShutdown
+	}
 
 	return &req, nil
 }
 
+// readLine reads the next line from the connection, passing stream
+// notifications that come first on to the client's streams.
+func (c *Client) readLine() ([]byte, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !c.handleStream(line) {
+			return line, nil
+		}
+	}
+}
+
+// handleStream passes line on to the client's streams if it is a stream
+// notification, and reports whether it was.
+func (c *Client) handleStream(line []byte) bool {
+	var req protocol.Request
+	return json.Unmarshal(line, &req) == nil && c.streams.Handle(&req)
+}
+
+// OpenStream opens a stream of the given kind on the connection. The data
+// the daemon sends on it arrives while the client reads responses or waits
+// for the stream with WaitStream.
+func (c *Client) OpenStream(kind string, params any) (*protocol.Stream, error) {
+	if err := c.authenticate(); err != nil {
+		return nil, err
+	}
+	st, err := c.streams.Open(kind, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	return st, nil
+}
+
+// WaitStream reads from the connection until the daemon closes its
+// direction of st, and returns the error it closed it with, if any.
+// Unlike requests, waiting for a stream is not subject to the timeout.
+func (c *Client) WaitStream(st *protocol.Stream) error {
+	for !st.Done() {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+		if isShutdownNotification(line) {
+			return ErrDaemonShutdown
+		}
+		c.handleStream(line)
+	}
+	return st.Err()
+}
+
+// isShutdownNotification reports whether a line read in place of a response
+// is the daemon's "shutdown" notification.
+func isShutdownNotification(line []byte) bool {
+	var req protocol.Request
+	return json.Unmarshal(line, &req) == nil && req.ID == nil && req.Method == protocol.MethodShutdown
+}
+
 // Up starts services.
-func (c *Client) Up(services []string) (*protocol.UpResult, error) {
-	params := protocol.UpParams{Services: services}
+// If wait is true, the daemon responds only after the services are ready.
+func (c *Client) Up(services []string, wait, removeOrphans bool) (*protocol.UpResult, error) {
+	params := protocol.UpParams{Services: services, ConfigPath: c.configPath, Wait: wait, RemoveOrphans: removeOrphans, Env: Env, Overrides: Overrides}
 	resp, err := c.Call(protocol.MethodUp, params)
 	if err != nil {
 		return nil, err
@@ -106,6 +331,38 @@ func (c *Client) Up(services []string) (*protocol.UpResult, error) {
 	return &result, nil
 }
 
+// Reload makes the daemon load the config file again and apply the changes
+// to its services.
+func (c *Client) Reload() (*protocol.ReloadResult, error) {
+	params := protocol.ReloadParams{ConfigPath: c.configPath, Env: Env, Overrides: Overrides}
+	resp, err := c.Call(protocol.MethodReload, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.ReloadResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Scale sets the number of replicas of services, by their names in the
+// config file.
+func (c *Client) Scale(replicas map[string]int) (*protocol.ReloadResult, error) {
+	params := protocol.ScaleParams{Replicas: replicas, ConfigPath: c.configPath, Env: Env, Overrides: Overrides}
+	resp, err := c.Call(protocol.MethodScale, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.ReloadResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // Shutdown shuts down the daemon, stopping all services.
 func (c *Client) Shutdown() (*protocol.ShutdownResult, error) {
 	resp, err := c.Call(protocol.MethodShutdown, nil)
@@ -120,9 +377,81 @@ func (c *Client) Shutdown() (*protocol.ShutdownResult, error) {
 	return &result, nil
 }
 
+// Version returns the version of the daemon.
+func (c *Client) Version() (*protocol.VersionResult, error) {
+	resp, err := c.Call(protocol.MethodVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.VersionResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Ping checks that the daemon is responding.
+func (c *Client) Ping() (*protocol.PingResult, error) {
+	resp, err := c.Call(protocol.MethodPing, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.PingResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Stats returns information about the daemon process.
+func (c *Client) Stats() (*protocol.StatsResult, error) {
+	resp, err := c.Call(protocol.MethodStats, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.StatsResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// History returns the recorded runs of a service.
+func (c *Client) History(service string) (*protocol.HistoryResult, error) {
+	params := protocol.HistoryParams{Service: service, ConfigPath: c.configPath}
+	resp, err := c.Call(protocol.MethodHistory, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.HistoryResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Inspect returns a detailed view of a service.
+func (c *Client) Inspect(service string) (*protocol.InspectResult, error) {
+	params := protocol.InspectParams{Service: service, ConfigPath: c.configPath}
+	resp, err := c.Call(protocol.MethodInspect, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.InspectResult
+	if err := resp.ParseResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // Down stops services.
 func (c *Client) Down(services []string) (*protocol.DownResult, error) {
-	params := protocol.DownParams{Services: services}
+	params := protocol.DownParams{Services: services, ConfigPath: c.configPath}
 	resp, err := c.Call(protocol.MethodDown, params)
 	if err != nil {
 		return nil, err
@@ -149,9 +478,10 @@ func (c *Client) Status() (*protocol.StatusResult, error) {
 	return &result, nil
 }
 
-// Restart restarts services.
-func (c *Client) Restart(services []string) (*protocol.RestartResult, error) {
-	params := protocol.RestartParams{Services: services}
+// Restart restarts services. With rolling, they are restarted one at a
+// time, each after the previous one is ready.
+func (c *Client) Restart(services []string, rolling bool) (*protocol.RestartResult, error) {
+	params := protocol.RestartParams{Services: services, ConfigPath: c.configPath, Rolling: rolling}
 	resp, err := c.Call(protocol.MethodRestart, params)
 	if err != nil {
 		return nil, err
@@ -169,12 +499,20 @@ type LogsResult struct {
 	Lines []protocol.LogEntry `json:"lines"`
 }
 
-// Logs gets service logs.
-func (c *Client) Logs(services []string, lines int, follow bool) (*LogsResult, error) {
+// Logs gets service logs. A non-empty stream limits them to the lines of
+// "stdout" or "stderr".
+func (c *Client) Logs(services []string, since time.Time, lines int, stream, grep string, follow bool) (*LogsResult, error) {
 	params := protocol.LogsParams{
-		Services: services,
-		Lines:    lines,
-		Follow:   follow,
+		Services:   services,
+		Lines:      lines,
+		Stream:     stream,
+		Grep:       grep,
+		Follow:     follow,
+		ConfigPath: c.configPath,
+		Batch:      true,
+	}
+	if !since.IsZero() {
+		params.Since = since.Format(time.RFC3339Nano)
 	}
 	resp, err := c.Call(protocol.MethodLogs, params)
 	if err != nil {
@@ -188,9 +526,10 @@ func (c *Client) Logs(services []string, lines int, follow bool) (*LogsResult, e
 	return &result, nil
 }
 
-// Attach attaches to a service's stdin/stdout.
-func (c *Client) Attach(service string) (*protocol.AttachResult, error) {
-	params := protocol.AttachParams{Service: service}
+// Attach attaches to a service's stdin/stdout. A read-only client only
+// watches the output.
+func (c *Client) Attach(service string, readOnly bool) (*protocol.AttachResult, error) {
+	params := protocol.AttachParams{Service: service, ConfigPath: c.configPath, Batch: true, ReadOnly: readOnly}
 	resp, err := c.Call(protocol.MethodAttach, params)
 	if err != nil {
 		return nil, err
@@ -203,11 +542,99 @@ func (c *Client) Attach(service string) (*protocol.AttachResult, error) {
 	return &result, nil
 }
 
-// SendStdin sends stdin data to the daemon as a notification.
-func (c *Client) SendStdin(data string) error {
-	notification, err := protocol.NewNotification(protocol.MethodStdin, protocol.StdinData{Data: data})
-	if err != nil {
-		return err
+// OneOff is a command started by Run or Exec. Writing to it sends input to
+// the command, and closing it ends the input. Reading from it returns the
+// command's stdout, and from Stderr its stderr. The data arrives while the
+// client waits for the command with WaitStream, after which Result gives
+// the command's exit status as a protocol.RunExit.
+type OneOff struct {
+	*protocol.Stream
+	Stderr *protocol.Stream
+	resize *protocol.Stream // Only for a command in a pseudo-terminal
+}
+
+// Resize tells the daemon the new size of the terminal of a command started
+// by Exec with a terminal.
+func (o *OneOff) Resize(size protocol.TerminalSize) error {
+	if o.resize == nil {
+		return nil
+	}
+	return json.NewEncoder(o.resize).Encode(size)
+}
+
+// Run starts a one-off command in a service's environment.
+func (c *Client) Run(service string, command []string) (*OneOff, error) {
+	return c.startOneOff(protocol.StreamKindRun, protocol.ExecParams{
+		RunParams: protocol.RunParams{Service: service, Command: command, ConfigPath: c.configPath},
+	})
+}
+
+// Exec starts a command in a running service's environment, in a
+// pseudo-terminal of the given size unless tty is nil. The terminal's
+// output all arrives as stdout.
+func (c *Client) Exec(service string, command []string, tty *protocol.TerminalSize) (*OneOff, error) {
+	return c.startOneOff(protocol.StreamKindExec, protocol.ExecParams{
+		RunParams: protocol.RunParams{Service: service, Command: command, ConfigPath: c.configPath},
+		TTY:       tty,
+	})
+}
+
+// startOneOff opens the stream of a one-off command, after the streams its
+// params name.
+func (c *Client) startOneOff(kind string, params protocol.ExecParams) (*OneOff, error) {
+	var o OneOff
+	var err error
+	if params.TTY == nil {
+		if o.Stderr, err = c.OpenStream(protocol.StreamKindStderr, nil); err != nil {
+			return nil, err
+		}
+		// The daemon only sends data on it
+		o.Stderr.Close()
+		params.Stderr = o.Stderr.ID()
+	} else {
+		if o.resize, err = c.OpenStream(protocol.StreamKindResize, nil); err != nil {
+			return nil, err
+		}
+		params.Resize = o.resize.ID()
+	}
+
+	var raw any = params
+	if kind == protocol.StreamKindRun {
+		raw = params.RunParams
+	}
+	if o.Stream, err = c.OpenStream(kind, raw); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// logEntries returns the log entries carried by a "log" or "log_batch"
+// notification, or nil for other notifications.
+func logEntries(notification *protocol.Request) []protocol.LogEntry {
+	switch notification.Method {
+	case protocol.MethodLog:
+		var entry protocol.LogEntry
+		if err := notification.ParseParams(&entry); err != nil {
+			return nil
+		}
+		return []protocol.LogEntry{entry}
+	case protocol.MethodLogBatch:
+		var batch protocol.LogBatch
+		if err := notification.ParseParams(&batch); err != nil {
+			return nil
+		}
+		return batch.Entries
+	default:
+		return nil
+	}
+}
+
+// logDropped returns the report of a "log.dropped" notification, and false
+// for other notifications.
+func logDropped(notification *protocol.Request) (protocol.LogDropped, bool) {
+	var dropped protocol.LogDropped
+	if notification.Method != protocol.MethodLogDropped || notification.ParseParams(&dropped) != nil {
+		return dropped, false
 	}
-	return c.encoder.Encode(notification)
+	return dropped, true
 }
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// listenSilent starts a Unix socket server that accepts connections but
+// never responds, simulating a hung daemon.
+func listenSilent(t *testing.T) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "hung.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	return socketPath
+}
+
+func TestClient_Timeout(t *testing.T) {
+	client := NewClient(listenSilent(t))
+	client.SetTimeout(100 * time.Millisecond)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+	_, err := client.Status()
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("expected timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the call to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestClient_CallContextCanceled(t *testing.T) {
+	client := NewClient(listenSilent(t))
+	client.SetTimeout(0)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := client.CallContext(ctx, "status", nil)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestLogEntries(t *testing.T) {
+	single, _ := protocol.NewNotification(protocol.MethodLog, protocol.LogEntry{Service: "api", Line: "a"})
+	batch, _ := protocol.NewNotification(protocol.MethodLogBatch, protocol.LogBatch{
+		Entries: []protocol.LogEntry{{Service: "api", Line: "b"}, {Service: "db", Line: "c"}},
+	})
+	other, _ := protocol.NewNotification(protocol.MethodAttachState, protocol.AttachState{Clients: 1})
+
+	if entries := logEntries(single); len(entries) != 1 || entries[0].Line != "a" {
+		t.Errorf("expected single entry 'a', got %+v", entries)
+	}
+	if entries := logEntries(batch); len(entries) != 2 || entries[0].Line != "b" || entries[1].Service != "db" {
+		t.Errorf("expected batch entries, got %+v", entries)
+	}
+	if entries := logEntries(other); entries != nil {
+		t.Errorf("expected no entries for other notifications, got %+v", entries)
+	}
+}
+
+func TestClient_ShutdownNotification(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "comproc.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Answer the first request with the notice of a daemon going away
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadBytes('\n')
+		notification, _ := protocol.NewNotification(protocol.MethodShutdown, nil)
+		json.NewEncoder(conn).Encode(notification)
+	}()
+
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Status(); !errors.Is(err, ErrDaemonShutdown) {
+		t.Errorf("expected ErrDaemonShutdown, got: %v", err)
+	}
+}
@@ -1,51 +1,209 @@
 package cli
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"text/tabwriter"
+	"time"
 
-	"github.com/ryym/comproc/internal/config"
+	"github.com/ryym/comproc/config"
 	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/process"
 	"github.com/ryym/comproc/internal/protocol"
+	"github.com/ryym/comproc/internal/suggest"
+	"github.com/ryym/comproc/internal/version"
 )
 
 // RunUp executes the 'up' command — starts services and optionally follows logs.
-func RunUp(socketPath string, services []string, follow bool) error {
+func RunUp(socketPath, configPath string, services []string, opts UpOptions) error {
 	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
 	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to daemon: %w", err)
+		return DaemonErrorf("failed to connect to daemon: %w", err)
 	}
 	defer client.Close()
 
-	result, err := client.Up(services)
+	result, err := client.Up(services, opts.Wait, opts.RemoveOrphans)
 	if err != nil {
 		return fmt.Errorf("up failed: %w", err)
 	}
 
-	if len(result.Started) > 0 {
-		fmt.Printf("Started: %v\n", result.Started)
+	printResult(result, func() {
+		if len(result.Removed) > 0 {
+			fmt.Printf("Removed: %v\n", result.Removed)
+		}
+		if len(result.Started) > 0 {
+			fmt.Printf("Started: %v\n", result.Started)
+		}
+		if len(result.Failed) > 0 {
+			fmt.Printf("Failed: %v\n", result.Failed)
+			printStartErrors(result.Failed, result.Errors)
+		}
+		if len(result.NotReady) > 0 {
+			fmt.Printf("Not ready: %v\n", result.NotReady)
+		}
+	})
+
+	// Services that were waited for count as acted on, even if they were
+	// already running
+	total := len(result.Failed) + len(result.NotReady)
+	for _, name := range result.Started {
+		if !slices.Contains(result.NotReady, name) {
+			total++
+		}
 	}
 	if len(result.Failed) > 0 {
-		fmt.Printf("Failed: %v\n", result.Failed)
-		return fmt.Errorf("some services failed to start")
+		return failureError(append(result.Failed, result.NotReady...), total, "some services failed to start")
+	}
+	if len(result.NotReady) > 0 {
+		return failureError(result.NotReady, total, "some services did not become ready")
 	}
 
-	if follow {
-		return streamLogs(client, services, 100, true)
+	if opts.Follow {
+		return streamLogs(client, services, LogsOptions{Lines: 100, Follow: true})
 	}
 
 	return nil
 }
 
+// printStartErrors prints why each failed service failed to start, with
+// the lines of output that follow the reason indented below it.
+func printStartErrors(failed []string, errs map[string]string) {
+	for _, name := range failed {
+		msg, ok := errs[name]
+		if !ok {
+			continue
+		}
+		reason, output, _ := strings.Cut(msg, "\n")
+		fmt.Printf("  %s: %s\n", name, reason)
+		if output != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(output, "\n", "\n    "))
+		}
+	}
+}
+
+// UpOptions configures the 'up' command.
+type UpOptions struct {
+	// Follow streams logs after the services are started.
+	Follow bool
+	// Wait blocks until the services are ready.
+	Wait bool
+	// RemoveOrphans stops and removes services that are no longer in the
+	// config file.
+	RemoveOrphans bool
+}
+
+// ForegroundOptions configures 'up --no-daemon'.
+type ForegroundOptions struct {
+	// ExitCodeFrom names a service whose termination stops all services
+	// and whose exit code becomes the exit code of comproc.
+	ExitCodeFrom string
+
+	// GracefulTimeout overrides the config's graceful_timeout if positive.
+	GracefulTimeout time.Duration
+}
+
+// RunForeground executes 'up --no-daemon' — runs services inside the current
+// process without a socket or server, streaming logs until interrupted.
+// All services are stopped before returning.
+func RunForeground(configPath string, services []string, opts ForegroundOptions) error {
+	d, err := daemon.New(configPath, Overrides, Env)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if opts.GracefulTimeout > 0 {
+		d.SetGracefulTimeout(opts.GracefulTimeout)
+	}
+
+	if services, err = d.ScopeServices("", services, false); err != nil {
+		return err
+	}
+	if opts.ExitCodeFrom != "" {
+		if !slices.Contains(d.ServiceNames(), opts.ExitCodeFrom) {
+			return serviceNotFound(opts.ExitCodeFrom, d.ServiceNames())
+		}
+		if len(services) > 0 && !slices.Contains(services, opts.ExitCodeFrom) {
+			services = append(services, opts.ExitCodeFrom)
+		}
+	}
+
+	formatter := NewLogFormatter(os.Stdout, d.ServiceNames())
+
+	// Subscribe before starting so that early output is not missed
+	ch := d.SubscribeLogs(nil)
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for line := range ch {
+			if line.Stream == daemon.StreamDropped {
+				fmt.Fprintf(os.Stderr, "--- %d log lines dropped ---\n", line.Dropped)
+				continue
+			}
+			formatter.PrintLine(line.Service, line.Line)
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	started, failed, errs := d.StartServices(services)
+	if len(started) > 0 {
+		fmt.Printf("Started: %v\n", started)
+	}
+
+	var runErr error
+	if len(failed) > 0 {
+		fmt.Printf("Failed: %v\n", failed)
+		printStartErrors(failed, errs)
+		runErr = failureError(failed, len(started)+len(failed), "some services failed to start")
+	} else if opts.ExitCodeFrom != "" {
+		exited, exitCode, err := d.WaitExit(opts.ExitCodeFrom)
+		if err != nil {
+			runErr = err
+		} else {
+			select {
+			case <-sigCh:
+			case <-exited:
+				if code := exitCode(); code != 0 {
+					// Processes killed by a signal report -1
+					runErr = &ExitError{Code: max(code, 1)}
+				}
+			}
+		}
+	} else {
+		<-sigCh
+	}
+
+	stopped := d.StopServices(nil)
+	d.UnsubscribeLogs(ch)
+	<-printed
+
+	if len(stopped) > 0 {
+		fmt.Printf("Stopped: %v\n", stopped)
+	}
+
+	return runErr
+}
+
 // RunDown executes the 'down' command — stops all services and shuts down the daemon.
 func RunDown(socketPath string) error {
 	client := NewClient(socketPath)
 	if err := client.Connect(); err != nil {
 		// Daemon not running, nothing to do
+		printResult(protocol.ShutdownResult{}, func() {})
 		return nil
 	}
 	defer client.Close()
@@ -55,18 +213,21 @@ func RunDown(socketPath string) error {
 		return fmt.Errorf("down failed: %w", err)
 	}
 
-	if len(result.Stopped) > 0 {
-		fmt.Printf("Stopped: %v\n", result.Stopped)
-	}
+	printResult(result, func() {
+		if len(result.Stopped) > 0 {
+			fmt.Printf("Stopped: %v\n", result.Stopped)
+		}
+	})
 
 	return nil
 }
 
 // RunStop executes the 'stop' command — stops specified services without shutting down the daemon.
-func RunStop(socketPath string, services []string) error {
+func RunStop(socketPath, configPath string, services []string) error {
 	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
 	if err := client.Connect(); err != nil {
-		fmt.Println("No services running")
+		printResult(protocol.DownResult{}, func() { fmt.Println("No services running") })
 		return nil
 	}
 	defer client.Close()
@@ -76,18 +237,29 @@ func RunStop(socketPath string, services []string) error {
 		return fmt.Errorf("stop failed: %w", err)
 	}
 
-	if len(result.Stopped) > 0 {
-		fmt.Printf("Stopped: %v\n", result.Stopped)
-	}
+	printResult(result, func() {
+		if len(result.Stopped) > 0 {
+			fmt.Printf("Stopped: %v\n", result.Stopped)
+		}
+	})
 
 	return nil
 }
 
+// StatusOptions configures the 'status' command.
+type StatusOptions struct {
+	Wide bool // Also show each service's restart policy, working directory, and command
+	Tree bool // Show services as a tree, each below the dependency it starts after
+	// Format prints the raw status as "json" or "yaml" instead of a table
+	// if set (see FormatStatus).
+	Format string
+}
+
 // RunStatus executes the 'status' command.
-func RunStatus(socketPath, configPath string) error {
+func RunStatus(socketPath, configPath string, opts StatusOptions) error {
 	client := NewClient(socketPath)
 	if err := client.Connect(); err != nil {
-		return showOfflineStatus(configPath)
+		return showOfflineStatus(configPath, opts)
 	}
 	defer client.Close()
 
@@ -96,90 +268,354 @@ func RunStatus(socketPath, configPath string) error {
 		return fmt.Errorf("status failed: %w", err)
 	}
 
+	if opts.Format != "" && opts.Format != StatusFormatTable {
+		return FormatStatus(os.Stdout, *result, opts.Format)
+	}
 	if len(result.Services) == 0 {
 		fmt.Println("No services")
 		return nil
 	}
 
-	printStatusTable(result.Services)
+	printStatusTable(os.Stdout, result.Services, opts)
+	printStatusEnv(os.Stdout, result.Env)
 	return nil
 }
 
 // showOfflineStatus loads the config file and shows all services as stopped.
-func showOfflineStatus(configPath string) error {
-	cfg, err := config.Load(configPath)
+func showOfflineStatus(configPath string, opts StatusOptions) error {
+	structured := opts.Format != "" && opts.Format != StatusFormatTable
+	cfg, err := loadConfig(configPath)
 	if err != nil {
+		if structured {
+			return FormatStatus(os.Stdout, protocol.StatusResult{}, opts.Format)
+		}
 		fmt.Println("No services defined")
 		return nil
 	}
 
 	var services []protocol.ServiceStatus
 	for _, name := range cfg.ServiceNames() {
+		svc := cfg.Services[name]
 		services = append(services, protocol.ServiceStatus{
-			Name:  name,
-			State: "stopped",
+			Name:       name,
+			State:      "stopped",
+			External:   svc.External,
+			Command:    svc.Command,
+			WorkingDir: serviceWorkingDir(svc, configPath),
+			Restart:    string(svc.GetRestartPolicy()),
+			DependsOn:  svc.DependencyNames(),
 		})
 	}
 
-	printStatusTable(services)
+	if structured {
+		return FormatStatus(os.Stdout, protocol.StatusResult{Services: services, Env: Env}, opts.Format)
+	}
+	printStatusTable(os.Stdout, services, opts)
+	printStatusEnv(os.Stdout, Env)
 	return nil
 }
 
-func printStatusTable(services []protocol.ServiceStatus) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tSTATE\tPID\tRESTARTS\tSTARTED")
-	for _, svc := range services {
+// printStatusEnv prints the config overlay in use below the status table,
+// if any.
+func printStatusEnv(out io.Writer, env string) {
+	if env != "" {
+		fmt.Fprintf(out, "\nEnv: %s\n", env)
+	}
+}
+
+func printStatusTable(out io.Writer, services []protocol.ServiceStatus, opts StatusOptions) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "NAME\tSTATE\tPID\tRESTARTS\tSTARTED\tEXIT CODE\tEXITED\tCPU\tMEM"
+	if opts.Wide {
+		// COMMAND comes last as it is long and may contain spaces
+		header += "\tPOLICY\tPORTS\tWORKDIR\tCOMMAND"
+	}
+	fmt.Fprintln(w, header)
+	names := make([]string, len(services))
+	for i, svc := range services {
+		names[i] = svc.Name
+	}
+	if opts.Tree {
+		services, names = statusTree(services)
+	}
+	for i, svc := range services {
 		pid := "-"
-		if svc.PID > 0 {
+		if svc.External != "" {
+			pid = "external"
+		} else if svc.PID > 0 {
 			pid = fmt.Sprintf("%d", svc.PID)
 		}
 		started := "-"
 		if svc.StartedAt != "" {
 			started = svc.StartedAt
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", svc.Name, svc.State, pid, svc.Restarts, started)
+		exitCode, exited := displayExit(svc)
+		cpu, mem := displayUsage(svc)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s", names[i], displayState(svc), pid, svc.Restarts, started, exitCode, exited, cpu, mem)
+		if opts.Wide {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", orDash(svc.Restart), displayPorts(svc.Ports), orDash(svc.WorkingDir), displayCommand(svc))
+		}
+		fmt.Fprintln(w)
 	}
 	w.Flush()
 }
 
+// displayExit returns the exit code and exit time shown for a service that
+// is stopped, failed, or waiting to be restarted after running.
+func displayExit(svc protocol.ServiceStatus) (code, exited string) {
+	switch svc.State {
+	case string(process.StateStopped), string(process.StateFailed), daemon.StateRestarting:
+	default:
+		return "-", "-"
+	}
+	if svc.ExitedAt == "" {
+		return "-", "-"
+	}
+	return displayExitCode(svc.ExitCode, svc.Signal), svc.ExitedAt
+}
+
+// displayUsage returns the CPU and memory use shown for a running service
+// that the daemon has sampled, e.g. "1.5%" and "120.3 MiB".
+func displayUsage(svc protocol.ServiceStatus) (cpu, mem string) {
+	if svc.CPU == nil || svc.Memory == 0 {
+		return "-", "-"
+	}
+	return fmt.Sprintf("%.1f%%", *svc.CPU), formatBytes(int(svc.Memory))
+}
+
+// displayExitCode returns the exit code of a run, or the name of the signal
+// that killed it. Daemons that don't report signals give killed processes
+// an exit code of -1.
+func displayExitCode(code int, signal string) string {
+	if signal != "" {
+		return signal
+	}
+	if code < 0 {
+		return "signal"
+	}
+	return strconv.Itoa(code)
+}
+
+// displayCommand returns the command shown by `status --wide` on one line,
+// with the lines of multi-line commands separated by "; ". External
+// services show their address instead.
+func displayCommand(svc protocol.ServiceStatus) string {
+	if svc.External != "" {
+		return "external: " + svc.External
+	}
+	return orDash(strings.ReplaceAll(strings.TrimSpace(svc.Command), "\n", "; "))
+}
+
+// displayPorts returns the ports shown by `status --wide`, e.g. "8080,41234".
+func displayPorts(ports []int) string {
+	strs := make([]string, len(ports))
+	for i, port := range ports {
+		strs[i] = strconv.Itoa(port)
+	}
+	return orDash(strings.Join(strs, ","))
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// displayState returns the state shown in the status table. A running
+// service with a readiness check is shown as "ready" once the check passes,
+// and as "unhealthy" when it keeps failing. External services are shown as
+// "waiting" until their address is reachable, and "unreachable" when it
+// stays down. A service waiting to be restarted shows when it will be.
+func displayState(svc protocol.ServiceStatus) string {
+	if svc.State == daemon.StateRestarting {
+		return displayRestarting(svc, time.Now())
+	}
+	if svc.State != string(process.StateRunning) {
+		return svc.State
+	}
+	if svc.External != "" {
+		switch process.Health(svc.Health) {
+		case process.HealthHealthy:
+			return "ready"
+		case process.HealthUnhealthy:
+			return "unreachable"
+		default:
+			return "waiting"
+		}
+	}
+	switch process.Health(svc.Health) {
+	case process.HealthHealthy:
+		return "ready"
+	case process.HealthUnhealthy:
+		return string(process.HealthUnhealthy)
+	default:
+		return svc.State
+	}
+}
+
+// displayRestarting returns the state of a service waiting to be restarted,
+// e.g. "restarting(4s)". It is kept to one word like the other columns.
+func displayRestarting(svc protocol.ServiceStatus, now time.Time) string {
+	at, err := time.Parse(time.RFC3339Nano, svc.NextRestartAt)
+	if err != nil {
+		return svc.State
+	}
+	// Round up so that the last second shows as "in 1s" rather than "in 0s"
+	remaining := max(at.Sub(now), 0)
+	return fmt.Sprintf("%s(%s)", svc.State, (remaining + time.Second - 1).Truncate(time.Second))
+}
+
+// RestartOptions configures the 'restart' command.
+type RestartOptions struct {
+	// Rolling restarts services one at a time, each after the previous one
+	// is ready.
+	Rolling bool
+}
+
 // RunRestart executes the 'restart' command.
-func RunRestart(socketPath string, services []string) error {
+func RunRestart(socketPath, configPath string, services []string, opts RestartOptions) error {
 	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
 	if err := client.Connect(); err != nil {
-		fmt.Println("No services running")
+		printResult(protocol.RestartResult{}, func() { fmt.Println("No services running") })
 		return nil
 	}
 	defer client.Close()
 
-	result, err := client.Restart(services)
+	result, err := client.Restart(services, opts.Rolling)
 	if err != nil {
 		return fmt.Errorf("restart failed: %w", err)
 	}
 
-	if len(result.Restarted) > 0 {
-		fmt.Printf("Restarted: %v\n", result.Restarted)
-	}
+	printResult(result, func() {
+		if len(result.Restarted) > 0 {
+			fmt.Printf("Restarted: %v\n", result.Restarted)
+		}
+		if len(result.Failed) > 0 {
+			fmt.Printf("Failed: %v\n", result.Failed)
+		}
+		if len(result.Skipped) > 0 {
+			fmt.Printf("Skipped: %v\n", result.Skipped)
+		}
+	})
 	if len(result.Failed) > 0 {
-		fmt.Printf("Failed: %v\n", result.Failed)
-		return fmt.Errorf("some services failed to restart")
+		total := len(result.Restarted) + len(result.Failed) + len(result.Skipped)
+		return failureError(append(result.Failed, result.Skipped...), total, "some services failed to restart")
+	}
+
+	return nil
+}
+
+// RunReload executes the 'reload' command.
+func RunReload(socketPath, configPath string) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	result, err := client.Reload()
+	if err != nil {
+		return fmt.Errorf("reload failed: %w", err)
+	}
+	return printReloadResult(result)
+}
+
+// RunScale executes the 'scale' command, setting the number of replicas of
+// services by name.
+func RunScale(socketPath, configPath string, replicas map[string]int) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
 	}
+	defer client.Close()
 
+	result, err := client.Scale(replicas)
+	if err != nil {
+		return fmt.Errorf("scale failed: %w", err)
+	}
+	return printReloadResult(result)
+}
+
+// printReloadResult prints what applying the config file changed, and
+// returns an error if services failed to start.
+func printReloadResult(result *protocol.ReloadResult) error {
+	printResult(result, func() {
+		if len(result.Added)+len(result.Removed)+len(result.Changed) == 0 {
+			fmt.Println("No changes")
+		}
+		if len(result.Added) > 0 {
+			fmt.Printf("Added: %v\n", result.Added)
+		}
+		if len(result.Removed) > 0 {
+			fmt.Printf("Removed: %v\n", result.Removed)
+		}
+		if len(result.Changed) > 0 {
+			fmt.Printf("Changed: %v\n", result.Changed)
+		}
+		if len(result.Started) > 0 {
+			fmt.Printf("Started: %v\n", result.Started)
+		}
+		if len(result.Failed) > 0 {
+			fmt.Printf("Failed: %v\n", result.Failed)
+			printStartErrors(result.Failed, result.Errors)
+		}
+	})
+	if len(result.Failed) > 0 {
+		return failureError(result.Failed, len(result.Started)+len(result.Failed), "some services failed to start")
+	}
 	return nil
 }
 
+// LogsOptions configures the 'logs' command.
+type LogsOptions struct {
+	Lines  int  // Number of recent lines to show
+	Follow bool // Keep streaming new lines
+	Raw    bool // Print lines as the processes wrote them, without prefixes or colors
+	Dedup  bool // Collapse identical consecutive lines of a service
+	// Since limits lines to those written after a time, given as a duration
+	// before now ("2h") or an RFC 3339 time.
+	Since string
+	// Output is a file that also receives the lines, without colors. If it
+	// contains {service}, each service is written to its own file.
+	Output string
+	// Stream limits lines to "stdout" or "stderr" if set.
+	Stream string
+	// Grep limits lines to those matching a regular expression if set. The
+	// daemon applies it, so other lines never reach the client.
+	Grep string
+}
+
 // RunLogs executes the 'logs' command.
-func RunLogs(socketPath string, services []string, lines int, follow bool) error {
+func RunLogs(socketPath, configPath string, services []string, opts LogsOptions) error {
 	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
 	if err := client.Connect(); err != nil {
 		return nil
 	}
 	defer client.Close()
 
-	return streamLogs(client, services, lines, follow)
+	return streamLogs(client, services, opts)
+}
+
+// parseSince parses the value of `logs --since`: a duration before now or
+// an RFC 3339 time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a duration such as 2h or a time such as 2006-01-02T15:04:05Z", value)
 }
 
 // streamLogs fetches and displays logs, optionally following new output until interrupted.
-func streamLogs(client *Client, services []string, lines int, follow bool) error {
+func streamLogs(client *Client, services []string, opts LogsOptions) error {
 	// Get all service names for proper alignment
 	status, err := client.Status()
 	if err != nil {
@@ -190,17 +626,44 @@ func streamLogs(client *Client, services []string, lines int, follow bool) error
 		serviceNames = append(serviceNames, svc.Name)
 	}
 	formatter := NewLogFormatter(os.Stdout, serviceNames)
+	formatter.SetRaw(opts.Raw)
+	formatter.SetDedup(opts.Dedup)
+	defer formatter.Flush()
+
+	var files *logFiles
+	if opts.Output != "" {
+		if files, err = openLogFiles(opts.Output, serviceNames, opts.Raw); err != nil {
+			return err
+		}
+		defer files.Close()
+	}
+	printEntry := func(entry protocol.LogEntry) error {
+		formatter.PrintEntry(entry)
+		if files != nil {
+			return files.PrintEntry(entry)
+		}
+		return nil
+	}
 
-	result, err := client.Logs(services, lines, follow)
+	var since time.Time
+	if opts.Since != "" {
+		if since, err = parseSince(opts.Since, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	result, err := client.Logs(services, since, opts.Lines, opts.Stream, opts.Grep, opts.Follow)
 	if err != nil {
 		return fmt.Errorf("logs failed: %w", err)
 	}
 
 	for _, entry := range result.Lines {
-		formatter.PrintLine(entry.Service, entry.Line)
+		if err := printEntry(entry); err != nil {
+			return err
+		}
 	}
 
-	if !follow {
+	if !opts.Follow {
 		return nil
 	}
 
@@ -212,29 +675,233 @@ func streamLogs(client *Client, services []string, lines int, follow bool) error
 		client.Close()
 	}()
 
+	var dropped int
+	defer func() { printDroppedSummary(dropped) }()
 	for {
 		notification, err := client.ReadNotification()
 		if err != nil {
+			if errors.Is(err, ErrDaemonShutdown) {
+				fmt.Fprintln(os.Stderr, "Daemon shutting down")
+			}
 			return nil
 		}
 
-		if notification.Method == protocol.MethodLog {
-			var entry protocol.LogEntry
-			if err := notification.ParseParams(&entry); err == nil {
-				formatter.PrintLine(entry.Service, entry.Line)
+		if d, ok := logDropped(notification); ok {
+			formatter.Flush()
+			printDropped(d)
+			dropped = d.Total
+			continue
+		}
+		for _, entry := range logEntries(notification) {
+			if err := printEntry(entry); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// RunStdin executes the 'stdin' command — writes everything read from input
+// to a service's stdin, in order, then exits. Unlike attach, it does not
+// show the service's output. Input is sent over a stream, so a failure on
+// the daemon's side ends the command without waiting for the input to end.
+func RunStdin(socketPath, configPath, service string, input io.Reader) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	params := protocol.StdinParams{Service: service, ConfigPath: configPath}
+	st, err := client.OpenStream(protocol.StreamKindStdin, params)
+	if err != nil {
+		return fmt.Errorf("stdin failed: %w", err)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, protocol.StreamChunkSize)
+		for {
+			n, err := input.Read(buf)
+			if n > 0 {
+				if _, err := st.Write(buf[:n]); err != nil {
+					// WaitStream reports the broken connection
+					return
+				}
+			}
+			if err == io.EOF {
+				st.Close()
+				return
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to read input: %w", err)
+				readErr <- err
+				st.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	if err := client.WaitStream(st); err != nil {
+		select {
+		case err := <-readErr:
+			return err
+		default:
+		}
+		return fmt.Errorf("stdin failed: %w", err)
+	}
+	return nil
+}
+
+// RunRun executes the 'run' command — runs a one-off command in a service's
+// working directory and environment through the daemon, forwarding input
+// and output, and exits with the command's exit code. Interrupting it stops
+// the command.
+func RunRun(socketPath, configPath, service string, command []string) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	o, err := client.Run(service, command)
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+	return streamOneOff(client, o, "run")
+}
+
+// ExecOptions configures the 'exec' command.
+type ExecOptions struct {
+	NoTTY bool // Don't allocate a terminal even if stdin is one
+}
+
+// RunExec executes the 'exec' command. The command runs in a terminal of
+// its own when stdin is a terminal.
+func RunExec(socketPath, configPath, service string, command []string, opts ExecOptions) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	var tty *protocol.TerminalSize
+	if !opts.NoTTY {
+		tty, _ = terminalSize(os.Stdin)
+	}
+	o, err := client.Exec(service, command, tty)
+	if err != nil {
+		return fmt.Errorf("exec failed: %w", err)
+	}
+	if tty == nil {
+		return streamOneOff(client, o, "exec")
+	}
+
+	// Keys go to the command as they are typed, and Ctrl-C reaches it as
+	// input instead of interrupting comproc
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("exec failed: %w", err)
+	}
+	defer restore()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for range winch {
+			if size, err := terminalSize(os.Stdin); err == nil {
+				o.Resize(*size)
+			}
+		}
+	}()
+	return streamOneOff(client, o, "exec")
+}
+
+// streamOneOff forwards stdin to a command started by Run or Exec and
+// writes its output until it exits, returning an ExitError for a non-zero
+// exit status.
+func streamOneOff(client *Client, o *OneOff, name string) error {
+	go func() {
+		io.Copy(o, os.Stdin)
+		o.Close()
+	}()
+
+	var output sync.WaitGroup
+	output.Go(func() { io.Copy(os.Stdout, o) })
+	if o.Stderr != nil {
+		output.Go(func() { io.Copy(os.Stderr, o.Stderr) })
+	}
+
+	// Handle Ctrl-C by closing the connection, which makes the daemon stop
+	// the command
+	var interrupted atomic.Bool
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		<-sigCh
+		interrupted.Store(true)
+		client.Close()
+	}()
+
+	err := client.WaitStream(o.Stream)
+	if err != nil {
+		// Ends the output streams
+		client.Close()
+	}
+	output.Wait()
+	if err != nil {
+		if errors.Is(err, ErrDaemonShutdown) {
+			return fmt.Errorf("%s failed: the daemon shut down before the command exited", name)
+		}
+		if interrupted.Load() {
+			return &ExitError{Code: 130}
+		}
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	var exit protocol.RunExit
+	if err := o.Result(&exit); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	if exit.ExitCode != 0 {
+		return &ExitError{Code: exit.ExitCode}
+	}
+	return nil
+}
+
+// AttachOptions configures the 'attach' command.
+type AttachOptions struct {
+	ReadOnly bool // Watch the output without sending input
+	// Record is a file that receives a transcript of the session's input
+	// and output with timestamps.
+	Record string
+}
+
 // RunAttach executes the 'attach' command.
-func RunAttach(socketPath string, service string) error {
+func RunAttach(socketPath, configPath, service string, opts AttachOptions) (err error) {
 	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
 	if err := client.Connect(); err != nil {
-		return fmt.Errorf("daemon is not running")
+		return DaemonErrorf("daemon is not running")
 	}
 	defer client.Close()
 
+	var record *transcript
+	if opts.Record != "" {
+		if record, err = createTranscript(opts.Record); err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := record.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
 	// Get all service names for log formatting
 	status, err := client.Status()
 	if err != nil {
@@ -247,28 +914,35 @@ func RunAttach(socketPath string, service string) error {
 	formatter := NewLogFormatter(os.Stdout, serviceNames)
 
 	// Attach to the service
-	result, err := client.Attach(service)
+	result, err := client.Attach(service, opts.ReadOnly)
 	if err != nil {
 		return fmt.Errorf("attach failed: %w", err)
 	}
 
 	// Display initial logs
 	for _, entry := range result.Lines {
-		formatter.PrintLine(entry.Service, entry.Line)
+		formatter.PrintEntry(entry)
+	}
+	state := result.AttachState
+	if state.Clients > 1 {
+		printAttachState(service, state, opts.ReadOnly)
 	}
 
-	// Read stdin and send to daemon in a goroutine
+	// Send stdin to the daemon over a stream in a goroutine, detaching
+	// once it ends. A read-only client only detaches on Ctrl-C.
 	stdinDone := make(chan struct{})
-	go func() {
-		defer close(stdinDone)
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			line := scanner.Text() + "\n"
-			if err := client.SendStdin(line); err != nil {
-				return
-			}
+	if !opts.ReadOnly {
+		st, err := client.OpenStream(protocol.StreamKindAttach, nil)
+		if err != nil {
+			return fmt.Errorf("attach failed: %w", err)
 		}
-	}()
+		go func() {
+			defer close(stdinDone)
+			input := record.InputWriter()
+			defer input.Flush()
+			io.Copy(io.MultiWriter(st, input), os.Stdin)
+		}()
+	}
 
 	// Handle Ctrl-C by closing the connection to detach
 	sigCh := make(chan os.Signal, 1)
@@ -283,27 +957,175 @@ func RunAttach(socketPath string, service string) error {
 	}()
 
 	// Read log notifications from daemon
+	var dropped int
+	defer func() { printDroppedSummary(dropped) }()
 	for {
 		notification, err := client.ReadNotification()
 		if err != nil {
+			if errors.Is(err, ErrDaemonShutdown) {
+				fmt.Fprintln(os.Stderr, "Daemon shutting down")
+			}
 			return nil
 		}
 
-		if notification.Method == protocol.MethodLog {
-			var entry protocol.LogEntry
-			if err := notification.ParseParams(&entry); err == nil {
-				formatter.PrintLine(entry.Service, entry.Line)
+		if notification.Method == protocol.MethodAttachState {
+			var next protocol.AttachState
+			if err := notification.ParseParams(&next); err == nil && next != state {
+				state = next
+				printAttachState(service, state, opts.ReadOnly)
 			}
+			continue
+		}
+		if d, ok := logDropped(notification); ok {
+			formatter.Flush()
+			printDropped(d)
+			dropped = d.Total
+			continue
+		}
+		for _, entry := range logEntries(notification) {
+			formatter.PrintEntry(entry)
+			record.Output(entry)
 		}
 	}
 }
 
+// printDropped tells the user that the daemon dropped log lines because
+// this client didn't read them fast enough.
+func printDropped(dropped protocol.LogDropped) {
+	fmt.Fprintf(os.Stderr, "--- %d log lines dropped: this client fell behind ---\n", dropped.Count)
+}
+
+// printDroppedSummary tells the user on exit that the followed output was
+// incomplete, in case the notices scrolled away.
+func printDroppedSummary(total int) {
+	if total > 0 {
+		fmt.Fprintf(os.Stderr, "%d log lines were dropped while following; the output is incomplete\n", total)
+	}
+}
+
+// printAttachState tells the user how many clients are attached to the
+// service and whether their input reaches it.
+func printAttachState(service string, state protocol.AttachState, readOnly bool) {
+	clients := "1 client"
+	if state.Clients != 1 {
+		clients = fmt.Sprintf("%d clients", state.Clients)
+	}
+	switch {
+	case readOnly:
+		fmt.Fprintf(os.Stderr, "%s attached to %s (read-only)\n", clients, service)
+	case state.Stdin:
+		fmt.Fprintf(os.Stderr, "%s attached to %s; your input is sent\n", clients, service)
+	default:
+		fmt.Fprintf(os.Stderr, "%s attached to %s; your input is ignored while another client has stdin\n", clients, service)
+	}
+}
+
+// RunEnv executes the 'env' command — prints a service's resolved environment.
+// It reads the config file directly, so no daemon is required. The
+// variables the daemon sets when it starts the service, such as picked
+// ports, are added if the service has started in a running daemon;
+// otherwise a note on stderr says they are missing.
+func RunEnv(socketPath, configPath, service, format string) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return ConfigErrorf("failed to load config: %w", err)
+	}
+
+	svc, ok := cfg.Services[service]
+	if !ok {
+		return serviceNotFound(service, cfg.ServiceNames())
+	}
+
+	env := svc.ResolvedEnv()
+	runtime, reason := runtimeEnv(socketPath, configPath, service)
+	if runtime == nil {
+		fmt.Fprintf(os.Stderr, "note: %s, so variables set when it starts, such as COMPROC_SERVICE and auto ports, are not included\n", reason)
+	}
+	// The config file takes precedence, as for the service itself, and
+	// keeps secrets the daemon masks
+	for k, v := range runtime {
+		if _, ok := env[k]; !ok {
+			env[k] = v
+		}
+	}
+	return FormatEnv(os.Stdout, env, format)
+}
+
+// runtimeEnv returns the environment of a service's last start in the
+// daemon, or nil and the reason it is not available.
+func runtimeEnv(socketPath, configPath, service string) (map[string]string, string) {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return nil, "the daemon is not running"
+	}
+	defer client.Close()
+
+	result, err := client.Inspect(service)
+	if err != nil {
+		return nil, fmt.Sprintf("%s is not loaded in the daemon", service)
+	}
+	// Set along with the rest when the service starts
+	if _, ok := result.Env["COMPROC_SERVICE"]; !ok {
+		return nil, fmt.Sprintf("%s has not started", service)
+	}
+	return result.Env, ""
+}
+
+// RunLint prints warnings about practices in the config file that are
+// valid but likely to cause trouble, and exits with status 1 if there are
+// any.
+func RunLint(configPath string) error {
+	warnings, err := config.Lint(configPath)
+	if err != nil {
+		return ConfigErrorf("failed to load config: %w", err)
+	}
+	for _, w := range warnings {
+		fmt.Println(w)
+	}
+	if len(warnings) > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// serviceNotFound returns the error for an unknown service name, suggesting
+// a similar name from names if there is one.
+func serviceNotFound(name string, names []string) error {
+	err := fmt.Errorf("service not found: %s", name)
+	if s := suggest.Closest(name, names); s != "" {
+		err = fmt.Errorf("service not found: %s (did you mean %s?)", name, s)
+	}
+	return &ExitError{Code: ExitFailure, Err: err, Services: []string{name}}
+}
+
+// DaemonOptions configures the daemon process.
+type DaemonOptions struct {
+	// GracefulTimeout overrides the config's graceful_timeout if positive.
+	GracefulTimeout time.Duration
+	// Listen overrides the config's socket.listen if not empty.
+	Listen string
+	// Token overrides the config's socket.token_file if not empty.
+	Token string
+}
+
 // RunDaemon runs the daemon process.
-func RunDaemon(socketPath, configPath string) error {
-	d, err := daemon.New(configPath)
+func RunDaemon(socketPath, configPath string, opts DaemonOptions) error {
+	d, err := daemon.New(configPath, Overrides, Env)
 	if err != nil {
 		return err
 	}
+	if opts.GracefulTimeout > 0 {
+		d.SetGracefulTimeout(opts.GracefulTimeout)
+	}
+	if opts.Listen != "" {
+		d.SetListenAddress(opts.Listen)
+	}
+	if opts.Token != "" {
+		d.SetToken(opts.Token)
+	}
+	// Services inherit the daemon's environment, and have no use for the token
+	os.Unsetenv("COMPROC_TOKEN")
 
 	// Handle shutdown signals
 	sigCh := make(chan os.Signal, 1)
@@ -317,3 +1139,305 @@ func RunDaemon(socketPath, configPath string) error {
 	// Run the daemon (this blocks)
 	return d.Run(socketPath)
 }
+
+// RunVersion executes the 'version' command — prints the CLI version and,
+// if a daemon is reachable, the daemon's version.
+func RunVersion(socketPath string) error {
+	fmt.Printf("Client: %s\n", version.String())
+
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		fmt.Println("Daemon: not running")
+		return nil
+	}
+	defer client.Close()
+
+	daemonVersion, err := fetchDaemonVersion(client)
+	if err != nil {
+		return fmt.Errorf("version failed: %w", err)
+	}
+	fmt.Printf("Daemon: %s\n", daemonVersion)
+
+	if daemonVersion != version.String() {
+		fmt.Fprintln(os.Stderr, versionMismatchWarning(daemonVersion))
+	}
+	return nil
+}
+
+// WarnVersionMismatch prints a warning to stderr if a daemon is running with
+// a version different from the CLI. A stale daemon left over from an older
+// build may not support newer RPC methods. Nothing is printed if the daemon
+// is not reachable.
+func WarnVersionMismatch(socketPath string) {
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		return
+	}
+	defer client.Close()
+
+	daemonVersion, err := fetchDaemonVersion(client)
+	if err != nil {
+		return
+	}
+	if daemonVersion != version.String() {
+		fmt.Fprintln(os.Stderr, versionMismatchWarning(daemonVersion))
+	}
+}
+
+// fetchDaemonVersion asks the daemon for its version. Daemons that predate
+// the 'version' method are reported as "unknown".
+func fetchDaemonVersion(client *Client) (string, error) {
+	result, err := client.Version()
+	if err != nil {
+		var rpcErr *protocol.Error
+		if errors.As(err, &rpcErr) && rpcErr.Code == protocol.MethodNotFound {
+			return "unknown", nil
+		}
+		return "", err
+	}
+	return result.Version, nil
+}
+
+func versionMismatchWarning(daemonVersion string) string {
+	return fmt.Sprintf("Warning: daemon version %s differs from CLI version %s; run 'comproc down' and start again to use the new daemon", daemonVersion, version.String())
+}
+
+// RunPing executes the 'ping' command — checks that the daemon responds and
+// prints the round-trip time of each request. It fails if the daemon is not
+// reachable or does not answer.
+func RunPing(socketPath string, count int, interval time.Duration) error {
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not reachable: %w", err)
+	}
+	defer client.Close()
+
+	for i := range count {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+
+		start := time.Now()
+		result, err := client.Ping()
+		elapsed := time.Since(start).Round(time.Microsecond)
+		if err != nil {
+			// Daemons older than the ping method still prove they are alive
+			var rpcErr *protocol.Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != protocol.MethodNotFound {
+				return fmt.Errorf("ping failed: %w", err)
+			}
+			fmt.Printf("Response from daemon: time=%s\n", elapsed)
+			continue
+		}
+		fmt.Printf("Response from daemon (pid %d): time=%s\n", result.PID, elapsed)
+	}
+	return nil
+}
+
+// RunHistory executes the 'history' command — shows the recent runs of a
+// service, oldest first. History is kept by the daemon, so it is lost when
+// the daemon exits.
+func RunHistory(socketPath, configPath, service string) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	result, err := client.History(service)
+	if err != nil {
+		return fmt.Errorf("history failed: %w", err)
+	}
+
+	if len(result.Runs) == 0 {
+		fmt.Printf("No runs of %s\n", service)
+		return nil
+	}
+	printHistoryTable(os.Stdout, result.Runs, time.Now())
+	return nil
+}
+
+// RunInspect executes the 'inspect' command — prints a JSON document
+// describing a service, for scripts and bug reports.
+func RunInspect(socketPath, configPath, service string) error {
+	client := NewClient(socketPath)
+	client.SetConfigPath(configPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	defer client.Close()
+
+	result, err := client.Inspect(service)
+	if err != nil {
+		return fmt.Errorf("inspect failed: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// printHistoryTable prints runs as a table. The duration of a run in
+// progress is measured up to now.
+func printHistoryTable(out io.Writer, runs []protocol.RunInfo, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tEXITED\tDURATION\tEXIT CODE\tREASON\tERROR")
+	for _, run := range runs {
+		startedAt, _ := time.Parse(time.RFC3339, run.StartedAt)
+		started, exited, exitCode := "-", "-", "-"
+		if !startedAt.IsZero() {
+			started = startedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		end := now
+		if run.ExitedAt != "" {
+			end, _ = time.Parse(time.RFC3339, run.ExitedAt)
+			exited = end.Local().Format("2006-01-02 15:04:05")
+			exitCode = displayExitCode(run.ExitCode, run.Signal)
+		}
+		duration := "-"
+		if !startedAt.IsZero() && !end.IsZero() {
+			duration = end.Sub(startedAt).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", started, exited, duration, exitCode, orDash(run.Reason), orDash(run.Error))
+	}
+	w.Flush()
+}
+
+// RunDaemonStats executes the 'daemon stats' command — shows information
+// about the running daemon process.
+func RunDaemonStats(socketPath string) error {
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not reachable: %w", err)
+	}
+	defer client.Close()
+
+	stats, err := client.Stats()
+	if err != nil {
+		return fmt.Errorf("daemon stats failed: %w", err)
+	}
+
+	uptime := time.Duration(stats.UptimeSeconds * float64(time.Second)).Round(time.Second)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", stats.Version)
+	fmt.Fprintf(w, "PID:\t%d\n", stats.PID)
+	fmt.Fprintf(w, "Uptime:\t%s (since %s)\n", uptime, stats.StartedAt)
+	fmt.Fprintf(w, "Config:\t%s\n", stats.ConfigPath)
+	for _, path := range stats.Projects {
+		fmt.Fprintf(w, "Project:\t%s\n", path)
+	}
+	if stats.EventsPath != "" {
+		fmt.Fprintf(w, "Events:\t%s\n", stats.EventsPath)
+	}
+	fmt.Fprintf(w, "Goroutines:\t%d\n", stats.Goroutines)
+	fmt.Fprintf(w, "Connections:\t%d\n", stats.Connections)
+	if stats.LogMemoryLimit > 0 {
+		fmt.Fprintf(w, "Log lines:\t%d (%s of %s)\n", stats.LogLines, formatBytes(stats.LogBytes), formatBytes(int(stats.LogMemoryLimit)))
+	} else {
+		fmt.Fprintf(w, "Log lines:\t%d (%s)\n", stats.LogLines, formatBytes(stats.LogBytes))
+	}
+	if stats.LogEvicted > 0 {
+		fmt.Fprintf(w, "Log evicted:\t%d lines over the memory limit\n", stats.LogEvicted)
+	}
+	if stats.LogDropped > 0 {
+		fmt.Fprintf(w, "Log dropped:\t%d lines for followers that fell behind\n", stats.LogDropped)
+	}
+	fmt.Fprintf(w, "Log followers:\t%d\n", stats.LogSubscribers)
+	return w.Flush()
+}
+
+// daemonStopTimeout is how long `daemon stop` waits for the daemon process
+// to exit. Services are stopped within their graceful timeouts first.
+const daemonStopTimeout = 30 * time.Second
+
+// RunDaemonStop executes the 'daemon stop' command — stops all services and
+// the daemon. If the daemon doesn't answer on its socket, the process
+// recorded in its pidfile is sent SIGTERM instead, and a pidfile left by a
+// daemon that is gone is removed. The pidfile of a daemon reached through
+// Host is on another machine, so it is not used.
+func RunDaemonStop(socketPath string) error {
+	pidPath := daemon.PIDFilePath(socketPath)
+	pid, pidErr := daemon.ReadPIDFile(pidPath)
+	if Host != "" {
+		pidErr = fs.ErrNotExist
+	}
+
+	client := NewClient(socketPath)
+	if err := client.Connect(); err == nil {
+		defer client.Close()
+		result, err := client.Shutdown()
+		if err != nil {
+			return fmt.Errorf("daemon stop failed: %w", err)
+		}
+		if pidErr == nil && !waitForExit(pid, daemonStopTimeout) {
+			return DaemonErrorf("daemon (pid %d) did not exit within %s", pid, daemonStopTimeout)
+		}
+		printResult(result, func() {
+			if len(result.Stopped) > 0 {
+				fmt.Printf("Stopped: %v\n", result.Stopped)
+			}
+			fmt.Println("Daemon stopped")
+		})
+		return nil
+	}
+
+	// The socket doesn't answer, so fall back to the pidfile
+	switch {
+	case errors.Is(pidErr, fs.ErrNotExist):
+		printResult(protocol.ShutdownResult{}, func() {
+			fmt.Println("Daemon is not running")
+		})
+		return nil
+	case pidErr != nil:
+		return DaemonErrorf("daemon is not reachable: %w", pidErr)
+	case !daemon.ProcessAlive(pid) || !daemon.PIDFileLocked(pidPath):
+		// Without the daemon's lock, the PID may belong to an unrelated
+		// process by now, which must not be signaled
+		os.Remove(pidPath)
+		printResult(protocol.ShutdownResult{}, func() {
+			fmt.Printf("Daemon is not running (removed the stale pidfile of pid %d)\n", pid)
+		})
+		return nil
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return DaemonErrorf("failed to signal the daemon (pid %d): %w", pid, err)
+	}
+	if !waitForExit(pid, daemonStopTimeout) {
+		return DaemonErrorf("daemon (pid %d) did not exit within %s", pid, daemonStopTimeout)
+	}
+	printResult(protocol.ShutdownResult{}, func() {
+		fmt.Printf("Daemon stopped (pid %d)\n", pid)
+	})
+	return nil
+}
+
+// waitForExit polls until the process with the given PID is gone, and
+// reports whether it went within timeout.
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for daemon.ProcessAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
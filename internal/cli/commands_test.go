@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 40, "3072.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestStatusTree(t *testing.T) {
+	services := []protocol.ServiceStatus{
+		{Name: "web", DependsOn: []string{"api", "cache"}},
+		{Name: "api", DependsOn: []string{"db"}},
+		{Name: "worker", DependsOn: []string{"db"}},
+		{Name: "db"},
+		{Name: "cache"},
+	}
+
+	sorted, labels := statusTree(services)
+	var names []string
+	for _, svc := range sorted {
+		names = append(names, svc.Name)
+	}
+	// web starts after api and cache; it goes below cache, which starts last
+	want := []string{
+		"db",
+		"├─ api",
+		"└─ worker",
+		"cache",
+		"└─ web (+api)",
+	}
+	if !slices.Equal(labels, want) {
+		t.Errorf("unexpected tree:\n%s\nwant:\n%s", strings.Join(labels, "\n"), strings.Join(want, "\n"))
+	}
+	if !slices.Equal(names, []string{"db", "api", "worker", "cache", "web"}) {
+		t.Errorf("unexpected order: %v", names)
+	}
+}
+
+func TestPrintStatusTable_Wide(t *testing.T) {
+	services := []protocol.ServiceStatus{
+		{Name: "api", State: "running", PID: 42, Command: "go run ./cmd/api\n--port 80\n", WorkingDir: "/srv/api", Restart: "on-failure", Ports: []int{8080, 41234}},
+		{Name: "db", State: "stopped", External: "localhost:5432", Restart: "never"},
+	}
+
+	var buf bytes.Buffer
+	printStatusTable(&buf, services, StatusOptions{Wide: true})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got:\n%s", buf.String())
+	}
+	if !strings.HasSuffix(lines[0], "POLICY      PORTS       WORKDIR   COMMAND") {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "on-failure  8080,41234  /srv/api  go run ./cmd/api; --port 80") {
+		t.Errorf("unexpected api row: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "never       -           -         external: localhost:5432") {
+		t.Errorf("unexpected db row: %q", lines[2])
+	}
+
+	buf.Reset()
+	printStatusTable(&buf, services, StatusOptions{})
+	if strings.Contains(buf.String(), "COMMAND") {
+		t.Errorf("expected no wide columns by default, got:\n%s", buf.String())
+	}
+}
+
+func TestDisplayExit(t *testing.T) {
+	tests := []struct {
+		name     string
+		svc      protocol.ServiceStatus
+		wantCode string
+		wantAt   string
+	}{
+		{"failed", protocol.ServiceStatus{State: "failed", ExitCode: 3, ExitedAt: "2024-01-15 10:30:00"}, "3", "2024-01-15 10:30:00"},
+		{"stopped", protocol.ServiceStatus{State: "stopped", ExitedAt: "2024-01-15 10:30:00"}, "0", "2024-01-15 10:30:00"},
+		{"signaled", protocol.ServiceStatus{State: "failed", ExitCode: -1, Signal: "SIGKILL", ExitedAt: "2024-01-15 10:30:00"}, "SIGKILL", "2024-01-15 10:30:00"},
+		{"signaled on old daemon", protocol.ServiceStatus{State: "stopped", ExitCode: -1, ExitedAt: "2024-01-15 10:30:00"}, "signal", "2024-01-15 10:30:00"},
+		{"never started", protocol.ServiceStatus{State: "stopped"}, "-", "-"},
+		{"running", protocol.ServiceStatus{State: "running", ExitedAt: "2024-01-15 10:30:00"}, "-", "-"},
+		{"restarting", protocol.ServiceStatus{State: "restarting", ExitCode: 1, ExitedAt: "2024-01-15 10:30:00"}, "1", "2024-01-15 10:30:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, at := displayExit(tt.svc)
+			if code != tt.wantCode || at != tt.wantAt {
+				t.Errorf("displayExit() = (%q, %q), want (%q, %q)", code, at, tt.wantCode, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestDisplayRestarting(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		next string
+		want string
+	}{
+		{now.Add(4 * time.Second).Format(time.RFC3339Nano), "restarting(4s)"},
+		{now.Add(1500 * time.Millisecond).Format(time.RFC3339Nano), "restarting(2s)"},
+		{now.Add(-time.Second).Format(time.RFC3339Nano), "restarting(0s)"},
+		{"", "restarting"},
+	}
+	for _, tt := range tests {
+		svc := protocol.ServiceStatus{State: "restarting", NextRestartAt: tt.next}
+		if got := displayRestarting(svc, now); got != tt.want {
+			t.Errorf("displayRestarting(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestPrintHistoryTable(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 30, 0, 0, time.Local)
+	runs := []protocol.RunInfo{
+		{StartedAt: start.Format(time.RFC3339), ExitedAt: start.Add(90 * time.Second).Format(time.RFC3339), ExitCode: -1, Signal: "SIGKILL", Reason: "up"},
+		{StartedAt: start.Add(2 * time.Minute).Format(time.RFC3339), ExitedAt: start.Add(2 * time.Minute).Format(time.RFC3339), ExitCode: 127, Reason: "policy", Error: "prepare failed"},
+		{StartedAt: start.Add(3 * time.Minute).Format(time.RFC3339), Reason: "restart"},
+	}
+
+	var out bytes.Buffer
+	printHistoryTable(&out, runs, start.Add(3*time.Minute+5*time.Second))
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	want := [][]string{
+		{"STARTED", "EXITED", "DURATION", "EXIT", "CODE", "REASON", "ERROR"},
+		{"2024-01-15", "10:30:00", "2024-01-15", "10:31:30", "1m30s", "SIGKILL", "up", "-"},
+		{"2024-01-15", "10:32:00", "2024-01-15", "10:32:00", "0s", "127", "policy", "prepare", "failed"},
+		{"2024-01-15", "10:33:00", "-", "5s", "-", "restart", "-"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got:\n%s", len(want), out.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); !slices.Equal(got, want[i]) {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2h", now.Add(-2 * time.Hour)},
+		{"90s", now.Add(-90 * time.Second)},
+		{"2024-01-15T10:30:00Z", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"2024-01-15T10:30:00.5+09:00", time.Date(2024, 1, 15, 1, 30, 0, 5e8, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Error("expected error for an invalid value")
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Supported output formats for the 'env' command.
+const (
+	EnvFormatPlain  = "plain"
+	EnvFormatDotenv = "dotenv"
+	EnvFormatExport = "export"
+)
+
+// FormatEnv writes environment variables to out in the given format,
+// sorted by key so the output is stable.
+//
+//   - plain:  KEY=value (unquoted)
+//   - dotenv: KEY="value" (double-quoted with escapes)
+//   - export: export KEY='value' (shell-quoted, suitable for eval/source)
+func FormatEnv(out io.Writer, env map[string]string, format string) error {
+	switch format {
+	case EnvFormatPlain, EnvFormatDotenv, EnvFormatExport:
+	default:
+		return fmt.Errorf("unknown env format: %q (expected plain, dotenv, or export)", format)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := env[k]
+		switch format {
+		case EnvFormatPlain:
+			fmt.Fprintf(out, "%s=%s\n", k, v)
+		case EnvFormatDotenv:
+			fmt.Fprintf(out, "%s=%s\n", k, dotenvQuote(v))
+		case EnvFormatExport:
+			fmt.Fprintf(out, "export %s=%s\n", k, shellQuote(v))
+		}
+	}
+
+	return nil
+}
+
+var dotenvReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"$", `\$`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+// dotenvQuote wraps a value in double quotes, escaping characters that
+// dotenv parsers would otherwise interpret.
+func dotenvQuote(s string) string {
+	return `"` + dotenvReplacer.Replace(s) + `"`
+}
+
+// shellQuote wraps a value in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
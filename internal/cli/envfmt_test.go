@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatEnv_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"PORT": "8080", "DEBUG": "true"}
+
+	if err := FormatEnv(&buf, env, EnvFormatPlain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "DEBUG=true\nPORT=8080\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestFormatEnv_Dotenv(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"MSG": `say "hi" $HOME` + "\nbye"}
+
+	if err := FormatEnv(&buf, env, EnvFormatDotenv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `MSG="say \"hi\" \$HOME\nbye"` + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestFormatEnv_Export(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"MSG": "it's $HOME"}
+
+	if err := FormatEnv(&buf, env, EnvFormatExport); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `export MSG='it'\''s $HOME'` + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestFormatEnv_UnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"PORT": "8080"}
+
+	if err := FormatEnv(&buf, env, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// Exit codes of comproc, so that scripts can tell kinds of failures apart
+// without parsing error messages.
+const (
+	ExitOK                = 0
+	ExitFailure           = 1 // Any failure not covered below
+	ExitUsage             = 2 // Invalid command line
+	ExitConfig            = 3 // The config file is missing or invalid
+	ExitDaemonUnreachable = 4 // The daemon is not running or does not respond
+	ExitPartialFailure    = 5 // Some of the services acted on failed
+	ExitAllFailed         = 6 // All of the services acted on failed
+	ExitInternal          = 7 // The daemon failed unexpectedly
+)
+
+// ExitError is returned when comproc should exit with a specific status code.
+// Err is printed if set; otherwise comproc exits without an error message.
+type ExitError struct {
+	Code     int
+	Err      error
+	Services []string // Services the error is about, for --output json
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitErrorf returns an ExitError with a formatted message.
+func exitErrorf(code int, format string, args ...any) error {
+	return &ExitError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// UsageErrorf returns an error for an invalid command line.
+func UsageErrorf(format string, args ...any) error {
+	return exitErrorf(ExitUsage, format, args...)
+}
+
+// ConfigErrorf returns an error for a config file that can't be loaded.
+func ConfigErrorf(format string, args ...any) error {
+	return exitErrorf(ExitConfig, format, args...)
+}
+
+// DaemonErrorf returns an error for a daemon that can't be reached.
+func DaemonErrorf(format string, args ...any) error {
+	return exitErrorf(ExitDaemonUnreachable, format, args...)
+}
+
+// failureError returns the error for a command that acted on total services
+// of which the failed ones failed, telling partial failures apart.
+func failureError(failed []string, total int, msg string) error {
+	code := ExitPartialFailure
+	if len(failed) >= total {
+		code = ExitAllFailed
+	}
+	return &ExitError{Code: code, Err: errors.New(msg), Services: failed}
+}
+
+// ExitCode returns the status comproc exits with after err.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var cfgErr *daemon.ConfigError
+	if errors.As(err, &cfgErr) {
+		return ExitConfig
+	}
+	var rpcErr *protocol.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case protocol.ConfigError:
+			return ExitConfig
+		case protocol.InternalError:
+			return ExitInternal
+		}
+	}
+	return ExitFailure
+}
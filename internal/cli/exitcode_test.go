@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"plain error", errors.New("boom"), ExitFailure},
+		{"wrapped exit error", fmt.Errorf("up failed: %w", DaemonErrorf("not running")), ExitDaemonUnreachable},
+		{"daemon config error", &daemon.ConfigError{Err: errors.New("bad")}, ExitConfig},
+		{"rpc config error", fmt.Errorf("up failed: %w", &protocol.Error{Code: protocol.ConfigError}), ExitConfig},
+		{"rpc internal error", &protocol.Error{Code: protocol.InternalError}, ExitInternal},
+		{"rpc service error", &protocol.Error{Code: protocol.ServiceError}, ExitFailure},
+		{"partial failure", failureError([]string{"a"}, 2, "failed"), ExitPartialFailure},
+		{"all failed", failureError([]string{"a", "b"}, 2, "failed"), ExitAllFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
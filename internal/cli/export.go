@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+)
+
+// Supported formats of the 'export' command.
+const (
+	ExportFormatVSCode  = "vscode"
+	ExportFormatLaunchd = "launchd"
+)
+
+// ExportOptions configures the 'export' command.
+type ExportOptions struct {
+	// Output is the file to write, or "-" for stdout. Formats that write
+	// a file per service take a directory. If empty, the format's
+	// conventional location is used.
+	Output string
+	// Force overwrites existing files that can't be merged.
+	Force bool
+}
+
+// RunExport executes the 'export' command — converts the config into files
+// for other tools. It reads the config file directly, so no daemon is required.
+func RunExport(configPath, format string, opts ExportOptions) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return ConfigErrorf("failed to load config: %w", err)
+	}
+
+	switch format {
+	case ExportFormatVSCode:
+		return exportVSCode(cfg, configPath, opts)
+	case ExportFormatLaunchd:
+		return exportLaunchd(cfg, configPath, opts)
+	default:
+		return fmt.Errorf("unknown export format: %q (expected %s or %s)", format, ExportFormatVSCode, ExportFormatLaunchd)
+	}
+}
+
+// vscodeTaskPrefix starts the labels of generated tasks, so they can be told
+// apart from the user's own tasks when the file is regenerated.
+const vscodeTaskPrefix = "comproc: "
+
+// vscodeTask is a task of .vscode/tasks.json.
+type vscodeTask struct {
+	Label          string              `json:"label"`
+	Type           string              `json:"type"`
+	Command        string              `json:"command"`
+	Args           []string            `json:"args"`
+	IsBackground   bool                `json:"isBackground,omitempty"`
+	ProblemMatcher []string            `json:"problemMatcher"`
+	Presentation   *vscodePresentation `json:"presentation,omitempty"`
+}
+
+type vscodePresentation struct {
+	Reveal string `json:"reveal,omitempty"`
+	Panel  string `json:"panel,omitempty"`
+}
+
+// vscodeTasks returns the tasks for a config: up, down, status, and logs for
+// all services, and up, stop, restart, and logs for each service.
+// configRefs are how the tasks refer to the config file and the override
+// files merged onto it.
+func vscodeTasks(cfg *config.Config, configRefs []string) []vscodeTask {
+	var global []string
+	for _, ref := range configRefs {
+		global = append(global, "-f", ref)
+	}
+	if Env != "" {
+		global = append(global, "--env", Env)
+	}
+	task := func(label string, args ...string) vscodeTask {
+		return vscodeTask{
+			Label:          vscodeTaskPrefix + label,
+			Type:           "shell",
+			Command:        "comproc",
+			Args:           append(slices.Clone(global), args...),
+			ProblemMatcher: []string{},
+		}
+	}
+	logs := func(label string, args ...string) vscodeTask {
+		t := task(label, append([]string{"logs", "-f"}, args...)...)
+		t.IsBackground = true
+		t.Presentation = &vscodePresentation{Reveal: "always", Panel: "dedicated"}
+		return t
+	}
+
+	tasks := []vscodeTask{
+		task("up", "up"),
+		task("down", "down"),
+		task("status", "status"),
+		logs("logs"),
+	}
+	for _, name := range cfg.ServiceNames() {
+		tasks = append(tasks,
+			task("up "+name, "up", name),
+			task("stop "+name, "stop", name),
+			task("restart "+name, "restart", name),
+			logs("logs "+name, name),
+		)
+	}
+	return tasks
+}
+
+// exportVSCode writes the tasks of a config to .vscode/tasks.json. Tasks
+// generated earlier are replaced while the user's own tasks are kept.
+func exportVSCode(cfg *config.Config, configPath string, opts ExportOptions) error {
+	output := opts.Output
+	if output == "" {
+		output = filepath.Join(filepath.Dir(configPath), ".vscode", "tasks.json")
+	}
+
+	// Refer to the config relative to the workspace that contains .vscode.
+	// Output to stdout is assumed to go to the config file's workspace.
+	workspace := filepath.Dir(configPath)
+	if output != "-" {
+		workspace = filepath.Dir(filepath.Dir(output))
+	}
+	var configRefs []string
+	absWorkspace, wsErr := filepath.Abs(workspace)
+	for _, path := range append([]string{configPath}, Overrides...) {
+		ref := path
+		if wsErr == nil {
+			if rel, err := filepath.Rel(absWorkspace, path); err == nil && !strings.HasPrefix(rel, "..") {
+				ref = "${workspaceFolder}/" + filepath.ToSlash(rel)
+			}
+		}
+		configRefs = append(configRefs, ref)
+	}
+
+	tasks := vscodeTasks(cfg, configRefs)
+	if output == "-" {
+		data, err := mergeVSCodeTasks(nil, tasks)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	existing, err := os.ReadFile(output)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", output, err)
+	}
+	data, err := mergeVSCodeTasks(existing, tasks)
+	if err != nil {
+		if !opts.Force {
+			return fmt.Errorf("cannot update %s: %w (use --force to overwrite it)", output, err)
+		}
+		if data, err = mergeVSCodeTasks(nil, tasks); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	fmt.Printf("Wrote %d tasks to %s\n", len(tasks), output)
+	return nil
+}
+
+// mergeVSCodeTasks returns the content of tasks.json with tasks replacing
+// the generated tasks of existing, which may be empty. Other tasks and
+// settings are kept. Files with comments can't be merged.
+func mergeVSCodeTasks(existing []byte, tasks []vscodeTask) ([]byte, error) {
+	doc := map[string]json.RawMessage{}
+	var kept []json.RawMessage
+	if len(existing) > 0 {
+		if err := json.Unmarshal(existing, &doc); err != nil {
+			return nil, fmt.Errorf("not a plain JSON object: %w", err)
+		}
+		if raw, ok := doc["tasks"]; ok {
+			var current []json.RawMessage
+			if err := json.Unmarshal(raw, &current); err != nil {
+				return nil, fmt.Errorf("invalid tasks: %w", err)
+			}
+			for _, t := range current {
+				var task struct {
+					Label string `json:"label"`
+				}
+				json.Unmarshal(t, &task)
+				if !strings.HasPrefix(task.Label, vscodeTaskPrefix) {
+					kept = append(kept, t)
+				}
+			}
+		}
+	}
+
+	if _, ok := doc["version"]; !ok {
+		doc["version"] = json.RawMessage(`"2.0.0"`)
+	}
+	for _, t := range tasks {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, data)
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	doc["tasks"] = data
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestVSCodeTasks(t *testing.T) {
+	cfg := &config.Config{ServiceOrder: []string{"api", "db"}}
+	tasks := vscodeTasks(cfg, []string{"${workspaceFolder}/comproc.yaml"})
+
+	var labels []string
+	for _, task := range tasks {
+		labels = append(labels, task.Label)
+	}
+	want := []string{
+		"comproc: up", "comproc: down", "comproc: status", "comproc: logs",
+		"comproc: up api", "comproc: stop api", "comproc: restart api", "comproc: logs api",
+		"comproc: up db", "comproc: stop db", "comproc: restart db", "comproc: logs db",
+	}
+	if !slices.Equal(labels, want) {
+		t.Errorf("expected labels %v, got %v", want, labels)
+	}
+
+	logs := tasks[7]
+	if want := []string{"-f", "${workspaceFolder}/comproc.yaml", "logs", "-f", "api"}; !slices.Equal(logs.Args, want) {
+		t.Errorf("expected args %v, got %v", want, logs.Args)
+	}
+	if !logs.IsBackground {
+		t.Error("expected logs task to run in the background")
+	}
+}
+
+func TestMergeVSCodeTasks(t *testing.T) {
+	existing := []byte(`{
+  "version": "2.0.0",
+  "tasks": [
+    {"label": "build", "type": "shell", "command": "make"},
+    {"label": "comproc: up old", "type": "shell", "command": "comproc"}
+  ]
+}`)
+	tasks := []vscodeTask{{Label: "comproc: up", Type: "shell", Command: "comproc"}}
+
+	data, err := mergeVSCodeTasks(existing, tasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Version string `json:"version"`
+		Tasks   []struct {
+			Label string `json:"label"`
+		} `json:"tasks"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid output: %v\n%s", err, data)
+	}
+	var labels []string
+	for _, task := range doc.Tasks {
+		labels = append(labels, task.Label)
+	}
+	if want := []string{"build", "comproc: up"}; !slices.Equal(labels, want) {
+		t.Errorf("expected labels %v, got %v", want, labels)
+	}
+	if doc.Version != "2.0.0" {
+		t.Errorf("expected version 2.0.0, got %q", doc.Version)
+	}
+}
+
+func TestMergeVSCodeTasks_Comments(t *testing.T) {
+	existing := []byte("{\n  // My tasks\n  \"tasks\": []\n}")
+	if _, err := mergeVSCodeTasks(existing, nil); err == nil {
+		t.Error("expected error for a file with comments")
+	}
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+)
+
+// launchdLabelInvalid matches characters not used in generated launchd labels.
+var launchdLabelInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// launchdLabel returns the label of the LaunchAgent of a service.
+func launchdLabel(project, service string) string {
+	clean := func(s string) string {
+		return launchdLabelInvalid.ReplaceAllString(s, "-")
+	}
+	return "com.comproc." + clean(project) + "." + clean(service)
+}
+
+// exportLaunchd writes a LaunchAgent plist for each service, by default to
+// ~/Library/LaunchAgents. Existing files are only replaced with Force.
+func exportLaunchd(cfg *config.Config, configPath string, opts ExportOptions) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dir := opts.Output
+	if dir == "" {
+		dir = filepath.Join(home, "Library", "LaunchAgents")
+	}
+	if dir == "-" {
+		return fmt.Errorf("launchd export writes one file per service; -o must be a directory")
+	}
+	logDir := filepath.Join(home, "Library", "Logs", "comproc")
+
+	project := cfg.Name
+	if project == "" {
+		project = filepath.Base(filepath.Dir(configPath))
+	}
+
+	type agent struct {
+		path string
+		data []byte
+	}
+	var agents []agent
+	for _, name := range cfg.ServiceNames() {
+		if cfg.Services[name].IsExternal() {
+			continue
+		}
+		label := launchdLabel(project, name)
+		path := filepath.Join(dir, label+".plist")
+		if _, err := os.Stat(path); err == nil && !opts.Force {
+			return fmt.Errorf("%s already exists (use --force to overwrite it)", path)
+		}
+		svc := cfg.Services[name]
+		agents = append(agents, agent{
+			path: path,
+			data: launchdPlist(label, svc, serviceWorkingDir(svc, configPath), filepath.Join(logDir, label+".log")),
+		})
+	}
+
+	// launchd does not create the directories of log files
+	for _, d := range []string{dir, logDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	for _, a := range agents {
+		if err := os.WriteFile(a.path, a.data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", a.path, err)
+		}
+		fmt.Printf("Wrote %s\n", a.path)
+	}
+
+	for _, name := range cfg.ServiceNames() {
+		svc := cfg.Services[name]
+		if !svc.IsExternal() && (len(svc.DependsOn) > 0 || svc.HasReadinessCheck()) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: launchd starts agents independently; depends_on and readiness checks are not carried over\n", name)
+		}
+	}
+	fmt.Printf("Load the agents with:\n  launchctl bootstrap gui/$(id -u) %s\n",
+		filepath.Join(dir, launchdLabel(project, "")+"*.plist"))
+	return nil
+}
+
+// serviceWorkingDir returns the absolute working directory of a service.
+func serviceWorkingDir(svc *config.Service, configPath string) string {
+	dir := svc.WorkingDir
+	if dir == "" {
+		return filepath.Dir(configPath)
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(filepath.Dir(configPath), dir)
+	}
+	return dir
+}
+
+// launchdPlist returns the LaunchAgent plist of a service. The agent starts
+// at login and is kept alive according to the service's restart policy.
+func launchdPlist(label string, svc *config.Service, workDir, logPath string) []byte {
+	var b bytes.Buffer
+	escape := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	str := func(s string) string {
+		return "<string>" + escape(s) + "</string>"
+	}
+	key := func(indent, k string) {
+		fmt.Fprintf(&b, "%s<key>%s</key>\n", indent, escape(k))
+	}
+
+	command := svc.Command
+	if svc.Prepare != "" {
+		command = svc.Prepare + " && exec " + svc.Command
+	}
+	shell := []string{"/bin/sh", "-c"}
+	if svc.LoginShell {
+		shell = []string{loginShellPath(), "-l", "-c"}
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	key("  ", "Label")
+	fmt.Fprintf(&b, "  %s\n", str(label))
+	key("  ", "ProgramArguments")
+	b.WriteString("  <array>\n")
+	for _, arg := range append(shell, command) {
+		fmt.Fprintf(&b, "    %s\n", str(arg))
+	}
+	b.WriteString("  </array>\n")
+	key("  ", "WorkingDirectory")
+	fmt.Fprintf(&b, "  %s\n", str(workDir))
+	if mask, ok := svc.GetUmask(); ok {
+		key("  ", "Umask")
+		fmt.Fprintf(&b, "  <integer>%d</integer>\n", mask)
+	}
+
+	env := svc.ResolvedEnv()
+	if len(env) > 0 {
+		key("  ", "EnvironmentVariables")
+		b.WriteString("  <dict>\n")
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			key("    ", k)
+			fmt.Fprintf(&b, "    %s\n", str(env[k]))
+		}
+		b.WriteString("  </dict>\n")
+	}
+
+	key("  ", "RunAtLoad")
+	b.WriteString("  <true/>\n")
+	switch svc.GetRestartPolicy() {
+	case config.RestartAlways:
+		key("  ", "KeepAlive")
+		b.WriteString("  <true/>\n")
+	case config.RestartOnFailure:
+		key("  ", "KeepAlive")
+		b.WriteString("  <dict>\n")
+		key("    ", "SuccessfulExit")
+		b.WriteString("    <false/>\n  </dict>\n")
+	}
+	key("  ", "StandardOutPath")
+	fmt.Fprintf(&b, "  %s\n", str(logPath))
+	key("  ", "StandardErrorPath")
+	fmt.Fprintf(&b, "  %s\n", str(logPath))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// loginShellPath returns the user's shell for services with login_shell.
+func loginShellPath() string {
+	if shell := os.Getenv("SHELL"); shell != "" && strings.HasPrefix(shell, "/") {
+		return shell
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestLaunchdLabel(t *testing.T) {
+	if got := launchdLabel("my app", "web/api"); got != "com.comproc.my-app.web-api" {
+		t.Errorf("unexpected label: %q", got)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	svc := &config.Service{
+		Name:    "api",
+		Prepare: "make build",
+		Command: "./bin/api --name 'a & b'",
+		Env:     map[string]string{"PORT": "8080"},
+		Restart: config.RestartOnFailure,
+		Umask:   "0022",
+	}
+	data := launchdPlist("com.comproc.shop.api", svc, "/src/shop", "/logs/api.log")
+
+	// The plist must be well-formed XML
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid XML: %v\n%s", err, data)
+		}
+	}
+
+	for _, want := range []string{
+		"<string>com.comproc.shop.api</string>",
+		"<string>make build &amp;&amp; exec ./bin/api --name &#39;a &amp; b&#39;</string>",
+		"<key>WorkingDirectory</key>\n  <string>/src/shop</string>",
+		"<key>Umask</key>\n  <integer>18</integer>",
+		"<key>PORT</key>\n    <string>8080</string>",
+		"<key>SuccessfulExit</key>\n    <false/>",
+		"<key>StandardErrorPath</key>\n  <string>/logs/api.log</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in plist:\n%s", want, data)
+		}
+	}
+}
+
+func TestLaunchdPlist_NoRestart(t *testing.T) {
+	data := launchdPlist("l", &config.Service{Command: "sleep 1"}, "/", "/l.log")
+	if strings.Contains(string(data), "KeepAlive") {
+		t.Errorf("expected no KeepAlive without restart policy:\n%s", data)
+	}
+	if strings.Contains(string(data), "Umask") {
+		t.Errorf("expected no Umask without umask:\n%s", data)
+	}
+}
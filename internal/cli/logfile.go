@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// logFileServicePlaceholder in the path given to `logs --output` splits the
+// output into a file per service.
+const logFileServicePlaceholder = "{service}"
+
+// logFiles copies log entries to the files of `logs --output`. Lines are
+// written without colors. A single file gets the same prefixes as the
+// terminal unless raw is set; files split per service get raw lines.
+type logFiles struct {
+	path         string
+	raw          bool
+	serviceNames []string
+	files        map[string]*os.File
+	formatters   map[string]*LogFormatter // By file path
+}
+
+// openLogFiles opens the log file at path for appending. If path contains
+// {service}, files are opened per service as lines arrive.
+func openLogFiles(path string, serviceNames []string, raw bool) (*logFiles, error) {
+	l := &logFiles{
+		path:         path,
+		raw:          raw,
+		serviceNames: serviceNames,
+		files:        make(map[string]*os.File),
+		formatters:   make(map[string]*LogFormatter),
+	}
+	if !l.split() {
+		if _, err := l.formatter(""); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *logFiles) split() bool {
+	return strings.Contains(l.path, logFileServicePlaceholder)
+}
+
+// PrintEntry writes a log entry to its file.
+func (l *logFiles) PrintEntry(entry protocol.LogEntry) error {
+	f, err := l.formatter(entry.Service)
+	if err != nil {
+		return err
+	}
+	f.PrintEntry(entry)
+	return nil
+}
+
+// formatter returns the formatter writing the file of a service, opening
+// the file on first use.
+func (l *logFiles) formatter(service string) (*LogFormatter, error) {
+	path := l.path
+	if l.split() {
+		// Services of other projects are qualified as "project/service"
+		name := strings.ReplaceAll(service, "/", "_")
+		path = strings.ReplaceAll(path, logFileServicePlaceholder, name)
+	}
+	if f, ok := l.formatters[path]; ok {
+		return f, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	l.files[path] = file
+
+	f := NewLogFormatter(file, l.serviceNames)
+	f.SetColorEnabled(false)
+	f.SetRaw(l.raw || l.split())
+	l.formatters[path] = f
+	return f, nil
+}
+
+// Close closes the open files.
+func (l *logFiles) Close() error {
+	var firstErr error
+	for _, file := range l.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestLogFiles_Single(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("earlier\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := openLogFiles(path, []string{"api", "worker"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.PrintEntry(protocol.LogEntry{Service: "api", Line: "started", Color: 1})
+	files.PrintEntry(protocol.LogEntry{Service: "worker", Line: "working"})
+	if err := files.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Appended, with prefixes and without colors
+	expected := "earlier\napi    | started\nworker | working\n"
+	if string(data) != expected {
+		t.Errorf("unexpected file content:\ngot:  %q\nwant: %q", data, expected)
+	}
+}
+
+func TestLogFiles_SplitPerService(t *testing.T) {
+	dir := t.TempDir()
+	files, err := openLogFiles(filepath.Join(dir, "logs", "{service}.log"), []string{"api", "shop/db"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.PrintEntry(protocol.LogEntry{Service: "api", Line: "one"})
+	files.PrintEntry(protocol.LogEntry{Service: "shop/db", Line: "two"})
+	files.PrintEntry(protocol.LogEntry{Service: "api", Line: "three"})
+	if err := files.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"api.log":     "one\nthree\n",
+		"shop_db.log": "two\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "logs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: got %q, want %q", name, data, expected)
+		}
+	}
+}
@@ -3,11 +3,15 @@ package cli
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
 )
 
-// ANSI color codes for service name coloring.
+// ANSI color codes for service name coloring, the default theme of Palette.
 // Colors chosen to be distinct and readable on both light and dark terminals.
 var serviceColors = []string{
 	"\033[36m", // Cyan
@@ -28,10 +32,28 @@ type LogFormatter struct {
 	maxNameLen   int
 	out          io.Writer
 	colorEnabled bool
+	raw          bool
+	palette      *Palette
 	serviceColor map[string]string
 	nextColor    int
+
+	// Deduplication of identical consecutive lines of a service
+	dedup      bool
+	repeats    map[string]*repeatedLine
+	flushTimer *time.Timer
+}
+
+// repeatedLine is the last line printed for a service and the number of
+// identical lines suppressed since.
+type repeatedLine struct {
+	line  string
+	count int
 }
 
+// dedupFlushDelay is how long suppressed repeats wait for a different line
+// before their count is printed.
+const dedupFlushDelay = time.Second
+
 // NewLogFormatter creates a new LogFormatter with the given service names.
 func NewLogFormatter(out io.Writer, serviceNames []string) *LogFormatter {
 	maxLen := 0
@@ -45,7 +67,9 @@ func NewLogFormatter(out io.Writer, serviceNames []string) *LogFormatter {
 		maxNameLen:   maxLen,
 		out:          out,
 		colorEnabled: true,
+		palette:      Colors,
 		serviceColor: make(map[string]string),
+		repeats:      make(map[string]*repeatedLine),
 	}
 
 	// Pre-assign colors to known services
@@ -63,12 +87,75 @@ func (f *LogFormatter) SetColorEnabled(enabled bool) {
 	f.colorEnabled = enabled
 }
 
+// SetRaw enables or disables raw output, which prints lines exactly as the
+// processes wrote them, without service prefixes or colors.
+func (f *LogFormatter) SetRaw(raw bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.raw = raw
+}
+
+// SetDedup enables or disables deduplication: identical consecutive lines
+// of a service are printed once, followed by a "last message repeated N
+// times" line when a different line arrives, after a second without one,
+// or on Flush.
+func (f *LogFormatter) SetDedup(dedup bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dedup = dedup
+}
+
+// Flush prints the counts of suppressed repeated lines.
+func (f *LogFormatter) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flushTimer != nil {
+		f.flushTimer.Stop()
+		f.flushTimer = nil
+	}
+	services := make([]string, 0, len(f.repeats))
+	for service, r := range f.repeats {
+		if r.count > 0 {
+			services = append(services, service)
+		}
+	}
+	slices.Sort(services)
+	for _, service := range services {
+		f.writeRepeats(service)
+	}
+}
+
+func (f *LogFormatter) isRaw() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.raw
+}
+
+// SetColor sets the color of a service to the color index assigned by the
+// daemon, so that it matches other clients regardless of print order.
+func (f *LogFormatter) SetColor(service string, index int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.serviceColor[service] = f.palette.color(service, index)
+}
+
+// PrintEntry prints a log entry received from the daemon in the color the
+// daemon assigned to its service. Markers are left out of raw output, which
+// holds only what the processes wrote.
+func (f *LogFormatter) PrintEntry(entry protocol.LogEntry) {
+	if entry.Stream == protocol.LogStreamMarker && f.isRaw() {
+		return
+	}
+	f.SetColor(entry.Service, entry.Color)
+	f.PrintLine(entry.Service, entry.RawLine())
+}
+
 // assignColor assigns a color to a service (must be called with lock held).
 func (f *LogFormatter) assignColor(service string) string {
 	if color, ok := f.serviceColor[service]; ok {
 		return color
 	}
-	color := serviceColors[f.nextColor%len(serviceColors)]
+	color := f.palette.color(service, f.nextColor)
 	f.serviceColor[service] = color
 	f.nextColor++
 	return color
@@ -79,6 +166,45 @@ func (f *LogFormatter) PrintLine(service, line string) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	if f.dedup {
+		r := f.repeats[service]
+		if r != nil && r.line == line {
+			r.count++
+			if f.flushTimer == nil {
+				f.flushTimer = time.AfterFunc(dedupFlushDelay, f.Flush)
+			}
+			return
+		}
+		if r != nil {
+			f.writeRepeats(service)
+		}
+		f.repeats[service] = &repeatedLine{line: line}
+	}
+	f.writeLine(service, line)
+}
+
+// writeRepeats prints the number of suppressed repeats of a service's last
+// line, if any (must be called with lock held).
+func (f *LogFormatter) writeRepeats(service string) {
+	r := f.repeats[service]
+	if r.count == 0 {
+		return
+	}
+	if r.count == 1 {
+		f.writeLine(service, "last message repeated 1 time")
+	} else {
+		f.writeLine(service, fmt.Sprintf("last message repeated %d times", r.count))
+	}
+	r.count = 0
+}
+
+// writeLine prints a line (must be called with lock held).
+func (f *LogFormatter) writeLine(service, line string) {
+	if f.raw {
+		io.WriteString(f.out, line+"\n")
+		return
+	}
+
 	// Update max length if we see a longer service name
 	if len(service) > f.maxNameLen {
 		f.maxNameLen = len(service)
@@ -3,7 +3,11 @@ package cli
 import (
 	"bytes"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
 )
 
 func TestLogFormatter_AlignsPrefixes(t *testing.T) {
@@ -146,3 +150,96 @@ func TestLogFormatter_AssignsDifferentColors(t *testing.T) {
 			apiColor, workerColor, dbColor)
 	}
 }
+
+func TestLogFormatter_PrintEntryUsesDaemonColor(t *testing.T) {
+	var buf bytes.Buffer
+	// Local order would give api the first color
+	formatter := NewLogFormatter(&buf, []string{"api", "worker"})
+
+	entry := protocol.LogEntry{Service: "api", Line: "hello", Color: 2}
+	formatter.PrintEntry(entry)
+
+	if !strings.HasPrefix(buf.String(), serviceColors[2]) {
+		t.Errorf("expected the daemon's color %q, got %q", serviceColors[2], buf.String())
+	}
+}
+
+func TestLogFormatter_Raw(t *testing.T) {
+	var buf bytes.Buffer
+	formatter := NewLogFormatter(&buf, []string{"api", "worker"})
+	formatter.SetRaw(true)
+
+	formatter.PrintLine("api", "started")
+	entry := protocol.LogEntry{Service: "worker", Color: 1}
+	entry.SetLine("bad \xff byte")
+	formatter.PrintEntry(entry)
+	// Markers are not part of the processes' output
+	formatter.PrintEntry(protocol.LogEntry{Service: "api", Line: "--- api restarted (requested) ---", Stream: protocol.LogStreamMarker})
+
+	expected := "started\nbad \xff byte\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:  %q\nwant: %q", buf.String(), expected)
+	}
+}
+
+func TestLogFormatter_Dedup(t *testing.T) {
+	var buf bytes.Buffer
+	formatter := NewLogFormatter(&buf, []string{"api", "db"})
+	formatter.SetColorEnabled(false)
+	formatter.SetDedup(true)
+
+	for i := 0; i < 3; i++ {
+		formatter.PrintLine("api", "connection refused")
+		// Lines of other services don't break a run of repeats
+		formatter.PrintLine("db", "ready")
+	}
+	formatter.PrintLine("api", "connected")
+	formatter.PrintLine("api", "connected")
+	formatter.Flush()
+
+	expected := "api | connection refused\n" +
+		"db  | ready\n" +
+		"api | last message repeated 2 times\n" +
+		"api | connected\n" +
+		"api | last message repeated 1 time\n" +
+		"db  | last message repeated 2 times\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestLogFormatter_DedupFlushesAfterDelay(t *testing.T) {
+	var buf syncBuffer
+	formatter := NewLogFormatter(&buf, []string{"api"})
+	formatter.SetColorEnabled(false)
+	formatter.SetDedup(true)
+
+	formatter.PrintLine("api", "retrying")
+	formatter.PrintLine("api", "retrying")
+
+	deadline := time.Now().Add(3 * dedupFlushDelay)
+	for !strings.Contains(buf.String(), "repeated 1 time") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the repeat count without further lines, got %q", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+// Output formats selected by the global --output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Output is the format of command results and errors. It is set from the
+// global --output flag.
+var Output = OutputText
+
+// ErrorOutput is an error printed as JSON with --output json.
+type ErrorOutput struct {
+	Code     int      `json:"code"` // Exit code (see ExitCode)
+	Message  string   `json:"message"`
+	Services []string `json:"services,omitempty"` // Services the error is about
+}
+
+// PrintError prints an error that ends a command to w, as JSON with
+// --output json.
+func PrintError(w io.Writer, err error) {
+	var exitErr *ExitError
+	isExitErr := errors.As(err, &exitErr)
+	if Output != OutputJSON {
+		if !isExitErr || exitErr.Err != nil {
+			io.WriteString(w, "Error: "+err.Error()+"\n")
+		}
+		return
+	}
+
+	out := ErrorOutput{Code: ExitCode(err), Message: err.Error()}
+	if isExitErr {
+		out.Services = exitErr.Services
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// printResult prints the result of a command to stdout: as JSON with
+// --output json, or with printText otherwise.
+func printResult(result any, printText func()) {
+	if Output == OutputJSON {
+		json.NewEncoder(os.Stdout).Encode(result)
+		return
+	}
+	printText()
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPrintError(t *testing.T) {
+	err := failureError([]string{"worker"}, 2, "some services failed to start")
+
+	var buf bytes.Buffer
+	PrintError(&buf, err)
+	if buf.String() != "Error: some services failed to start\n" {
+		t.Errorf("unexpected text output: %q", buf.String())
+	}
+
+	buf.Reset()
+	PrintError(&buf, &ExitError{Code: 1})
+	if buf.String() != "" {
+		t.Errorf("expected no output for an exit error without a message, got %q", buf.String())
+	}
+
+	Output = OutputJSON
+	defer func() { Output = OutputText }()
+
+	buf.Reset()
+	PrintError(&buf, err)
+	want := `{"code":5,"message":"some services failed to start","services":["worker"]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	PrintError(&buf, errors.New("boom"))
+	if buf.String() != `{"code":1,"message":"boom"}`+"\n" {
+		t.Errorf("unexpected JSON for a plain error: %q", buf.String())
+	}
+}
@@ -0,0 +1,29 @@
+package cli
+
+import "github.com/ryym/comproc/config"
+
+// Env is the name of the config overlay merged onto config files (see
+// config.LoadOverlay), or empty for none. It is set from the global --env
+// flag.
+var Env string
+
+// Overrides are the absolute paths of the files merged onto the config file
+// (see config.LoadOverrides). They are set from the second and later -f
+// flags.
+var Overrides []string
+
+// ConfigArgs returns the -f flags that make another comproc process load
+// the config file at configPath with the same override files.
+func ConfigArgs(configPath string) []string {
+	args := []string{"-f", configPath}
+	for _, path := range Overrides {
+		args = append(args, "-f", path)
+	}
+	return args
+}
+
+// loadConfig loads a config file with the files in Overrides and the
+// overlay selected by Env merged onto it.
+func loadConfig(path string) (*config.Config, error) {
+	return config.LoadOverrides(path, Overrides, Env)
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Palette is the set of colors service names are shown in.
+type Palette struct {
+	colors []string          // ANSI sequences assigned to services in turn
+	fixed  map[string]string // ANSI sequences of services with a color of their own
+}
+
+// Colors is the palette of service names in logs. It is set from the
+// COMPROC_COLORS environment variable.
+var Colors = &Palette{colors: serviceColors}
+
+// themes are the palettes that COMPROC_COLORS may name.
+var themes = map[string][]string{
+	"default": serviceColors,
+	// Okabe-Ito colors, which stay distinct with color vision deficiencies
+	"colorblind": {
+		"\033[38;5;214m", // Orange
+		"\033[38;5;74m",  // Sky blue
+		"\033[38;5;36m",  // Bluish green
+		"\033[38;5;185m", // Yellow
+		"\033[38;5;25m",  // Blue
+		"\033[38;5;166m", // Vermillion
+		"\033[38;5;175m", // Reddish purple
+	},
+	// Dark colors that stay readable on light backgrounds
+	"light": {
+		"\033[34m",       // Blue
+		"\033[35m",       // Magenta
+		"\033[32m",       // Green
+		"\033[31m",       // Red
+		"\033[36m",       // Cyan
+		"\033[38;5;130m", // Brown
+		"\033[38;5;91m",  // Purple
+		"\033[38;5;24m",  // Dark blue
+	},
+}
+
+// colorNames are the basic ANSI colors by name.
+var colorNames = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33,
+	"blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+}
+
+// ParsePalette parses a palette written as comma-separated entries, each of
+// which is a color added to the palette, the name of a theme whose colors
+// are added, or service=color to give a service a fixed color:
+//
+//	colorblind,api=#ff8800,db=208
+//
+// A color is a name such as red or bright-red, a 256-color index, or a hex
+// RGB value. Without any colors or themes, the default theme is used.
+func ParsePalette(spec string) (*Palette, error) {
+	p := &Palette{fixed: make(map[string]string)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if service, color, ok := strings.Cut(entry, "="); ok {
+			seq, err := parseColor(strings.TrimSpace(color))
+			if err != nil {
+				return nil, fmt.Errorf("service %q: %w", strings.TrimSpace(service), err)
+			}
+			p.fixed[strings.TrimSpace(service)] = seq
+			continue
+		}
+		if theme, ok := themes[entry]; ok {
+			p.colors = append(p.colors, theme...)
+			continue
+		}
+		seq, err := parseColor(entry)
+		if err != nil {
+			return nil, err
+		}
+		p.colors = append(p.colors, seq)
+	}
+	if len(p.colors) == 0 {
+		p.colors = serviceColors
+	}
+	return p, nil
+}
+
+// parseColor returns the ANSI sequence that sets the foreground to a color.
+func parseColor(s string) (string, error) {
+	name := strings.ToLower(s)
+	if code, ok := colorNames[strings.TrimPrefix(name, "bright-")]; ok {
+		if name != strings.TrimPrefix(name, "bright-") {
+			code += 60
+		}
+		return fmt.Sprintf("\033[%dm", code), nil
+	}
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 6 {
+			if rgb, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				return fmt.Sprintf("\033[38;2;%d;%d;%dm", rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+			}
+		}
+	} else if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 255 {
+		return fmt.Sprintf("\033[38;5;%dm", n), nil
+	}
+	return "", fmt.Errorf("invalid color %q: expected a name such as cyan or bright-red, a number from 0 to 255, #rrggbb, or a theme (colorblind, light, default)", s)
+}
+
+// color returns the color of a service that has the index-th color of the
+// palette unless it has a fixed color. Services of other projects, shown as
+// project/service, also match a fixed color given to the bare name.
+func (p *Palette) color(service string, index int) string {
+	if seq, ok := p.fixed[service]; ok {
+		return seq
+	}
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		if seq, ok := p.fixed[service[i+1:]]; ok {
+			return seq
+		}
+	}
+	return p.colors[index%len(p.colors)]
+}
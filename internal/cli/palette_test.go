@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"cyan", "\033[36m"},
+		{"bright-red", "\033[91m"},
+		{"Blue", "\033[34m"},
+		{"208", "\033[38;5;208m"},
+		{"#ff8800", "\033[38;2;255;136;0m"},
+	}
+	for _, tt := range tests {
+		got, err := parseColor(tt.input)
+		if err != nil {
+			t.Errorf("parseColor(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseColor(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"pink", "256", "-1", "#ff88", "#gg0000", "bright-"} {
+		if _, err := parseColor(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	p, err := ParsePalette("colorblind, api=#ff8800, 208")
+	if err != nil {
+		t.Fatalf("ParsePalette failed: %v", err)
+	}
+	if len(p.colors) != len(themes["colorblind"])+1 || p.colors[len(p.colors)-1] != "\033[38;5;208m" {
+		t.Errorf("expected the theme's colors followed by 208, got %q", p.colors)
+	}
+	if got := p.color("api", 3); got != "\033[38;2;255;136;0m" {
+		t.Errorf("expected the fixed color of api, got %q", got)
+	}
+	if got := p.color("other/api", 3); got != "\033[38;2;255;136;0m" {
+		t.Errorf("expected the fixed color of api for another project's api, got %q", got)
+	}
+	if got := p.color("db", 1); got != themes["colorblind"][1] {
+		t.Errorf("expected the second color of the palette, got %q", got)
+	}
+
+	// Fixed colors alone keep the default palette for other services
+	p, err = ParsePalette("api=red")
+	if err != nil {
+		t.Fatalf("ParsePalette failed: %v", err)
+	}
+	if !slices.Equal(p.colors, serviceColors) {
+		t.Errorf("expected the default palette, got %q", p.colors)
+	}
+
+	if _, err := ParsePalette("cyan,db=nope"); err == nil || !strings.Contains(err.Error(), `service "db"`) {
+		t.Errorf("expected an error for db's color, got %v", err)
+	}
+}
+
+func TestLogFormatter_Palette(t *testing.T) {
+	orig := Colors
+	defer func() { Colors = orig }()
+	var err error
+	if Colors, err = ParsePalette("green,blue,worker=red"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	formatter := NewLogFormatter(&buf, []string{"api", "worker"})
+	formatter.PrintEntry(protocol.LogEntry{Service: "api", Line: "a", Color: 3})
+	formatter.PrintEntry(protocol.LogEntry{Service: "worker", Line: "w", Color: 0})
+
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0], "\033[34m") {
+		t.Errorf("expected api in the fourth color, which wraps to blue, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "\033[31m") {
+		t.Errorf("expected worker in its fixed color, got %q", lines[1])
+	}
+}
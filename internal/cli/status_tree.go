@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// statusTree orders services for `status --tree` and returns them with the
+// labels shown in the NAME column. Each service is placed below the
+// dependency it starts after, i.e. the one that comes last in start order,
+// so dependencies appear above their dependents. Other dependencies of a
+// service are listed after its name.
+func statusTree(services []protocol.ServiceStatus) ([]protocol.ServiceStatus, []string) {
+	byName := make(map[string]protocol.ServiceStatus, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	// Start order: dependencies first, otherwise in the order given
+	var order []string
+	visited := make(map[string]bool, len(services))
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; ok {
+				visit(dep)
+			}
+		}
+		order = append(order, name)
+	}
+	for _, svc := range services {
+		visit(svc.Name)
+	}
+	startIndex := make(map[string]int, len(order))
+	for i, name := range order {
+		startIndex[name] = i
+	}
+
+	parent := make(map[string]string)
+	children := make(map[string][]string)
+	var roots []string
+	for _, name := range order {
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; ok && (parent[name] == "" || startIndex[dep] > startIndex[parent[name]]) {
+				parent[name] = dep
+			}
+		}
+		if p := parent[name]; p != "" {
+			children[p] = append(children[p], name)
+		} else {
+			roots = append(roots, name)
+		}
+	}
+
+	var sorted []protocol.ServiceStatus
+	var labels []string
+	var walk func(name, prefix, indent string)
+	walk = func(name, prefix, indent string) {
+		svc := byName[name]
+		label := prefix + name
+		var others []string
+		for _, dep := range svc.DependsOn {
+			if dep != parent[name] {
+				others = append(others, dep)
+			}
+		}
+		if len(others) > 0 {
+			label += " (+" + strings.Join(others, ", ") + ")"
+		}
+		sorted = append(sorted, svc)
+		labels = append(labels, label)
+
+		kids := children[name]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				walk(child, indent+"└─ ", indent+"   ")
+			} else {
+				walk(child, indent+"├─ ", indent+"│  ")
+			}
+		}
+	}
+	for _, name := range roots {
+		walk(name, "", "")
+	}
+	return sorted, labels
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// Supported output formats for the 'status' command.
+const (
+	StatusFormatTable = "table"
+	StatusFormatJSON  = "json"
+	StatusFormatYAML  = "yaml"
+)
+
+// FormatStatus writes the raw status result to out as JSON or YAML, for
+// scripts that would otherwise scrape the table. Both use the JSON field
+// names of protocol.StatusResult.
+func FormatStatus(out io.Writer, result protocol.StatusResult, format string) error {
+	if result.Services == nil {
+		result.Services = []protocol.ServiceStatus{}
+	}
+
+	switch format {
+	case StatusFormatJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case StatusFormatYAML:
+		// JSON is valid YAML, so decoding it keeps the field names and order
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown status format: %q (expected json or yaml)", format)
+	}
+}
+
+// blockStyle clears the flow and quoting styles of a node decoded from JSON,
+// so that it is written as block YAML. Strings that would read as another
+// type are still quoted by the encoder.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestFormatStatus_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	result := protocol.StatusResult{
+		Services: []protocol.ServiceStatus{{Name: "api", State: "running", PID: 123, Restarts: 1}},
+		Env:      "prod",
+	}
+
+	if err := FormatStatus(&buf, result, StatusFormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got protocol.StatusResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if len(got.Services) != 1 || got.Services[0].PID != 123 || got.Env != "prod" {
+		t.Errorf("unexpected result: %+v", got)
+	}
+}
+
+func TestFormatStatus_YAML(t *testing.T) {
+	var buf bytes.Buffer
+	result := protocol.StatusResult{
+		Services: []protocol.ServiceStatus{
+			{Name: "api", State: "running", PID: 123, Restarts: 0, DependsOn: []string{"db"}},
+			{Name: "true", State: "stopped", Restarts: 2},
+		},
+	}
+
+	if err := FormatStatus(&buf, result, StatusFormatYAML); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `services:
+  - name: api
+    state: running
+    pid: 123
+    restarts: 0
+    ready: false
+    color: 0
+    depends_on:
+      - db
+  - name: "true"
+    state: stopped
+    restarts: 2
+    ready: false
+    color: 0
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestFormatStatus_NoServices(t *testing.T) {
+	var buf bytes.Buffer
+	if err := FormatStatus(&buf, protocol.StatusResult{}, StatusFormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "{\n  \"services\": []\n}\n" {
+		t.Errorf("expected an empty list of services, got %q", buf.String())
+	}
+}
+
+func TestFormatStatus_Unknown(t *testing.T) {
+	if err := FormatStatus(&bytes.Buffer{}, protocol.StatusResult{}, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux || darwin
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// terminalSize returns the size of the terminal f refers to, failing if f
+// is not a terminal.
+func terminalSize(f *os.File) (*protocol.TerminalSize, error) {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return nil, err
+	}
+	return &protocol.TerminalSize{Rows: ws.Row, Cols: ws.Col}, nil
+}
+
+// makeRaw puts the terminal f refers to into raw mode, as cfmakeraw(3)
+// does, so that keys such as Ctrl-C reach the other end as input. It
+// returns a function that restores the previous mode.
+func makeRaw(f *os.File) (restore func(), err error) {
+	var saved syscall.Termios
+	if err := ioctl(f, ioctlGetTermios, unsafe.Pointer(&saved)); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(f, ioctlSetTermios, unsafe.Pointer(&saved)) }, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// terminalSize always fails, as exec runs commands without a terminal on
+// this platform.
+func terminalSize(f *os.File) (*protocol.TerminalSize, error) {
+	return nil, errors.New("terminals are only supported on Linux and macOS")
+}
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("terminals are only supported on Linux and macOS")
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+)
+
+// TmuxOptions configures the 'tmux' command.
+type TmuxOptions struct {
+	Session string // Session name (default: comproc-<project>)
+	Panes   bool   // Split one window into a pane per service instead of a window per service
+	Attach  bool   // Run `comproc attach` instead of `comproc logs -f` in each pane
+	Detach  bool   // Create the session without attaching to it
+}
+
+// RunTmux executes the 'tmux' command — creates a tmux session showing each
+// service in its own window or pane, then attaches to it. The panes run
+// comproc commands against the running daemon. If the session already
+// exists, it is attached as is.
+func RunTmux(socketPath, configPath string, services []string, opts TmuxOptions) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return ConfigErrorf("failed to load config: %w", err)
+	}
+	if len(services) == 0 {
+		// External services have no output to show
+		for _, name := range cfg.ServiceNames() {
+			if !cfg.Services[name].IsExternal() {
+				services = append(services, name)
+			}
+		}
+		if len(services) == 0 {
+			return fmt.Errorf("no services to show")
+		}
+	}
+	for _, name := range services {
+		if _, ok := cfg.Services[name]; !ok {
+			return serviceNotFound(name, cfg.ServiceNames())
+		}
+	}
+
+	client := NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		return DaemonErrorf("daemon is not running; start services with `comproc up` first")
+	}
+	client.Close()
+
+	tmux, err := exec.LookPath("tmux")
+	if err != nil {
+		return fmt.Errorf("tmux not found: %w", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	session := opts.Session
+	if session == "" {
+		session = tmuxSessionName(cfg, configPath)
+	}
+
+	// has-session with a leading "=" matches the name exactly
+	if exec.Command(tmux, "has-session", "-t", "="+session).Run() != nil {
+		args := tmuxCommands(exe, socketPath, configPath, session, services, opts)
+		if out, err := exec.Command(tmux, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to create tmux session: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if opts.Detach {
+		fmt.Printf("Created tmux session %s\n", session)
+		return nil
+	}
+
+	// Inside tmux, attaching would nest sessions
+	attach := "attach-session"
+	if os.Getenv("TMUX") != "" {
+		attach = "switch-client"
+	}
+	cmd := exec.Command(tmux, attach, "-t", "="+session)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// tmuxSessionName returns the default session name for a project. tmux
+// does not allow "." or ":" in session names.
+func tmuxSessionName(cfg *config.Config, configPath string) string {
+	project := cfg.Name
+	if project == "" {
+		project = filepath.Base(filepath.Dir(configPath))
+	}
+	return "comproc-" + strings.NewReplacer(".", "_", ":", "_").Replace(project)
+}
+
+// tmuxCommands returns the arguments of a single tmux invocation that
+// creates the session. Commands are separated by ";" arguments so that tmux
+// runs them in order before any pane command can exit. Panes are kept open
+// after their command exits, so errors stay visible.
+func tmuxCommands(exe, socketPath, configPath, session string, services []string, opts TmuxOptions) []string {
+	paneCommand := func(service string) string {
+		subcommand := "logs -f"
+		if opts.Attach {
+			subcommand = "attach"
+		}
+		return fmt.Sprintf("COMPROC_SOCKET=%s %s -f %s %s %s",
+			shellQuote(socketPath), shellQuote(exe), shellQuote(configPath), subcommand, shellQuote(service))
+	}
+
+	var args []string
+	add := func(cmd ...string) {
+		if len(args) > 0 {
+			args = append(args, ";")
+		}
+		args = append(args, cmd...)
+	}
+
+	if opts.Panes {
+		window := session + ":services"
+		add("new-session", "-d", "-s", session, "-n", "services", paneCommand(services[0]))
+		add("set-option", "-w", "-t", window, "remain-on-exit", "on")
+		add("set-option", "-w", "-t", window, "pane-border-status", "top")
+		add("select-pane", "-t", window, "-T", services[0])
+		for _, service := range services[1:] {
+			add("split-window", "-t", window, paneCommand(service))
+			add("select-pane", "-T", service)
+			// Re-tile after each split so there is room for the next pane
+			add("select-layout", "-t", window, "tiled")
+		}
+		add("select-pane", "-t", window+".0")
+		return args
+	}
+
+	add("new-session", "-d", "-s", session, "-n", services[0], paneCommand(services[0]))
+	add("set-option", "-w", "remain-on-exit", "on")
+	for _, service := range services[1:] {
+		add("new-window", "-t", session+":", "-n", service, paneCommand(service))
+		add("set-option", "-w", "remain-on-exit", "on")
+	}
+	add("select-window", "-t", session+":^")
+	return args
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestTmuxSessionName(t *testing.T) {
+	tests := []struct {
+		name       string
+		configPath string
+		want       string
+	}{
+		{"shop", "/src/app/comproc.yaml", "comproc-shop"},
+		{"", "/src/my.app/comproc.yaml", "comproc-my_app"},
+	}
+	for _, tt := range tests {
+		got := tmuxSessionName(&config.Config{Name: tt.name}, tt.configPath)
+		if got != tt.want {
+			t.Errorf("tmuxSessionName(%q, %q) = %q, want %q", tt.name, tt.configPath, got, tt.want)
+		}
+	}
+}
+
+// splitTmuxCommands splits tmux arguments into the ";"-separated commands.
+func splitTmuxCommands(args []string) [][]string {
+	var cmds [][]string
+	start := 0
+	for i, arg := range args {
+		if arg == ";" {
+			cmds = append(cmds, args[start:i])
+			start = i + 1
+		}
+	}
+	return append(cmds, args[start:])
+}
+
+func TestTmuxCommands_Windows(t *testing.T) {
+	args := tmuxCommands("/bin/comproc", "/tmp/c.sock", "/src/comproc.yaml", "s", []string{"api", "db"}, TmuxOptions{})
+	cmds := splitTmuxCommands(args)
+
+	var windows []string
+	for _, cmd := range cmds {
+		if cmd[0] == "new-session" || cmd[0] == "new-window" {
+			windows = append(windows, cmd[slices.Index(cmd, "-n")+1])
+		}
+	}
+	if want := []string{"api", "db"}; !slices.Equal(windows, want) {
+		t.Errorf("expected windows %v, got %v", want, windows)
+	}
+
+	first := cmds[0]
+	want := "COMPROC_SOCKET='/tmp/c.sock' '/bin/comproc' -f '/src/comproc.yaml' logs -f 'api'"
+	if first[len(first)-1] != want {
+		t.Errorf("expected pane command %q, got %q", want, first[len(first)-1])
+	}
+}
+
+func TestTmuxCommands_Panes(t *testing.T) {
+	args := tmuxCommands("/bin/comproc", "/tmp/c.sock", "/src/comproc.yaml", "s", []string{"api", "db", "web"}, TmuxOptions{Panes: true, Attach: true})
+	cmds := splitTmuxCommands(args)
+
+	var splits int
+	for _, cmd := range cmds {
+		switch cmd[0] {
+		case "new-window":
+			t.Errorf("expected no extra windows, got %v", cmd)
+		case "split-window":
+			splits++
+			if !strings.HasSuffix(cmd[len(cmd)-1], "attach 'db'") && !strings.HasSuffix(cmd[len(cmd)-1], "attach 'web'") {
+				t.Errorf("unexpected pane command: %q", cmd[len(cmd)-1])
+			}
+		}
+	}
+	if splits != 2 {
+		t.Errorf("expected 2 splits, got %d", splits)
+	}
+}
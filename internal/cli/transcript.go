@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// transcriptTimeFormat is the time of each line of a transcript, with
+// milliseconds so that input and the output it causes can be told apart.
+const transcriptTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// transcript records an attach session for `attach --record`: each line
+// sent to the service and each line of its output, with the time it was
+// sent or received and its stream:
+//
+//	2024-01-15T10:30:00.123+09:00 stdin  help
+//	2024-01-15T10:30:00.125+09:00 stdout commands: help, quit
+//
+// A nil *transcript records nothing.
+type transcript struct {
+	mu   sync.Mutex
+	w    io.WriteCloser
+	err  error // First write error
+	now  func() time.Time
+	open bool
+}
+
+// createTranscript creates the transcript file at path, replacing any
+// existing file.
+func createTranscript(path string) (*transcript, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %w", err)
+	}
+	return newTranscript(file), nil
+}
+
+func newTranscript(w io.WriteCloser) *transcript {
+	return &transcript{w: w, now: time.Now, open: true}
+}
+
+// Input records a line sent to the service's stdin.
+func (t *transcript) Input(line string) {
+	t.record("stdin", line)
+}
+
+// InputWriter returns a writer that records the input written to it, a
+// line at a time. Its Flush records the input after the last newline.
+func (t *transcript) InputWriter() *inputRecorder {
+	return &inputRecorder{t: t}
+}
+
+// inputRecorder records input sent to the service's stdin in a transcript.
+type inputRecorder struct {
+	t       *transcript
+	pending []byte // Input after the last newline
+}
+
+func (r *inputRecorder) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	for {
+		i := bytes.IndexByte(r.pending, '\n')
+		if i < 0 {
+			break
+		}
+		r.t.Input(string(r.pending[:i]))
+		r.pending = r.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush records the input after the last newline, if any.
+func (r *inputRecorder) Flush() {
+	if len(r.pending) > 0 {
+		r.t.Input(string(r.pending))
+		r.pending = nil
+	}
+}
+
+// Output records a line of the service's output.
+func (t *transcript) Output(entry protocol.LogEntry) {
+	t.record(entry.Stream, entry.RawLine())
+}
+
+func (t *transcript) record(stream, line string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil || !t.open {
+		return
+	}
+	_, t.err = fmt.Fprintf(t.w, "%s %-6s %s\n", t.now().Format(transcriptTimeFormat), stream, line)
+}
+
+// Close closes the transcript file and returns the first error met while
+// writing it.
+func (t *transcript) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open = false
+	if err := t.w.Close(); err != nil && t.err == nil {
+		t.err = err
+	}
+	if t.err != nil {
+		return fmt.Errorf("failed to write transcript: %w", t.err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	if err := os.WriteFile(path, []byte("previous session\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := createTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	record.now = func() time.Time {
+		now = now.Add(5 * time.Millisecond)
+		return now
+	}
+	// Input is recorded by line, however it is split when read
+	input := record.InputWriter()
+	input.Write([]byte("he"))
+	input.Write([]byte("lp\nqu"))
+	record.Output(protocol.LogEntry{Service: "repl", Line: "commands: help, quit", Stream: "stdout"})
+	record.Output(protocol.LogEntry{Service: "repl", Line: "aGk=", Encoding: "base64", Stream: "stderr"})
+	input.Write([]byte("it"))
+	input.Flush()
+	if err := record.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Lines after the session are not recorded
+	record.Input("quit")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2024-01-15T10:30:00.005Z stdin  help\n" +
+		"2024-01-15T10:30:00.010Z stdout commands: help, quit\n" +
+		"2024-01-15T10:30:00.015Z stderr hi\n" +
+		"2024-01-15T10:30:00.020Z stdin  quit\n"
+	if string(data) != want {
+		t.Errorf("expected transcript:\n%s\ngot:\n%s", want, data)
+	}
+
+	// A nil transcript records nothing
+	var none *transcript
+	none.Input("help")
+	none.InputWriter().Write([]byte("help\n"))
+	if err := none.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTranscript_CreateError(t *testing.T) {
+	_, err := createTranscript(filepath.Join(t.TempDir(), "missing", "session.log"))
+	if err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
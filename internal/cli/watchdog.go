@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ryym/comproc/internal/daemon"
+	"github.com/ryym/comproc/internal/process"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+const (
+	// watchdogPollInterval is how often the watchdog records which services
+	// are running, so that it can start them again after a crash.
+	watchdogPollInterval = time.Second
+	// watchdogRespawnDelay is the pause before a crashed daemon is started again.
+	watchdogRespawnDelay = time.Second
+	// watchdogMaxCrashes crashes within watchdogCrashWindow make the watchdog give up.
+	watchdogMaxCrashes  = 5
+	watchdogCrashWindow = time.Minute
+)
+
+// RunDaemonWatchdog runs the daemon as a child process and starts it again
+// if it dies unexpectedly (e.g. from a panic or a kill) while services are
+// running. The new daemon stops the processes left over from the crashed one
+// (see daemon.Journal), and the watchdog starts those services again.
+// A daemon that shuts down normally ends the watchdog.
+func RunDaemonWatchdog(socketPath, configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var crashes crashHistory
+	var restore []string
+	for {
+		cmd := exec.Command(exe, append(ConfigArgs(configPath), "__daemon")...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start daemon: %w", err)
+		}
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		tracker := newServiceTracker(socketPath, configPath)
+		if len(restore) > 0 {
+			tracker.restore(restore)
+		}
+		go tracker.run()
+
+		var exitErr error
+		select {
+		case sig := <-sigCh:
+			// Forward the signal and let the daemon shut down normally
+			cmd.Process.Signal(sig)
+			exitErr = <-exited
+			tracker.stop()
+			return exitErr
+		case exitErr = <-exited:
+		}
+		tracker.stop()
+
+		if exitErr == nil {
+			return nil
+		}
+		restore = tracker.running()
+		if len(restore) == 0 {
+			return fmt.Errorf("daemon exited: %w", exitErr)
+		}
+		if crashes.add(time.Now()) >= watchdogMaxCrashes {
+			return fmt.Errorf("daemon crashed %d times within %s, giving up: %w", watchdogMaxCrashes, watchdogCrashWindow, exitErr)
+		}
+
+		fmt.Fprintf(os.Stderr, "comproc: daemon exited unexpectedly (%v); restarting it with %s\n", exitErr, strings.Join(restore, ", "))
+		time.Sleep(watchdogRespawnDelay)
+	}
+}
+
+// crashHistory counts recent daemon crashes.
+type crashHistory struct {
+	times []time.Time
+}
+
+// add records a crash at t and returns the number of crashes within
+// watchdogCrashWindow before t, including this one.
+func (h *crashHistory) add(t time.Time) int {
+	recent := h.times[:0]
+	for _, c := range h.times {
+		if t.Sub(c) < watchdogCrashWindow {
+			recent = append(recent, c)
+		}
+	}
+	h.times = append(recent, t)
+	return len(h.times)
+}
+
+// serviceTracker periodically records which services of the project are
+// running in the daemon.
+type serviceTracker struct {
+	socketPath string
+	configPath string
+	done       chan struct{}
+	stopped    chan struct{}
+
+	mu       sync.Mutex
+	services []string
+	pending  []string // Services to start once the daemon is reachable
+}
+
+func newServiceTracker(socketPath, configPath string) *serviceTracker {
+	return &serviceTracker{
+		socketPath: socketPath,
+		configPath: configPath,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// restore makes the tracker start the given services once the daemon accepts
+// connections. Until then, they count as running.
+func (t *serviceTracker) restore(services []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = services
+	t.services = services
+}
+
+// running returns the services that were running at the last poll.
+func (t *serviceTracker) running() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.services
+}
+
+func (t *serviceTracker) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(watchdogPollInterval)
+	defer ticker.Stop()
+	for {
+		t.poll()
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *serviceTracker) stop() {
+	close(t.done)
+	<-t.stopped
+}
+
+func (t *serviceTracker) poll() {
+	client := NewClient(t.socketPath)
+	client.SetConfigPath(t.configPath)
+	client.SetTimeout(5 * time.Second)
+	if err := client.Connect(); err != nil {
+		return
+	}
+	defer client.Close()
+
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(pending) > 0 {
+		if _, err := client.Up(pending, false, false); err != nil {
+			fmt.Fprintf(os.Stderr, "comproc: failed to restart services: %v\n", err)
+		}
+	}
+
+	result, err := client.Status()
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	t.services = runningServices(result.Services)
+	t.mu.Unlock()
+}
+
+// runningServices returns the names of the running, starting, or
+// restarting services of the watched project. Services of other projects sharing the daemon (named
+// "project/service") are not restored, as their configs are unknown here.
+func runningServices(statuses []protocol.ServiceStatus) []string {
+	var names []string
+	for _, st := range statuses {
+		if strings.Contains(st.Name, "/") {
+			continue
+		}
+		switch st.State {
+		case string(process.StateRunning), string(process.StateStarting), daemon.StateRestarting:
+			names = append(names, st.Name)
+		}
+	}
+	return names
+}
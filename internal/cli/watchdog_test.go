@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestCrashHistory(t *testing.T) {
+	var h crashHistory
+	start := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		if got := h.add(start.Add(time.Duration(i) * time.Second)); got != i {
+			t.Errorf("crash %d: expected count %d, got %d", i, i, got)
+		}
+	}
+
+	// Crashes older than the window are forgotten
+	if got := h.add(start.Add(watchdogCrashWindow + 2*time.Second)); got != 2 {
+		t.Errorf("expected count 2 after the window passed, got %d", got)
+	}
+}
+
+func TestRunningServices(t *testing.T) {
+	statuses := []protocol.ServiceStatus{
+		{Name: "api", State: "running", PID: 10},
+		{Name: "db", State: "starting"},
+		{Name: "worker", State: "stopped"},
+		{Name: "job", State: "failed"},
+		{Name: "flaky", State: "restarting"},
+		{Name: "other/api", State: "running", PID: 20},
+	}
+
+	got := runningServices(statuses)
+	want := []string{"api", "db", "flaky"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
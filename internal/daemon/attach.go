@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// Attachment is a client attached to a service. Every attached client
+// receives the service's output; whose input reaches the service's stdin
+// depends on the service's attach_stdin policy.
+type Attachment struct {
+	service  string
+	readOnly bool
+	changed  func() // Called when other clients attach or detach
+}
+
+// attachments tracks the clients attached to each service.
+type attachments struct {
+	mu      sync.Mutex
+	clients map[string][]*Attachment // By service, in attach order
+}
+
+// Attach registers a client attached to a service. changed is called
+// whenever another client attaches to or detaches from the service, after
+// which AttachState returns the client's new state. It must not block.
+func (d *Daemon) Attach(service string, readOnly bool, changed func()) *Attachment {
+	a := &Attachment{service: service, readOnly: readOnly, changed: changed}
+
+	d.attached.mu.Lock()
+	defer d.attached.mu.Unlock()
+	if d.attached.clients == nil {
+		d.attached.clients = make(map[string][]*Attachment)
+	}
+	d.attached.clients[a.service] = append(d.attached.clients[a.service], a)
+	d.notifyAttached(a)
+	return a
+}
+
+// Detach unregisters a client attached with Attach.
+func (d *Daemon) Detach(a *Attachment) {
+	d.attached.mu.Lock()
+	defer d.attached.mu.Unlock()
+	clients := slices.DeleteFunc(d.attached.clients[a.service], func(c *Attachment) bool { return c == a })
+	if len(clients) == 0 {
+		delete(d.attached.clients, a.service)
+		return
+	}
+	d.attached.clients[a.service] = clients
+	d.notifyAttached(a)
+}
+
+// AttachState returns the current state of an attached client.
+func (d *Daemon) AttachState(a *Attachment) protocol.AttachState {
+	d.attached.mu.Lock()
+	defer d.attached.mu.Unlock()
+	return protocol.AttachState{
+		Clients: len(d.attached.clients[a.service]),
+		Stdin:   d.canSendStdin(a),
+	}
+}
+
+// WriteAttachedStdin writes input of an attached client to the service's
+// stdin, unless the client is not allowed to send input.
+func (d *Daemon) WriteAttachedStdin(a *Attachment, data []byte) error {
+	d.attached.mu.Lock()
+	allowed := d.canSendStdin(a)
+	d.attached.mu.Unlock()
+
+	if !allowed {
+		return nil
+	}
+	return d.WriteStdin(a.service, data)
+}
+
+// notifyAttached tells the clients of a's service other than a that their
+// state may have changed. The caller holds d.attached.mu.
+func (d *Daemon) notifyAttached(a *Attachment) {
+	for _, c := range d.attached.clients[a.service] {
+		if c != a {
+			c.changed()
+		}
+	}
+}
+
+// canSendStdin reports whether input of a client reaches the service. The
+// caller holds d.attached.mu.
+func (d *Daemon) canSendStdin(a *Attachment) bool {
+	if a.readOnly || !slices.Contains(d.attached.clients[a.service], a) {
+		return false
+	}
+	d.mu.RLock()
+	svc, ok := d.config.Services[a.service]
+	d.mu.RUnlock()
+	if !ok || svc.GetAttachStdin() == config.AttachStdinShared {
+		return true
+	}
+
+	// Only the earliest client that sends input has stdin
+	for _, c := range d.attached.clients[a.service] {
+		if !c.readOnly {
+			return c == a
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+func TestAttach_StdinPolicy(t *testing.T) {
+	d := &Daemon{config: &config.Config{Services: map[string]*config.Service{
+		"web":  {Command: "npm run dev"},
+		"repl": {Command: "python3 -i", AttachStdin: config.AttachStdinFirst},
+	}}}
+
+	var webChanges int
+	web1 := d.Attach("web", false, func() { webChanges++ })
+	web2 := d.Attach("web", false, func() {})
+	if webChanges != 1 {
+		t.Errorf("expected the first client to be notified once, got %d", webChanges)
+	}
+	for _, a := range []*Attachment{web1, web2} {
+		if got := d.AttachState(a); got != (protocol.AttachState{Clients: 2, Stdin: true}) {
+			t.Errorf("expected shared stdin, got %+v", got)
+		}
+	}
+
+	watcher := d.Attach("repl", true, func() {})
+	first := d.Attach("repl", false, func() {})
+	second := d.Attach("repl", false, func() {})
+	if d.AttachState(watcher).Stdin || !d.AttachState(first).Stdin || d.AttachState(second).Stdin {
+		t.Error("expected only the first client that sends input to have stdin")
+	}
+
+	// stdin passes to the next client
+	d.Detach(first)
+	if got := d.AttachState(second); got != (protocol.AttachState{Clients: 2, Stdin: true}) {
+		t.Errorf("expected the second client to take over stdin, got %+v", got)
+	}
+	if d.AttachState(first).Stdin {
+		t.Error("expected a detached client not to have stdin")
+	}
+}
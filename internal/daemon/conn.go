@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// shutdownNoticeTimeout limits how long the daemon waits for a client to
+// accept the shutdown notification, so an unresponsive client can't hold up
+// the shutdown.
+const shutdownNoticeTimeout = 100 * time.Millisecond
+
+// connection is a client connection to the server. Resources that handlers
+// acquire for the client, such as log subscriptions, are tied to the
+// connection and released when it closes, however the handler ends.
+type connection struct {
+	net.Conn
+	reader *bufio.Reader
+	// ctx is cancelled when the client disconnects, the server shuts down,
+	// or a streaming handler ends the connection
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Streams of the connection, and those waiting for the one-off
+	// command that names them
+	streams *protocol.StreamMux
+	held    heldStreams
+
+	// The service the client is attached to, set once "attach" succeeds
+	attachment *Attachment
+
+	mu       sync.Mutex
+	releases []func()
+	closed   bool
+}
+
+func newConnection(ctx context.Context, conn net.Conn) *connection {
+	ctx, cancel := context.WithCancel(ctx)
+	return &connection{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+		ctx:    ctx,
+		cancel: cancel,
+		held:   make(heldStreams),
+	}
+}
+
+// onClose registers release to be called when the connection closes, or
+// calls it right away if the connection is already closed.
+func (c *connection) onClose(release func()) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		release()
+		return
+	}
+	c.releases = append(c.releases, release)
+	c.mu.Unlock()
+}
+
+// close cancels the connection's context, releases everything registered
+// with onClose, and closes the underlying connection.
+func (c *connection) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	releases := c.releases
+	c.releases = nil
+	c.mu.Unlock()
+
+	c.cancel()
+	for _, release := range releases {
+		release()
+	}
+	c.Conn.Close()
+}
+
+// notifyShutdown sends a "shutdown" notification to the client, unless the
+// connection is already closed, then closes it.
+func (c *connection) notifyShutdown() {
+	c.mu.Lock()
+	if !c.closed {
+		notification, _ := protocol.NewNotification(protocol.MethodShutdown, nil)
+		c.Conn.SetWriteDeadline(time.Now().Add(shutdownNoticeTimeout))
+		json.NewEncoder(c.Conn).Encode(notification)
+	}
+	c.mu.Unlock()
+	c.close()
+}
+
+// subscribeLogs subscribes to the logs of services for as long as the
+// connection is open.
+func (c *connection) subscribeLogs(d *Daemon, services []string) <-chan LogLine {
+	ch := d.SubscribeLogs(services)
+	c.onClose(func() { d.UnsubscribeLogs(ch) })
+	return ch
+}
+
+// watchDisconnect discards client input in the background and cancels the
+// connection's context once the client disconnects. Streaming handlers
+// that don't otherwise read from the client use it to stop streaming to a
+// client that is gone while there is nothing to write. No further requests
+// can be read from the connection.
+func (c *connection) watchDisconnect() {
+	go func() {
+		io.Copy(io.Discard, c.reader)
+		c.cancel()
+	}()
+}
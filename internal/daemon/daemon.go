@@ -5,66 +5,144 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/ryym/comproc/internal/config"
+	"github.com/ryym/comproc/config"
 	"github.com/ryym/comproc/internal/process"
 )
 
+const (
+	// startConfirmWindow is how long a started service must keep running,
+	// unless it becomes ready sooner, to be reported as started.
+	startConfirmWindow = 500 * time.Millisecond
+	// startFailureLines is how many lines of output are reported for a
+	// service that exits within startConfirmWindow.
+	startFailureLines = 5
+)
+
 // Daemon manages processes and handles RPC requests.
 type Daemon struct {
 	mu sync.RWMutex
 
 	config       *config.Config
 	configPath   string
+	env          string   // Overlay merged onto config files (see config.LoadOverlay)
+	overrides    []string // Files merged onto the primary config file (see config.LoadOverrides)
 	serviceOrder []string
 	processes    map[string]*process.Process
+	projects     map[string]*project // Additional projects by config path
 	logMgr       *LogManager
+	history      *History
 	supervisor   *Supervisor
+	attached     attachments
+	ports        autoPorts
+	usage        usageSamples
+	replicas     replicaCounts
 
-	server *Server
-	ctx    context.Context
-	cancel context.CancelFunc
+	server    *Server
+	journal   *Journal
+	events    *EventLog
+	plugins   *Plugins
+	restored  map[string]journalRecord // Journal records of services not loaded yet
+	startedAt time.Time
+	graceful  time.Duration // How long stopped services may take to exit
+	listen    string        // TCP address to accept clients on, besides the socket
+	token     string        // Token TCP clients authenticate with, overriding socket.token_file
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
-// New creates a new daemon instance.
-func New(configPath string) (*Daemon, error) {
-	cfg, err := config.Load(configPath)
+// ConfigError is returned when a config file can't be loaded.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("failed to load config: %v", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// New creates a new daemon instance. The override files are merged onto
+// the config file in order. If env is not empty, the overlay of that name
+// is merged onto the config files the daemon loads.
+func New(configPath string, overrides []string, env string) (*Daemon, error) {
+	cfg, err := config.LoadOverrides(configPath, overrides, env)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
+		return nil, &ConfigError{Err: err}
 	}
 
 	absConfigPath, err := filepath.Abs(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute config path: %w", err)
 	}
+	var absOverrides []string
+	for _, path := range overrides {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute config path: %w", err)
+		}
+		absOverrides = append(absOverrides, absPath)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	d := &Daemon{
 		config:       cfg,
 		configPath:   absConfigPath,
+		env:          env,
+		overrides:    absOverrides,
 		serviceOrder: cfg.ServiceNames(),
 		processes:    make(map[string]*process.Process),
+		projects:     make(map[string]*project),
 		logMgr:       NewLogManager(1000), // Keep last 1000 lines per service
+		history:      NewHistory(),
+		startedAt:    time.Now(),
+		graceful:     cfg.GetGracefulTimeout(),
+		listen:       cfg.Socket.GetListen(),
 		ctx:          ctx,
 		cancel:       cancel,
 	}
 	d.supervisor = NewSupervisor(d)
+	d.logMgr.SetMemoryLimit(cfg.GetLogMemoryLimit())
+	for _, name := range d.serviceOrder {
+		d.logMgr.Color(name)
+	}
 
 	// Initialize processes
 	for name, svc := range cfg.Services {
-		// Resolve working directory relative to config file
-		if svc.WorkingDir != "" && !filepath.IsAbs(svc.WorkingDir) {
-			svc.WorkingDir = filepath.Join(filepath.Dir(absConfigPath), svc.WorkingDir)
-		} else if svc.WorkingDir == "" {
-			svc.WorkingDir = filepath.Dir(absConfigPath)
-		}
+		resolveWorkingDir(svc, absConfigPath)
 		d.processes[name] = process.New(svc)
+
+		for _, sinkCfg := range svc.Logging {
+			sinkCfg.Project = projectName(cfg, absConfigPath)
+			sink, err := NewLogSink(name, sinkCfg, filepath.Dir(absConfigPath))
+			if err != nil {
+				d.logMgr.Close()
+				cancel()
+				return nil, fmt.Errorf("service %q: failed to create %s log sink: %w", name, sinkCfg.Driver, err)
+			}
+			d.logMgr.AddSink(name, sink)
+		}
+
+		file, err := newLogFile(name, svc, filepath.Dir(absConfigPath))
+		if err != nil {
+			d.logMgr.Close()
+			cancel()
+			return nil, fmt.Errorf("service %q: failed to open log file: %w", name, err)
+		}
+		d.logMgr.setLogFile(name, svc, file)
 	}
 
 	return d, nil
@@ -72,28 +150,162 @@ func New(configPath string) (*Daemon, error) {
 
 // SocketPath returns the path to the Unix socket for the given config file.
 // Each config file path gets its own socket, so multiple comproc instances
-// can run independently.
-func SocketPath(configPath string) string {
+// can run independently. COMPROC_SOCKET takes precedence, then the path set
+// in the config's socket section, read with the override files and the
+// overlay named env merged onto it as the daemon reads it. A config that
+// can't be loaded is an error, as the daemon wouldn't start with it either;
+// a missing one leaves the path derived from configPath.
+func SocketPath(configPath string, overrides []string, env string) (string, error) {
 	// Allow override via COMPROC_SOCKET environment variable
 	if path := os.Getenv("COMPROC_SOCKET"); path != "" {
-		return path
+		return path, nil
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		cfg, err := config.LoadOverrides(configPath, overrides, env)
+		if err != nil {
+			return "", err
+		}
+		if path := cfg.Socket.ResolvePath(configPath); path != "" {
+			return path, nil
+		}
 	}
 	hash := sha256.Sum256([]byte(configPath))
 	suffix := hex.EncodeToString(hash[:6]) // 12 hex chars
 	name := fmt.Sprintf("comproc-%s.sock", suffix)
 	// Use XDG_RUNTIME_DIR if available, otherwise fall back to tmp
 	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
-		return filepath.Join(dir, name)
+		return filepath.Join(dir, name), nil
 	}
-	return filepath.Join(os.TempDir(), name)
+	return filepath.Join(os.TempDir(), name), nil
+}
+
+// OutputPath returns the path of the file that receives the stdout and stderr
+// of a background daemon listening on socketPath.
+func OutputPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".log"
 }
 
 // Run starts the daemon and blocks until it's shut down.
 func (d *Daemon) Run(socketPath string) error {
+	// Don't take over the journal of a daemon that is still running
+	if conn, err := net.DialTimeout("unix", socketPath, 100*time.Millisecond); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", socketPath)
+	}
+
+	// The pidfile is removed last, once everything else is cleaned up
+	pidPath := PIDFilePath(socketPath)
+	pidFile, err := writePIDFile(pidPath)
+	if err != nil {
+		return err
+	}
+	defer removePIDFile(pidPath, pidFile)
+
+	journal, records, err := OpenJournal(JournalPath(socketPath))
+	if err != nil {
+		return err
+	}
+	d.journal = journal
+	d.restoreJournal(records)
+
+	events, err := OpenEventLog(EventsPath(socketPath))
+	if err != nil {
+		d.journal.Remove()
+		return err
+	}
+	d.events = events
+
+	if cfg := d.config.LogStore; cfg != nil {
+		dir := cfg.ResolveDir(d.configPath)
+		if dir == "" {
+			dir = LogStorePath(socketPath)
+		}
+		store, err := OpenLogStore(dir, cfg.GetSegmentSize(), cfg.GetMaxSize())
+		if err != nil {
+			d.journal.Remove()
+			d.events.Close()
+			return err
+		}
+		d.logMgr.SetStore(store)
+	}
+
+	plugins, err := startPlugins(d.config.Plugins, filepath.Dir(d.configPath), []string{
+		"COMPROC_SOCKET=" + socketPath,
+		"COMPROC_CONFIG=" + d.configPath,
+		"COMPROC_PROJECT=" + projectName(d.config, d.configPath),
+	})
+	if err != nil {
+		d.journal.Remove()
+		d.events.Close()
+		return err
+	}
+	d.plugins = plugins
+
 	d.server = NewServer(d, socketPath)
+	defer d.Close()
+
+	stateDone := make(chan struct{})
+	go func() {
+		defer close(stateDone)
+		d.writeStateFile(d.ctx, StateFilePath(socketPath))
+	}()
+	defer func() {
+		// Wait for the state file to be removed
+		d.cancel()
+		<-stateDone
+	}()
+	go d.watchUsage(d.ctx)
 	return d.server.Run(d.ctx)
 }
 
+// restoreJournal applies the state recorded by a previous daemon that did
+// not shut down cleanly: restart counts are carried over, and processes it
+// left running are stopped, as their output can no longer be collected.
+func (d *Daemon) restoreJournal(records map[string]journalRecord) {
+	var wg sync.WaitGroup
+	d.mu.Lock()
+	for name, rec := range records {
+		if proc, ok := d.processes[name]; ok {
+			proc.SetRestarts(rec.Restarts)
+		} else {
+			// May belong to a project that is loaded later
+			if d.restored == nil {
+				d.restored = make(map[string]journalRecord)
+			}
+			d.restored[name] = rec
+		}
+		if rec.PID != 0 {
+			wg.Go(func() {
+				stopLeftover(name, rec.PID)
+			})
+		}
+	}
+	d.mu.Unlock()
+	wg.Wait()
+}
+
+// Close cancels the daemon context and releases resources such as log sinks.
+// Services should be stopped before calling Close, which also removes the
+// journal as there is nothing left to restore and notifies plugins.
+func (d *Daemon) Close() error {
+	d.cancel()
+	d.journal.Remove()
+	d.emit(pluginEvent{Event: config.PluginEventDaemonDown})
+	d.plugins.Close()
+	d.events.Close()
+	return d.logMgr.Close()
+}
+
+// emit records a lifecycle event in the events file and sends it to the
+// plugins.
+func (d *Daemon) emit(e pluginEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	d.events.Write(e)
+	d.plugins.Emit(e)
+}
+
 // Shutdown gracefully shuts down the daemon.
 func (d *Daemon) Shutdown() error {
 	d.cancel()
@@ -112,16 +324,27 @@ func (d *Daemon) ShutdownAsync() []string {
 }
 
 // StartServices starts the specified services (or all if none specified).
-func (d *Daemon) StartServices(services []string) (started, failed []string) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+// A service whose dependencies have readiness checks is started only after
+// those dependencies become ready; if a dependency fails to become ready,
+// the service is reported as failed. A started service that exits with an
+// error within startConfirmWindow is also reported as failed. errs holds
+// why each service failed.
+func (d *Daemon) StartServices(services []string) (started, failed []string, errs map[string]string) {
+	return d.startServices(services, runReasonUp)
+}
 
+// startServices starts services like StartServices, recording reason in
+// the history of each started service.
+func (d *Daemon) startServices(services []string, reason string) (started, failed []string, errs map[string]string) {
+	errs = make(map[string]string)
+	d.mu.RLock()
 	toStart := services
 	if len(toStart) == 0 {
 		// Start all services in dependency order
 		sorted, err := d.config.TopologicalSort()
 		if err != nil {
-			return nil, []string{"all"}
+			d.mu.RUnlock()
+			return nil, []string{"all"}, map[string]string{"all": err.Error()}
 		}
 		for _, svc := range sorted {
 			toStart = append(toStart, svc.Name)
@@ -130,41 +353,176 @@ func (d *Daemon) StartServices(services []string) (started, failed []string) {
 		// Resolve dependencies for specified services
 		toStart = d.resolveDependencies(services)
 	}
+	d.mu.RUnlock()
 
+	var maybeStarted []string
 	for _, name := range toStart {
-		proc, ok := d.processes[name]
-		if !ok {
+		if err := d.waitDependencies(name); err != nil {
 			failed = append(failed, name)
+			errs[name] = err.Error()
 			continue
 		}
 
-		if proc.GetState() == process.StateRunning {
-			// Already running
-			continue
+		ok, err := d.startService(name, reason)
+		if err != nil {
+			failed = append(failed, name)
+			errs[name] = err.Error()
+		} else if ok {
+			maybeStarted = append(maybeStarted, name)
 		}
+	}
 
-		// Set up log capture
-		logWriter := d.logMgr.Writer(name)
-		proc.SetOutput(logWriter, logWriter)
-
-		if err := proc.Start(d.ctx); err != nil {
+	for _, name := range maybeStarted {
+		if err := d.confirmStarted(name); err != nil {
 			failed = append(failed, name)
+			errs[name] = err.Error()
 		} else {
 			started = append(started, name)
-			// Start monitoring for restart policy
-			svc := d.config.Services[name]
-			d.supervisor.StartMonitoring(d.ctx, name, proc, svc)
 		}
 	}
 
-	return started, failed
+	return started, failed, errs
+}
+
+// confirmStarted waits until a started service has been running for
+// startConfirmWindow or has become ready, and returns an error with the
+// end of its output if it exited with an error before that. Commands that
+// fail right away, such as those with a wrong flag or a missing binary,
+// are reported this way rather than as started.
+func (d *Daemon) confirmStarted(name string) error {
+	d.mu.RLock()
+	proc := d.processes[name]
+	svc := d.config.Services[name]
+	d.mu.RUnlock()
+
+	startedAt := proc.GetStartedAt()
+	done := proc.Wait()
+	ctx, cancel := context.WithDeadline(d.ctx, startedAt.Add(startConfirmWindow))
+	defer cancel()
+
+	if svc.HasReadinessCheck() && proc.WaitReady(ctx) == nil {
+		return nil
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// The window may have passed while earlier services were being
+		// confirmed, so check for an exit within it as well
+		exitedAt := proc.GetExitedAt()
+		if exitedAt.IsZero() || exitedAt.After(startedAt.Add(startConfirmWindow)) {
+			return nil
+		}
+	}
+
+	var msg string
+	if sig := proc.GetExitSignal(); sig != 0 {
+		msg = "killed by " + process.SignalName(sig)
+	} else if code := proc.GetExitCode(); code != 0 {
+		msg = fmt.Sprintf("exited with code %d", code)
+	} else {
+		// Commands that finish their work at once are fine
+		return nil
+	}
+	for _, line := range d.logMgr.GetLinesSince([]string{name}, startedAt, startFailureLines) {
+		if line.Stream != StreamMarker {
+			msg += "\n" + line.Line
+		}
+	}
+	return errors.New(msg)
+}
+
+// startService starts a single service unless it is already running.
+// It reports whether the service was started. The daemon lock is not held
+// while the process starts, as running its prepare command may take a while.
+func (d *Daemon) startService(name, reason string) (bool, error) {
+	d.mu.RLock()
+	proc, ok := d.processes[name]
+	svc := d.config.Services[name]
+	d.mu.RUnlock()
+
+	if !ok {
+		return false, fmt.Errorf("service not found: %s", name)
+	}
+
+	if state := proc.GetState(); state == process.StateRunning || state == process.StateStarting {
+		// Already running, or being started by another request
+		return false, nil
+	}
+
+	// Set up log capture
+	proc.SetOutput(d.logMgr.Writer(name), d.logMgr.ErrWriter(name))
+
+	env, err := d.runtimeEnv(name)
+	if err == nil {
+		proc.SetExtraEnv(env)
+		err = proc.Start(d.ctx)
+	}
+	if errors.Is(err, process.ErrAlreadyRunning) {
+		// Another request started it since the state was checked
+		return false, nil
+	}
+	if err != nil {
+		d.history.FailedToStart(name, reason, proc.GetExitCode(), err)
+		d.emit(pluginEvent{Event: config.PluginEventServiceFailed, Service: name, Error: err.Error()})
+		return false, err
+	}
+	d.history.Started(name, reason, proc.GetStartedAt())
+	d.journal.Record(name, journalStarted, proc.PID(), 0, proc.GetRestarts())
+	d.emit(pluginEvent{Event: config.PluginEventServiceStarted, Service: name, PID: proc.PID(), Restarts: proc.GetRestarts()})
+
+	// Start monitoring for restart policy
+	d.supervisor.StartMonitoring(d.ctx, name, proc, svc)
+	return true, nil
+}
+
+// waitDependencies blocks until every dependency of the service that has a
+// readiness check is ready, unless its condition is service_started.
+// External dependencies always have one.
+func (d *Daemon) waitDependencies(name string) error {
+	d.mu.RLock()
+	svc, ok := d.config.Services[name]
+	if !ok {
+		d.mu.RUnlock()
+		return fmt.Errorf("service not found: %s", name)
+	}
+	var deps []*process.Process
+	var depNames []string
+	for _, dep := range svc.DependsOn {
+		if depSvc, ok := d.config.Services[dep.Service]; ok && dep.WaitsReady(depSvc) {
+			deps = append(deps, d.processes[dep.Service])
+			depNames = append(depNames, dep.Service)
+		}
+	}
+	d.mu.RUnlock()
+
+	for i, proc := range deps {
+		if err := proc.WaitReady(d.ctx); err != nil {
+			return fmt.Errorf("dependency %s did not become ready: %w", depNames[i], err)
+		}
+	}
+	return nil
+}
+
+// WaitReady blocks until each of the given services is ready, and returns
+// the services that exited or became unhealthy instead.
+func (d *Daemon) WaitReady(services []string) (notReady []string) {
+	for _, name := range services {
+		d.mu.RLock()
+		proc, ok := d.processes[name]
+		d.mu.RUnlock()
+
+		if !ok || proc.WaitReady(d.ctx) != nil {
+			notReady = append(notReady, name)
+		}
+	}
+	return notReady
 }
 
 // StopServices stops the specified services (or all if none specified).
 func (d *Daemon) StopServices(services []string) (stopped []string) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
+	// The services are resolved under the lock, but stopped without it, so
+	// that other requests aren't held up for the graceful timeout
+	d.mu.RLock()
 	toStop := services
 	if len(toStop) == 0 {
 		// Stop all services in reverse dependency order
@@ -177,25 +535,121 @@ func (d *Daemon) StopServices(services []string) (stopped []string) {
 		toStop = d.resolveDependents(services)
 	}
 
+	// Stop services concurrently, so a slow service doesn't hold up
+	// unrelated ones. Each service waits for its dependents being stopped
+	// to exit first, which keeps reverse dependency order between them.
+	dependents := make(map[string][]string)
+	done := make(map[string]chan struct{}, len(toStop))
 	for _, name := range toStop {
-		proc, ok := d.processes[name]
-		if !ok {
-			continue
+		done[name] = make(chan struct{})
+	}
+	procs := make(map[string]*process.Process, len(toStop))
+	for _, name := range toStop {
+		procs[name] = d.processes[name]
+		if svc, ok := d.config.Services[name]; ok {
+			for _, dep := range svc.DependencyNames() {
+				if _, ok := done[dep]; ok {
+					dependents[dep] = append(dependents[dep], name)
+				}
+			}
 		}
+	}
+	graceful := d.graceful
+	d.mu.RUnlock()
 
-		if proc.GetState() == process.StateStopped || proc.GetState() == process.StateFailed {
-			continue
+	var wg sync.WaitGroup
+	results := make([]bool, len(toStop))
+	for i, name := range toStop {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[name])
+			for _, dep := range dependents[name] {
+				<-done[dep]
+			}
+			if proc := procs[name]; proc != nil {
+				results[i] = d.stopProcess(name, proc, graceful)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range toStop {
+		if results[i] {
+			stopped = append(stopped, name)
 		}
+	}
+	return stopped
+}
 
-		// Stop monitoring before stopping the process
-		d.supervisor.StopMonitoring(name)
+// SetGracefulTimeout overrides the config's graceful_timeout, which is how
+// long stopped services may take to exit before they are killed.
+func (d *Daemon) SetGracefulTimeout(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.graceful = timeout
+}
 
-		if err := proc.Stop(gracefulTimeout); err == nil {
-			stopped = append(stopped, name)
+// gracefulTimeout returns how long stopped services may take to exit before
+// they are killed.
+func (d *Daemon) gracefulTimeout() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.graceful
+}
+
+// SetListenAddress overrides the config's socket.listen, the TCP address
+// on which the daemon accepts clients besides its socket. It must be called
+// before Run.
+func (d *Daemon) SetListenAddress(addr string) {
+	d.listen = addr
+}
+
+// SetToken overrides the config's socket.token_file, giving the token that
+// clients on the TCP address must authenticate with. It must be called
+// before Run.
+func (d *Daemon) SetToken(token string) {
+	d.token = token
+}
+
+// Env returns the name of the config overlay the daemon runs with, or empty
+// for none.
+func (d *Daemon) Env() string {
+	return d.env
+}
+
+// Overrides returns the files the daemon merges onto its primary config
+// file.
+func (d *Daemon) Overrides() []string {
+	return d.overrides
+}
+
+// stopProcess stops the process of a service if it is running, giving it
+// graceful to exit, and reports whether it was stopped. It doesn't need the
+// daemon lock.
+func (d *Daemon) stopProcess(name string, proc *process.Process, graceful time.Duration) bool {
+	if state := proc.GetState(); state == process.StateStopped || state == process.StateFailed {
+		// A service waiting to be restarted is stopped by cancelling the
+		// restart
+		if _, ok := d.supervisor.Pending(name); !ok {
+			return false
 		}
+		d.supervisor.StopMonitoring(name)
+		d.journal.Record(name, journalStopped, 0, 0, proc.GetRestarts())
+		d.emit(pluginEvent{Event: config.PluginEventServiceStopped, Service: name})
+		return true
 	}
 
-	return stopped
+	// Stop monitoring before stopping the process
+	d.supervisor.StopMonitoring(name)
+
+	if err := proc.Stop(graceful); err != nil {
+		return false
+	}
+	d.history.Exited(name, proc.GetExitCode(), process.SignalName(proc.GetExitSignal()), proc.GetExitedAt())
+	d.journal.Record(name, journalStopped, 0, 0, proc.GetRestarts())
+	d.emit(pluginEvent{Event: config.PluginEventServiceStopped, Service: name})
+	return true
 }
 
 // StopAll stops all services.
@@ -207,10 +661,91 @@ func (d *Daemon) StopAll() error {
 // RestartServices restarts the specified services.
 func (d *Daemon) RestartServices(services []string) (restarted, failed []string) {
 	stopped := d.StopServices(services)
-	started, startFailed := d.StartServices(stopped)
+	for _, name := range stopped {
+		d.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (requested) ---", name))
+	}
+	started, startFailed, _ := d.startServices(stopped, runReasonRestart)
 	return started, startFailed
 }
 
+// RollingRestart restarts services one at a time in dependency order (all
+// services if none specified), starting each only after the one before it
+// has become ready, so that services standing in for each other are never
+// all down at once. Unlike RestartServices, only the service itself is
+// restarted, while its dependents keep running, as taking them down with
+// each step would make them unavailable. The rollout stops at the first
+// service that fails to start or become ready; the services it did not get
+// to are skipped.
+func (d *Daemon) RollingRestart(services []string) (restarted, failed, skipped []string) {
+	d.mu.RLock()
+	sorted, _ := d.config.TopologicalSort()
+	d.mu.RUnlock()
+
+	var order []string
+	for _, svc := range sorted {
+		if len(services) == 0 || slices.Contains(services, svc.Name) {
+			order = append(order, svc.Name)
+		}
+	}
+
+	for i, name := range order {
+		// Stop just the service, without the dependents StopServices
+		// stops, and without the lock, like StopServices
+		d.mu.RLock()
+		proc, graceful := d.processes[name], d.graceful
+		d.mu.RUnlock()
+		if proc != nil {
+			d.stopProcess(name, proc, graceful)
+		}
+		d.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (rolling) ---", name))
+		started, startFailed, _ := d.startServices([]string{name}, runReasonRestart)
+		notReady := d.WaitReady(started)
+		for _, s := range started {
+			if !slices.Contains(notReady, s) {
+				restarted = append(restarted, s)
+			}
+		}
+		if failed := append(startFailed, notReady...); len(failed) > 0 {
+			for _, rest := range order[i+1:] {
+				if !slices.Contains(restarted, rest) {
+					skipped = append(skipped, rest)
+				}
+			}
+			return restarted, failed, skipped
+		}
+	}
+	return restarted, nil, nil
+}
+
+// restartDependents restarts the running services that depend on a service
+// with restart_dependents, after the service's restart policy restarted it.
+// A service restarted by RestartServices needs no such step, as its
+// dependents are stopped and started with it.
+func (d *Daemon) restartDependents(name string) {
+	d.mu.RLock()
+	var dependents []string
+	for _, dependent := range d.serviceOrder {
+		if state := d.processes[dependent].GetState(); state != process.StateRunning && state != process.StateStarting {
+			continue
+		}
+		for _, dep := range d.config.Services[dependent].DependsOn {
+			if dep.Service == name && dep.RestartDependents {
+				dependents = append(dependents, dependent)
+			}
+		}
+	}
+	d.mu.RUnlock()
+	if len(dependents) == 0 {
+		return
+	}
+
+	stopped := d.StopServices(dependents)
+	for _, dependent := range stopped {
+		d.logMgr.Mark(dependent, fmt.Sprintf("--- %s restarted (%s restarted) ---", dependent, name))
+	}
+	d.startServices(stopped, runReasonDependency)
+}
+
 // GetStatus returns the status of all services.
 func (d *Daemon) GetStatus() []ServiceStatus {
 	d.mu.RLock()
@@ -218,30 +753,87 @@ func (d *Daemon) GetStatus() []ServiceStatus {
 
 	var statuses []ServiceStatus
 	for _, name := range d.serviceOrder {
-		proc := d.processes[name]
-		status := ServiceStatus{
-			Name:     name,
-			State:    string(proc.GetState()),
-			PID:      proc.PID(),
-			Restarts: proc.GetRestarts(),
-			ExitCode: proc.GetExitCode(),
-		}
-		if !proc.GetStartedAt().IsZero() {
-			status.StartedAt = proc.GetStartedAt().Format("2006-01-02 15:04:05")
-		}
-		statuses = append(statuses, status)
+		statuses = append(statuses, d.serviceStatus(name))
 	}
 
 	return statuses
 }
 
-// GetLogs returns recent logs for the specified services.
-func (d *Daemon) GetLogs(services []string, lines int) []LogLine {
+// serviceStatus returns the status of a service. The caller holds the
+// daemon lock.
+func (d *Daemon) serviceStatus(name string) ServiceStatus {
+	proc := d.processes[name]
+	status := ServiceStatus{
+		Name:     name,
+		State:    string(proc.GetState()),
+		PID:      proc.PID(),
+		Restarts: proc.GetRestarts(),
+		ExitCode: proc.GetExitCode(),
+		Signal:   process.SignalName(proc.GetExitSignal()),
+		Health:   string(proc.GetHealth()),
+		Ready:    proc.IsReady(),
+		External: proc.Service.External,
+		Color:    d.logMgr.Color(name),
+		Ports:    d.ServicePorts(name),
+
+		Command:    proc.Service.Command,
+		WorkingDir: proc.Service.WorkingDir,
+		Restart:    string(proc.Service.GetRestartPolicy()),
+		DependsOn:  d.config.Services[name].DependencyNames(),
+	}
+	if !proc.GetStartedAt().IsZero() {
+		status.StartedAt = proc.GetStartedAt().Format("2006-01-02 15:04:05")
+	}
+	if !proc.GetExitedAt().IsZero() {
+		status.ExitedAt = proc.GetExitedAt().Format("2006-01-02 15:04:05")
+	}
+	if sample, ok := d.usage.get(name, status.PID); ok && proc.GetState() == process.StateRunning {
+		status.CPU = &sample.cpu
+		status.Memory = sample.usage.Memory
+	}
+	if pending, ok := d.supervisor.Pending(name); ok {
+		status.State = StateRestarting
+		status.NextRestart = pending.At
+		status.RestartAttempt = pending.Attempt
+	}
+	return status
+}
+
+// Inspection is a detailed view of one service.
+type Inspection struct {
+	Status  ServiceStatus
+	Service *config.Service   // Resolved config
+	Env     map[string]string // Variables comproc sets for the service
+	Runs    []serviceRun      // Oldest first
+	Log     ServiceLogStats
+}
+
+// Inspect returns a detailed view of a service.
+func (d *Daemon) Inspect(service string) (*Inspection, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	proc, ok := d.processes[service]
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+	return &Inspection{
+		Status:  d.serviceStatus(service),
+		Service: proc.Service,
+		Env:     proc.Env(),
+		Runs:    d.history.Runs(service),
+		Log:     d.logMgr.ServiceStats(service),
+	}, nil
+}
+
+// GetLogs returns recent logs for the specified services, written at or
+// after since if it is not zero, that pass filter.
+func (d *Daemon) GetLogs(services []string, since time.Time, lines int, filter LogFilter) []LogLine {
 	if len(services) == 0 {
 		services = d.ServiceNames()
 	}
 
-	return d.logMgr.GetLines(services, lines)
+	return d.logMgr.GetFilteredLines(services, since, lines, filter)
 }
 
 // SubscribeLogs subscribes to log updates.
@@ -272,6 +864,55 @@ func (d *Daemon) WriteStdin(service string, data []byte) error {
 	return err
 }
 
+// WaitExit returns a channel that is closed when the current run of the
+// service's process exits, along with a function reporting its exit code.
+// The service must have been started.
+func (d *Daemon) WaitExit(service string) (<-chan struct{}, func() int, error) {
+	d.mu.RLock()
+	proc, ok := d.processes[service]
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("service not found: %s", service)
+	}
+
+	done := proc.Wait()
+	if done == nil {
+		return nil, nil, fmt.Errorf("service has not been started: %s", service)
+	}
+	return done, proc.GetExitCode, nil
+}
+
+// OneOff returns a command that runs args in a service's working directory
+// and environment, as of its last run.
+func (d *Daemon) OneOff(service string, args []string) (*exec.Cmd, error) {
+	d.mu.RLock()
+	proc, ok := d.processes[service]
+	d.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+	cmd, err := proc.OneOff(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to run %s: %w", service, args[0], err)
+	}
+	return cmd, nil
+}
+
+// IsRunning reports whether a service's process is running or starting.
+func (d *Daemon) IsRunning(service string) bool {
+	d.mu.RLock()
+	proc, ok := d.processes[service]
+	d.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	state := proc.GetState()
+	return state == process.StateRunning || state == process.StateStarting
+}
+
 // resolveDependencies returns services with their dependencies in startup order.
 func (d *Daemon) resolveDependencies(services []string) []string {
 	visited := make(map[string]bool)
@@ -285,7 +926,7 @@ func (d *Daemon) resolveDependencies(services []string) []string {
 		visited[name] = true
 
 		if svc, ok := d.config.Services[name]; ok {
-			for _, dep := range svc.DependsOn {
+			for _, dep := range svc.DependencyNames() {
 				visit(dep)
 			}
 		}
@@ -304,7 +945,7 @@ func (d *Daemon) resolveDependents(services []string) []string {
 	// Build reverse dependency map
 	dependents := make(map[string][]string)
 	for name, svc := range d.config.Services {
-		for _, dep := range svc.DependsOn {
+		for _, dep := range svc.DependencyNames() {
 			dependents[dep] = append(dependents[dep], name)
 		}
 	}
@@ -333,6 +974,33 @@ func (d *Daemon) resolveDependents(services []string) []string {
 	return result
 }
 
+// Stats describes the daemon itself rather than its services.
+type Stats struct {
+	StartedAt  time.Time
+	ConfigPath string   // Config of the primary project
+	Projects   []string // Configs of additional projects, sorted
+	EventsPath string   // Events file, if any
+	Log        LogStats
+}
+
+// Stats returns information about the daemon.
+func (d *Daemon) Stats() Stats {
+	d.mu.RLock()
+	stats := Stats{
+		StartedAt:  d.startedAt,
+		ConfigPath: d.configPath,
+		EventsPath: d.events.Path(),
+	}
+	for path := range d.projects {
+		stats.Projects = append(stats.Projects, path)
+	}
+	d.mu.RUnlock()
+
+	slices.Sort(stats.Projects)
+	stats.Log = d.logMgr.Stats()
+	return stats
+}
+
 // ServiceStatus represents the status of a service (used internally).
 type ServiceStatus struct {
 	Name      string
@@ -341,9 +1009,52 @@ type ServiceStatus struct {
 	Restarts  int
 	StartedAt string
 	ExitCode  int
+	Signal    string
+	ExitedAt  string
+	Health    string
+	Ready     bool
+	External  string
+	Color     int
+	Ports     []int // Ports of the last run
+
+	// Resource use in the latest sample of a running service, if any
+	CPU    *float64 // Percent of one core
+	Memory int64    // Resident bytes of the process group
+
+	// Set while the state is StateRestarting
+	NextRestart    time.Time
+	RestartAttempt int
+
+	Command    string
+	WorkingDir string
+	Restart    string
+	DependsOn  []string
 }
 
 // ServiceNames returns the names of all configured services in config file order.
+// Services of additional projects follow, in the order the projects were loaded.
 func (d *Daemon) ServiceNames() []string {
-	return d.serviceOrder
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]string(nil), d.serviceOrder...)
+}
+
+// GetHistory returns the recorded runs of a service, oldest first.
+func (d *Daemon) GetHistory(service string) ([]serviceRun, error) {
+	d.mu.RLock()
+	_, ok := d.processes[service]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+	return d.history.Runs(service), nil
+}
+
+// ScopeServices translates service names sent by a client for the project at
+// configPath into daemon service names (see scopeServices). If load is true,
+// a project that is not yet known to the daemon is loaded first.
+func (d *Daemon) ScopeServices(configPath string, services []string, load bool) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.scopeServices(configPath, services, load)
 }
@@ -1,16 +1,22 @@
 package daemon
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ryym/comproc/internal/process"
 )
 
 func TestSocketPathDifferentConfigPaths(t *testing.T) {
 	t.Setenv("COMPROC_SOCKET", "")
 	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
 
-	path1 := SocketPath("/home/user/project-a/comproc.yaml")
-	path2 := SocketPath("/home/user/project-b/comproc.yaml")
+	path1, _ := SocketPath("/home/user/project-a/comproc.yaml", nil, "")
+	path2, _ := SocketPath("/home/user/project-b/comproc.yaml", nil, "")
 
 	if path1 == path2 {
 		t.Errorf("different config paths should produce different socket paths, got %s for both", path1)
@@ -21,8 +27,8 @@ func TestSocketPathSameConfigPath(t *testing.T) {
 	t.Setenv("COMPROC_SOCKET", "")
 	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
 
-	path1 := SocketPath("/home/user/project/comproc.yaml")
-	path2 := SocketPath("/home/user/project/comproc.yaml")
+	path1, _ := SocketPath("/home/user/project/comproc.yaml", nil, "")
+	path2, _ := SocketPath("/home/user/project/comproc.yaml", nil, "")
 
 	if path1 != path2 {
 		t.Errorf("same config path should produce same socket path, got %s and %s", path1, path2)
@@ -32,7 +38,7 @@ func TestSocketPathSameConfigPath(t *testing.T) {
 func TestSocketPathEnvOverride(t *testing.T) {
 	t.Setenv("COMPROC_SOCKET", "/custom/path.sock")
 
-	path := SocketPath("/any/config/path.yaml")
+	path, _ := SocketPath("/any/config/path.yaml", nil, "")
 
 	if path != "/custom/path.sock" {
 		t.Errorf("COMPROC_SOCKET should override, got %s", path)
@@ -43,7 +49,7 @@ func TestSocketPathUsesXDGRuntimeDir(t *testing.T) {
 	t.Setenv("COMPROC_SOCKET", "")
 	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
 
-	path := SocketPath("/home/user/project/comproc.yaml")
+	path, _ := SocketPath("/home/user/project/comproc.yaml", nil, "")
 
 	if !strings.HasPrefix(path, "/run/user/1000/") {
 		t.Errorf("should use XDG_RUNTIME_DIR, got %s", path)
@@ -52,3 +58,135 @@ func TestSocketPathUsesXDGRuntimeDir(t *testing.T) {
 		t.Errorf("should match pattern comproc-{hash}.sock, got %s", path)
 	}
 }
+
+func TestSocketPathFromConfig(t *testing.T) {
+	t.Setenv("COMPROC_SOCKET", "")
+	dir := t.TempDir()
+	configPath := writeConfig(t, dir, "socket:\n  path: app.sock\nservices:\n  app:\n    command: sleep 60\n")
+	override := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(override, []byte("services:\n  worker:\n    command: sleep 60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := SocketPath(configPath, []string{override}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, "app.sock"); path != want {
+		t.Errorf("expected the configured socket %s, got %s", want, path)
+	}
+
+	// Errors of the files merged onto the config are reported, as the
+	// daemon wouldn't start with them
+	if err := os.WriteFile(override, []byte("services: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SocketPath(configPath, []string{override}, ""); err == nil {
+		t.Error("expected an error for an override that can't be parsed")
+	}
+	if _, err := SocketPath(configPath, nil, "staging"); err == nil {
+		t.Error("expected an error for a missing overlay")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		expected   string
+	}{
+		{"/run/user/1000/comproc-abc.sock", "/run/user/1000/comproc-abc.log"},
+		{"/tmp/custom", "/tmp/custom.log"},
+	}
+
+	for _, tt := range tests {
+		if got := OutputPath(tt.socketPath); got != tt.expected {
+			t.Errorf("OutputPath(%q) = %q, want %q", tt.socketPath, got, tt.expected)
+		}
+	}
+}
+
+func TestStop_DoesNotBlockStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(d *Daemon)
+	}{
+		{"stop", func(d *Daemon) { d.StopServices(nil) }},
+		{"rolling restart", func(d *Daemon) { d.RollingRestart(nil) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, t.TempDir(), `
+graceful_timeout: 2s
+services:
+  stubborn:
+    command: trap '' TERM; echo up; sleep 60
+    ready_log_pattern: up
+`)
+			d, err := New(path, nil, "")
+			if err != nil {
+				t.Fatalf("failed to create daemon: %v", err)
+			}
+			defer d.StopAll()
+			if _, failed, _ := d.StartServices(nil); len(failed) > 0 {
+				t.Fatalf("failed to start services: %v", failed)
+			}
+			if notReady := d.WaitReady([]string{"stubborn"}); len(notReady) > 0 {
+				t.Fatalf("expected stubborn to become ready")
+			}
+
+			stopped := make(chan struct{})
+			go func() {
+				tt.stop(d)
+				close(stopped)
+			}()
+			// Give the stop time to start waiting out the graceful timeout
+			time.Sleep(200 * time.Millisecond)
+
+			status := make(chan []ServiceStatus)
+			go func() { status <- d.GetStatus() }()
+			select {
+			case got := <-status:
+				if got[0].State != string(process.StateStopping) {
+					t.Errorf("expected stubborn to be stopping, got %q", got[0].State)
+				}
+			case <-time.After(time.Second):
+				t.Error("expected status to answer while services are being stopped")
+			}
+			<-stopped
+		})
+	}
+}
+
+func TestStartServices_Concurrent(t *testing.T) {
+	primary := writeConfig(t, t.TempDir(), `
+services:
+  app:
+    command: sleep 60
+`)
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+
+	// Requests that race to start the same service all succeed
+	var wg sync.WaitGroup
+	errs := make(chan map[string]string, 16)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, failed, failures := d.StartServices([]string{"app"}); len(failed) > 0 {
+				errs <- failures
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for failures := range errs {
+		t.Errorf("expected concurrent starts to succeed, got %v", failures)
+	}
+	if state := d.processes["app"].GetState(); state != process.StateRunning {
+		t.Errorf("expected app to be running, got %s", state)
+	}
+}
@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Rotation of the events file. Once it would grow past eventLogMaxSize, it
+// is renamed with a ".1" suffix, shifting older files up to
+// eventLogBackups.
+const (
+	eventLogMaxSize = 10 << 20
+	eventLogBackups = 3
+)
+
+// EventsPath returns the path of the events file of the daemon listening on
+// socketPath. It lives next to the socket.
+func EventsPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".events.jsonl"
+}
+
+// EventLog appends lifecycle events to a file as JSON lines, in the same
+// format plugins receive them, so that what happened while nobody was
+// watching can be looked up later. Unlike the journal, it is kept after the
+// daemon shuts down. A nil *EventLog discards all events.
+type EventLog struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+}
+
+// OpenEventLog opens the events file at path for appending.
+func OpenEventLog(path string) (*EventLog, error) {
+	l := &EventLog{path: path, maxSize: eventLogMaxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *EventLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Path returns the path of the events file, or "" for a nil *EventLog.
+func (l *EventLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Write appends an event, rotating the file first if it would grow past its
+// size limit. Errors are ignored so that a broken events file never affects
+// the services.
+func (l *EventLog) Write(e pluginEvent) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		l.rotate()
+		if l.file == nil {
+			return
+		}
+	}
+	n, _ := l.file.Write(data)
+	l.size += int64(n)
+}
+
+// rotate moves the current file to the first backup and starts a new one.
+// If the file can't be moved, it keeps being appended to.
+func (l *EventLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	for i := eventLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	renameErr := os.Rename(l.path, l.path+".1")
+	if err := l.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to rotate events file: %w", renameErr)
+	}
+	return nil
+}
+
+// Close closes the events file.
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventsPath(t *testing.T) {
+	got := EventsPath("/tmp/comproc-abc.sock")
+	if got != "/tmp/comproc-abc.events.jsonl" {
+		t.Errorf("expected /tmp/comproc-abc.events.jsonl, got %s", got)
+	}
+}
+
+func TestEventLog_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.events.jsonl")
+	l, err := OpenEventLog(path)
+	if err != nil {
+		t.Fatalf("OpenEventLog failed: %v", err)
+	}
+	l.Write(pluginEvent{Time: time.Now(), Event: "service.started", Service: "api", PID: 42})
+	l.Close()
+
+	// Events of the next daemon are appended
+	l, err = OpenEventLog(path)
+	if err != nil {
+		t.Fatalf("OpenEventLog failed: %v", err)
+	}
+	l.Write(pluginEvent{Time: time.Now(), Event: "service.failed", Service: "api", ExitCode: 1})
+	l.Close()
+
+	events := readEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Event != "service.started" || events[0].PID != 42 {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Event != "service.failed" || events[1].ExitCode != 1 {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestEventLog_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.events.jsonl")
+	l, err := OpenEventLog(path)
+	if err != nil {
+		t.Fatalf("OpenEventLog failed: %v", err)
+	}
+	defer l.Close()
+	l.maxSize = 200
+
+	// Each event is about 80 bytes, so each file holds two
+	for i := range 10 {
+		l.Write(pluginEvent{Time: time.Now(), Event: "service.started", Service: "api", PID: 1000 + i})
+	}
+
+	if events := readEvents(t, path); len(events) != 2 || events[1].PID != 1009 {
+		t.Errorf("expected the last 2 events in the current file, got %+v", events)
+	}
+	if events := readEvents(t, path+".1"); len(events) != 2 || events[1].PID != 1007 {
+		t.Errorf("expected the 2 events before them in the first backup, got %+v", events)
+	}
+	if _, err := os.Stat(path + ".3"); err != nil {
+		t.Errorf("expected a third backup: %v", err)
+	}
+	if _, err := os.Stat(path + ".4"); err == nil {
+		t.Error("expected no more than 3 backups")
+	}
+}
+
+func TestEventLog_Nil(t *testing.T) {
+	var l *EventLog
+	l.Write(pluginEvent{Event: "daemon.up"})
+	if l.Path() != "" || l.Close() != nil {
+		t.Error("expected a nil event log to do nothing")
+	}
+}
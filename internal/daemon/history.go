@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+)
+
+// Reasons a run of a service was started.
+const (
+	runReasonUp      = "up"      // Started by `up`
+	runReasonRestart = "restart" // Restarted by `restart`
+	runReasonPolicy  = "policy"  // Restarted by the restart policy after it exited
+	// Restarted because a dependency with restart_dependents was restarted
+	runReasonDependency = "dependency"
+	// Restarted for using more memory than its mem_restart_limit
+	runReasonMemory = "memory"
+	// Started or restarted by `reload` after the config changed
+	runReasonReload = "reload"
+)
+
+// historyLimit is the number of runs kept per service.
+const historyLimit = 50
+
+// serviceRun is a single run of a service, from start to exit.
+type serviceRun struct {
+	StartedAt time.Time
+	ExitedAt  time.Time // Zero while the run is in progress
+	ExitCode  int
+	Signal    string // Name of the signal that killed the run, if any
+	Reason    string
+	Error     string // Why the run failed to start, if it did
+}
+
+// History keeps the most recent runs of each service, for diagnosing
+// services that crash now and then. A nil *History records nothing.
+type History struct {
+	mu   sync.Mutex
+	runs map[string][]serviceRun
+}
+
+// NewHistory creates an empty history.
+func NewHistory() *History {
+	return &History{runs: make(map[string][]serviceRun)}
+}
+
+// Started records the start of a new run.
+func (h *History) Started(service, reason string, at time.Time) {
+	h.add(service, serviceRun{StartedAt: at, Reason: reason})
+}
+
+// FailedToStart records a run that could not be started.
+func (h *History) FailedToStart(service, reason string, exitCode int, err error) {
+	now := time.Now()
+	h.add(service, serviceRun{StartedAt: now, ExitedAt: now, ExitCode: exitCode, Reason: reason, Error: err.Error()})
+}
+
+// Exited records the exit of the service's current run, with the name of
+// the signal that killed it, if any. It does nothing if no run is in
+// progress.
+func (h *History) Exited(service string, exitCode int, signal string, at time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := h.runs[service]
+	if len(runs) == 0 || !runs[len(runs)-1].ExitedAt.IsZero() {
+		return
+	}
+	last := &runs[len(runs)-1]
+	last.ExitedAt = at
+	last.ExitCode = exitCode
+	last.Signal = signal
+}
+
+// Runs returns the recorded runs of a service, oldest first.
+func (h *History) Runs(service string) []serviceRun {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]serviceRun(nil), h.runs[service]...)
+}
+
+func (h *History) add(service string, run serviceRun) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := append(h.runs[service], run)
+	if len(runs) > historyLimit {
+		runs = runs[len(runs)-historyLimit:]
+	}
+	h.runs[service] = runs
+}
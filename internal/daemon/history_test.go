@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory()
+	start := time.Now()
+
+	h.Started("api", runReasonUp, start)
+	h.Exited("api", -1, "SIGKILL", start.Add(time.Second))
+	// An exit without a run in progress is ignored
+	h.Exited("api", 2, "", start.Add(2*time.Second))
+	h.FailedToStart("api", runReasonPolicy, 127, errors.New("prepare failed"))
+	h.Started("api", runReasonRestart, start.Add(3*time.Second))
+
+	runs := h.Runs("api")
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 runs, got %+v", runs)
+	}
+	if runs[0].Reason != runReasonUp || runs[0].Signal != "SIGKILL" || !runs[0].ExitedAt.Equal(start.Add(time.Second)) {
+		t.Errorf("unexpected first run: %+v", runs[0])
+	}
+	if runs[1].Reason != runReasonPolicy || runs[1].ExitCode != 127 || runs[1].Error != "prepare failed" || runs[1].ExitedAt.IsZero() {
+		t.Errorf("unexpected failed run: %+v", runs[1])
+	}
+	if runs[2].Reason != runReasonRestart || !runs[2].ExitedAt.IsZero() {
+		t.Errorf("expected the last run to be in progress, got %+v", runs[2])
+	}
+
+	// Runs returns a copy
+	runs[0].Reason = "changed"
+	if h.Runs("api")[0].Reason != runReasonUp {
+		t.Error("expected Runs to return a copy")
+	}
+	if runs := h.Runs("web"); len(runs) != 0 {
+		t.Errorf("expected no runs of an unknown service, got %+v", runs)
+	}
+}
+
+func TestHistory_Limit(t *testing.T) {
+	h := NewHistory()
+	start := time.Now()
+	for i := range historyLimit + 5 {
+		h.Started("api", runReasonPolicy, start.Add(time.Duration(i)*time.Second))
+		h.Exited("api", i, "", start.Add(time.Duration(i)*time.Second))
+	}
+
+	runs := h.Runs("api")
+	if len(runs) != historyLimit {
+		t.Fatalf("expected %d runs, got %d", historyLimit, len(runs))
+	}
+	if runs[0].ExitCode != 5 {
+		t.Errorf("expected the oldest runs to be dropped, first run has exit code %d", runs[0].ExitCode)
+	}
+}
+
+func TestHistory_Nil(t *testing.T) {
+	var h *History
+	h.Started("api", runReasonUp, time.Now())
+	h.Exited("api", 0, "", time.Now())
+	if runs := h.Runs("api"); runs != nil {
+		t.Errorf("expected no runs, got %+v", runs)
+	}
+}
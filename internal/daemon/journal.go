@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Journal events
+const (
+	journalStarted   = "started"
+	journalRestarted = "restarted"
+	journalExited    = "exited"
+	journalStopped   = "stopped"
+)
+
+// leftoverKillTimeout is how long processes left over from a crashed daemon
+// get to exit after SIGTERM before they are killed.
+const leftoverKillTimeout = 3 * time.Second
+
+// JournalPath returns the path of the state journal of the daemon listening
+// on socketPath. It lives next to the socket.
+func JournalPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".journal"
+}
+
+// journalEntry is one line of the journal.
+type journalEntry struct {
+	Time     time.Time `json:"time"`
+	Service  string    `json:"service"`
+	Event    string    `json:"event"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode int       `json:"exit_code,omitempty"`
+	Restarts int       `json:"restarts"`
+}
+
+// journalRecord is the state of a service after replaying the journal.
+type journalRecord struct {
+	Restarts int
+	PID      int // Non-zero if the service was last recorded as running
+}
+
+// Journal is an append-only log of service state transitions. It survives
+// daemon crashes: the next daemon replays it to restore restart counts and
+// to clean up processes the crashed daemon left running. A daemon that shuts
+// down normally removes it. A nil *Journal discards all records.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenJournal replays the journal at path, if any, and opens it for
+// appending. The journal is rewritten with one entry per service so that it
+// does not grow across daemon restarts.
+func OpenJournal(path string) (*Journal, map[string]journalRecord, error) {
+	records := make(map[string]journalRecord)
+	if f, err := os.Open(path); err == nil {
+		records = replayJournal(f)
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	// Write the compacted journal and swap it in atomically
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	j := &Journal{path: path, file: file}
+	now := time.Now()
+	for service, rec := range records {
+		if err := j.write(journalEntry{Time: now, Service: service, Event: journalStopped, Restarts: rec.Restarts}); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to replace journal: %w", err)
+	}
+	return j, records, nil
+}
+
+// replayJournal computes the last known state of each service. Lines that
+// can't be parsed, such as one cut short by a crash, are skipped.
+func replayJournal(r io.Reader) map[string]journalRecord {
+	records := make(map[string]journalRecord)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Service == "" {
+			continue
+		}
+		rec := journalRecord{Restarts: entry.Restarts}
+		if entry.Event == journalStarted || entry.Event == journalRestarted {
+			rec.PID = entry.PID
+		}
+		records[entry.Service] = rec
+	}
+	return records
+}
+
+// Record appends a state transition of a service. Errors are ignored so that
+// a broken journal never affects the services.
+func (j *Journal) Record(service, event string, pid, exitCode, restarts int) {
+	if j == nil {
+		return
+	}
+	j.write(journalEntry{
+		Time:     time.Now(),
+		Service:  service,
+		Event:    event,
+		PID:      pid,
+		ExitCode: exitCode,
+		Restarts: restarts,
+	})
+}
+
+func (j *Journal) write(entry journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Remove closes and deletes the journal. It is called on a clean shutdown,
+// after which there is no state worth restoring.
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	j.file.Close()
+	j.file = nil
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+// stopLeftover terminates the process group of a service that a crashed
+// daemon left running. Each service runs in its own process group led by its
+// PID; a PID that no longer leads a group was reused and is left alone.
+func stopLeftover(service string, pid int) {
+	if pgid, err := syscall.Getpgid(pid); err != nil || pgid != pid {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "comproc: stopping %s (pid %d) left running by a previous daemon\n", service, pid)
+
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		return
+	}
+	deadline := time.Now().Add(leftoverKillTimeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(-pid, 0); err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	syscall.Kill(-pid, syscall.SIGKILL)
+}
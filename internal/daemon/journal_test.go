@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournalPath(t *testing.T) {
+	got := JournalPath("/tmp/comproc-abc.sock")
+	if got != "/tmp/comproc-abc.journal" {
+		t.Errorf("expected /tmp/comproc-abc.journal, got %s", got)
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	input := strings.Join([]string{
+		`{"service":"api","event":"started","pid":100,"restarts":0}`,
+		`{"service":"db","event":"started","pid":200,"restarts":0}`,
+		`{"service":"api","event":"exited","exit_code":1,"restarts":0}`,
+		`{"service":"api","event":"restarted","pid":101,"restarts":1}`,
+		`{"service":"db","event":"stopped","restarts":0}`,
+		`{"service":"worker","event":"sta`, // Cut short by a crash
+	}, "\n")
+
+	records := replayJournal(strings.NewReader(input))
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", records)
+	}
+	if rec := records["api"]; rec.Restarts != 1 || rec.PID != 101 {
+		t.Errorf("expected api to be running as 101 with 1 restart, got %+v", rec)
+	}
+	if rec := records["db"]; rec.Restarts != 0 || rec.PID != 0 {
+		t.Errorf("expected db to be stopped, got %+v", rec)
+	}
+}
+
+func TestJournal_RecordAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.journal")
+
+	j, records, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records for a new journal, got %v", records)
+	}
+	j.Record("api", journalStarted, 100, 0, 0)
+	j.Record("api", journalRestarted, 101, 0, 1)
+	j.Record("db", journalStarted, 200, 0, 2)
+	j.Record("db", journalStopped, 0, 0, 2)
+
+	// Reopen without removing, as after a crash
+	j2, records, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	if rec := records["api"]; rec.Restarts != 1 || rec.PID != 101 {
+		t.Errorf("expected api running as 101 with 1 restart, got %+v", rec)
+	}
+	if rec := records["db"]; rec.Restarts != 2 || rec.PID != 0 {
+		t.Errorf("expected db stopped with 2 restarts, got %+v", rec)
+	}
+
+	// The journal is compacted to one entry per service
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected 2 lines after compaction, got %d:\n%s", lines, data)
+	}
+
+	if err := j2.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed, got %v", err)
+	}
+	// Recording after removal is a no-op
+	j2.Record("api", journalStarted, 102, 0, 1)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected journal to stay removed, got %v", err)
+	}
+}
+
+func TestJournal_Nil(t *testing.T) {
+	var j *Journal
+	j.Record("api", journalStarted, 100, 0, 0)
+	if err := j.Remove(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestStopLeftover(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	stopLeftover("api", cmd.Process.Pid)
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("expected leftover process to be stopped")
+	}
+}
@@ -2,9 +2,14 @@ package daemon
 
 import (
 	"io"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ryym/comproc/internal/protocol"
 )
 
 // LogLine represents a single log line.
@@ -12,70 +17,475 @@ type LogLine struct {
 	Service   string
 	Line      string
 	Timestamp time.Time
-	Stream    string // "stdout" or "stderr"
+	Stream    string // "stdout", "stderr", StreamMarker, or StreamDropped
+	Color     int    // Color index of the service (see LogManager.Color)
+	Dropped   int    // Lines dropped before this one, for StreamDropped notices
+}
+
+// StreamMarker is the stream of lines added by comproc itself, such as the
+// markers separating the runs of a service (see LogManager.Mark).
+const StreamMarker = protocol.LogStreamMarker
+
+// StreamDropped is the stream of notices that a subscriber receives in
+// place of lines it lost, carrying their number. They belong to no service.
+const StreamDropped = "dropped"
+
+// LogFilter selects the lines that a reader of the logs receives. The zero
+// value passes every line, and markers and dropped notices pass any filter
+// so that runs can still be told apart.
+type LogFilter struct {
+	Stream string         // Only lines of "stdout" or "stderr" if set
+	Grep   *regexp.Regexp // Only lines matching it if set
+}
+
+// match reports whether line passes the filter.
+func (f LogFilter) match(line LogLine) bool {
+	switch line.Stream {
+	case StreamMarker, StreamDropped:
+		return true
+	}
+	if f.Stream != "" && line.Stream != f.Stream {
+		return false
+	}
+	return f.Grep == nil || f.Grep.MatchString(line.Line)
 }
 
 // subscriber represents a log subscription with an optional service filter.
+// Lines that don't fit in the channel are queued on disk and delivered in
+// order by a pump goroutine, so a slow reader doesn't lose lines in a burst.
+// Lines that don't fit on disk either are dropped and counted, and the
+// subscriber receives a StreamDropped notice in their place once there is
+// room again.
 type subscriber struct {
 	ch       chan LogLine
 	services map[string]bool // nil means all services
+
+	mu         sync.Mutex
+	spill      *spillFile    // Created on the first overflow
+	spillLimit int64         // Maximum size of the spill file
+	pumpDone   chan struct{} // Non-nil while the pump is running
+	done       chan struct{} // Closed on unsubscribe
+	dropped    int           // Lines dropped since the last notice
+	lost       *atomic.Int64 // Lines dropped by all subscribers of the manager
+}
+
+// send delivers a line without blocking, queueing it on disk if the channel
+// is full or earlier lines are still queued. Lines are dropped only when the
+// spill file is full or can't be written.
+func (s *subscriber) send(line LogLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		// Closed; lines may still arrive from an older subscriber snapshot
+		return
+	default:
+	}
+
+	if s.dropped > 0 {
+		if !s.enqueue(s.droppedNotice(line.Timestamp)) {
+			s.drop()
+			return
+		}
+		s.dropped = 0
+	}
+	if !s.enqueue(line) {
+		s.drop()
+	}
+}
+
+// enqueue delivers a line to the channel or, if it is full or earlier lines
+// are still queued, to the spill file, and reports whether it succeeded.
+// Must be called with s.mu held.
+func (s *subscriber) enqueue(line LogLine) bool {
+	if s.pumpDone == nil {
+		select {
+		case s.ch <- line:
+			return true
+		default:
+		}
+	}
+
+	if s.spill == nil {
+		spill, err := newSpillFile(s.spillLimit)
+		if err != nil {
+			return false
+		}
+		s.spill = spill
+	}
+	if err := s.spill.push(line); err != nil {
+		return false
+	}
+
+	if s.pumpDone == nil {
+		s.pumpDone = make(chan struct{})
+		go s.pump(s.pumpDone)
+	}
+	return true
+}
+
+// drop counts a line that couldn't be delivered. Must be called with s.mu
+// held.
+func (s *subscriber) drop() {
+	s.dropped++
+	if s.lost != nil {
+		s.lost.Add(1)
+	}
+}
+
+// droppedNotice returns the notice of the lines dropped since the last one.
+func (s *subscriber) droppedNotice(at time.Time) LogLine {
+	return LogLine{Stream: StreamDropped, Timestamp: at, Dropped: s.dropped}
+}
+
+// pump moves queued lines from the spill file to the channel until the
+// queue is empty or the subscription is closed.
+func (s *subscriber) pump(pumpDone chan struct{}) {
+	defer close(pumpDone)
+	for {
+		s.mu.Lock()
+		line, ok := s.spill.pop()
+		if !ok && s.dropped > 0 {
+			// Lines dropped after the last queued one are reported now
+			// rather than with the next line, which may never come
+			line, ok = s.droppedNotice(time.Now()), true
+			s.dropped = 0
+		}
+		if !ok {
+			s.pumpDone = nil
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- line:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close stops the pump, closes the channel, and removes the spill file.
+func (s *subscriber) close() {
+	// Closing done with the lock held ensures that no send starts a pump
+	// or writes to the channel afterwards
+	s.mu.Lock()
+	close(s.done)
+	pumpDone := s.pumpDone
+	s.mu.Unlock()
+	if pumpDone != nil {
+		<-pumpDone
+	}
+
+	close(s.ch)
+	if s.spill != nil {
+		s.spill.close()
+	}
 }
 
 // LogManager manages log collection and distribution.
+// Every line is kept in a per-service in-memory ring buffer (which backs
+// `logs` and `attach`) and delivered to any additional sinks attached to
+// the service.
+//
+// The ring buffers share a memory limit. When the size of their lines
+// exceeds it, the oldest lines of every service are evicted in proportion
+// to the service's share of the memory.
+//
+// Lines of different services are handled concurrently: each service has
+// its own lock, and subscribers are read from an immutable snapshot that is
+// replaced on (un)subscribe, so writing a line never takes a lock shared by
+// all services. Lines of one service reach each subscriber in order.
 type LogManager struct {
-	mu          sync.RWMutex
-	buffers     map[string]*RingBuffer
-	bufferSize  int
+	mu         sync.RWMutex // Guards services and colors
+	services   map[string]*serviceLog
+	colors     map[string]int
+	bufferSize int
+	spillLimit int64 // Per-subscriber overflow limit in bytes
+
+	store *LogStore // On-disk history, if enabled
+
+	memoryLimit int64        // Limit of the size of the buffered lines (0: unlimited)
+	memory      atomic.Int64 // Size of the buffered lines
+	evictMu     sync.Mutex   // Held while lines are evicted
+	evicted     atomic.Int64 // Lines evicted to stay within memoryLimit
+	dropped     atomic.Int64 // Lines dropped by subscribers that fell behind
+
+	subMu       sync.Mutex // Serializes changes to subscribers
 	subscribers map[<-chan LogLine]*subscriber
+	subs        atomic.Pointer[subscriberSet]
+}
+
+// serviceLog holds the history and sinks of one service.
+type serviceLog struct {
+	mu     sync.Mutex // Serializes lines of the service
+	buffer *RingBuffer
+	sinks  []LogSink
+
+	// file receives the history instead of the store, if set
+	file LogSink
+	// discard keeps no history, so lines only reach sinks and followers
+	discard bool
+}
+
+// ownHistory reports whether the service's history is kept elsewhere than
+// the store.
+func (svc *serviceLog) ownHistory() bool {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.file != nil || svc.discard
+}
+
+// subscriberSet is a snapshot of the subscribers indexed by service filter.
+// It is never modified once published.
+type subscriberSet struct {
+	all       []*subscriber            // Subscribers without a filter
+	byService map[string][]*subscriber // Subscribers filtered to a service
 }
 
 // NewLogManager creates a new log manager.
 func NewLogManager(bufferSize int) *LogManager {
-	return &LogManager{
-		buffers:     make(map[string]*RingBuffer),
+	m := &LogManager{
+		services:    make(map[string]*serviceLog),
+		colors:      make(map[string]int),
 		bufferSize:  bufferSize,
+		spillLimit:  defaultSpillLimit,
 		subscribers: make(map[<-chan LogLine]*subscriber),
 	}
+	m.subs.Store(&subscriberSet{})
+	return m
+}
+
+// service returns the log of a service, creating it on first use.
+func (m *LogManager) service(name string) *serviceLog {
+	m.mu.RLock()
+	svc, ok := m.services[name]
+	m.mu.RUnlock()
+	if ok {
+		return svc
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if svc, ok = m.services[name]; !ok {
+		svc = &serviceLog{buffer: NewRingBuffer(m.bufferSize)}
+		m.services[name] = svc
+	}
+	return svc
+}
+
+// Color returns the color index of a service, assigning the next index on
+// first use. Indexes are kept for the daemon's lifetime, so every client
+// shows a service in the same color.
+func (m *LogManager) Color(service string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	color, ok := m.colors[service]
+	if !ok {
+		color = len(m.colors)
+		m.colors[service] = color
+	}
+	return color
+}
+
+// AddSink attaches an additional sink that receives all lines of the service.
+func (m *LogManager) AddSink(service string, sink LogSink) {
+	svc := m.service(service)
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.sinks = append(svc.sinks, sink)
+}
+
+// SetLogFile writes the history of a service to file instead of the store.
+// Recent lines are still kept in memory. It must be called before any line
+// of the service is added.
+func (m *LogManager) SetLogFile(service string, file LogSink) {
+	svc := m.service(service)
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.file = file
+}
+
+// DiscardHistory keeps no history of a service, neither in memory nor in
+// the store. Its lines are still delivered to sinks and followers.
+func (m *LogManager) DiscardHistory(service string) {
+	svc := m.service(service)
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.discard = true
+}
+
+// SetMemoryLimit limits the total size of the lines kept in the ring buffers
+// to limit bytes. Zero means no limit. It must be called before any line is
+// added.
+func (m *LogManager) SetMemoryLimit(limit int64) {
+	m.memoryLimit = limit
+}
+
+// SetStore keeps the history of every service in an on-disk store in
+// addition to the ring buffers, and serves history from it. It must be
+// called before any line is added.
+func (m *LogManager) SetStore(store *LogStore) {
+	m.store = store
+}
+
+// Close detaches and closes all additional sinks and the store.
+func (m *LogManager) Close() error {
+	m.mu.RLock()
+	services := make([]*serviceLog, 0, len(m.services))
+	for _, svc := range m.services {
+		services = append(services, svc)
+	}
+	m.mu.RUnlock()
+
+	var firstErr error
+	for _, svc := range services {
+		if err := svc.closeSinks(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if m.store != nil {
+		if err := m.store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CloseService detaches and closes the additional sinks and the log file of
+// a service that was removed. Its lines in memory are kept.
+func (m *LogManager) CloseService(service string) error {
+	m.mu.RLock()
+	svc, ok := m.services[service]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return svc.closeSinks()
+}
+
+// closeSinks detaches and closes the additional sinks and the log file of
+// the service, and returns the first error met.
+func (svc *serviceLog) closeSinks() error {
+	svc.mu.Lock()
+	sinks := svc.sinks
+	if svc.file != nil {
+		sinks = append(sinks, svc.file)
+	}
+	svc.sinks = nil
+	svc.file = nil
+	svc.mu.Unlock()
+
+	var firstErr error
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // Writer returns an io.Writer that captures output for the given service.
 func (m *LogManager) Writer(service string) io.Writer {
+	return m.streamWriter(service, "stdout")
+}
+
+// ErrWriter is like Writer, but captures the service's stderr.
+func (m *LogManager) ErrWriter(service string) io.Writer {
+	return m.streamWriter(service, "stderr")
+}
+
+func (m *LogManager) streamWriter(service, stream string) io.Writer {
 	return &logWriter{
 		mgr:     m,
 		service: service,
-		stream:  "stdout",
+		stream:  stream,
+		color:   m.Color(service),
 	}
 }
 
+// Mark adds a line written by comproc rather than the service to the
+// service's history and followers. Markers are not delivered to sinks.
+func (m *LogManager) Mark(service, text string) {
+	m.addLine(LogLine{
+		Service:   service,
+		Line:      text,
+		Timestamp: time.Now(),
+		Stream:    StreamMarker,
+		Color:     m.Color(service),
+	})
+}
+
 // GetLines returns the most recent lines for the specified services.
 func (m *LogManager) GetLines(services []string, count int) []LogLine {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	return m.GetLinesSince(services, time.Time{}, count)
+}
 
+// GetLinesSince returns the last count lines of the specified services that
+// were written at or after since, oldest first. With a store, the history
+// is read from disk and is not limited by the ring buffers, except for
+// services with a log file of their own.
+func (m *LogManager) GetLinesSince(services []string, since time.Time, count int) []LogLine {
+	return m.GetFilteredLines(services, since, count, LogFilter{})
+}
+
+// GetFilteredLines is like GetLinesSince, but only counts and returns the
+// lines that pass filter.
+func (m *LogManager) GetFilteredLines(services []string, since time.Time, count int, filter LogFilter) []LogLine {
 	var result []LogLine
-	for _, svc := range services {
-		if buf, ok := m.buffers[svc]; ok {
-			result = append(result, buf.GetAll()...)
+	for _, name := range services {
+		m.mu.RLock()
+		svc, ok := m.services[name]
+		m.mu.RUnlock()
+
+		if m.store != nil && !(ok && svc.ownHistory()) {
+			lines, err := m.store.ReadFiltered(name, since, count, filter)
+			if err == nil {
+				result = append(result, lines...)
+				continue
+			}
+			// Fall back to the ring buffer if the store can't be read
+		}
+		if !ok {
+			continue
+		}
+		for _, line := range svc.buffer.GetAll() {
+			if !line.Timestamp.Before(since) && filter.match(line) {
+				result = append(result, line)
+			}
 		}
 	}
 
-	// Sort by timestamp and return last N
-	// Simple approach: already in chronological order within each service
+	// Lines are in order within each service; merge them by time
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
 	if len(result) > count {
 		result = result[len(result)-count:]
 	}
-
+	if m.store != nil {
+		for i := range result {
+			result[i].Color = m.Color(result[i].Service)
+		}
+	}
 	return result
 }
 
 // Subscribe returns a channel that receives new log lines.
 // If services is non-empty, only lines from those services are sent.
+// Lines that arrive faster than they are read are buffered on disk, and
+// those beyond its limit are replaced by StreamDropped notices.
 func (m *LogManager) Subscribe(services []string) <-chan LogLine {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
 
 	sub := &subscriber{
-		ch: make(chan LogLine, 100),
+		ch:         make(chan LogLine, 100),
+		spillLimit: m.spillLimit,
+		done:       make(chan struct{}),
+		lost:       &m.dropped,
 	}
 	if len(services) > 0 {
 		sub.services = make(map[string]bool, len(services))
@@ -84,44 +494,197 @@ func (m *LogManager) Subscribe(services []string) <-chan LogLine {
 		}
 	}
 	m.subscribers[sub.ch] = sub
+	m.publishSubscribers()
 
 	return sub.ch
 }
 
 // Unsubscribe removes a subscription.
 func (m *LogManager) Unsubscribe(ch <-chan LogLine) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if sub, ok := m.subscribers[ch]; ok {
-		close(sub.ch)
+	m.subMu.Lock()
+	sub, ok := m.subscribers[ch]
+	if ok {
 		delete(m.subscribers, ch)
+		m.publishSubscribers()
+	}
+	m.subMu.Unlock()
+
+	// Lines may still be sent through an older snapshot; the subscriber
+	// ignores them once closed.
+	if ok {
+		sub.close()
+	}
+}
+
+// publishSubscribers replaces the snapshot of subscribers used to deliver
+// lines. Must be called with m.subMu held.
+func (m *LogManager) publishSubscribers() {
+	set := &subscriberSet{byService: make(map[string][]*subscriber)}
+	for _, sub := range m.subscribers {
+		if sub.services == nil {
+			set.all = append(set.all, sub)
+			continue
+		}
+		for service := range sub.services {
+			set.byService[service] = append(set.byService[service], sub)
+		}
+	}
+	m.subs.Store(set)
+}
+
+// LogStats summarizes the state of a LogManager.
+type LogStats struct {
+	Lines       int   // Lines held in the in-memory buffers
+	Bytes       int   // Total length of those lines
+	MemoryLimit int64 // Limit of Bytes (0: unlimited)
+	Evicted     int64 // Lines evicted to stay within the memory limit
+	Dropped     int64 // Lines dropped by subscribers that fell behind
+	Subscribers int
+}
+
+// Stats returns the current log buffer usage.
+func (m *LogManager) Stats() LogStats {
+	m.subMu.Lock()
+	stats := LogStats{Subscribers: len(m.subscribers)}
+	m.subMu.Unlock()
+
+	stats.MemoryLimit = m.memoryLimit
+	stats.Evicted = m.evicted.Load()
+	stats.Dropped = m.dropped.Load()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, svc := range m.services {
+		stats.Lines += svc.buffer.Len()
+		stats.Bytes += svc.buffer.Bytes()
 	}
+	return stats
+}
+
+// Where the history of a service is kept, besides the recent lines in memory.
+const (
+	LogHistoryMemory = "memory" // Only the recent lines
+	LogHistoryStore  = "store"  // The on-disk log store
+	LogHistoryFile   = "file"   // The service's log_file
+	LogHistoryNone   = "none"   // Discarded with log_file: /dev/null
+)
+
+// ServiceLogStats summarizes the log of one service.
+type ServiceLogStats struct {
+	Lines    int // Lines held in the service's in-memory buffer
+	Bytes    int // Total length of those lines
+	Capacity int // Lines the buffer holds at most
+	Sinks    int
+	History  string // One of the LogHistory constants
+}
+
+// ServiceStats returns the log buffer usage of a service.
+func (m *LogManager) ServiceStats(service string) ServiceLogStats {
+	svc := m.service(service)
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	stats := ServiceLogStats{
+		Lines:    svc.buffer.Len(),
+		Bytes:    svc.buffer.Bytes(),
+		Capacity: m.bufferSize,
+		Sinks:    len(svc.sinks),
+		History:  LogHistoryMemory,
+	}
+	switch {
+	case svc.discard:
+		stats.History = LogHistoryNone
+	case svc.file != nil:
+		stats.History = LogHistoryFile
+	case m.store != nil:
+		stats.History = LogHistoryStore
+	}
+	return stats
 }
 
 // addLine adds a log line and notifies subscribers.
 func (m *LogManager) addLine(line LogLine) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	svc := m.service(line.Service)
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	switch {
+	case svc.discard:
+	case svc.file != nil:
+		m.grow(svc.buffer.Add(line))
+		svc.file.WriteLine(line)
+	default:
+		m.grow(svc.buffer.Add(line))
+		if m.store != nil {
+			// Like sinks, a failing store never affects the service
+			m.store.Write(line)
+		}
+	}
 
-	// Get or create buffer
-	buf, ok := m.buffers[line.Service]
-	if !ok {
-		buf = NewRingBuffer(m.bufferSize)
-		m.buffers[line.Service] = buf
+	// Deliver to additional sinks. Errors are ignored so that a broken
+	// sink never affects the service or other sinks.
+	if line.Stream != StreamMarker {
+		for _, sink := range svc.sinks {
+			sink.WriteLine(line)
+		}
 	}
-	buf.Add(line)
 
 	// Notify subscribers (non-blocking)
-	for _, sub := range m.subscribers {
-		if sub.services != nil && !sub.services[line.Service] {
+	subs := m.subs.Load()
+	for _, sub := range subs.all {
+		sub.send(line)
+	}
+	for _, sub := range subs.byService[line.Service] {
+		sub.send(line)
+	}
+}
+
+// logEvictionSlack is the fraction of the memory limit (1/n) that eviction
+// frees beyond the limit, so that lines aren't evicted on every new line
+// once the limit is reached.
+const logEvictionSlack = 10
+
+// grow accounts for a change of delta bytes in the size of the buffered
+// lines, evicting lines if it exceeds the memory limit.
+func (m *LogManager) grow(delta int) {
+	if m.memory.Add(int64(delta)) > m.memoryLimit && m.memoryLimit > 0 {
+		m.evict()
+	}
+}
+
+// evict drops the oldest lines of every service until the size of the
+// buffered lines is below the memory limit by logEvictionSlack. Each
+// service gives up lines in proportion to its share of the memory, so a
+// chatty service doesn't wipe out the history of quiet ones. If another
+// goroutine is already evicting lines, evict returns at once.
+func (m *LogManager) evict() {
+	if !m.evictMu.TryLock() {
+		return
+	}
+	defer m.evictMu.Unlock()
+
+	total := m.memory.Load()
+	excess := total - (m.memoryLimit - m.memoryLimit/logEvictionSlack)
+	if excess <= 0 {
+		return
+	}
+
+	m.mu.RLock()
+	buffers := make([]*RingBuffer, 0, len(m.services))
+	for _, svc := range m.services {
+		buffers = append(buffers, svc.buffer)
+	}
+	m.mu.RUnlock()
+
+	for _, b := range buffers {
+		// Round up so that small shares still free something
+		share := (excess*int64(b.Bytes()) + total - 1) / total
+		if share <= 0 {
 			continue
 		}
-		select {
-		case sub.ch <- line:
-		default:
-			// Channel full, skip
-		}
+		lines, freed := b.DropOldest(int(share))
+		m.memory.Add(-int64(freed))
+		m.evicted.Add(int64(lines))
 	}
 }
 
@@ -130,6 +693,7 @@ type logWriter struct {
 	mgr     *LogManager
 	service string
 	stream  string
+	color   int
 	partial string // Incomplete line buffer
 }
 
@@ -145,6 +709,7 @@ func (w *logWriter) Write(p []byte) (n int, err error) {
 				Line:      lines[i],
 				Timestamp: time.Now(),
 				Stream:    w.stream,
+				Color:     w.color,
 			})
 		}
 	}
@@ -162,6 +727,7 @@ type RingBuffer struct {
 	size  int
 	head  int
 	count int
+	bytes int // Total length of the buffered lines
 }
 
 // NewRingBuffer creates a new ring buffer.
@@ -172,16 +738,49 @@ func NewRingBuffer(size int) *RingBuffer {
 	}
 }
 
-// Add adds an item to the buffer.
-func (b *RingBuffer) Add(item LogLine) {
+// Add adds an item to the buffer. It returns the change in the total length
+// of the buffered lines, which is negative if a longer line is overwritten.
+func (b *RingBuffer) Add(item LogLine) int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	delta := len(item.Line) - len(b.items[b.head].Line)
+	b.bytes += delta
 	b.items[b.head] = item
 	b.head = (b.head + 1) % b.size
 	if b.count < b.size {
 		b.count++
 	}
+	return delta
+}
+
+// DropOldest removes the oldest lines until their total length reaches
+// bytes or the buffer is empty. It returns the number of removed lines and
+// their total length.
+func (b *RingBuffer) DropOldest(bytes int) (lines, freed int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for freed < bytes && b.count > 0 {
+		oldest := (b.head - b.count + b.size) % b.size
+		freed += len(b.items[oldest].Line)
+		b.items[oldest] = LogLine{}
+		b.count--
+		lines++
+	}
+	b.bytes -= freed
+	return lines, freed
+}
+
+// WriteLine implements LogSink.
+func (b *RingBuffer) WriteLine(line LogLine) error {
+	b.Add(line)
+	return nil
+}
+
+// Close implements LogSink. It is a no-op for in-memory buffers.
+func (b *RingBuffer) Close() error {
+	return nil
 }
 
 // GetAll returns all items in chronological order.
@@ -190,10 +789,7 @@ func (b *RingBuffer) GetAll() []LogLine {
 	defer b.mu.RUnlock()
 
 	result := make([]LogLine, b.count)
-	start := 0
-	if b.count == b.size {
-		start = b.head
-	}
+	start := (b.head - b.count + b.size) % b.size
 
 	for i := 0; i < b.count; i++ {
 		idx := (start + i) % b.size
@@ -209,3 +805,10 @@ func (b *RingBuffer) Len() int {
 	defer b.mu.RUnlock()
 	return b.count
 }
+
+// Bytes returns the total length of the lines in the buffer.
+func (b *RingBuffer) Bytes() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.bytes
+}
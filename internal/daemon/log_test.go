@@ -1,6 +1,9 @@
 package daemon
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -60,6 +63,48 @@ func TestRingBuffer_Empty(t *testing.T) {
 	}
 }
 
+func TestRingBuffer_Bytes(t *testing.T) {
+	buf := NewRingBuffer(2)
+
+	buf.Add(LogLine{Line: "a"})
+	buf.Add(LogLine{Line: "bb"})
+	if buf.Bytes() != 3 {
+		t.Errorf("expected 3 bytes, got %d", buf.Bytes())
+	}
+
+	// Overwrites "a"
+	buf.Add(LogLine{Line: "cccc"})
+	if buf.Bytes() != 6 {
+		t.Errorf("expected 6 bytes after overflow, got %d", buf.Bytes())
+	}
+}
+
+func TestRingBuffer_DropOldest(t *testing.T) {
+	buf := NewRingBuffer(4)
+	for _, line := range []string{"aa", "bb", "cc", "dd", "ee"} {
+		buf.Add(LogLine{Line: line})
+	}
+
+	lines, freed := buf.DropOldest(3)
+	if lines != 2 || freed != 4 {
+		t.Errorf("expected 2 lines of 4 bytes dropped, got %d lines of %d bytes", lines, freed)
+	}
+	if buf.Len() != 2 || buf.Bytes() != 4 {
+		t.Errorf("expected 2 lines of 4 bytes left, got %d lines of %d bytes", buf.Len(), buf.Bytes())
+	}
+
+	// New lines go after the remaining ones
+	buf.Add(LogLine{Line: "ff"})
+	got := buf.GetAll()
+	if len(got) != 3 || got[0].Line != "dd" || got[1].Line != "ee" || got[2].Line != "ff" {
+		t.Errorf("expected [dd ee ff], got %v", got)
+	}
+
+	if lines, _ := buf.DropOldest(100); lines != 3 || buf.Len() != 0 {
+		t.Errorf("expected all 3 lines dropped, got %d, %d left", lines, buf.Len())
+	}
+}
+
 func TestLogManager_Writer(t *testing.T) {
 	mgr := NewLogManager(10)
 
@@ -120,6 +165,77 @@ func TestLogManager_MultipleServices(t *testing.T) {
 	}
 }
 
+func TestLogManager_Stats(t *testing.T) {
+	mgr := NewLogManager(10)
+
+	mgr.Writer("api").Write([]byte("hello\n"))
+	mgr.Writer("db").Write([]byte("hi\n"))
+	ch := mgr.Subscribe(nil)
+	defer mgr.Unsubscribe(ch)
+
+	stats := mgr.Stats()
+	want := LogStats{Lines: 2, Bytes: 7, Subscribers: 1}
+	if stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestLogManager_ServiceStats(t *testing.T) {
+	mgr := NewLogManager(10)
+	mgr.Writer("api").Write([]byte("hello\nworld\n"))
+	mgr.Writer("db").Write([]byte("hi\n"))
+	mgr.DiscardHistory("quiet")
+
+	want := ServiceLogStats{Lines: 2, Bytes: 10, Capacity: 10, History: LogHistoryMemory}
+	if stats := mgr.ServiceStats("api"); stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+	if stats := mgr.ServiceStats("quiet"); stats.History != LogHistoryNone {
+		t.Errorf("expected no history for a discarded service, got %+v", stats)
+	}
+}
+
+func TestLogManager_MemoryLimit(t *testing.T) {
+	mgr := NewLogManager(1000)
+	mgr.SetMemoryLimit(1000)
+
+	// "quiet" uses a fifth of the memory, "chatty" the rest
+	line := strings.Repeat("x", 9)
+	for i := 0; i < 20; i++ {
+		mgr.Writer("quiet").Write([]byte(line + "\n"))
+	}
+	for i := 0; i < 80; i++ {
+		mgr.Writer("chatty").Write([]byte(line + "\n"))
+	}
+	if stats := mgr.Stats(); stats.Evicted != 0 || stats.Bytes != 900 {
+		t.Fatalf("expected no eviction below the limit, got %+v", stats)
+	}
+
+	for i := 0; i < 20; i++ {
+		mgr.Writer("chatty").Write([]byte(line + "\n"))
+	}
+	stats := mgr.Stats()
+	if stats.Bytes > 1000 || stats.Evicted == 0 {
+		t.Fatalf("expected lines to be evicted to stay within the limit, got %+v", stats)
+	}
+	if stats.MemoryLimit != 1000 {
+		t.Errorf("expected the limit in stats, got %d", stats.MemoryLimit)
+	}
+
+	// Both services lost lines in proportion to their share
+	quiet := len(mgr.GetLines([]string{"quiet"}, 1000))
+	chatty := len(mgr.GetLines([]string{"chatty"}, 1000))
+	if quiet >= 20 || quiet < 15 {
+		t.Errorf("expected quiet to lose a few lines, %d left", quiet)
+	}
+	if chatty >= 100 || chatty < 70 {
+		t.Errorf("expected chatty to lose most of the evicted lines, %d left", chatty)
+	}
+	if int64(20+100-quiet-chatty) != stats.Evicted {
+		t.Errorf("expected %d evicted lines, got %d", 20+100-quiet-chatty, stats.Evicted)
+	}
+}
+
 func TestLogManager_Subscribe(t *testing.T) {
 	mgr := NewLogManager(10)
 
@@ -206,6 +322,171 @@ func TestLogManager_SubscribeAll(t *testing.T) {
 	mgr.Unsubscribe(ch)
 }
 
+func TestLogManager_SlowSubscriberGetsAllLines(t *testing.T) {
+	mgr := NewLogManager(10)
+	ch := mgr.Subscribe(nil)
+	defer mgr.Unsubscribe(ch)
+
+	// Far more lines than the channel holds, written before any are read
+	const total = 1000
+	writer := mgr.Writer("api")
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+
+	for i := 0; i < total; i++ {
+		select {
+		case line := <-ch:
+			if expected := fmt.Sprintf("line %d", i); line.Line != expected {
+				t.Fatalf("expected %q, got %q", expected, line.Line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for line %d", i)
+		}
+	}
+}
+
+func TestLogManager_SpillLimit(t *testing.T) {
+	mgr := NewLogManager(10)
+	mgr.spillLimit = 1024
+	ch := mgr.Subscribe(nil)
+	defer mgr.Unsubscribe(ch)
+
+	// Writing must not block even when the reader is stuck
+	writer := mgr.Writer("api")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+
+	received := 0
+	for {
+		select {
+		case <-ch:
+			received++
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	if received <= 100 || received >= 1000 {
+		t.Errorf("expected some lines beyond the channel capacity to be kept and the rest dropped, got %d", received)
+	}
+}
+
+func TestLogManager_DroppedNotice(t *testing.T) {
+	mgr := NewLogManager(10)
+	mgr.spillLimit = 1024
+	ch := mgr.Subscribe(nil)
+	defer mgr.Unsubscribe(ch)
+
+	const total = 1000
+	writer := mgr.Writer("api")
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+
+	// Every line is either received or counted by a notice, even those
+	// dropped after the last line
+	received, dropped := 0, 0
+	for received+dropped < total {
+		select {
+		case line := <-ch:
+			if line.Stream == StreamDropped {
+				dropped += line.Dropped
+			} else {
+				received++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout with %d lines received and %d dropped", received, dropped)
+		}
+	}
+	if dropped == 0 {
+		t.Error("expected lines to be dropped")
+	}
+	if stats := mgr.Stats(); stats.Dropped != int64(dropped) {
+		t.Errorf("expected %d dropped lines in stats, got %d", dropped, stats.Dropped)
+	}
+}
+
+func TestLogManager_UnsubscribeWhileSpilling(t *testing.T) {
+	mgr := NewLogManager(10)
+	ch := mgr.Subscribe(nil)
+
+	writer := mgr.Writer("api")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(writer, "line %d\n", i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		mgr.Unsubscribe(ch)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe blocked")
+	}
+
+	// The channel is closed after the buffered lines
+	for range ch {
+	}
+}
+
+func TestLogManager_ConcurrentServices(t *testing.T) {
+	mgr := NewLogManager(1000)
+	all := mgr.Subscribe(nil)
+	defer mgr.Unsubscribe(all)
+	filtered := mgr.Subscribe([]string{"svc0", "svc1"})
+	defer mgr.Unsubscribe(filtered)
+
+	const services, lines = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < services; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writer := mgr.Writer(fmt.Sprintf("svc%d", i))
+			for j := 0; j < lines; j++ {
+				fmt.Fprintf(writer, "%d\n", j)
+			}
+		}(i)
+	}
+
+	// Subscribing and unsubscribing while lines are written must not
+	// disturb other subscribers
+	for i := 0; i < 20; i++ {
+		mgr.Unsubscribe(mgr.Subscribe(nil))
+	}
+	wg.Wait()
+
+	receive := func(ch <-chan LogLine, want int) map[string]int {
+		next := make(map[string]int)
+		for n := 0; n < want; n++ {
+			select {
+			case line := <-ch:
+				if line.Line != fmt.Sprint(next[line.Service]) {
+					t.Fatalf("%s: expected line %d, got %s", line.Service, next[line.Service], line.Line)
+				}
+				next[line.Service]++
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected %d lines, got %d", want, n)
+			}
+		}
+		return next
+	}
+	if got := receive(all, services*lines); len(got) != services {
+		t.Errorf("expected lines of %d services, got %v", services, got)
+	}
+	if got := receive(filtered, 2*lines); len(got) != 2 {
+		t.Errorf("expected lines of svc0 and svc1 only, got %v", got)
+	}
+	if stats := mgr.Stats(); stats.Lines != services*lines || stats.Subscribers != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
 func TestLogManager_GetLinesLimit(t *testing.T) {
 	mgr := NewLogManager(10)
 	writer := mgr.Writer("api")
@@ -219,3 +500,20 @@ func TestLogManager_GetLinesLimit(t *testing.T) {
 		t.Errorf("expected 3 lines (limited), got %d", len(lines))
 	}
 }
+
+func TestLogManager_Color(t *testing.T) {
+	mgr := NewLogManager(10)
+	if mgr.Color("db") != 0 || mgr.Color("api") != 1 {
+		t.Fatal("expected colors to be assigned in order of first use")
+	}
+	if mgr.Color("db") != 0 {
+		t.Error("expected a service to keep its color")
+	}
+
+	w := mgr.Writer("api")
+	w.Write([]byte("hello\n"))
+	lines := mgr.GetLines([]string{"api"}, 10)
+	if len(lines) != 1 || lines[0].Color != 1 {
+		t.Errorf("expected lines to carry the service's color, got %+v", lines)
+	}
+}
@@ -0,0 +1,453 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogStorePath returns the default directory of the on-disk log store of a
+// daemon listening on socketPath.
+func LogStorePath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".logs"
+}
+
+// LogStore keeps the log history of each service on disk, so history is
+// not limited by memory and survives daemon restarts.
+//
+// Each service has a directory of segments. A segment is a data file
+// holding one record per line (a stream byte, the line, and a newline) and
+// an index file holding a fixed-size entry per line: the line's timestamp
+// and the offset of its record. Since lines are appended in time order, the
+// index allows finding the lines after a point in time, or the last N
+// lines, by binary search and direct reads instead of scanning the data.
+// When a service's segments exceed the size limit, the oldest are removed.
+type LogStore struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	mu       sync.Mutex
+	services map[string]*serviceStore
+}
+
+// logIndexEntrySize is the size of an index entry: the timestamp in Unix
+// nanoseconds and the record offset, both big-endian int64.
+const logIndexEntrySize = 16
+
+// Stream bytes of data records.
+var streamBytes = map[string]byte{"stdout": 'o', "stderr": 'e', StreamMarker: 'm'}
+
+// OpenLogStore opens or creates a log store in dir.
+func OpenLogStore(dir string, segmentSize, maxSize int64) (*LogStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log store: %w", err)
+	}
+	return &LogStore{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxSize:     maxSize,
+		services:    make(map[string]*serviceStore),
+	}, nil
+}
+
+// service returns the store of a service, loading its segments on first use.
+func (s *LogStore) service(name string) (*serviceStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss, ok := s.services[name]; ok {
+		return ss, nil
+	}
+	// Qualified names contain "/"
+	ss, err := openServiceStore(filepath.Join(s.dir, url.PathEscape(name)))
+	if err != nil {
+		return nil, err
+	}
+	s.services[name] = ss
+	return ss, nil
+}
+
+// Write appends a line to the history of its service.
+func (s *LogStore) Write(line LogLine) error {
+	ss, err := s.service(line.Service)
+	if err != nil {
+		return err
+	}
+	return ss.append(line, s.segmentSize, s.maxSize)
+}
+
+// Read returns the last count lines of a service that were written at or
+// after since, oldest first.
+func (s *LogStore) Read(service string, since time.Time, count int) ([]LogLine, error) {
+	ss, err := s.service(service)
+	if err != nil {
+		return nil, err
+	}
+	return ss.read(service, since, count, LogFilter{})
+}
+
+// ReadFiltered is like Read, but only counts and returns the lines that pass
+// filter.
+func (s *LogStore) ReadFiltered(service string, since time.Time, count int, filter LogFilter) ([]LogLine, error) {
+	ss, err := s.service(service)
+	if err != nil {
+		return nil, err
+	}
+	return ss.read(service, since, count, filter)
+}
+
+// Close closes the files of all services.
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ss := range s.services {
+		ss.close()
+	}
+	s.services = make(map[string]*serviceStore)
+	return nil
+}
+
+// serviceStore holds the segments of one service.
+type serviceStore struct {
+	mu       sync.Mutex
+	dir      string
+	segments []*logSegment // Oldest first; the last one is written to
+	size     int64         // Total size of the segments' files
+}
+
+// logSegment is a data file and its index. Only the segment being written
+// keeps its files open; older segments are opened while they are read.
+type logSegment struct {
+	id       uint64
+	dataSize int64
+	count    int      // Number of lines
+	data     *os.File // nil while closed
+	index    *os.File
+}
+
+func openServiceStore(dir string) (*serviceStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log store: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log store: %w", err)
+	}
+
+	ss := &serviceStore{dir: dir}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".idx")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := ss.openSegment(id)
+		if err != nil {
+			ss.close()
+			return nil, err
+		}
+		ss.segments = append(ss.segments, seg)
+		ss.size += seg.dataSize + int64(seg.count)*logIndexEntrySize
+	}
+	sort.Slice(ss.segments, func(i, j int) bool { return ss.segments[i].id < ss.segments[j].id })
+	for i := 0; i < len(ss.segments)-1; i++ {
+		ss.segments[i].close()
+	}
+	return ss, nil
+}
+
+func (ss *serviceStore) segmentPath(id uint64, ext string) string {
+	return filepath.Join(ss.dir, fmt.Sprintf("%016d%s", id, ext))
+}
+
+// openSegment opens or creates the files of a segment. An entry or record
+// partially written when a daemon died is cut off.
+func (ss *serviceStore) openSegment(id uint64) (*logSegment, error) {
+	open := func(ext string) (*os.File, int64, error) {
+		f, err := os.OpenFile(ss.segmentPath(id, ext), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open log segment: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("failed to open log segment: %w", err)
+		}
+		return f, info.Size(), nil
+	}
+
+	index, indexSize, err := open(".idx")
+	if err != nil {
+		return nil, err
+	}
+	data, dataSize, err := open(".log")
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	seg := &logSegment{id: id, data: data, index: index, count: int(indexSize / logIndexEntrySize)}
+	index.Truncate(int64(seg.count) * logIndexEntrySize)
+	if seg.count > 0 {
+		// The data ends with the last indexed record. A record without an
+		// index entry, or cut short, is dropped.
+		entries, err := seg.readIndex(seg.count-1, seg.count)
+		if err != nil {
+			seg.close()
+			return nil, err
+		}
+		last := entries[0].offset
+		end, ok := recordEnd(data, last, dataSize)
+		if !ok {
+			seg.count--
+			index.Truncate(int64(seg.count) * logIndexEntrySize)
+			end = last
+		}
+		dataSize = end
+	} else {
+		dataSize = 0
+	}
+	seg.dataSize = dataSize
+	data.Truncate(dataSize)
+	return seg, nil
+}
+
+// recordEnd returns the end of the record at offset, if it is complete.
+func recordEnd(f *os.File, offset, size int64) (int64, bool) {
+	if offset >= size {
+		return 0, false
+	}
+	buf := make([]byte, size-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return 0, false
+	}
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return 0, false
+	}
+	return offset + int64(i) + 1, true
+}
+
+func (ss *serviceStore) append(line LogLine, segmentSize, maxSize int64) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if len(ss.segments) == 0 || ss.segments[len(ss.segments)-1].dataSize >= segmentSize {
+		var id uint64
+		if len(ss.segments) > 0 {
+			last := ss.segments[len(ss.segments)-1]
+			last.close()
+			id = last.id + 1
+		}
+		seg, err := ss.openSegment(id)
+		if err != nil {
+			return err
+		}
+		ss.segments = append(ss.segments, seg)
+	}
+	seg := ss.segments[len(ss.segments)-1]
+
+	record := make([]byte, 0, len(line.Line)+2)
+	record = append(record, streamBytes[line.Stream])
+	record = append(record, line.Line...)
+	record = append(record, '\n')
+	if _, err := seg.data.WriteAt(record, seg.dataSize); err != nil {
+		return fmt.Errorf("failed to write log segment: %w", err)
+	}
+	var entry [logIndexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:8], uint64(line.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(entry[8:], uint64(seg.dataSize))
+	if _, err := seg.index.WriteAt(entry[:], int64(seg.count)*logIndexEntrySize); err != nil {
+		return fmt.Errorf("failed to write log index: %w", err)
+	}
+	seg.dataSize += int64(len(record))
+	seg.count++
+	ss.size += int64(len(record)) + logIndexEntrySize
+
+	// Drop the oldest segments beyond the limit, but keep the current one
+	for ss.size > maxSize && len(ss.segments) > 1 {
+		old := ss.segments[0]
+		old.close()
+		os.Remove(ss.segmentPath(old.id, ".log"))
+		os.Remove(ss.segmentPath(old.id, ".idx"))
+		ss.size -= old.dataSize + int64(old.count)*logIndexEntrySize
+		ss.segments = ss.segments[1:]
+	}
+	return nil
+}
+
+func (ss *serviceStore) read(service string, since time.Time, count int, filter LogFilter) ([]LogLine, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	// Collect from the newest segment backwards
+	var chunks [][]LogLine
+	remaining := count
+	for i := len(ss.segments) - 1; i >= 0 && remaining > 0; i-- {
+		seg := ss.segments[i]
+		if seg.data == nil {
+			if err := ss.openForRead(seg); err != nil {
+				return nil, err
+			}
+			defer seg.close()
+		}
+		start := 0
+		if !since.IsZero() {
+			var err error
+			if start, err = seg.search(since); err != nil {
+				return nil, err
+			}
+		}
+		// With a filter, the lines to read can't be told by count
+		if filter == (LogFilter{}) && seg.count-start > remaining {
+			start = seg.count - remaining
+		}
+		lines, err := seg.readLines(service, start)
+		if err != nil {
+			return nil, err
+		}
+		if filter != (LogFilter{}) {
+			lines = slices.DeleteFunc(lines, func(line LogLine) bool { return !filter.match(line) })
+			if len(lines) > remaining {
+				lines = lines[len(lines)-remaining:]
+			}
+		}
+		chunks = append(chunks, lines)
+		remaining -= len(lines)
+		if start > 0 {
+			// Earlier lines are older than since or beyond count
+			break
+		}
+	}
+
+	var result []LogLine
+	for i := len(chunks) - 1; i >= 0; i-- {
+		result = append(result, chunks[i]...)
+	}
+	return result, nil
+}
+
+// openForRead opens the files of a closed segment for reading.
+func (ss *serviceStore) openForRead(seg *logSegment) error {
+	data, err := os.Open(ss.segmentPath(seg.id, ".log"))
+	if err != nil {
+		return fmt.Errorf("failed to open log segment: %w", err)
+	}
+	index, err := os.Open(ss.segmentPath(seg.id, ".idx"))
+	if err != nil {
+		data.Close()
+		return fmt.Errorf("failed to open log segment: %w", err)
+	}
+	seg.data, seg.index = data, index
+	return nil
+}
+
+func (ss *serviceStore) close() {
+	for _, seg := range ss.segments {
+		seg.close()
+	}
+	ss.segments = nil
+}
+
+// logIndexEntry is a decoded index entry.
+type logIndexEntry struct {
+	time   int64
+	offset int64
+}
+
+// readIndex reads the index entries [from, to).
+func (seg *logSegment) readIndex(from, to int) ([]logIndexEntry, error) {
+	buf := make([]byte, (to-from)*logIndexEntrySize)
+	if _, err := seg.index.ReadAt(buf, int64(from)*logIndexEntrySize); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read log index: %w", err)
+	}
+	entries := make([]logIndexEntry, to-from)
+	for i := range entries {
+		b := buf[i*logIndexEntrySize:]
+		entries[i] = logIndexEntry{
+			time:   int64(binary.BigEndian.Uint64(b[:8])),
+			offset: int64(binary.BigEndian.Uint64(b[8:16])),
+		}
+	}
+	return entries, nil
+}
+
+// search returns the index of the first line written at or after t.
+func (seg *logSegment) search(t time.Time) (int, error) {
+	target := t.UnixNano()
+	var searchErr error
+	i := sort.Search(seg.count, func(i int) bool {
+		entries, err := seg.readIndex(i, i+1)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return entries[0].time >= target
+	})
+	return i, searchErr
+}
+
+// readLines reads the lines from index start to the end of the segment.
+func (seg *logSegment) readLines(service string, start int) ([]LogLine, error) {
+	if start >= seg.count {
+		return nil, nil
+	}
+	entries, err := seg.readIndex(start, seg.count)
+	if err != nil {
+		return nil, err
+	}
+	base := entries[0].offset
+	data := make([]byte, seg.dataSize-base)
+	if _, err := seg.data.ReadAt(data, base); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read log segment: %w", err)
+	}
+
+	lines := make([]LogLine, 0, len(entries))
+	for i, e := range entries {
+		end := int64(len(data))
+		if i+1 < len(entries) {
+			end = entries[i+1].offset - base
+		}
+		record := data[e.offset-base : end]
+		if len(record) < 2 {
+			continue
+		}
+		lines = append(lines, LogLine{
+			Service:   service,
+			Line:      string(record[1 : len(record)-1]),
+			Timestamp: time.Unix(0, e.time),
+			Stream:    recordStream(record[0]),
+		})
+	}
+	return lines, nil
+}
+
+func recordStream(b byte) string {
+	for stream, sb := range streamBytes {
+		if sb == b {
+			return stream
+		}
+	}
+	return "stdout"
+}
+
+func (seg *logSegment) close() {
+	if seg.data != nil {
+		seg.data.Close()
+		seg.index.Close()
+		seg.data, seg.index = nil, nil
+	}
+}
@@ -0,0 +1,259 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLogStorePath(t *testing.T) {
+	got := LogStorePath("/tmp/comproc-abc.sock")
+	if got != "/tmp/comproc-abc.logs" {
+		t.Errorf("expected /tmp/comproc-abc.logs, got %s", got)
+	}
+}
+
+// writeStoreLines writes n lines to a service, one second apart from base.
+func writeStoreLines(t *testing.T, s *LogStore, service string, base time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := s.Write(LogLine{
+			Service:   service,
+			Line:      fmt.Sprintf("line %d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Stream:    "stdout",
+		})
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+}
+
+func TestLogStore_Read(t *testing.T) {
+	s, err := OpenLogStore(t.TempDir(), 1<<20, 8<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeStoreLines(t, s, "api", base, 10)
+	s.Write(LogLine{Service: "api", Line: "oops", Timestamp: base.Add(10 * time.Second), Stream: "stderr"})
+	s.Write(LogLine{Service: "proj/web", Line: "hello", Timestamp: base, Stream: "stdout"})
+
+	lines, err := s.Read("api", time.Time{}, 3)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(lines) != 3 || lines[0].Line != "line 8" || lines[2].Line != "oops" {
+		t.Fatalf("expected the last 3 lines, got %+v", lines)
+	}
+	if lines[2].Stream != "stderr" || lines[2].Service != "api" || !lines[2].Timestamp.Equal(base.Add(10*time.Second)) {
+		t.Errorf("expected the stderr line as written, got %+v", lines[2])
+	}
+
+	lines, _ = s.Read("api", base.Add(7*time.Second), 100)
+	if len(lines) != 4 || lines[0].Line != "line 7" {
+		t.Errorf("expected the lines since line 7, got %+v", lines)
+	}
+
+	lines, _ = s.Read("proj/web", time.Time{}, 100)
+	if len(lines) != 1 || lines[0].Line != "hello" {
+		t.Errorf("expected the line of proj/web, got %+v", lines)
+	}
+}
+
+func TestLogStore_SegmentsAndLimit(t *testing.T) {
+	dir := t.TempDir()
+	// "line N\n" records are 8-9 bytes, so segments hold a few lines each
+	s, err := OpenLogStore(dir, 64, 512)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeStoreLines(t, s, "api", base, 100)
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "api", "*.log"))
+	if len(segments) < 2 {
+		t.Fatalf("expected several segments, got %v", segments)
+	}
+
+	// Reads span segments
+	lines, err := s.Read("api", base.Add(90*time.Second), 100)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(lines) != 10 || lines[0].Line != "line 90" || lines[9].Line != "line 99" {
+		t.Errorf("expected lines 90 to 99, got %+v", lines)
+	}
+
+	// The oldest segments are removed beyond the limit
+	lines, _ = s.Read("api", time.Time{}, 1000)
+	if len(lines) == 0 || len(lines) >= 100 || lines[len(lines)-1].Line != "line 99" {
+		t.Errorf("expected the oldest lines to be dropped, got %d lines", len(lines))
+	}
+	var size int64
+	files, _ := os.ReadDir(filepath.Join(dir, "api"))
+	for _, f := range files {
+		info, _ := f.Info()
+		size += info.Size()
+	}
+	if size > 512+64+logIndexEntrySize*8 {
+		t.Errorf("expected the store to stay near its limit, got %d bytes", size)
+	}
+}
+
+func TestLogStore_ReadFiltered(t *testing.T) {
+	s, err := OpenLogStore(t.TempDir(), 64, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		stream := "stdout"
+		if i%10 == 0 {
+			stream = "stderr"
+		}
+		s.Write(LogLine{Service: "api", Line: fmt.Sprintf("line %d", i), Timestamp: base.Add(time.Duration(i) * time.Second), Stream: stream})
+	}
+	s.Write(LogLine{Service: "api", Line: "--- api restarted ---", Timestamp: base.Add(time.Minute), Stream: StreamMarker})
+
+	// The count applies to the stream's lines across segments; markers are kept
+	lines, err := s.ReadFiltered("api", time.Time{}, 3, LogFilter{Stream: "stderr"})
+	if err != nil {
+		t.Fatalf("ReadFiltered failed: %v", err)
+	}
+	if len(lines) != 3 || lines[0].Line != "line 10" || lines[1].Line != "line 20" || lines[2].Stream != StreamMarker {
+		t.Errorf("expected the last stderr lines and the marker, got %+v", lines)
+	}
+
+	lines, _ = s.ReadFiltered("api", base.Add(5*time.Second), 100, LogFilter{Stream: "stderr"})
+	if len(lines) != 3 || lines[0].Line != "line 10" {
+		t.Errorf("expected stderr lines since 5s, got %+v", lines)
+	}
+
+	lines, _ = s.ReadFiltered("api", time.Time{}, 2, LogFilter{Grep: regexp.MustCompile(`^line 1\d$`)})
+	if len(lines) != 2 || lines[0].Line != "line 19" || lines[1].Stream != StreamMarker {
+		t.Errorf("expected the last matching line and the marker, got %+v", lines)
+	}
+}
+
+func TestLogStore_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := OpenLogStore(dir, 64, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	writeStoreLines(t, s, "api", base, 20)
+	s.Close()
+
+	// Simulate a record cut short by a crash
+	segments, _ := filepath.Glob(filepath.Join(dir, "api", "*.log"))
+	last := segments[len(segments)-1]
+	info, _ := os.Stat(last)
+	os.Truncate(last, info.Size()-3)
+
+	s, err = OpenLogStore(dir, 64, 1<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	defer s.Close()
+	s.Write(LogLine{Service: "api", Line: "after", Timestamp: base.Add(time.Minute), Stream: "stdout"})
+
+	lines, err := s.Read("api", time.Time{}, 3)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(lines) != 3 || lines[0].Line != "line 17" || lines[1].Line != "line 18" || lines[2].Line != "after" {
+		t.Errorf("expected the cut line to be dropped, got %+v", lines)
+	}
+}
+
+func TestLogManager_Store(t *testing.T) {
+	store, err := OpenLogStore(t.TempDir(), 1<<20, 8<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	m := NewLogManager(2)
+	m.SetStore(store)
+	defer m.Close()
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		m.addLine(LogLine{Service: "api", Line: fmt.Sprintf("api %d", i), Timestamp: base.Add(time.Duration(2*i) * time.Second), Stream: "stdout"})
+		m.addLine(LogLine{Service: "db", Line: fmt.Sprintf("db %d", i), Timestamp: base.Add(time.Duration(2*i+1) * time.Second), Stream: "stdout"})
+	}
+
+	// History goes beyond the ring buffers and is merged by time
+	lines := m.GetLines([]string{"api", "db"}, 4)
+	want := []string{"api 3", "db 3", "api 4", "db 4"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, lines)
+	}
+	for i, line := range lines {
+		if line.Line != want[i] {
+			t.Errorf("line %d: expected %q, got %q", i, want[i], line.Line)
+		}
+	}
+	if lines[1].Color != m.Color("db") {
+		t.Errorf("expected the color of db, got %d", lines[1].Color)
+	}
+
+	lines = m.GetLinesSince([]string{"api"}, base.Add(3*time.Second), 100)
+	if len(lines) != 3 || lines[0].Line != "api 2" {
+		t.Errorf("expected api lines since 3s, got %+v", lines)
+	}
+}
+
+func TestLogManager_LogFile(t *testing.T) {
+	store, err := OpenLogStore(t.TempDir(), 1<<20, 8<<20)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	m := NewLogManager(10)
+	m.SetStore(store)
+	file := &memorySink{}
+	m.SetLogFile("api", file)
+	m.DiscardHistory("noisy")
+	sink := &memorySink{}
+	m.AddSink("noisy", sink)
+
+	m.Writer("api").Write([]byte("hello\n"))
+	m.Writer("noisy").Write([]byte("spam\n"))
+	m.Writer("db").Write([]byte("stored\n"))
+
+	if len(file.lines) != 1 || file.lines[0].Line != "hello" {
+		t.Errorf("expected the log file to receive api's line, got %+v", file.lines)
+	}
+	if lines, _ := store.Read("api", time.Time{}, 10); len(lines) != 0 {
+		t.Errorf("expected api to be kept out of the store, got %+v", lines)
+	}
+	if lines := m.GetLines([]string{"api"}, 10); len(lines) != 1 || lines[0].Line != "hello" {
+		t.Errorf("expected api's recent lines in memory, got %+v", lines)
+	}
+
+	// Discarded lines still reach sinks, but no history
+	if lines := m.GetLines([]string{"noisy"}, 10); len(lines) != 0 {
+		t.Errorf("expected no history for noisy, got %+v", lines)
+	}
+	if len(sink.lines) != 1 {
+		t.Errorf("expected the sink to receive noisy's line, got %+v", sink.lines)
+	}
+	if lines := m.GetLines([]string{"db"}, 10); len(lines) != 1 || lines[0].Line != "stored" {
+		t.Errorf("expected db's history from the store, got %+v", lines)
+	}
+
+	m.Close()
+	if !file.closed {
+		t.Error("expected the log file to be closed")
+	}
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PIDFilePath returns the path of the pidfile of the daemon listening on
+// socketPath. It lives next to the socket.
+func PIDFilePath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".pid"
+}
+
+// writePIDFile records the current process in the pidfile at path,
+// replacing the pidfile of a daemon that is gone. The returned file holds a
+// lock on the pidfile until it is closed by removePIDFile, which tells the
+// pidfile of a running daemon apart from a stale one whose PID may have been
+// reused by an unrelated process.
+func writePIDFile(path string) (*os.File, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to lock pidfile: %w", err)
+	}
+	if _, err := f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	return f, nil
+}
+
+// removePIDFile removes the pidfile at path if it still names the current
+// process, so that a daemon never removes the pidfile of its successor, and
+// releases its lock.
+func removePIDFile(path string, f *os.File) {
+	if pid, err := ReadPIDFile(path); err == nil && pid == os.Getpid() {
+		os.Remove(path)
+	}
+	f.Close()
+}
+
+// PIDFileLocked reports whether a running daemon holds the lock on the
+// pidfile at path. A pidfile without the lock was left behind by a daemon
+// that is gone, even if a process with its PID exists.
+func PIDFileLocked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
+
+// ReadPIDFile returns the PID recorded in the pidfile at path. The error
+// satisfies errors.Is(err, fs.ErrNotExist) if there is no pidfile.
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pidfile %s", path)
+	}
+	return pid, nil
+}
+
+// ProcessAlive reports whether a process with the given PID exists.
+func ProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPIDFilePath(t *testing.T) {
+	got := PIDFilePath("/tmp/comproc-abc.sock")
+	if got != "/tmp/comproc-abc.pid" {
+		t.Errorf("expected /tmp/comproc-abc.pid, got %s", got)
+	}
+}
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.pid")
+	if _, err := ReadPIDFile(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist without a pidfile, got %v", err)
+	}
+
+	f, err := writePIDFile(path)
+	if err != nil {
+		t.Fatalf("writePIDFile failed: %v", err)
+	}
+	if !PIDFileLocked(path) {
+		t.Error("expected the pidfile to be locked")
+	}
+	pid, err := ReadPIDFile(path)
+	if err != nil || pid != os.Getpid() {
+		t.Fatalf("expected pid %d, got %d, %v", os.Getpid(), pid, err)
+	}
+	if !ProcessAlive(pid) {
+		t.Error("expected the current process to be alive")
+	}
+
+	removePIDFile(path, f)
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the pidfile to be removed, got %v", err)
+	}
+}
+
+func TestRemovePIDFile_KeepsOtherDaemons(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.pid")
+	// The pidfile of a daemon started after this one
+	if err := os.WriteFile(path, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removePIDFile(path, f)
+	if pid, err := ReadPIDFile(path); err != nil || pid != 1 {
+		t.Errorf("expected the other daemon's pidfile to be kept, got %d, %v", pid, err)
+	}
+}
+
+func TestPIDFileLocked_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.pid")
+	// A live process that is not a daemon holding the pidfile
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if PIDFileLocked(path) {
+		t.Error("expected a pidfile without the lock to be stale")
+	}
+	if PIDFileLocked(filepath.Join(t.TempDir(), "missing.pid")) {
+		t.Error("expected a missing pidfile not to be locked")
+	}
+}
+
+func TestReadPIDFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.pid")
+	if err := os.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPIDFile(path); err == nil {
+		t.Error("expected an error for an invalid pidfile")
+	}
+}
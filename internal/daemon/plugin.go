@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+// pluginEvent is a lifecycle event sent to plugins as one line of JSON.
+type pluginEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Service  string    `json:"service,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode int       `json:"exit_code,omitempty"`
+	Signal   string    `json:"signal,omitempty"` // Signal that killed the process, e.g. "SIGKILL"
+	Restarts int       `json:"restarts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	NextRestartAt time.Time `json:"next_restart_at,omitzero"` // Set on service.restarting
+	Memory        int64     `json:"memory,omitempty"`         // Bytes in use, set on service.mem_limit
+	MemLimit      int64     `json:"mem_limit,omitempty"`      // Bytes allowed, set on service.mem_limit
+}
+
+// Plugins delivers lifecycle events to the plugin commands of a config.
+// Each plugin runs for as long as the daemon and reads events from its
+// stdin; events are dropped if it falls behind or has exited.
+// A nil *Plugins discards all events.
+type Plugins struct {
+	mu      sync.Mutex
+	plugins []runningPlugin
+	closed  bool
+}
+
+type runningPlugin struct {
+	cfg  config.Plugin
+	pipe *commandPipe
+}
+
+// startPlugins starts the given plugin commands in baseDir with env added
+// to their environment.
+func startPlugins(cfgs []config.Plugin, baseDir string, env []string) (*Plugins, error) {
+	p := &Plugins{}
+	for i, cfg := range cfgs {
+		cmd := exec.Command("sh", "-c", cfg.Command)
+		cmd.Dir = baseDir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		pipe, err := startCommandPipe(cmd)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to start plugins[%d]: %w", i, err)
+		}
+		p.plugins = append(p.plugins, runningPlugin{cfg: cfg, pipe: pipe})
+	}
+	return p, nil
+}
+
+// Emit sends an event to the plugins subscribed to it.
+func (p *Plugins) Emit(e pluginEvent) {
+	if p == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	for _, plugin := range p.plugins {
+		if plugin.cfg.Subscribes(e.Event) {
+			plugin.pipe.Send(string(data) + "\n")
+		}
+	}
+}
+
+// Close delivers the queued events, closes the stdin of each plugin, and
+// waits for them to exit.
+func (p *Plugins) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, plugin := range p.plugins {
+		wg.Go(plugin.pipe.Close)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+	plugins, err := startPlugins([]config.Plugin{
+		{Command: `cat > all.log`},
+		{Command: `cat > failures.log`, Events: []string{config.PluginEventServiceFailed}},
+		{Command: `echo "$COMPROC_PROJECT" > env.log; cat > /dev/null`},
+	}, dir, []string{"COMPROC_PROJECT=shop"})
+	if err != nil {
+		t.Fatalf("failed to start plugins: %v", err)
+	}
+
+	plugins.Emit(pluginEvent{Event: config.PluginEventServiceStarted, Service: "api", PID: 42})
+	plugins.Emit(pluginEvent{Event: config.PluginEventServiceFailed, Service: "api", ExitCode: 1})
+	// Close waits for the plugins to consume all queued events and exit
+	plugins.Close()
+	// Events after Close are discarded
+	plugins.Emit(pluginEvent{Event: config.PluginEventDaemonDown})
+
+	all := readEvents(t, filepath.Join(dir, "all.log"))
+	if len(all) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(all))
+	}
+	if all[0].Event != config.PluginEventServiceStarted || all[0].Service != "api" || all[0].PID != 42 {
+		t.Errorf("unexpected event: %+v", all[0])
+	}
+	if all[0].Time.IsZero() {
+		t.Error("expected event time to be set")
+	}
+
+	failures := readEvents(t, filepath.Join(dir, "failures.log"))
+	if len(failures) != 1 || failures[0].Event != config.PluginEventServiceFailed || failures[0].ExitCode != 1 {
+		t.Errorf("expected only the failure event, got %+v", failures)
+	}
+
+	env, err := os.ReadFile(filepath.Join(dir, "env.log"))
+	if err != nil {
+		t.Fatalf("failed to read env output: %v", err)
+	}
+	if strings.TrimSpace(string(env)) != "shop" {
+		t.Errorf("expected COMPROC_PROJECT=shop, got %q", env)
+	}
+}
+
+func TestPlugins_Nil(t *testing.T) {
+	var plugins *Plugins
+	plugins.Emit(pluginEvent{Event: config.PluginEventDaemonUp})
+	plugins.Close()
+}
+
+func readEvents(t *testing.T, path string) []pluginEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+	var events []pluginEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var e pluginEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
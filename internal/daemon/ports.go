@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/process"
+)
+
+// autoPorts remembers the ports of each service's last run, so that a
+// restarted service gets the ports it had before if they are still free.
+type autoPorts struct {
+	mu    sync.Mutex
+	ports map[string][]int // One per entry of the service's ports
+}
+
+// runtimeEnv returns the environment variables a service gets from the
+// daemon when it starts: which service and run it is, the ports picked for
+// its "auto" ports, and the states and picked ports of its dependencies.
+func (d *Daemon) runtimeEnv(name string) (map[string]string, error) {
+	d.mu.RLock()
+	svc, ok := d.config.Services[name]
+	deps := make(map[string]*config.Service)
+	states := make(map[string]string)
+	var restarts int
+	if ok {
+		for _, dep := range svc.DependencyNames() {
+			deps[dep] = d.config.Services[dep]
+			if proc, ok := d.processes[dep]; ok {
+				states[dep] = string(proc.GetState())
+			}
+		}
+		if proc, ok := d.processes[name]; ok {
+			restarts = proc.GetRestarts()
+		}
+	}
+	projName, configPath, service := d.serviceProject(name)
+	d.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	ports, err := d.allocatePorts(name, svc)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{
+		"COMPROC_SERVICE":     service,
+		"COMPROC_PROJECT":     projName,
+		"COMPROC_CONFIG_PATH": configPath,
+		"COMPROC_RESTARTS":    strconv.Itoa(restarts),
+	}
+	if svc.Replica > 0 {
+		env["COMPROC_REPLICA"] = strconv.Itoa(svc.Replica)
+	}
+	for i, entry := range svc.Ports {
+		if entry == config.PortAuto {
+			env[config.PortEnvName(i)] = strconv.Itoa(ports[i])
+		}
+	}
+
+	for dep, depSvc := range deps {
+		// Dependencies of other projects are qualified
+		prefix := config.EnvName(dep[strings.LastIndex(dep, projectSeparator)+1:])
+		if state, ok := states[dep]; ok {
+			env[prefix+"_SERVICE_STATE"] = state
+		}
+		if depSvc != nil && len(depSvc.Ports) > 0 && depSvc.Ports[0] == config.PortAuto {
+			if ports := d.ServicePorts(dep); len(ports) > 0 {
+				env[prefix+"_PORT"] = strconv.Itoa(ports[0])
+			}
+		}
+	}
+	return env, nil
+}
+
+// allocatePorts returns the ports of a service's next run, picking a free
+// port for each "auto" entry. Ports picked for the previous run are reused
+// if they are still free.
+func (d *Daemon) allocatePorts(name string, svc *config.Service) ([]int, error) {
+	d.ports.mu.Lock()
+	defer d.ports.mu.Unlock()
+	if d.ports.ports == nil {
+		d.ports.ports = make(map[string][]int)
+	}
+
+	// Don't hand out the ports of other services, which may not be
+	// listening yet
+	var taken []int
+	for other, ports := range d.ports.ports {
+		if other != name {
+			taken = append(taken, ports...)
+		}
+	}
+
+	prev := d.ports.ports[name]
+	ports := make([]int, len(svc.Ports))
+	for i, entry := range svc.Ports {
+		if entry != config.PortAuto {
+			ports[i], _ = strconv.Atoi(entry)
+			taken = append(taken, ports[i])
+			continue
+		}
+		if i < len(prev) && !slices.Contains(taken, prev[i]) && process.PortFree(prev[i]) {
+			ports[i] = prev[i]
+		} else {
+			port, err := freePort(taken)
+			if err != nil {
+				return nil, err
+			}
+			ports[i] = port
+		}
+		taken = append(taken, ports[i])
+	}
+	d.ports.ports[name] = ports
+	return ports, nil
+}
+
+// ServicePorts returns the ports of a service's last run, or nil if it has
+// no ports or has not started.
+func (d *Daemon) ServicePorts(name string) []int {
+	d.ports.mu.Lock()
+	defer d.ports.mu.Unlock()
+	return slices.Clone(d.ports.ports[name])
+}
+
+// releasePorts forgets the ports of removed services, so that other
+// services can be given them.
+func (d *Daemon) releasePorts(names []string) {
+	d.ports.mu.Lock()
+	defer d.ports.mu.Unlock()
+	for _, name := range names {
+		delete(d.ports.ports, name)
+	}
+}
+
+// freePort returns a free TCP port chosen by the system, other than the
+// taken ones.
+func freePort(taken []int) (int, error) {
+	for range 10 {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, fmt.Errorf("failed to find a free port: %w", err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if !slices.Contains(taken, port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to find a free port")
+}
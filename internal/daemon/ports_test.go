@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestAllocatePorts(t *testing.T) {
+	web := config.NewService("node server.js").WithPorts("8080", config.PortAuto)
+	app := config.NewService("node app.js").WithPorts(config.PortAuto).WithDependsOn("web")
+	d := &Daemon{config: &config.Config{Services: map[string]*config.Service{"web": web, "app": app}}}
+
+	ports, err := d.allocatePorts("web", web)
+	if err != nil {
+		t.Fatalf("allocatePorts failed: %v", err)
+	}
+	if len(ports) != 2 || ports[0] != 8080 || ports[1] == 0 {
+		t.Fatalf("expected the fixed port and a picked port, got %v", ports)
+	}
+
+	// A restart reuses the picked port while it is free
+	again, _ := d.allocatePorts("web", web)
+	if again[1] != ports[1] {
+		t.Errorf("expected port %d to be reused, got %d", ports[1], again[1])
+	}
+
+	// Another service doesn't get the same port
+	env, err := d.runtimeEnv("app")
+	if err != nil {
+		t.Fatalf("runtimeEnv failed: %v", err)
+	}
+	if env["PORT"] == "" || env["PORT"] == strconv.Itoa(ports[1]) {
+		t.Errorf("expected a port of its own for app, got %v", env)
+	}
+	if _, ok := env["WEB_PORT"]; ok {
+		t.Errorf("expected WEB_PORT to come from the config, got %v", env)
+	}
+
+	// A port taken in the meantime is replaced
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(ports[1]))
+	if err != nil {
+		t.Skipf("cannot listen on the picked port: %v", err)
+	}
+	defer l.Close()
+	again, _ = d.allocatePorts("web", web)
+	if again[1] == ports[1] || again[1] == 0 {
+		t.Errorf("expected a new port instead of the taken %d, got %d", ports[1], again[1])
+	}
+	if got := d.ServicePorts("web"); got[1] != again[1] {
+		t.Errorf("expected the new port to be recorded, got %v", got)
+	}
+}
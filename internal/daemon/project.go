@@ -0,0 +1,447 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/process"
+	"github.com/ryym/comproc/internal/suggest"
+)
+
+// A daemon is started for one config file (the primary project), whose
+// services keep their plain names. When several projects share a daemon
+// socket (via COMPROC_SOCKET), additional projects are loaded on demand and
+// their services are namespaced as "project/service".
+
+// projectSeparator separates the project name from the service name.
+const projectSeparator = "/"
+
+// project holds the services contributed by one config file.
+type project struct {
+	name       string
+	configPath string
+	services   []string // Names as registered in the daemon, in config order
+}
+
+// loadConfig loads the config file of a project with the daemon's overlay,
+// the replica counts set by scale, and, for the primary project, its
+// override files.
+func (d *Daemon) loadConfig(configPath string) (*config.Config, error) {
+	return d.loadScaled(configPath, d.replicas.get(configPath))
+}
+
+// loadScaled loads the config file of a project like loadConfig, with the
+// given replica counts.
+func (d *Daemon) loadScaled(configPath string, replicas map[string]int) (*config.Config, error) {
+	var overrides []string
+	if configPath == d.configPath {
+		overrides = d.overrides
+	}
+	cfg, err := config.LoadScaled(configPath, overrides, d.env, replicas)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return cfg, nil
+}
+
+// CheckOverrides returns an error unless overrides, the files a client
+// merges onto the config file at configPath, are those the daemon loads the
+// project with. Only the primary project may have override files.
+func (d *Daemon) CheckOverrides(configPath string, overrides []string) error {
+	if configPath != "" && configPath != d.configPath {
+		if len(overrides) > 0 {
+			return errors.New("override files (a second -f) can only be used for the daemon's primary project")
+		}
+		return nil
+	}
+	if !slices.Equal(overrides, d.overrides) {
+		describe := func(files []string) string {
+			if len(files) == 0 {
+				return "no override files"
+			}
+			return "override files " + strings.Join(files, ", ")
+		}
+		return fmt.Errorf("the daemon runs with %s, not %s; stop it with 'comproc daemon stop' to switch", describe(d.overrides), describe(overrides))
+	}
+	return nil
+}
+
+// projectName returns the name of the project defined by a config file:
+// the config's `name` field, or the name of its directory.
+func projectName(cfg *config.Config, configPath string) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return filepath.Base(filepath.Dir(configPath))
+}
+
+// addProject loads a config file as an additional project and registers its
+// services with qualified names. Must be called with d.mu held.
+func (d *Daemon) addProject(configPath string) (*project, error) {
+	cfg, err := d.loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := projectName(cfg, configPath)
+	for _, p := range d.projects {
+		if p.name == name {
+			return nil, fmt.Errorf("project name %q is already used by %s", name, p.configPath)
+		}
+	}
+
+	proj := &project{name: name, configPath: configPath}
+	services := projectServices(cfg, configPath, name+projectSeparator)
+
+	// Create log sinks first so that a failure leaves the daemon unchanged
+	outputs, err := openLogOutputs(services, name, configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		d.registerService(svc, outputs)
+		d.config.ServiceOrder = append(d.config.ServiceOrder, svc.Name)
+		d.serviceOrder = append(d.serviceOrder, svc.Name)
+		proj.services = append(proj.services, svc.Name)
+	}
+
+	d.projects[configPath] = proj
+	return proj, nil
+}
+
+// projectServices returns the services of a project's config in config
+// order, as the daemon registers them: named with prefix, which qualifies
+// the names of additional projects, and with absolute working directories.
+func projectServices(cfg *config.Config, configPath, prefix string) []*config.Service {
+	var services []*config.Service
+	for _, svcName := range cfg.ServiceNames() {
+		svc := cfg.Services[svcName]
+		resolveWorkingDir(svc, configPath)
+		svc.Name = prefix + svcName
+		if svc.ReplicaOf != "" {
+			svc.ReplicaOf = prefix + svc.ReplicaOf
+		}
+		for i, dep := range svc.DependsOn {
+			svc.DependsOn[i].Service = prefix + dep.Service
+		}
+		services = append(services, svc)
+	}
+	return services
+}
+
+// logOutputs holds the log sinks and files of services about to be
+// registered, by service name.
+type logOutputs struct {
+	sinks map[string][]LogSink
+	files map[string]LogSink
+}
+
+// openLogOutputs creates the log sinks and opens the log files of services
+// of the project at configPath. On failure, those already created are
+// closed.
+func openLogOutputs(services []*config.Service, projName, configPath string) (*logOutputs, error) {
+	outputs := &logOutputs{
+		sinks: make(map[string][]LogSink),
+		files: make(map[string]LogSink),
+	}
+	for _, svc := range services {
+		for _, sinkCfg := range svc.Logging {
+			sinkCfg.Project = projName
+			sink, err := NewLogSink(svc.Name, sinkCfg, filepath.Dir(configPath))
+			if err != nil {
+				outputs.close()
+				return nil, fmt.Errorf("service %q: failed to create %s log sink: %w", svc.Name, sinkCfg.Driver, err)
+			}
+			outputs.sinks[svc.Name] = append(outputs.sinks[svc.Name], sink)
+		}
+		file, err := newLogFile(svc.Name, svc, filepath.Dir(configPath))
+		if err != nil {
+			outputs.close()
+			return nil, fmt.Errorf("service %q: failed to open log file: %w", svc.Name, err)
+		}
+		if file != nil {
+			outputs.files[svc.Name] = file
+		}
+	}
+	return outputs, nil
+}
+
+func (o *logOutputs) close() {
+	for _, list := range o.sinks {
+		for _, s := range list {
+			s.Close()
+		}
+	}
+	for _, f := range o.files {
+		f.Close()
+	}
+}
+
+// registerService adds a service with its log outputs to the daemon. The
+// caller adds it to the service orders. Must be called with d.mu held.
+func (d *Daemon) registerService(svc *config.Service, outputs *logOutputs) {
+	for _, sink := range outputs.sinks[svc.Name] {
+		d.logMgr.AddSink(svc.Name, sink)
+	}
+	d.logMgr.setLogFile(svc.Name, svc, outputs.files[svc.Name])
+
+	d.config.Services[svc.Name] = svc
+	d.logMgr.Color(svc.Name)
+	d.processes[svc.Name] = process.New(svc)
+	if rec, ok := d.restored[svc.Name]; ok {
+		d.processes[svc.Name].SetRestarts(rec.Restarts)
+		delete(d.restored, svc.Name)
+	}
+}
+
+// scopeServices translates service names given by a client of the project
+// at configPath into daemon service names. An empty configPath or the
+// primary project's path leaves names as they are. For other projects,
+// names are qualified and an empty list selects all of the project's
+// services. If load is true, an unknown project is loaded first.
+func (d *Daemon) scopeServices(configPath string, services []string, load bool) ([]string, error) {
+	if configPath == "" || configPath == d.configPath {
+		if len(services) == 0 && len(d.projects) > 0 {
+			// Don't let commands of the primary project affect other projects
+			return d.primaryServices(), nil
+		}
+		return d.resolveNames(services)
+	}
+
+	proj, ok := d.projects[configPath]
+	if !ok {
+		if !load {
+			return nil, fmt.Errorf("project not loaded in this daemon: %s", configPath)
+		}
+		var err error
+		proj, err = d.addProject(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(services) == 0 {
+		return append([]string(nil), proj.services...), nil
+	}
+
+	scoped := make([]string, 0, len(services))
+	for _, svc := range services {
+		if strings.Contains(svc, projectSeparator) {
+			// Already qualified
+			scoped = append(scoped, svc)
+		} else {
+			scoped = append(scoped, proj.name+projectSeparator+svc)
+		}
+	}
+	return d.resolveNames(scoped)
+}
+
+// resolveNames resolves service names given by a client. Names containing
+// glob metacharacters (see path.Match) are replaced with the names of the
+// matching services, in config order. "*" does not match the project
+// separator, so patterns of one project don't match services of another.
+// The name of a service with replicas is replaced with the names of its
+// replicas. Other names must be a service name or an unambiguous prefix of
+// one. Must be called with d.mu held.
+func (d *Daemon) resolveNames(services []string) ([]string, error) {
+	var resolved []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+	for _, svc := range services {
+		if replicas := d.replicasOf(svc); len(replicas) > 0 {
+			for _, name := range replicas {
+				add(name)
+			}
+			continue
+		}
+		if !strings.ContainsAny(svc, "*?[") {
+			name, err := d.resolveName(svc)
+			if err != nil {
+				return nil, err
+			}
+			add(name)
+			continue
+		}
+		matched := false
+		for _, name := range d.serviceOrder {
+			ok, err := path.Match(svc, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid service pattern: %q", svc)
+			}
+			if ok {
+				matched = true
+				add(name)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no services match %q", svc)
+		}
+	}
+	return resolved, nil
+}
+
+// resolveName returns the service named by name or, if there is none, the
+// only service of the same project whose name starts with it. Otherwise
+// the error suggests a similar service name. Must be called with d.mu held.
+func (d *Daemon) resolveName(name string) (string, error) {
+	if _, ok := d.processes[name]; ok {
+		return name, nil
+	}
+
+	// Only consider services of the same project
+	var candidates []string
+	prefix, _, qualified := strings.Cut(name, projectSeparator)
+	for _, svc := range d.serviceOrder {
+		p, _, ok := strings.Cut(svc, projectSeparator)
+		if ok == qualified && (!ok || p == prefix) {
+			candidates = append(candidates, svc)
+		}
+	}
+
+	switch matches := suggest.Prefixed(name, candidates); len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		if s := suggest.Closest(name, candidates); s != "" {
+			return "", fmt.Errorf("service not found: %s (did you mean %s?)", name, s)
+		}
+		return "", fmt.Errorf("service not found: %s", name)
+	default:
+		return "", fmt.Errorf("service name %s is ambiguous (matches %s)", name, strings.Join(matches, ", "))
+	}
+}
+
+// replicasOf returns the replicas of the service named name in the config,
+// in order. Must be called with d.mu held.
+func (d *Daemon) replicasOf(name string) []string {
+	var replicas []string
+	for _, svc := range d.serviceOrder {
+		if d.config.Services[svc].ReplicaOf == name {
+			replicas = append(replicas, svc)
+		}
+	}
+	return replicas
+}
+
+// serviceProject returns the project a service belongs to, the path of the
+// project's config file, and the service's name within the project.
+// Must be called with d.mu held.
+func (d *Daemon) serviceProject(name string) (projName, configPath, service string) {
+	for _, p := range d.projects {
+		if slices.Contains(p.services, name) {
+			return p.name, p.configPath, strings.TrimPrefix(name, p.name+projectSeparator)
+		}
+	}
+	return projectName(d.config, d.configPath), d.configPath, name
+}
+
+// primaryServices returns the services of the primary project.
+// Must be called with d.mu held.
+func (d *Daemon) primaryServices() []string {
+	var names []string
+	for _, name := range d.serviceOrder {
+		if !strings.Contains(name, projectSeparator) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// resolveWorkingDir makes the service's working directory absolute,
+// relative to the config file.
+func resolveWorkingDir(svc *config.Service, configPath string) {
+	if svc.WorkingDir != "" && !filepath.IsAbs(svc.WorkingDir) {
+		svc.WorkingDir = filepath.Join(filepath.Dir(configPath), svc.WorkingDir)
+	} else if svc.WorkingDir == "" {
+		svc.WorkingDir = filepath.Dir(configPath)
+	}
+}
+
+// RemoveOrphans stops the services of the project at configPath that are no
+// longer defined in its config file and removes them from the daemon. It
+// returns the removed services.
+func (d *Daemon) RemoveOrphans(configPath string) ([]string, error) {
+	if configPath == "" {
+		configPath = d.configPath
+	}
+	cfg, err := d.loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return d.removeOrphans(configPath, cfg), nil
+}
+
+// removeOrphans removes the services of the project at configPath that are
+// not defined in cfg, its config as loaded again.
+func (d *Daemon) removeOrphans(configPath string, cfg *config.Config) []string {
+	d.mu.Lock()
+	var registered []string
+	prefix := ""
+	if proj, ok := d.projects[configPath]; ok {
+		registered = proj.services
+		prefix = proj.name + projectSeparator
+	} else if configPath == d.configPath {
+		registered = d.primaryServices()
+	}
+	var orphans []string
+	for _, name := range registered {
+		if _, ok := cfg.Services[strings.TrimPrefix(name, prefix)]; !ok {
+			orphans = append(orphans, name)
+		}
+	}
+	isOrphan := func(name string) bool { return slices.Contains(orphans, name) }
+
+	// The services left don't depend on orphans anymore, so they are not
+	// stopped along with them. They are replaced by copies, as the
+	// services may be read without the lock.
+	for name, svc := range d.config.Services {
+		if !slices.ContainsFunc(svc.DependsOn, func(dep config.Dependency) bool { return isOrphan(dep.Service) }) {
+			continue
+		}
+		trimmed := *svc
+		trimmed.DependsOn = slices.DeleteFunc(slices.Clone(svc.DependsOn), func(dep config.Dependency) bool {
+			return isOrphan(dep.Service)
+		})
+		d.config.Services[name] = &trimmed
+	}
+	d.mu.Unlock()
+
+	if len(orphans) == 0 {
+		return nil
+	}
+	d.StopServices(orphans)
+
+	d.mu.Lock()
+	for _, name := range orphans {
+		// Exited services may still be waiting to be restarted
+		d.supervisor.StopMonitoring(name)
+		delete(d.processes, name)
+		delete(d.config.Services, name)
+	}
+	d.releasePorts(orphans)
+	// The orders may share their backing array, so neither is modified in place
+	d.serviceOrder = slices.DeleteFunc(slices.Clone(d.serviceOrder), isOrphan)
+	d.config.ServiceOrder = slices.DeleteFunc(slices.Clone(d.config.ServiceOrder), isOrphan)
+	if proj, ok := d.projects[configPath]; ok {
+		proj.services = slices.DeleteFunc(proj.services, isOrphan)
+	}
+	d.mu.Unlock()
+
+	for _, name := range orphans {
+		if err := d.logMgr.CloseService(name); err != nil {
+			fmt.Fprintf(os.Stderr, "comproc: %s: failed to close log outputs: %v\n", name, err)
+		}
+	}
+	return orphans
+}
@@ -0,0 +1,369 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	path := filepath.Join(dir, "comproc.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestScopeServices_PrimaryProject(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+
+	got, err := d.ScopeServices(primary, []string{"api"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"api"}) {
+		t.Errorf("expected [api], got %v", got)
+	}
+
+	// No services means all services while only one project is loaded
+	got, err = d.ScopeServices(primary, nil, false)
+	if err != nil || got != nil {
+		t.Errorf("expected nil services, got %v (err: %v)", got, err)
+	}
+}
+
+func TestScopeServices_AdditionalProject(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+`)
+	other := writeConfig(t, filepath.Join(dir, "shop"), `
+services:
+  web:
+    command: sleep 60
+    depends_on:
+      - db
+  db:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+
+	if _, err := d.ScopeServices(other, nil, false); err == nil {
+		t.Error("expected error for a project that is not loaded")
+	}
+
+	got, err := d.ScopeServices(other, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"shop/web", "shop/db"}) {
+		t.Errorf("expected [shop/web shop/db], got %v", got)
+	}
+
+	got, err = d.ScopeServices(other, []string{"web"}, false)
+	if err != nil || !slices.Equal(got, []string{"shop/web"}) {
+		t.Errorf("expected [shop/web], got %v (err: %v)", got, err)
+	}
+
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"api", "shop/web", "shop/db"}) {
+		t.Errorf("unexpected service names: %v", names)
+	}
+	if deps := d.config.Services["shop/web"].DependencyNames(); !slices.Equal(deps, []string{"shop/db"}) {
+		t.Errorf("expected dependencies to be qualified, got %v", deps)
+	}
+	if wd := d.config.Services["shop/web"].WorkingDir; wd != filepath.Join(dir, "shop") {
+		t.Errorf("expected working dir relative to the project's config, got %s", wd)
+	}
+
+	// Once another project is loaded, the primary project's commands only
+	// affect its own services
+	got, err = d.ScopeServices(primary, nil, false)
+	if err != nil || !slices.Equal(got, []string{"api"}) {
+		t.Errorf("expected [api], got %v (err: %v)", got, err)
+	}
+}
+
+func TestRuntimeEnv_ServiceMetadata(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+`)
+	other := writeConfig(t, filepath.Join(dir, "shop"), `
+services:
+  web:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	if _, err := d.ScopeServices(other, nil, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.processes["shop/web"].SetRestarts(2)
+
+	tests := []struct {
+		name string
+		want map[string]string
+	}{
+		{"api", map[string]string{"COMPROC_SERVICE": "api", "COMPROC_PROJECT": "main", "COMPROC_CONFIG_PATH": primary, "COMPROC_RESTARTS": "0"}},
+		{"shop/web", map[string]string{"COMPROC_SERVICE": "web", "COMPROC_PROJECT": "shop", "COMPROC_CONFIG_PATH": other, "COMPROC_RESTARTS": "2"}},
+	}
+	for _, tt := range tests {
+		env, err := d.runtimeEnv(tt.name)
+		if err != nil {
+			t.Fatalf("runtimeEnv failed: %v", err)
+		}
+		for k, v := range tt.want {
+			if env[k] != v {
+				t.Errorf("%s: expected %s=%s, got %q", tt.name, k, v, env[k])
+			}
+		}
+	}
+}
+
+func TestScopeServices_Patterns(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+  worker-mail:
+    command: sleep 60
+  worker-image:
+    command: sleep 60
+`)
+	other := writeConfig(t, filepath.Join(dir, "shop"), `
+services:
+  worker-cart:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	if _, err := d.ScopeServices(other, nil, true); err != nil {
+		t.Fatalf("failed to load project: %v", err)
+	}
+
+	got, err := d.ScopeServices(primary, []string{"worker-*", "worker-mail"}, false)
+	if err != nil || !slices.Equal(got, []string{"worker-mail", "worker-image"}) {
+		t.Errorf("expected the primary project's workers, got %v (err: %v)", got, err)
+	}
+
+	got, err = d.ScopeServices(other, []string{"worker-*"}, false)
+	if err != nil || !slices.Equal(got, []string{"shop/worker-cart"}) {
+		t.Errorf("expected [shop/worker-cart], got %v (err: %v)", got, err)
+	}
+
+	if _, err := d.ScopeServices(primary, []string{"db*"}, false); err == nil || !strings.Contains(err.Error(), `no services match "db*"`) {
+		t.Errorf("expected no match error, got %v", err)
+	}
+	if _, err := d.ScopeServices(primary, []string{"[api"}, false); err == nil || !strings.Contains(err.Error(), "invalid service pattern") {
+		t.Errorf("expected invalid pattern error, got %v", err)
+	}
+}
+
+func TestScopeServices_Prefixes(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+  api-gateway:
+    command: sleep 60
+  worker:
+    command: sleep 60
+`)
+	other := writeConfig(t, filepath.Join(dir, "shop"), `
+services:
+  web:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	if _, err := d.ScopeServices(other, nil, true); err != nil {
+		t.Fatalf("failed to load project: %v", err)
+	}
+
+	// An exact name wins over longer names it is a prefix of
+	got, err := d.ScopeServices(primary, []string{"api", "wor"}, false)
+	if err != nil || !slices.Equal(got, []string{"api", "worker"}) {
+		t.Errorf("expected [api worker], got %v (err: %v)", got, err)
+	}
+	got, err = d.ScopeServices(other, []string{"w"}, false)
+	if err != nil || !slices.Equal(got, []string{"shop/web"}) {
+		t.Errorf("expected [shop/web], got %v (err: %v)", got, err)
+	}
+
+	tests := []struct {
+		configPath string
+		service    string
+		wantErr    string
+	}{
+		{primary, "a", "service name a is ambiguous (matches api, api-gateway)"},
+		{primary, "aip", "service not found: aip (did you mean api?)"},
+		{primary, "wroker", "service not found: wroker (did you mean worker?)"},
+		{primary, "postgres", "service not found: postgres"},
+		// Services of other projects are not suggested
+		{primary, "wbe", "service not found: wbe"},
+		{other, "wbe", "service not found: shop/wbe (did you mean shop/web?)"},
+	}
+	for _, tt := range tests {
+		_, err := d.ScopeServices(tt.configPath, []string{tt.service}, false)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected %q error, got %v", tt.service, tt.wantErr, err)
+		}
+	}
+	if _, err := d.ScopeServices(primary, []string{"wbe"}, false); strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("expected no suggestion from another project, got %v", err)
+	}
+}
+
+func TestScopeServices_DuplicateProjectName(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, filepath.Join(dir, "main"), `
+services:
+  api:
+    command: sleep 60
+`)
+	first := writeConfig(t, filepath.Join(dir, "a", "app"), `
+services:
+  web:
+    command: sleep 60
+`)
+	second := writeConfig(t, filepath.Join(dir, "b", "app"), `
+services:
+  web:
+    command: sleep 60
+`)
+
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+
+	if _, err := d.ScopeServices(first, nil, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = d.ScopeServices(second, nil, true)
+	if err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("expected duplicate project name error, got: %v", err)
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, dir, `
+services:
+  old:
+    command: sleep 60
+    ports: [auto]
+    log_file: old.log
+  app:
+    command: sleep 60
+    depends_on:
+      - old
+`)
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	if _, failed, _ := d.StartServices(nil); len(failed) > 0 {
+		t.Fatalf("failed to start services: %v", failed)
+	}
+
+	app := d.config.Services["app"]
+
+	writeConfig(t, dir, `
+services:
+  app:
+    command: sleep 60
+`)
+	removed, err := d.RemoveOrphans(primary)
+	if err != nil {
+		t.Fatalf("RemoveOrphans failed: %v", err)
+	}
+	if !slices.Equal(removed, []string{"old"}) {
+		t.Errorf("expected [old] to be removed, got %v", removed)
+	}
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"app"}) {
+		t.Errorf("expected only app to be left, got %v", names)
+	}
+	if !d.processes["app"].IsReady() {
+		t.Error("expected app to keep running")
+	}
+	if ports := d.ServicePorts("old"); ports != nil {
+		t.Errorf("expected the ports of old to be released, got %v", ports)
+	}
+	if deps := d.config.Services["app"].DependsOn; len(deps) != 0 {
+		t.Errorf("expected app not to depend on old anymore, got %v", deps)
+	}
+	if len(app.DependsOn) != 1 {
+		t.Errorf("expected the service app was registered with to be left unchanged, got %v", app.DependsOn)
+	}
+	if file := d.logMgr.services["old"].file; file != nil {
+		t.Error("expected the log file of old to be closed")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, dir, `
+services:
+  app:
+    command: sleep 60
+`)
+	override := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(override, []byte("services:\n  worker:\n    command: sleep 60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(primary, []string{override}, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"app", "worker"}) {
+		t.Errorf("expected the override's service to be added, got %v", names)
+	}
+
+	if err := d.CheckOverrides(primary, []string{override}); err != nil {
+		t.Errorf("expected the same override files to be accepted, got %v", err)
+	}
+	if err := d.CheckOverrides("", nil); err == nil || !strings.Contains(err.Error(), "runs with override files") {
+		t.Errorf("expected a mismatch error, got %v", err)
+	}
+	other := writeConfig(t, filepath.Join(dir, "other"), "services: {}\n")
+	if err := d.CheckOverrides(other, []string{override}); err == nil {
+		t.Error("expected override files of another project to be refused")
+	}
+}
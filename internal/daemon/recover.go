@@ -0,0 +1,28 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+)
+
+// panicOutput receives the reports of recovered panics. The daemon's stderr
+// is kept in its output file (see OutputPath).
+var panicOutput io.Writer = os.Stderr
+
+// recoverPanic recovers from a panic in the calling goroutine and reports it,
+// so that a bug in one handler or background task does not bring down the
+// daemon and every service it manages. It must be deferred directly:
+//
+//	defer recoverPanic("supervisor")
+func recoverPanic(where string) {
+	if r := recover(); r != nil {
+		reportPanic(where, r)
+	}
+}
+
+// reportPanic writes a recovered panic value and the current stack trace.
+func reportPanic(where string, r any) {
+	fmt.Fprintf(panicOutput, "comproc: panic in %s: %v\n%s", where, r, debug.Stack())
+}
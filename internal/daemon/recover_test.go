@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// capturePanics redirects panic reports to a buffer for the duration of the test.
+func capturePanics(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	orig := panicOutput
+	panicOutput = &buf
+	t.Cleanup(func() { panicOutput = orig })
+	return &buf
+}
+
+func TestRecoverPanic(t *testing.T) {
+	out := capturePanics(t)
+
+	func() {
+		defer recoverPanic("test task")
+		panic("boom")
+	}()
+
+	report := out.String()
+	if !strings.Contains(report, "comproc: panic in test task: boom") {
+		t.Errorf("expected panic report, got:\n%s", report)
+	}
+	if !strings.Contains(report, "goroutine") {
+		t.Errorf("expected stack trace in report, got:\n%s", report)
+	}
+}
+
+func TestServer_HandlerPanic(t *testing.T) {
+	out := capturePanics(t)
+
+	// A server without a daemon panics when a handler touches it
+	s := &Server{}
+	id := 1
+	req := &protocol.Request{JSONRPC: protocol.JSONRPCVersion, Method: protocol.MethodStatus, ID: &id}
+
+	resp := s.safeHandleRequest(nil, req)
+	if resp == nil || resp.Error == nil {
+		t.Fatalf("expected error response, got %+v", resp)
+	}
+	if resp.Error.Code != protocol.InternalError {
+		t.Errorf("expected InternalError, got %d", resp.Error.Code)
+	}
+	if resp.ID == nil || *resp.ID != id {
+		t.Errorf("expected response ID %d, got %v", id, resp.ID)
+	}
+	if !strings.Contains(out.String(), `panic in "status" handler`) {
+		t.Errorf("expected panic report, got:\n%s", out.String())
+	}
+}
+
+func TestSupervisor_MonitorPanic(t *testing.T) {
+	out := capturePanics(t)
+
+	// A nil process makes the monitor panic; it must return instead of
+	// crashing the test binary
+	s := NewSupervisor(nil)
+	s.monitor(context.Background(), "api", nil, &config.Service{Restart: config.RestartAlways})
+
+	if !strings.Contains(out.String(), "panic in supervisor of api") {
+		t.Errorf("expected panic report, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/process"
+)
+
+// ReloadResult reports what Reload changed.
+type ReloadResult struct {
+	Added   []string // Services new to the config file
+	Removed []string // Services no longer in the config file, stopped and removed
+	Changed []string // Services whose definition changed
+	Started []string // Added services and restarted services that started
+	Failed  []string
+	Errors  map[string]string // Why each failed service failed, by name
+}
+
+// Reload loads the config file of the project at configPath again and
+// applies it to the running daemon: services added to the file are
+// started, services removed from it are stopped and removed, and services
+// whose definition changed are restarted with the new one, along with their
+// dependents, if they were running. Other services keep running. Settings
+// outside of services, and the logging and log files of existing services,
+// are applied only when the daemon starts.
+func (d *Daemon) Reload(configPath string) (*ReloadResult, error) {
+	if configPath == "" {
+		configPath = d.configPath
+	}
+	cfg, err := d.loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return d.applyConfig(configPath, cfg)
+}
+
+// applyConfig applies cfg, the config of the project at configPath as
+// loaded again, to the running daemon as described for Reload.
+func (d *Daemon) applyConfig(configPath string, cfg *config.Config) (*ReloadResult, error) {
+	d.mu.Lock()
+	projName, prefix, registered := projectName(d.config, d.configPath), "", d.primaryServices()
+	if configPath != d.configPath {
+		proj, ok := d.projects[configPath]
+		if !ok {
+			d.mu.Unlock()
+			return nil, fmt.Errorf("project not loaded in this daemon: %s", configPath)
+		}
+		projName, prefix, registered = proj.name, proj.name+projectSeparator, proj.services
+	}
+	registered = slices.Clone(registered)
+
+	result := &ReloadResult{}
+	var added []*config.Service
+	changed := make(map[string]*config.Service)
+	services := projectServices(cfg, configPath, prefix)
+	for _, svc := range services {
+		current, ok := d.config.Services[svc.Name]
+		switch {
+		case !ok:
+			added = append(added, svc)
+			result.Added = append(result.Added, svc.Name)
+		case !reflect.DeepEqual(current, svc):
+			changed[svc.Name] = svc
+			result.Changed = append(result.Changed, svc.Name)
+		}
+	}
+
+	// Open the log outputs of added services first so that a failure
+	// leaves the daemon unchanged
+	outputs, err := openLogOutputs(added, projName, configPath)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result.Removed = d.removeOrphans(configPath, cfg)
+
+	// Running services are stopped along with their dependents, which are
+	// started again with them. Empty lists would stop or start every
+	// service.
+	var restart []string
+	if len(result.Changed) > 0 {
+		restart = d.StopServices(result.Changed)
+	}
+
+	d.mu.Lock()
+	for name, svc := range changed {
+		d.supervisor.StopMonitoring(name)
+		d.config.Services[name] = svc
+		d.processes[name] = process.New(svc)
+	}
+	for _, svc := range added {
+		d.registerService(svc, outputs)
+	}
+	names := make([]string, len(services))
+	for i, svc := range services {
+		names[i] = svc.Name
+	}
+	d.serviceOrder = replaceServices(d.serviceOrder, registered, names)
+	d.config.ServiceOrder = replaceServices(d.config.ServiceOrder, registered, names)
+	if proj, ok := d.projects[configPath]; ok {
+		proj.services = names
+	}
+	d.mu.Unlock()
+
+	for _, name := range restart {
+		d.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (config reloaded) ---", name))
+	}
+	if toStart := append(restart, result.Added...); len(toStart) > 0 {
+		result.Started, result.Failed, result.Errors = d.startServices(toStart, runReasonReload)
+	}
+	return result, nil
+}
+
+// replaceServices returns a copy of the service order with the services in
+// old replaced by services, at the position of the first of them.
+func replaceServices(order, old, services []string) []string {
+	var replaced []string
+	inserted := false
+	for _, name := range order {
+		if !slices.Contains(old, name) {
+			replaced = append(replaced, name)
+		} else if !inserted {
+			replaced = append(replaced, services...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		replaced = append(replaced, services...)
+	}
+	return replaced
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, dir, `
+services:
+  db:
+    command: sleep 60
+  api:
+    command: sleep 60
+    depends_on:
+      - db
+  web:
+    command: sleep 60
+    depends_on:
+      - api
+  old:
+    command: sleep 60
+    ports: [auto]
+`)
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	if _, failed, _ := d.StartServices(nil); len(failed) > 0 {
+		t.Fatalf("failed to start services: %v", failed)
+	}
+	pids := make(map[string]int)
+	for _, name := range []string{"db", "api", "web"} {
+		pids[name] = d.processes[name].PID()
+	}
+
+	writeConfig(t, dir, `
+services:
+  db:
+    command: sleep 60
+  api:
+    command: sleep 61
+    depends_on:
+      - db
+  web:
+    command: sleep 60
+    depends_on:
+      - api
+  worker:
+    command: sleep 60
+`)
+	result, err := d.Reload(primary)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if !slices.Equal(result.Added, []string{"worker"}) {
+		t.Errorf("expected [worker] to be added, got %v", result.Added)
+	}
+	if !slices.Equal(result.Removed, []string{"old"}) {
+		t.Errorf("expected [old] to be removed, got %v", result.Removed)
+	}
+	if ports := d.ServicePorts("old"); ports != nil {
+		t.Errorf("expected the ports of old to be released, got %v", ports)
+	}
+	if !slices.Equal(result.Changed, []string{"api"}) {
+		t.Errorf("expected [api] to be changed, got %v", result.Changed)
+	}
+	// The dependent of a changed service is restarted with it
+	if !slices.Equal(result.Started, []string{"api", "web", "worker"}) || len(result.Failed) > 0 {
+		t.Errorf("expected api, web, and worker to be started, got %v (failed: %v)", result.Started, result.Errors)
+	}
+
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"db", "api", "web", "worker"}) {
+		t.Errorf("expected services in config order, got %v", names)
+	}
+	if pid := d.processes["db"].PID(); pid != pids["db"] {
+		t.Error("expected db to keep running")
+	}
+	if pid := d.processes["web"].PID(); pid == pids["web"] {
+		t.Error("expected web to be restarted")
+	}
+	if cmd := d.processes["api"].Service.Command; cmd != "sleep 61" {
+		t.Errorf("expected api to run the new command, got %q", cmd)
+	}
+	if runs, _ := d.GetHistory("api"); len(runs) != 2 || runs[1].Reason != runReasonReload {
+		t.Errorf("expected api's new run to be recorded as a reload, got %+v", runs)
+	}
+
+	// Reloading an unchanged config changes nothing
+	result, err = d.Reload(primary)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(result.Added)+len(result.Removed)+len(result.Changed)+len(result.Started) > 0 {
+		t.Errorf("expected no changes, got %+v", result)
+	}
+}
+
+func TestReload_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	primary := writeConfig(t, dir, `
+services:
+  app:
+    command: sleep 60
+`)
+	d, err := New(primary, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+
+	writeConfig(t, dir, `
+services:
+  app:
+    depends_on: [missing]
+`)
+	_, err = d.Reload(primary)
+	if _, ok := err.(*ConfigError); !ok {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"app"}) {
+		t.Errorf("expected the daemon to be unchanged, got %v", names)
+	}
+}
@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// access describes what the clients of a listener may do.
+type access struct {
+	readOnly bool   // Only read-only methods may be called
+	token    string // Token a client must send with "auth" first, if not empty
+}
+
+// listenTCP listens on the TCP address addr, with TLS if socketCfg has a
+// certificate.
+func (s *Server) listenTCP(addr string, socketCfg *config.Socket) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	files := socketCfg.GetTLS(s.daemon.configPath)
+	if files == nil && !isLoopbackAddress(addr) {
+		return nil, fmt.Errorf("refusing to listen on %s without TLS, which would send the token and requests over the network in plain text: set socket.tls or listen on a loopback address such as 127.0.0.1", addr)
+	}
+	if files != nil {
+		cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
+
+// isLoopbackAddress reports whether the host of the TCP address addr only
+// accepts connections from this machine. An empty host, meaning all
+// interfaces, and host names other than localhost are not.
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// remoteToken returns the token TCP clients must authenticate with: the one
+// set with SetToken, or else the content of the config's socket.token_file.
+// Listening on TCP without a token is refused, as anyone who can reach the
+// address could run commands otherwise.
+func (d *Daemon) remoteToken() (string, error) {
+	if d.token != "" {
+		return d.token, nil
+	}
+	path := d.config.Socket.ResolveTokenFile(d.configPath)
+	if path == "" {
+		return "", errors.New("listening on TCP requires a token: set socket.token_file or COMPROC_TOKEN")
+	}
+	return readTokenFile(path)
+}
+
+// readOnlyToken returns the token clients of the read-only TCP listener
+// must authenticate with: the content of socket.read_only.token_file. It
+// is separate from the token of the other listener, which would let its
+// holders run every command there.
+func (d *Daemon) readOnlyToken() (string, error) {
+	path := d.config.Socket.ReadOnly.ResolveTokenFile(d.configPath)
+	if path == "" {
+		return "", errors.New("listening on TCP requires a token: set socket.read_only.token_file")
+	}
+	return readTokenFile(path)
+}
+
+// readTokenFile reads the token held in the file at path.
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file is empty: %s", path)
+	}
+	return token, nil
+}
+
+// authenticate checks the "auth" request a client of a listener with a
+// token must send first. It returns the response and whether the client may
+// go on. Any token is accepted on a listener without one.
+func authenticate(req *protocol.Request, token string) (*protocol.Response, bool) {
+	if req.ID == nil {
+		return protocol.NewErrorResponse(protocol.Unauthorized, "authentication required", nil), false
+	}
+	if req.Method != protocol.MethodAuth {
+		msg := "authentication required: set COMPROC_TOKEN or --token to the daemon's token"
+		return protocol.NewErrorResponse(protocol.Unauthorized, msg, req.ID), false
+	}
+	var params protocol.AuthParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID), false
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(params.Token), []byte(token)) != 1 {
+		return protocol.NewErrorResponse(protocol.Unauthorized, "invalid token", req.ID), false
+	}
+	resp, err := protocol.NewResponse(nil, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID), false
+	}
+	return resp, true
+}
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestIsLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:7007", true},
+		{"[::1]:7007", true},
+		{"localhost:7007", true},
+		{":7007", false},
+		{"0.0.0.0:7007", false},
+		{"192.168.1.10:7007", false},
+		{"dev.example.com:7007", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopbackAddress(tt.addr); got != tt.want {
+			t.Errorf("isLoopbackAddress(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestListenTCP_RequiresTLSOffLoopback(t *testing.T) {
+	s := NewServer(&Daemon{config: &config.Config{}}, "")
+	_, err := s.listenTCP("0.0.0.0:0", nil)
+	if err == nil || !strings.Contains(err.Error(), "without TLS") {
+		t.Errorf("expected a non-loopback address without TLS to be refused, got: %v", err)
+	}
+
+	l, err := s.listenTCP("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("expected a loopback address to be allowed, got: %v", err)
+	}
+	l.Close()
+}
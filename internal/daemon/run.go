@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/ryym/comproc/internal/process"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// runWaitDelay is how long the output of a one-off command is still read
+// after it exits.
+const runWaitDelay = time.Second
+
+// heldStreams are the "stderr" and "resize" streams of a connection that no
+// "run" or "exec" stream has claimed yet, by channel. They are only used by
+// the goroutine reading the connection, which accepts streams in the order
+// the client opened them.
+type heldStreams map[int]heldStream
+
+type heldStream struct {
+	kind   string
+	stream *protocol.Stream
+}
+
+// claim removes the held stream of the given kind on channel and returns
+// it. It returns nil if channel is 0, and an error if no such stream is
+// held.
+func (h heldStreams) claim(channel int, kind string) (*protocol.Stream, error) {
+	if channel == 0 {
+		return nil, nil
+	}
+	held, ok := h[channel]
+	if !ok || held.kind != kind {
+		return nil, &protocol.Error{Code: protocol.InvalidParams, Message: fmt.Sprintf("no %q stream on channel %d", kind, channel)}
+	}
+	delete(h, channel)
+	return held.stream, nil
+}
+
+// oneOff is a one-off command requested by a "run" or "exec" stream, with
+// the streams it claimed.
+type oneOff struct {
+	params  protocol.ExecParams
+	running bool // Whether the service must be running
+	stderr  *protocol.Stream
+	resize  *protocol.Stream
+}
+
+// acceptOneOff parses the params of a "run" or "exec" stream and claims the
+// streams they name. It must be called by the goroutine reading the
+// connection, before it accepts further streams.
+func acceptOneOff(c *connection, open protocol.StreamOpen) (*oneOff, error) {
+	o := &oneOff{running: open.Kind == protocol.StreamKindExec}
+	var err error
+	if o.running {
+		err = json.Unmarshal(open.Params, &o.params)
+	} else {
+		err = json.Unmarshal(open.Params, &o.params.RunParams)
+	}
+	if err != nil {
+		return nil, &protocol.Error{Code: protocol.InvalidParams, Message: err.Error()}
+	}
+	if o.stderr, err = c.held.claim(o.params.Stderr, protocol.StreamKindStderr); err != nil {
+		return nil, err
+	}
+	if o.resize, err = c.held.claim(o.params.Resize, protocol.StreamKindResize); err != nil {
+		if o.stderr != nil {
+			o.stderr.CloseWithError(err)
+		}
+		return nil, err
+	}
+	return o, nil
+}
+
+// runOneOff runs the command of a "run" or "exec" stream, forwarding the
+// data of the stream to its input and its output to the stream, and closes
+// the stream with its exit status once it exits. A client that disconnects
+// first stops the command, as `down` stops a service.
+func (s *Server) runOneOff(c *connection, st *protocol.Stream, o *oneOff, kind string) error {
+	params := o.params
+	if o.stderr != nil {
+		defer o.stderr.Close()
+	}
+	if o.resize != nil {
+		defer o.resize.Close()
+	}
+	if params.Service == "" {
+		return &protocol.Error{Code: protocol.InvalidParams, Message: "service name is required"}
+	}
+	if len(params.Command) == 0 {
+		return &protocol.Error{Code: protocol.InvalidParams, Message: "command is required"}
+	}
+
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return &protocol.Error{Code: scopeErrorCode(err), Message: err.Error()}
+	}
+	if len(scoped) != 1 {
+		return &protocol.Error{
+			Code:    protocol.InvalidParams,
+			Message: fmt.Sprintf("%q matches %d services; %s takes one service", params.Service, len(scoped), kind),
+		}
+	}
+	service := scoped[0]
+	if o.running && !s.daemon.IsRunning(service) {
+		return &protocol.Error{Code: protocol.ServiceError, Message: fmt.Sprintf("%s is not running; use `comproc run` to run a command without it", service)}
+	}
+	cmd, err := s.daemon.OneOff(service, params.Command)
+	if err != nil {
+		return &protocol.Error{Code: protocol.ServiceError, Message: err.Error()}
+	}
+
+	var input io.WriteCloser
+	outputDone := make(chan struct{})
+	if params.TTY != nil {
+		pty, err := process.StartPTY(cmd, params.TTY.Rows, params.TTY.Cols)
+		if err != nil {
+			return &protocol.Error{Code: protocol.ServiceError, Message: fmt.Sprintf("%s: failed to run %s: %v", service, params.Command[0], err)}
+		}
+		defer pty.Close()
+		// The terminal's input can't be closed on its own; the command
+		// reads the end of input from the terminal's EOF character instead
+		input = nopCloser{pty}
+		if o.resize != nil {
+			go forwardResizes(o.resize, pty)
+		}
+		go func() {
+			defer close(outputDone)
+			io.Copy(st, pty)
+		}()
+	} else {
+		// Background processes the command leaves behind may hold its
+		// output open; they don't keep it from being reported as exited
+		cmd.WaitDelay = runWaitDelay
+		cmd.Stdout = st
+		cmd.Stderr = st
+		if o.stderr != nil {
+			cmd.Stderr = o.stderr
+		}
+		if input, err = cmd.StdinPipe(); err != nil {
+			return &protocol.Error{Code: protocol.InternalError, Message: err.Error()}
+		}
+		if err := cmd.Start(); err != nil {
+			return &protocol.Error{Code: protocol.ServiceError, Message: fmt.Sprintf("%s: failed to run %s: %v", service, params.Command[0], err)}
+		}
+		// Wait returns once the output is copied
+		close(outputDone)
+	}
+
+	// The input ends when the client closes its direction of the stream
+	go func() {
+		defer input.Close()
+		io.Copy(input, st)
+	}()
+
+	exited := make(chan struct{})
+	graceful := s.daemon.gracefulTimeout()
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			stopOneOff(cmd, graceful, exited)
+		case <-exited:
+		}
+	}()
+
+	// Errors other than the exit status are of copying the output, which
+	// only fails once the client is gone
+	cmd.Wait()
+	close(exited)
+	select {
+	case <-outputDone:
+	case <-time.After(runWaitDelay):
+	}
+	if o.stderr != nil {
+		o.stderr.Close()
+	}
+	st.CloseWithResult(runExit(cmd.ProcessState))
+	return nil
+}
+
+// forwardResizes passes the sizes read from a "resize" stream to the
+// pseudo-terminal of a one-off command until the stream ends.
+func forwardResizes(st *protocol.Stream, pty *os.File) {
+	dec := json.NewDecoder(st)
+	for {
+		var size protocol.TerminalSize
+		if err := dec.Decode(&size); err != nil {
+			return
+		}
+		process.ResizePTY(pty, size.Rows, size.Cols)
+	}
+}
+
+// stopOneOff stops the process group of a one-off command with SIGTERM,
+// and with SIGKILL if it hasn't exited after timeout.
+func stopOneOff(cmd *exec.Cmd, timeout time.Duration, exited <-chan struct{}) {
+	pgid := cmd.Process.Pid
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
+
+// runExit returns the exit status of a one-off command, reported as a shell
+// would for a command killed by a signal.
+func runExit(state *os.ProcessState) protocol.RunExit {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if ok && ws.Signaled() {
+		return protocol.RunExit{ExitCode: 128 + int(ws.Signal()), Signal: process.SignalName(ws.Signal())}
+	}
+	return protocol.RunExit{ExitCode: state.ExitCode()}
+}
+
+// nopCloser is a writer whose Close does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
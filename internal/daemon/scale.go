@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// replicaCounts holds the replica counts set by scale, which take
+// precedence over the replicas of the config files while the daemon runs.
+type replicaCounts struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int // By config path, then service
+}
+
+// get returns a copy of the counts set for the project at configPath.
+func (r *replicaCounts) get(configPath string) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int)
+	maps.Copy(counts, r.counts[configPath])
+	return counts
+}
+
+func (r *replicaCounts) set(configPath string, counts map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[string]map[string]int)
+	}
+	r.counts[configPath] = counts
+}
+
+// Scale sets the number of replicas of services of the project at
+// configPath, named as in its config file, and applies the config file like
+// Reload: added replicas are started, and removed ones are stopped and
+// removed. A service without replicas is replaced by its replicas. The
+// counts are kept for later reloads until the daemon exits.
+func (d *Daemon) Scale(configPath string, replicas map[string]int) (*ReloadResult, error) {
+	if configPath == "" {
+		configPath = d.configPath
+	}
+
+	d.mu.RLock()
+	prefix := ""
+	if proj, ok := d.projects[configPath]; ok {
+		prefix = proj.name + projectSeparator
+	} else if configPath != d.configPath {
+		d.mu.RUnlock()
+		return nil, fmt.Errorf("project not loaded in this daemon: %s", configPath)
+	}
+	for name, count := range replicas {
+		if _, ok := d.processes[prefix+name]; !ok && len(d.replicasOf(prefix+name)) == 0 {
+			d.mu.RUnlock()
+			return nil, fmt.Errorf("service not found: %s", name)
+		}
+		if count < 1 {
+			d.mu.RUnlock()
+			return nil, fmt.Errorf("invalid replica count for %s: %d (must be at least 1)", name, count)
+		}
+	}
+	d.mu.RUnlock()
+
+	counts := d.replicas.get(configPath)
+	maps.Copy(counts, replicas)
+	cfg, err := d.loadScaled(configPath, counts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := d.applyConfig(configPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.replicas.set(configPath, counts)
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+services:
+  web:
+    command: sleep 60
+    replicas: 2
+  worker:
+    command: sleep 60
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	if _, failed, _ := d.StartServices(nil); len(failed) > 0 {
+		t.Fatalf("failed to start services: %v", failed)
+	}
+	pid := d.processes["web-1"].PID()
+
+	result, err := d.Scale("", map[string]int{"web": 3})
+	if err != nil {
+		t.Fatalf("Scale failed: %v", err)
+	}
+	if !slices.Equal(result.Added, []string{"web-3"}) || !slices.Equal(result.Started, []string{"web-3"}) || len(result.Changed) > 0 {
+		t.Errorf("expected web-3 to be added and started, got %+v", result)
+	}
+	if got := d.processes["web-1"].PID(); got != pid {
+		t.Error("expected web-1 to keep running")
+	}
+	if env, _ := d.runtimeEnv("web-3"); env["COMPROC_REPLICA"] != "3" {
+		t.Errorf("expected COMPROC_REPLICA=3, got %v", env)
+	}
+
+	d.mu.RLock()
+	names, err := d.resolveNames([]string{"web"})
+	d.mu.RUnlock()
+	if err != nil || !slices.Equal(names, []string{"web-1", "web-2", "web-3"}) {
+		t.Errorf("expected web to name its replicas, got %v (%v)", names, err)
+	}
+
+	// A service without replicas is replaced by its replicas
+	result, err = d.Scale("", map[string]int{"web": 1, "worker": 2})
+	if err != nil {
+		t.Fatalf("Scale failed: %v", err)
+	}
+	if !slices.Equal(result.Removed, []string{"web-2", "web-3", "worker"}) || !slices.Equal(result.Added, []string{"worker-1", "worker-2"}) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if want := []string{"web-1", "worker-1", "worker-2"}; !slices.Equal(d.ServiceNames(), want) {
+		t.Errorf("expected services %v, got %v", want, d.ServiceNames())
+	}
+
+	// The counts outlive reloads
+	result, err = d.Reload("")
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(result.Added)+len(result.Removed)+len(result.Changed) > 0 {
+		t.Errorf("expected no changes, got %+v", result)
+	}
+}
+
+func TestScale_Errors(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+services:
+  web:
+    command: sleep 60
+    ports: [8080]
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+
+	tests := []struct {
+		replicas map[string]int
+		wantErr  string
+	}{
+		{map[string]int{"api": 2}, "service not found: api"},
+		{map[string]int{"web": 0}, "invalid replica count for web: 0"},
+		{map[string]int{"web": 2}, "replicas can't share the fixed port 8080"},
+	}
+	for _, tt := range tests {
+		if _, err := d.Scale("", tt.replicas); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Scale(%v): expected %q error, got: %v", tt.replicas, tt.wantErr, err)
+		}
+	}
+	if names := d.ServiceNames(); !slices.Equal(names, []string{"web"}) {
+		t.Errorf("expected the services to be unchanged, got %v", names)
+	}
+}
@@ -1,27 +1,32 @@
 package daemon
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/ryym/comproc/config"
 	"github.com/ryym/comproc/internal/protocol"
+	"github.com/ryym/comproc/internal/version"
 )
 
-const gracefulTimeout = 10 * time.Second
-
 // Server handles JSON-RPC requests from clients.
 type Server struct {
 	daemon     *Daemon
 	socketPath string
-	listener   net.Listener
+	listeners  []net.Listener
 	mu         sync.Mutex
-	conns      map[net.Conn]bool
+	conns      map[*connection]bool
 }
 
 // NewServer creates a new RPC server.
@@ -29,88 +34,192 @@ func NewServer(d *Daemon, socketPath string) *Server {
 	return &Server{
 		daemon:     d,
 		socketPath: socketPath,
-		conns:      make(map[net.Conn]bool),
+		conns:      make(map[*connection]bool),
 	}
 }
 
 // Run starts the server and blocks until the context is cancelled.
 func (s *Server) Run(ctx context.Context) error {
-	// Remove existing socket file
-	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove existing socket: %w", err)
-	}
-
-	listener, err := net.Listen("unix", s.socketPath)
+	socketCfg := s.daemon.config.Socket
+	listener, err := listenSocket(s.socketPath, socketCfg)
 	if err != nil {
-		return fmt.Errorf("failed to listen on socket: %w", err)
+		return err
 	}
-	s.listener = listener
+	s.listeners = append(s.listeners, listener)
+	go s.accept(ctx, listener, access{})
 
-	// Set socket permissions
-	if err := os.Chmod(s.socketPath, 0600); err != nil {
-		listener.Close()
-		return fmt.Errorf("failed to set socket permissions: %w", err)
-	}
-
-	// Accept connections in a goroutine
-	go func() {
-		for {
-			conn, err := listener.Accept()
+	if socketCfg != nil && socketCfg.ReadOnly != nil {
+		ro := socketCfg.ReadOnly
+		if roPath := ro.ResolvePath(s.daemon.configPath); roPath != "" {
+			roListener, err := listenSocket(roPath, ro)
 			if err != nil {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					continue
-				}
+				s.closeListeners()
+				return fmt.Errorf("read-only socket: %w", err)
 			}
+			s.listeners = append(s.listeners, roListener)
+			go s.accept(ctx, roListener, access{readOnly: true})
+		}
+		if ro.Listen != "" {
+			token, err := s.daemon.readOnlyToken()
+			if err != nil {
+				s.closeListeners()
+				return fmt.Errorf("read-only listener: %w", err)
+			}
+			roTCPListener, err := s.listenTCP(ro.Listen, ro)
+			if err != nil {
+				s.closeListeners()
+				return fmt.Errorf("read-only listener: %w", err)
+			}
+			s.listeners = append(s.listeners, roTCPListener)
+			go s.accept(ctx, roTCPListener, access{token: token, readOnly: true})
+		}
+	}
 
-			s.mu.Lock()
-			s.conns[conn] = true
-			s.mu.Unlock()
-
-			go s.handleConnection(ctx, conn)
+	if addr := s.daemon.listen; addr != "" {
+		token, err := s.daemon.remoteToken()
+		if err != nil {
+			s.closeListeners()
+			return err
 		}
-	}()
+		tcpListener, err := s.listenTCP(addr, socketCfg)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		s.listeners = append(s.listeners, tcpListener)
+		go s.accept(ctx, tcpListener, access{token: token})
+	}
+	s.daemon.emit(pluginEvent{Event: config.PluginEventDaemonUp})
 
 	// Wait for context cancellation
 	<-ctx.Done()
 
-	// Close listener and all connections
-	listener.Close()
+	// Close listeners, and tell each client the daemon is going away
+	s.closeListeners()
 	s.mu.Lock()
-	for conn := range s.conns {
-		conn.Close()
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
 	}
 	s.mu.Unlock()
-
-	// Clean up socket file
-	os.Remove(s.socketPath)
+	for _, c := range conns {
+		c.notifyShutdown()
+	}
 
 	return nil
 }
 
-// handleConnection handles a single client connection.
-func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
+// listenSocket listens on a Unix socket at path, replacing a stale socket
+// file, with the permissions of cfg.
+func listenSocket(path string, cfg *config.Socket) (net.Listener, error) {
+	// Remove existing socket file
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+
+	// Set socket permissions
+	if err := setSocketAccess(path, cfg); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// closeListeners closes the listeners, which also removes their socket files.
+func (s *Server) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+}
+
+// accept accepts connections on a listener until the context is cancelled.
+// Its connections are limited as given by a.
+func (s *Server) accept(ctx context.Context, listener net.Listener, a access) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				continue
+			}
+		}
+
+		go s.handleConnection(ctx, conn, a)
+	}
+}
+
+// setSocketAccess applies the file mode and group of the socket config, so
+// that a trusted group of users can share one daemon.
+func setSocketAccess(path string, cfg *config.Socket) error {
+	if err := os.Chmod(path, cfg.GetMode()); err != nil {
+		return err
+	}
+	if cfg == nil || cfg.Group == "" {
+		return nil
+	}
+	gid, err := lookupGroup(cfg.Group)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, -1, gid)
+}
+
+// lookupGroup returns the ID of a group given by name or ID.
+func lookupGroup(group string) (int, error) {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		if g, err = user.LookupGroupId(group); err != nil {
+			return 0, fmt.Errorf("unknown group: %s", group)
+		}
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// handleConnection handles a single client connection. A handler that
+// streams to the client cancels the connection's context when it ends, as
+// the connection can't be used for further requests. Once ctx is done, the
+// client is notified of the shutdown before the connection is closed.
+func (s *Server) handleConnection(ctx context.Context, conn net.Conn, a access) {
+	c := newConnection(ctx, conn)
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
 	defer func() {
-		conn.Close()
+		if ctx.Err() != nil {
+			c.notifyShutdown()
+		} else {
+			c.close()
+		}
 		s.mu.Lock()
-		delete(s.conns, conn)
+		delete(s.conns, c)
 		s.mu.Unlock()
 	}()
+	defer recoverPanic("connection handler")
 
-	reader := bufio.NewReader(conn)
 	encoder := json.NewEncoder(conn)
+	streams := protocol.NewStreamMux(conn, false, func(st *protocol.Stream, open protocol.StreamOpen) {
+		s.acceptStream(c, st, open, a.readOnly)
+	})
+	c.streams = streams
+	c.onClose(streams.Close)
 
+	authenticated := a.token == ""
 	for {
 		select {
-		case <-ctx.Done():
+		case <-c.ctx.Done():
 			return
 		default:
 		}
 
 		// Read a line (JSON-RPC request)
-		line, err := reader.ReadBytes('\n')
+		line, err := c.reader.ReadBytes('\n')
 		if err != nil {
 			return
 		}
@@ -122,15 +231,50 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 			continue
 		}
 
-		resp := s.handleRequest(ctx, conn, reader, &req)
+		// A client of a listener with a token must authenticate before
+		// anything else, and is disconnected if it fails to
+		if !authenticated || req.Method == protocol.MethodAuth {
+			resp, ok := authenticate(&req, a.token)
+			encoder.Encode(resp)
+			if !ok {
+				return
+			}
+			authenticated = true
+			continue
+		}
+
+		// Stream notifications can arrive between any requests
+		if streams.Handle(&req) {
+			continue
+		}
+
+		if a.readOnly && !protocol.IsReadOnly(req.Method) {
+			msg := fmt.Sprintf("method %q is not allowed on a read-only socket", req.Method)
+			encoder.Encode(protocol.NewErrorResponse(protocol.MethodNotAllowed, msg, req.ID))
+			continue
+		}
+
+		resp := s.safeHandleRequest(c, &req)
 		if resp != nil {
 			encoder.Encode(resp)
 		}
 	}
 }
 
+// safeHandleRequest calls handleRequest, turning a panic in a handler into an
+// internal error response instead of crashing the daemon.
+func (s *Server) safeHandleRequest(c *connection, req *protocol.Request) (resp *protocol.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(fmt.Sprintf("%q handler", req.Method), r)
+			resp = protocol.NewErrorResponse(protocol.InternalError, fmt.Sprintf("internal error: %v", r), req.ID)
+		}
+	}()
+	return s.handleRequest(c, req)
+}
+
 // handleRequest processes a single RPC request.
-func (s *Server) handleRequest(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *protocol.Request) *protocol.Response {
+func (s *Server) handleRequest(c *connection, req *protocol.Request) *protocol.Response {
 	switch req.Method {
 	case protocol.MethodUp:
 		return s.handleUp(req)
@@ -142,10 +286,26 @@ func (s *Server) handleRequest(ctx context.Context, conn net.Conn, reader *bufio
 		return s.handleStatus(req)
 	case protocol.MethodRestart:
 		return s.handleRestart(req)
+	case protocol.MethodReload:
+		return s.handleReload(req)
+	case protocol.MethodScale:
+		return s.handleScale(req)
 	case protocol.MethodLogs:
-		return s.handleLogs(ctx, conn, req)
+		return s.handleLogs(c, req)
 	case protocol.MethodAttach:
-		return s.handleAttach(ctx, conn, reader, req)
+		return s.handleAttach(c, req)
+	case protocol.MethodVersion:
+		return s.handleVersion(req)
+	case protocol.MethodPing:
+		return s.handlePing(req)
+	case protocol.MethodStats:
+		return s.handleStats(req)
+	case protocol.MethodHistory:
+		return s.handleHistory(req)
+	case protocol.MethodInspect:
+		return s.handleInspect(req)
+	case protocol.MethodStdin:
+		return s.handleStdin(req)
 	default:
 		return protocol.NewErrorResponse(protocol.MethodNotFound, "method not found", req.ID)
 	}
@@ -157,11 +317,45 @@ func (s *Server) handleUp(req *protocol.Request) *protocol.Response {
 		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
 	}
 
-	started, failed := s.daemon.StartServices(params.Services)
+	if env := s.daemon.Env(); params.Env != env {
+		return protocol.NewErrorResponse(protocol.ConfigError, envMismatch(env, params.Env), req.ID)
+	}
+	if err := s.daemon.CheckOverrides(params.ConfigPath, params.Overrides); err != nil {
+		return protocol.NewErrorResponse(protocol.ConfigError, err.Error(), req.ID)
+	}
+
+	// Remove orphans first so that they can't be started by name
+	var removed []string
+	if params.RemoveOrphans {
+		var err error
+		if removed, err = s.daemon.RemoveOrphans(params.ConfigPath); err != nil {
+			return scopeErrorResponse(err, req.ID)
+		}
+	}
+
+	services, err := s.daemon.ScopeServices(params.ConfigPath, params.Services, true)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+
+	started, failed, errs := s.daemon.StartServices(services)
 
 	result := protocol.UpResult{
+		Removed: removed,
 		Started: started,
 		Failed:  failed,
+		Errors:  errs,
+	}
+
+	if params.Wait {
+		toWait := services
+		if len(toWait) == 0 {
+			toWait = s.daemon.ServiceNames()
+		}
+		toWait = slices.DeleteFunc(slices.Clone(toWait), func(name string) bool {
+			return slices.Contains(failed, name)
+		})
+		result.NotReady = s.daemon.WaitReady(toWait)
 	}
 
 	resp, err := protocol.NewResponse(result, *req.ID)
@@ -171,6 +365,67 @@ func (s *Server) handleUp(req *protocol.Request) *protocol.Response {
 	return resp
 }
 
+func (s *Server) handleReload(req *protocol.Request) *protocol.Response {
+	var params protocol.ReloadParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
+	}
+
+	if env := s.daemon.Env(); params.Env != env {
+		return protocol.NewErrorResponse(protocol.ConfigError, envMismatch(env, params.Env), req.ID)
+	}
+	if err := s.daemon.CheckOverrides(params.ConfigPath, params.Overrides); err != nil {
+		return protocol.NewErrorResponse(protocol.ConfigError, err.Error(), req.ID)
+	}
+
+	reloaded, err := s.daemon.Reload(params.ConfigPath)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	return reloadResponse(reloaded, req.ID)
+}
+
+func (s *Server) handleScale(req *protocol.Request) *protocol.Response {
+	var params protocol.ScaleParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
+	}
+	if len(params.Replicas) == 0 {
+		return protocol.NewErrorResponse(protocol.InvalidParams, "no replica counts given", req.ID)
+	}
+
+	if env := s.daemon.Env(); params.Env != env {
+		return protocol.NewErrorResponse(protocol.ConfigError, envMismatch(env, params.Env), req.ID)
+	}
+	if err := s.daemon.CheckOverrides(params.ConfigPath, params.Overrides); err != nil {
+		return protocol.NewErrorResponse(protocol.ConfigError, err.Error(), req.ID)
+	}
+
+	scaled, err := s.daemon.Scale(params.ConfigPath, params.Replicas)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	return reloadResponse(scaled, req.ID)
+}
+
+// reloadResponse returns the response to a request that applied a config
+// file to the daemon.
+func reloadResponse(reloaded *ReloadResult, id *int) *protocol.Response {
+	result := protocol.ReloadResult{
+		Added:   reloaded.Added,
+		Removed: reloaded.Removed,
+		Changed: reloaded.Changed,
+		Started: reloaded.Started,
+		Failed:  reloaded.Failed,
+		Errors:  reloaded.Errors,
+	}
+	resp, err := protocol.NewResponse(result, *id)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), id)
+	}
+	return resp
+}
+
 func (s *Server) handleShutdown(req *protocol.Request) *protocol.Response {
 	stopped := s.daemon.ShutdownAsync()
 
@@ -191,7 +446,12 @@ func (s *Server) handleDown(req *protocol.Request) *protocol.Response {
 		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
 	}
 
-	stopped := s.daemon.StopServices(params.Services)
+	services, err := s.daemon.ScopeServices(params.ConfigPath, params.Services, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+
+	stopped := s.daemon.StopServices(services)
 
 	result := protocol.DownResult{
 		Stopped: stopped,
@@ -209,18 +469,179 @@ func (s *Server) handleStatus(req *protocol.Request) *protocol.Response {
 
 	var protoStatuses []protocol.ServiceStatus
 	for _, st := range statuses {
-		protoStatuses = append(protoStatuses, protocol.ServiceStatus{
-			Name:      st.Name,
-			State:     st.State,
-			PID:       st.PID,
-			Restarts:  st.Restarts,
-			StartedAt: st.StartedAt,
-			ExitCode:  st.ExitCode,
-		})
+		protoStatuses = append(protoStatuses, newServiceStatus(st))
 	}
 
 	result := protocol.StatusResult{
 		Services: protoStatuses,
+		Env:      s.daemon.Env(),
+	}
+
+	resp, err := protocol.NewResponse(result, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handleVersion(req *protocol.Request) *protocol.Response {
+	result := protocol.VersionResult{
+		Version: version.String(),
+	}
+
+	resp, err := protocol.NewResponse(result, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handlePing(req *protocol.Request) *protocol.Response {
+	result := protocol.PingResult{
+		PID: os.Getpid(),
+	}
+
+	resp, err := protocol.NewResponse(result, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handleStats(req *protocol.Request) *protocol.Response {
+	stats := s.daemon.Stats()
+
+	s.mu.Lock()
+	conns := len(s.conns)
+	s.mu.Unlock()
+
+	result := protocol.StatsResult{
+		Version:        version.String(),
+		PID:            os.Getpid(),
+		StartedAt:      stats.StartedAt.Format(time.RFC3339),
+		UptimeSeconds:  time.Since(stats.StartedAt).Seconds(),
+		ConfigPath:     stats.ConfigPath,
+		Projects:       stats.Projects,
+		EventsPath:     stats.EventsPath,
+		Goroutines:     runtime.NumGoroutine(),
+		Connections:    conns,
+		LogLines:       stats.Log.Lines,
+		LogBytes:       stats.Log.Bytes,
+		LogMemoryLimit: stats.Log.MemoryLimit,
+		LogEvicted:     stats.Log.Evicted,
+		LogDropped:     stats.Log.Dropped,
+		LogSubscribers: stats.Log.Subscribers,
+	}
+
+	resp, err := protocol.NewResponse(result, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handleStdin(req *protocol.Request) *protocol.Response {
+	var params protocol.StdinParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
+	}
+	if params.Service == "" {
+		return protocol.NewErrorResponse(protocol.InvalidParams, "service name is required", req.ID)
+	}
+
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	if len(scoped) != 1 {
+		return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("%q matches %d services; stdin takes one service", params.Service, len(scoped)), req.ID)
+	}
+	if err := s.daemon.WriteStdin(scoped[0], params.Data); err != nil {
+		return protocol.NewErrorResponse(protocol.ServiceError, fmt.Sprintf("%s: %v", scoped[0], err), req.ID)
+	}
+
+	resp, err := protocol.NewResponse(protocol.StdinResult{Written: len(params.Data)}, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handleHistory(req *protocol.Request) *protocol.Response {
+	var params protocol.HistoryParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
+	}
+	if params.Service == "" {
+		return protocol.NewErrorResponse(protocol.InvalidParams, "service name is required", req.ID)
+	}
+
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	if len(scoped) != 1 {
+		return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("%q matches %d services; history takes one service", params.Service, len(scoped)), req.ID)
+	}
+	runs, err := s.daemon.GetHistory(scoped[0])
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.ServiceError, err.Error(), req.ID)
+	}
+
+	result := protocol.HistoryResult{
+		Service: params.Service,
+		Runs:    make([]protocol.RunInfo, 0, len(runs)),
+	}
+	for _, run := range runs {
+		result.Runs = append(result.Runs, newRunInfo(run))
+	}
+
+	resp, err := protocol.NewResponse(result, *req.ID)
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
+	}
+	return resp
+}
+
+func (s *Server) handleInspect(req *protocol.Request) *protocol.Response {
+	var params protocol.InspectParams
+	if err := req.ParseParams(&params); err != nil {
+		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
+	}
+	if params.Service == "" {
+		return protocol.NewErrorResponse(protocol.InvalidParams, "service name is required", req.ID)
+	}
+
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	if len(scoped) != 1 {
+		return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("%q matches %d services; inspect takes one service", params.Service, len(scoped)), req.ID)
+	}
+	insp, err := s.daemon.Inspect(scoped[0])
+	if err != nil {
+		return protocol.NewErrorResponse(protocol.ServiceError, err.Error(), req.ID)
+	}
+
+	result := protocol.InspectResult{
+		Service: params.Service,
+		Config:  newServiceConfig(insp.Service),
+		Status:  newServiceStatus(insp.Status),
+		History: make([]protocol.RunInfo, 0, len(insp.Runs)),
+		Logs: protocol.LogBufferInfo{
+			Lines:    insp.Log.Lines,
+			Bytes:    insp.Log.Bytes,
+			Capacity: insp.Log.Capacity,
+			Sinks:    insp.Log.Sinks,
+			History:  insp.Log.History,
+		},
+		// Secrets never leave the daemon, as inspect is allowed on
+		// read-only sockets
+		Env: config.MaskSecrets(insp.Env),
+	}
+	for _, run := range insp.Runs {
+		result.History = append(result.History, newRunInfo(run))
 	}
 
 	resp, err := protocol.NewResponse(result, *req.ID)
@@ -236,11 +657,16 @@ func (s *Server) handleRestart(req *protocol.Request) *protocol.Response {
 		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
 	}
 
-	restarted, failed := s.daemon.RestartServices(params.Services)
+	services, err := s.daemon.ScopeServices(params.ConfigPath, params.Services, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
 
-	result := protocol.RestartResult{
-		Restarted: restarted,
-		Failed:    failed,
+	var result protocol.RestartResult
+	if params.Rolling {
+		result.Restarted, result.Failed, result.Skipped = s.daemon.RollingRestart(services)
+	} else {
+		result.Restarted, result.Failed = s.daemon.RestartServices(services)
 	}
 
 	resp, err := protocol.NewResponse(result, *req.ID)
@@ -250,18 +676,41 @@ func (s *Server) handleRestart(req *protocol.Request) *protocol.Response {
 	return resp
 }
 
-func (s *Server) handleLogs(ctx context.Context, conn net.Conn, req *protocol.Request) *protocol.Response {
+func (s *Server) handleLogs(c *connection, req *protocol.Request) *protocol.Response {
 	var params protocol.LogsParams
 	if err := req.ParseParams(&params); err != nil {
 		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
 	}
 
+	services, err := s.daemon.ScopeServices(params.ConfigPath, params.Services, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+
 	// Get recent logs
 	lines := params.Lines
 	if lines <= 0 {
 		lines = 100
 	}
-	logs := s.daemon.GetLogs(params.Services, lines)
+	var since time.Time
+	if params.Since != "" {
+		since, err = time.Parse(time.RFC3339Nano, params.Since)
+		if err != nil {
+			return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("invalid since: %v", err), req.ID)
+		}
+	}
+	switch params.Stream {
+	case "", "stdout", "stderr":
+	default:
+		return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("invalid stream: %q", params.Stream), req.ID)
+	}
+	filter := LogFilter{Stream: params.Stream}
+	if params.Grep != "" {
+		if filter.Grep, err = regexp.Compile(params.Grep); err != nil {
+			return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("invalid grep: %v", err), req.ID)
+		}
+	}
+	logs := s.daemon.GetLogs(services, since, lines, filter)
 
 	// Send initial response
 	result := struct {
@@ -270,12 +719,7 @@ func (s *Server) handleLogs(ctx context.Context, conn net.Conn, req *protocol.Re
 		Lines: make([]protocol.LogEntry, 0, len(logs)),
 	}
 	for _, l := range logs {
-		result.Lines = append(result.Lines, protocol.LogEntry{
-			Service:   l.Service,
-			Line:      l.Line,
-			Timestamp: l.Timestamp.Format(time.RFC3339),
-			Stream:    l.Stream,
-		})
+		result.Lines = append(result.Lines, newLogEntry(l))
 	}
 
 	resp, err := protocol.NewResponse(result, *req.ID)
@@ -285,41 +729,24 @@ func (s *Server) handleLogs(ctx context.Context, conn net.Conn, req *protocol.Re
 
 	// If follow mode, start streaming
 	if params.Follow {
-		encoder := json.NewEncoder(conn)
+		encoder := json.NewEncoder(c)
 
 		// Send initial response first
 		encoder.Encode(resp)
 
-		// Subscribe to log updates
-		ch := s.daemon.SubscribeLogs(params.Services)
-		defer s.daemon.UnsubscribeLogs(ch)
+		// Subscribe to log updates until the client disconnects
+		ch := c.subscribeLogs(s.daemon, services)
+		c.watchDisconnect()
 
-		for {
-			select {
-			case <-ctx.Done():
-				return nil
-			case line, ok := <-ch:
-				if !ok {
-					return nil
-				}
-				entry := protocol.LogEntry{
-					Service:   line.Service,
-					Line:      line.Line,
-					Timestamp: line.Timestamp.Format(time.RFC3339),
-					Stream:    line.Stream,
-				}
-				notification, _ := protocol.NewNotification(protocol.MethodLog, entry)
-				if err := encoder.Encode(notification); err != nil {
-					return nil
-				}
-			}
-		}
+		streamLogLines(c.ctx, encoder, ch, params.Batch, filter)
+		c.cancel()
+		return nil
 	}
 
 	return resp
 }
 
-func (s *Server) handleAttach(ctx context.Context, conn net.Conn, reader *bufio.Reader, req *protocol.Request) *protocol.Response {
+func (s *Server) handleAttach(c *connection, req *protocol.Request) *protocol.Response {
 	var params protocol.AttachParams
 	if err := req.ParseParams(&params); err != nil {
 		return protocol.NewErrorResponse(protocol.InvalidParams, err.Error(), req.ID)
@@ -329,39 +756,69 @@ func (s *Server) handleAttach(ctx context.Context, conn net.Conn, reader *bufio.
 		return protocol.NewErrorResponse(protocol.InvalidParams, "service name is required", req.ID)
 	}
 
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return scopeErrorResponse(err, req.ID)
+	}
+	if len(scoped) != 1 {
+		return protocol.NewErrorResponse(protocol.InvalidParams, fmt.Sprintf("%q matches %d services; attach takes one service", params.Service, len(scoped)), req.ID)
+	}
+	service := scoped[0]
+
 	// Get recent logs for the service
-	logs := s.daemon.GetLogs([]string{params.Service}, 100)
+	logs := s.daemon.GetLogs([]string{service}, time.Time{}, 100, LogFilter{})
 
 	result := protocol.AttachResult{
 		Lines: make([]protocol.LogEntry, 0, len(logs)),
 	}
 	for _, l := range logs {
-		result.Lines = append(result.Lines, protocol.LogEntry{
-			Service:   l.Service,
-			Line:      l.Line,
-			Timestamp: l.Timestamp.Format(time.RFC3339),
-			Stream:    l.Stream,
-		})
+		result.Lines = append(result.Lines, newLogEntry(l))
 	}
 
+	// Other clients attaching or detaching is signaled on changed
+	changed := make(chan struct{}, 1)
+	attachment := s.daemon.Attach(service, params.ReadOnly, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	c.onClose(func() { s.daemon.Detach(attachment) })
+	result.AttachState = s.daemon.AttachState(attachment)
+
 	resp, err := protocol.NewResponse(result, *req.ID)
 	if err != nil {
 		return protocol.NewErrorResponse(protocol.InternalError, err.Error(), req.ID)
 	}
 
-	encoder := json.NewEncoder(conn)
+	encoder := &syncEncoder{enc: json.NewEncoder(c)}
 	encoder.Encode(resp)
 
+	// Send the client its new state after each change, next to the log stream
+	go func() {
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-changed:
+				notification, _ := protocol.NewNotification(protocol.MethodAttachState, s.daemon.AttachState(attachment))
+				if encoder.Encode(notification) != nil {
+					return
+				}
+			}
+		}
+	}()
+
 	// Subscribe to log updates for the service
-	ch := s.daemon.SubscribeLogs([]string{params.Service})
-	defer s.daemon.UnsubscribeLogs(ch)
+	ch := c.subscribeLogs(s.daemon, []string{service})
 
-	// Read stdin data from client in a goroutine
-	stdinDone := make(chan struct{})
+	// Serve the client's "attach" stream, which carries its input, until
+	// it disconnects
+	c.attachment = attachment
 	go func() {
-		defer close(stdinDone)
+		defer c.cancel()
 		for {
-			line, err := reader.ReadBytes('\n')
+			line, err := c.reader.ReadBytes('\n')
 			if err != nil {
 				return
 			}
@@ -369,37 +826,236 @@ func (s *Server) handleAttach(ctx context.Context, conn net.Conn, reader *bufio.
 			if err := json.Unmarshal(line, &notification); err != nil {
 				continue
 			}
-			if notification.Method == protocol.MethodStdin {
-				var data protocol.StdinData
-				if err := notification.ParseParams(&data); err != nil {
-					continue
-				}
-				s.daemon.WriteStdin(params.Service, []byte(data.Data))
-			}
+			c.streams.Handle(&notification)
 		}
 	}()
 
 	// Stream log notifications to client
+	streamLogLines(c.ctx, encoder, ch, params.Batch, LogFilter{})
+	c.cancel()
+	return nil
+}
+
+// syncEncoder serializes messages that several goroutines write to one
+// connection.
+type syncEncoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (e *syncEncoder) Encode(v any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(v)
+}
+
+// Log lines streamed to a client that accepts batches are collected for up
+// to logBatchInterval, or until logBatchMaxSize lines are pending, and sent
+// as a single notification. This saves encoding and write overhead for
+// chatty services.
+const (
+	logBatchInterval = 20 * time.Millisecond
+	logBatchMaxSize  = 500
+)
+
+// streamLogLines sends lines from ch to the client as notifications until ch
+// is closed, writing fails, or ctx is done. Lines dropped because the client
+// fell behind are reported with "log.dropped" notifications in their place.
+func streamLogLines(ctx context.Context, encoder interface{ Encode(v any) error }, ch <-chan LogLine, batch bool, filter LogFilter) {
+	var pending []protocol.LogEntry
+	var flush <-chan time.Time
+	var dropped int
+
+	send := func() bool {
+		if len(pending) == 0 {
+			return true
+		}
+		notification, _ := protocol.NewNotification(protocol.MethodLogBatch, protocol.LogBatch{Entries: pending})
+		pending = nil
+		flush = nil
+		return encoder.Encode(notification) == nil
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case <-stdinDone:
-			return nil
+			return
+		case <-flush:
+			if !send() {
+				return
+			}
 		case line, ok := <-ch:
 			if !ok {
-				return nil
+				send()
+				return
+			}
+			if !filter.match(line) {
+				continue
+			}
+			if line.Stream == StreamDropped {
+				// Entries already batched came before the dropped lines
+				if !send() {
+					return
+				}
+				dropped += line.Dropped
+				notification, _ := protocol.NewNotification(protocol.MethodLogDropped, protocol.LogDropped{Count: line.Dropped, Total: dropped})
+				if err := encoder.Encode(notification); err != nil {
+					return
+				}
+				continue
 			}
-			entry := protocol.LogEntry{
-				Service:   line.Service,
-				Line:      line.Line,
-				Timestamp: line.Timestamp.Format(time.RFC3339),
-				Stream:    line.Stream,
+			entry := newLogEntry(line)
+
+			if !batch {
+				notification, _ := protocol.NewNotification(protocol.MethodLog, entry)
+				if err := encoder.Encode(notification); err != nil {
+					return
+				}
+				continue
 			}
-			notification, _ := protocol.NewNotification(protocol.MethodLog, entry)
-			if err := encoder.Encode(notification); err != nil {
-				return nil
+
+			pending = append(pending, entry)
+			if len(pending) >= logBatchMaxSize {
+				if !send() {
+					return
+				}
+			} else if flush == nil {
+				flush = time.After(logBatchInterval)
 			}
 		}
 	}
 }
+
+// scopeErrorResponse returns the error response for a failure to scope the
+// services of a request, telling config errors apart.
+func scopeErrorResponse(err error, id *int) *protocol.Response {
+	return protocol.NewErrorResponse(scopeErrorCode(err), err.Error(), id)
+}
+
+// scopeErrorCode returns the error code for a ScopeServices error.
+func scopeErrorCode(err error) int {
+	var cfgErr *ConfigError
+	if errors.As(err, &cfgErr) {
+		return protocol.ConfigError
+	}
+	return protocol.ServiceError
+}
+
+// envMismatch describes an up request for a config overlay other than the
+// one the daemon runs with.
+func envMismatch(daemonEnv, clientEnv string) string {
+	describe := func(env string) string {
+		if env == "" {
+			return "no env"
+		}
+		return fmt.Sprintf("env %q", env)
+	}
+	return fmt.Sprintf("the daemon runs with %s, not %s; stop it with 'comproc daemon stop' to switch", describe(daemonEnv), describe(clientEnv))
+}
+
+// newServiceStatus converts the status of a service to its wire
+// representation.
+func newServiceStatus(st ServiceStatus) protocol.ServiceStatus {
+	var nextRestart string
+	if !st.NextRestart.IsZero() {
+		nextRestart = st.NextRestart.Format(time.RFC3339Nano)
+	}
+	return protocol.ServiceStatus{
+		Name:      st.Name,
+		State:     st.State,
+		PID:       st.PID,
+		Restarts:  st.Restarts,
+		StartedAt: st.StartedAt,
+		ExitCode:  st.ExitCode,
+		Signal:    st.Signal,
+		ExitedAt:  st.ExitedAt,
+		Health:    st.Health,
+		Ready:     st.Ready,
+		External:  st.External,
+		Color:     st.Color,
+		Ports:     st.Ports,
+		CPU:       st.CPU,
+		Memory:    st.Memory,
+
+		NextRestartAt:  nextRestart,
+		RestartAttempt: st.RestartAttempt,
+
+		Command:    st.Command,
+		WorkingDir: st.WorkingDir,
+		Restart:    st.Restart,
+		DependsOn:  st.DependsOn,
+	}
+}
+
+// newRunInfo converts a recorded run to its wire representation.
+func newRunInfo(run serviceRun) protocol.RunInfo {
+	info := protocol.RunInfo{
+		StartedAt: run.StartedAt.Format(time.RFC3339),
+		ExitCode:  run.ExitCode,
+		Signal:    run.Signal,
+		Reason:    run.Reason,
+		Error:     run.Error,
+	}
+	if !run.ExitedAt.IsZero() {
+		info.ExitedAt = run.ExitedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// newServiceConfig converts the resolved config of a service to its wire
+// representation, with defaults applied. Log sinks are reduced to their
+// drivers, as their settings may hold credentials.
+func newServiceConfig(svc *config.Service) protocol.ServiceConfig {
+	cfg := protocol.ServiceConfig{
+		Command:         svc.Command,
+		External:        svc.External,
+		Prepare:         svc.Prepare,
+		WorkingDir:      svc.WorkingDir,
+		Restart:         string(svc.GetRestartPolicy()),
+		StopMode:        string(svc.GetStopMode()),
+		AttachStdin:     string(svc.GetAttachStdin()),
+		DependsOn:       svc.DependencyNames(),
+		Ports:           svc.Ports,
+		LoginShell:      svc.LoginShell,
+		LogFile:         svc.LogFile,
+		ReadyLogPattern: svc.ReadyLogPattern,
+		MemRestartLimit: svc.MemLimit,
+	}
+	if mask, ok := svc.GetUmask(); ok {
+		cfg.Umask = fmt.Sprintf("%04o", mask)
+	}
+	for _, ns := range svc.Isolate {
+		cfg.Isolate = append(cfg.Isolate, string(ns))
+	}
+	for _, req := range svc.Requires {
+		cfg.Requires = append(cfg.Requires, req.String())
+	}
+	for _, sink := range svc.Logging {
+		cfg.Logging = append(cfg.Logging, sink.Driver)
+	}
+	if hc := svc.Healthcheck; hc != nil {
+		cfg.Healthcheck = &protocol.HealthcheckConfig{
+			Command:     hc.Command,
+			WaitForFile: hc.WaitForFile,
+			Interval:    hc.GetInterval().String(),
+			Timeout:     hc.GetTimeout().String(),
+			Retries:     hc.GetRetries(),
+		}
+		if hc.StartPeriod > 0 {
+			cfg.Healthcheck.StartPeriod = time.Duration(hc.StartPeriod).String()
+		}
+	}
+	return cfg
+}
+
+// newLogEntry converts a captured log line to its wire representation.
+func newLogEntry(line LogLine) protocol.LogEntry {
+	entry := protocol.LogEntry{
+		Service:   line.Service,
+		Timestamp: line.Timestamp.Format(time.RFC3339),
+		Stream:    line.Stream,
+		Color:     line.Color,
+	}
+	entry.SetLine(line.Line)
+	return entry
+}
@@ -0,0 +1,439 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// decodeNotifications parses newline-delimited notifications.
+func decodeNotifications(t *testing.T, data []byte) []protocol.Request {
+	t.Helper()
+
+	var result []protocol.Request
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var req protocol.Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			t.Fatalf("failed to parse notification: %v", err)
+		}
+		result = append(result, req)
+	}
+	return result
+}
+
+func TestStreamLogLines_Batch(t *testing.T) {
+	ch := make(chan LogLine, 10)
+	for _, l := range []string{"a", "b", "c"} {
+		ch <- LogLine{Service: "api", Line: l, Timestamp: time.Now(), Stream: "stdout"}
+	}
+	close(ch)
+
+	var out bytes.Buffer
+	streamLogLines(context.Background(), json.NewEncoder(&out), ch, true, LogFilter{})
+
+	notifications := decodeNotifications(t, out.Bytes())
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifications))
+	}
+	if notifications[0].Method != protocol.MethodLogBatch {
+		t.Errorf("expected %q, got %q", protocol.MethodLogBatch, notifications[0].Method)
+	}
+
+	var batch protocol.LogBatch
+	if err := notifications[0].ParseParams(&batch); err != nil {
+		t.Fatalf("failed to parse batch: %v", err)
+	}
+	if len(batch.Entries) != 3 || batch.Entries[0].Line != "a" || batch.Entries[2].Line != "c" {
+		t.Errorf("expected entries a, b, c in order, got %+v", batch.Entries)
+	}
+}
+
+func TestStreamLogLines_FlushesAfterInterval(t *testing.T) {
+	ch := make(chan LogLine, 10)
+	r, w := net.Pipe()
+	defer r.Close()
+	defer w.Close()
+
+	go streamLogLines(context.Background(), json.NewEncoder(w), ch, true, LogFilter{})
+	ch <- LogLine{Service: "api", Line: "hello", Timestamp: time.Now()}
+
+	// A single line is delivered without waiting for more
+	reader := bufio.NewReader(r)
+	done := make(chan []byte, 1)
+	go func() {
+		line, _ := reader.ReadBytes('\n')
+		done <- line
+	}()
+
+	select {
+	case line := <-done:
+		notifications := decodeNotifications(t, line)
+		if len(notifications) != 1 || notifications[0].Method != protocol.MethodLogBatch {
+			t.Errorf("expected a batch notification, got %s", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the batch to be flushed")
+	}
+	close(ch)
+}
+
+func TestStreamLogLines_Unbatched(t *testing.T) {
+	ch := make(chan LogLine, 10)
+	for _, l := range []string{"a", "b"} {
+		ch <- LogLine{Service: "api", Line: l, Timestamp: time.Now()}
+	}
+	close(ch)
+
+	var out bytes.Buffer
+	streamLogLines(context.Background(), json.NewEncoder(&out), ch, false, LogFilter{})
+
+	notifications := decodeNotifications(t, out.Bytes())
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+	for _, n := range notifications {
+		if n.Method != protocol.MethodLog {
+			t.Errorf("expected %q, got %q", protocol.MethodLog, n.Method)
+		}
+	}
+}
+
+func TestStreamLogLines_Dropped(t *testing.T) {
+	ch := make(chan LogLine, 10)
+	ch <- LogLine{Service: "api", Line: "a", Timestamp: time.Now(), Stream: "stdout"}
+	ch <- LogLine{Stream: StreamDropped, Timestamp: time.Now(), Dropped: 3}
+	ch <- LogLine{Service: "api", Line: "b", Timestamp: time.Now(), Stream: "stdout"}
+	ch <- LogLine{Stream: StreamDropped, Timestamp: time.Now(), Dropped: 2}
+	close(ch)
+
+	var out bytes.Buffer
+	streamLogLines(context.Background(), json.NewEncoder(&out), ch, true, LogFilter{Stream: "stdout"})
+
+	// The batched line is sent before the notice of the lines after it
+	var got []string
+	for _, n := range decodeNotifications(t, out.Bytes()) {
+		switch n.Method {
+		case protocol.MethodLogBatch:
+			var batch protocol.LogBatch
+			n.ParseParams(&batch)
+			for _, e := range batch.Entries {
+				got = append(got, e.Line)
+			}
+		case protocol.MethodLogDropped:
+			var dropped protocol.LogDropped
+			n.ParseParams(&dropped)
+			got = append(got, fmt.Sprintf("dropped %d/%d", dropped.Count, dropped.Total))
+		}
+	}
+	want := []string{"a", "dropped 3/3", "b", "dropped 2/5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestStreamLogLines_Grep(t *testing.T) {
+	ch := make(chan LogLine, 10)
+	ch <- LogLine{Service: "api", Line: "GET /health", Timestamp: time.Now(), Stream: "stdout"}
+	ch <- LogLine{Service: "api", Line: "error: timeout", Timestamp: time.Now(), Stream: "stderr"}
+	ch <- LogLine{Service: "api", Line: "--- api restarted ---", Timestamp: time.Now(), Stream: StreamMarker}
+	ch <- LogLine{Service: "api", Line: "error: refused", Timestamp: time.Now(), Stream: "stdout"}
+	close(ch)
+
+	var out bytes.Buffer
+	streamLogLines(context.Background(), json.NewEncoder(&out), ch, false, LogFilter{Grep: regexp.MustCompile("^error")})
+
+	var got []string
+	for _, n := range decodeNotifications(t, out.Bytes()) {
+		var entry protocol.LogEntry
+		n.ParseParams(&entry)
+		got = append(got, entry.Line)
+	}
+	want := []string{"error: timeout", "--- api restarted ---", "error: refused"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSetSocketAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.sock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Use the current group, which the user can always assign
+	gid := strconv.Itoa(os.Getgid())
+	if err := setSocketAccess(path, &config.Socket{Mode: "0660", Group: gid}); err != nil {
+		t.Fatalf("failed to set socket access: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("expected mode 0660, got %o", perm)
+	}
+	if got := info.Sys().(*syscall.Stat_t).Gid; strconv.Itoa(int(got)) != gid {
+		t.Errorf("expected group %s, got %d", gid, got)
+	}
+
+	if err := setSocketAccess(path, nil); err != nil {
+		t.Fatalf("failed to set default socket access: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected default mode 0600, got %o", info.Mode().Perm())
+	}
+
+	if err := setSocketAccess(path, &config.Socket{Group: "no-such-group-comproc"}); err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+}
+
+func TestServer_ReadOnlyConnection(t *testing.T) {
+	s := NewServer(nil, "")
+	client, server := net.Pipe()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.handleConnection(ctx, server, access{readOnly: true})
+
+	reader := bufio.NewReader(client)
+	call := func(method string) *protocol.Response {
+		t.Helper()
+		req, err := protocol.NewRequest(method, nil, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewEncoder(client).Encode(req); err != nil {
+			t.Fatal(err)
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(line, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return &resp
+	}
+
+	if resp := call(protocol.MethodDown); resp.Error == nil || resp.Error.Code != protocol.MethodNotAllowed {
+		t.Errorf("expected down to be rejected, got %+v", resp)
+	}
+	if resp := call(protocol.MethodPing); resp.Error != nil {
+		t.Errorf("expected ping to be allowed, got %+v", resp.Error)
+	}
+}
+
+func TestServer_TokenConnection(t *testing.T) {
+	s := NewServer(nil, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connect := func() (func(method string, params any) *protocol.Response, *bufio.Reader) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		go s.handleConnection(ctx, server, access{token: "secret"})
+		reader := bufio.NewReader(client)
+		return func(method string, params any) *protocol.Response {
+			t.Helper()
+			req, err := protocol.NewRequest(method, params, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.NewEncoder(client).Encode(req); err != nil {
+				t.Fatal(err)
+			}
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp protocol.Response
+			if err := json.Unmarshal(line, &resp); err != nil {
+				t.Fatal(err)
+			}
+			return &resp
+		}, reader
+	}
+
+	call, reader := connect()
+	if resp := call(protocol.MethodPing, nil); resp.Error == nil || resp.Error.Code != protocol.Unauthorized {
+		t.Errorf("expected ping to require authentication, got %+v", resp)
+	}
+	if _, err := reader.ReadBytes('\n'); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+
+	call, _ = connect()
+	if resp := call(protocol.MethodAuth, protocol.AuthParams{Token: "guess"}); resp.Error == nil || resp.Error.Message != "invalid token" {
+		t.Errorf("expected a wrong token to be rejected, got %+v", resp)
+	}
+
+	call, _ = connect()
+	if resp := call(protocol.MethodAuth, protocol.AuthParams{Token: "secret"}); resp.Error != nil {
+		t.Fatalf("expected the token to be accepted, got %+v", resp.Error)
+	}
+	if resp := call(protocol.MethodPing, nil); resp.Error != nil {
+		t.Errorf("expected ping to be allowed, got %+v", resp.Error)
+	}
+}
+
+func TestServer_RefusesStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		kind     string
+		params   any
+		code     int
+	}{
+		{"read-only socket", true, protocol.StreamKindStdin, nil, protocol.MethodNotAllowed},
+		{"unknown kind", false, "unknown", nil, protocol.MethodNotFound},
+		{"unknown stderr stream", false, protocol.StreamKindRun, protocol.RunParams{Stderr: 7}, protocol.InvalidParams},
+		{"input without attaching", false, protocol.StreamKindAttach, nil, protocol.InvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(nil, "")
+			client, server := net.Pipe()
+			defer client.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go s.handleConnection(ctx, server, access{readOnly: tt.readOnly})
+
+			streams := protocol.NewStreamMux(client, true, nil)
+			st, err := streams.Open(tt.kind, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			line, err := bufio.NewReader(client).ReadBytes('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			var req protocol.Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				t.Fatal(err)
+			}
+			if !streams.Handle(&req) {
+				t.Fatalf("expected a stream notification, got %s", line)
+			}
+
+			var rpcErr *protocol.Error
+			if !errors.As(st.Err(), &rpcErr) || rpcErr.Code != tt.code {
+				t.Errorf("expected the stream to be closed with code %d, got %v", tt.code, st.Err())
+			}
+		})
+	}
+}
+
+func TestServer_FollowReleasedOnDisconnect(t *testing.T) {
+	d := &Daemon{logMgr: NewLogManager(10)}
+	defer d.logMgr.Close()
+	s := NewServer(d, "")
+	client, server := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.handleConnection(ctx, server, access{})
+		close(done)
+	}()
+
+	req, err := protocol.NewRequest(protocol.MethodLogs, protocol.LogsParams{Follow: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bufio.NewReader(client).ReadBytes('\n'); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for d.logMgr.Stats().Subscribers == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the subscription")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// No log lines are written, so only the disconnect can end the stream
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the connection handler to end")
+	}
+	if n := d.logMgr.Stats().Subscribers; n != 0 {
+		t.Errorf("expected the subscription to be released, got %d subscribers", n)
+	}
+}
+
+func TestConnection_OnCloseAfterClose(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := newConnection(context.Background(), server)
+	c.close()
+
+	released := false
+	c.onClose(func() { released = true })
+	if !released {
+		t.Error("expected release to be called on a closed connection")
+	}
+	if c.ctx.Err() == nil {
+		t.Error("expected the connection's context to be cancelled")
+	}
+}
+
+func TestServer_NotifiesShutdown(t *testing.T) {
+	d := &Daemon{logMgr: NewLogManager(10)}
+	defer d.logMgr.Close()
+	s := NewServer(d, "")
+	client, server := net.Pipe()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.handleConnection(ctx, server, access{})
+
+	req, err := protocol.NewRequest(protocol.MethodLogs, protocol.LogsParams{Follow: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(client)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("expected a shutdown notification, got error: %v", err)
+	}
+	notifications := decodeNotifications(t, line)
+	if len(notifications) != 1 || notifications[0].Method != protocol.MethodShutdown {
+		t.Errorf("expected a shutdown notification, got %s", line)
+	}
+	// The connection is closed after the notification
+	if _, err := reader.ReadBytes('\n'); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,250 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/logsink"
+)
+
+// LogSink receives log lines captured from a service.
+// Sinks must be safe for use from multiple goroutines.
+type LogSink interface {
+	// WriteLine delivers a single log line to the sink.
+	WriteLine(line LogLine) error
+	// Close flushes and releases any resources held by the sink.
+	Close() error
+}
+
+// LogSinkFactory creates a sink for a service from its configuration.
+// baseDir is the directory of the config file, used to resolve relative paths.
+type LogSinkFactory func(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error)
+
+// sinkFactories holds the built-in drivers. Others are registered through
+// the public logsink package.
+var sinkFactories = map[string]LogSinkFactory{
+	config.LogDriverFile:    newFileSink,
+	config.LogDriverSyslog:  newSyslogSink,
+	config.LogDriverCommand: newCommandSink,
+	config.LogDriverLoki:    newLokiSink,
+	config.LogDriverGELF:    newGELFSink,
+}
+
+// NewLogSink creates a sink using the built-in factory for cfg.Driver, or
+// else the one registered with logsink.Register.
+func NewLogSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	if factory, ok := sinkFactories[cfg.Driver]; ok {
+		return factory(service, cfg, baseDir)
+	}
+	factory, ok := logsink.Lookup(cfg.Driver)
+	if !ok {
+		return nil, fmt.Errorf("unknown log driver: %q", cfg.Driver)
+	}
+	sink, err := factory(service, cfg, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return registeredSink{sink}, nil
+}
+
+// registeredSink adapts a sink registered with logsink.Register.
+type registeredSink struct {
+	sink logsink.Sink
+}
+
+func (s registeredSink) WriteLine(line LogLine) error {
+	return s.sink.WriteLine(logsink.Line{
+		Service:   line.Service,
+		Line:      line.Line,
+		Timestamp: line.Timestamp,
+		Stream:    line.Stream,
+	})
+}
+
+func (s registeredSink) Close() error {
+	return s.sink.Close()
+}
+
+// newLogFile opens the file that receives the history of a service with a
+// log_file. It returns nil if the service has none or discards its history.
+func newLogFile(service string, svc *config.Service, baseDir string) (LogSink, error) {
+	if svc.LogFile == "" || svc.LogFile == config.LogFileDiscard {
+		return nil, nil
+	}
+	return newFileSink(service, config.LogSinkConfig{Driver: config.LogDriverFile, Path: svc.LogFile}, baseDir)
+}
+
+// setLogFile routes the history of a service to file, or discards it as
+// set by the service's log_file.
+func (m *LogManager) setLogFile(service string, svc *config.Service, file LogSink) {
+	if svc.LogFile == config.LogFileDiscard {
+		m.DiscardHistory(service)
+	} else if file != nil {
+		m.SetLogFile(service, file)
+	}
+}
+
+// formatSinkLine formats a log line for plain-text sinks.
+func formatSinkLine(line LogLine) string {
+	return fmt.Sprintf("%s %s %s\n", line.Timestamp.Format(time.RFC3339Nano), line.Stream, line.Line)
+}
+
+// fileSink appends log lines to a file.
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	path := cfg.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) WriteLine(line LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.file, formatSinkLine(line))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// syslogSink sends log lines to the local syslog daemon.
+// Lines from stderr are logged at error priority, others at info.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "comproc/" + service
+	}
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) WriteLine(line LogLine) error {
+	if line.Stream == "stderr" {
+		return s.writer.Err(line.Line)
+	}
+	return s.writer.Info(line.Line)
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+// commandSink pipes log lines to the stdin of an external command.
+type commandSink struct {
+	pipe *commandPipe
+}
+
+func newCommandSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	cmd := exec.Command("sh", "-c", cfg.Command)
+	cmd.Dir = baseDir
+	cmd.Env = append(os.Environ(), "COMPROC_SERVICE="+service)
+
+	pipe, err := startCommandPipe(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start log command: %w", err)
+	}
+	return &commandSink{pipe: pipe}, nil
+}
+
+func (s *commandSink) WriteLine(line LogLine) error {
+	s.pipe.Send(formatSinkLine(line))
+	return nil
+}
+
+func (s *commandSink) Close() error {
+	s.pipe.Close()
+	return nil
+}
+
+// commandPipe writes to the stdin of an external command.
+// Writes are queued and performed asynchronously so a slow command never
+// blocks the caller; data is dropped when the queue is full.
+type commandPipe struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	queue chan string
+	done  chan struct{}
+	once  sync.Once
+}
+
+// startCommandPipe starts cmd with its stdin connected to a new pipe.
+func startCommandPipe(cmd *exec.Cmd) (*commandPipe, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &commandPipe{
+		cmd:   cmd,
+		stdin: stdin,
+		queue: make(chan string, 1000),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *commandPipe) run() {
+	defer close(p.done)
+	for data := range p.queue {
+		if _, err := io.WriteString(p.stdin, data); err != nil {
+			// The command has exited; drain the queue
+			for range p.queue {
+			}
+			return
+		}
+	}
+}
+
+// Send queues data to be written to the command's stdin.
+func (p *commandPipe) Send(data string) {
+	select {
+	case p.queue <- data:
+	default:
+		// Queue full, skip
+	}
+}
+
+// Close writes the queued data, closes the command's stdin, and waits for
+// the command to exit.
+func (p *commandPipe) Close() {
+	p.once.Do(func() {
+		close(p.queue)
+		<-p.done
+		p.stdin.Close()
+		p.cmd.Wait()
+	})
+}
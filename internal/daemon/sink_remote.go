@@ -0,0 +1,352 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+const (
+	remoteQueueSize     = 1000
+	remoteBatchSize     = 500
+	remoteFlushInterval = time.Second
+	remoteTimeout       = 5 * time.Second
+)
+
+// remoteQueue batches log lines and sends them from a background goroutine,
+// so a slow or unreachable endpoint never blocks the caller. Lines are
+// dropped when the queue is full, and batches that fail to send are dropped.
+type remoteQueue struct {
+	send  func(batch []LogLine) error
+	queue chan LogLine
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newRemoteQueue(send func(batch []LogLine) error) *remoteQueue {
+	q := &remoteQueue{
+		send:  send,
+		queue: make(chan LogLine, remoteQueueSize),
+		done:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *remoteQueue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(remoteFlushInterval)
+	defer ticker.Stop()
+
+	var batch []LogLine
+	flush := func() {
+		if len(batch) > 0 {
+			q.send(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case line, ok := <-q.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, line)
+			if len(batch) >= remoteBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Send queues a line to be sent with the next batch.
+func (q *remoteQueue) Send(line LogLine) {
+	select {
+	case q.queue <- line:
+	default:
+		// Queue full, skip
+	}
+}
+
+// Close sends the queued lines and stops the background goroutine.
+func (q *remoteQueue) Close() {
+	q.once.Do(func() {
+		close(q.queue)
+		<-q.done
+	})
+}
+
+// sinkLabels returns the labels attached to the lines of a service: the
+// project, the service name without its project prefix, and the labels of
+// the configuration. The stream label is added per line.
+func sinkLabels(service string, cfg config.LogSinkConfig) map[string]string {
+	labels := make(map[string]string, len(cfg.Labels)+2)
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	if cfg.Project != "" {
+		labels["project"] = cfg.Project
+		service = strings.TrimPrefix(service, cfg.Project+projectSeparator)
+	}
+	labels["service"] = service
+	return labels
+}
+
+// postJSON sends a JSON body to an HTTP endpoint and checks the status code.
+func postJSON(client *http.Client, endpoint string, body []byte) error {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// lokiSink pushes log lines to Grafana Loki.
+type lokiSink struct {
+	client   *http.Client
+	endpoint string
+	labels   map[string]string
+	queue    *remoteQueue
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLokiSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	// A base URL refers to the push API of the server
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/loki/api/v1/push"
+	}
+	s := &lokiSink{
+		client:   &http.Client{Timeout: remoteTimeout},
+		endpoint: u.String(),
+		labels:   sinkLabels(service, cfg),
+	}
+	s.queue = newRemoteQueue(s.push)
+	return s, nil
+}
+
+func (s *lokiSink) WriteLine(line LogLine) error {
+	s.queue.Send(line)
+	return nil
+}
+
+func (s *lokiSink) Close() error {
+	s.queue.Close()
+	return nil
+}
+
+// push sends a batch with one Loki stream per output stream.
+func (s *lokiSink) push(batch []LogLine) error {
+	var streams []*lokiStream
+	byName := make(map[string]*lokiStream)
+	for _, line := range batch {
+		st, ok := byName[line.Stream]
+		if !ok {
+			labels := make(map[string]string, len(s.labels)+1)
+			for k, v := range s.labels {
+				labels[k] = v
+			}
+			labels["stream"] = line.Stream
+			st = &lokiStream{Stream: labels}
+			byName[line.Stream] = st
+			streams = append(streams, st)
+		}
+		ts := strconv.FormatInt(line.Timestamp.UnixNano(), 10)
+		st.Values = append(st.Values, [2]string{ts, line.Line})
+	}
+
+	body, err := json.Marshal(map[string]any{"streams": streams})
+	if err != nil {
+		return err
+	}
+	return postJSON(s.client, s.endpoint, body)
+}
+
+// GELF syslog levels of stdout and stderr lines.
+const (
+	gelfLevelInfo  = 6
+	gelfLevelError = 3
+)
+
+// GELF UDP chunking limits.
+const (
+	gelfChunkSize      = 8192
+	gelfChunkHeader    = 12
+	gelfMaxChunks      = 128
+	gelfChunkMagicByte = 0x1e
+)
+
+// gelfSink sends log lines as GELF messages over UDP, TCP, or HTTP.
+type gelfSink struct {
+	host   string
+	fields map[string]any
+	write  func(msg []byte) error
+	close  func()
+	queue  *remoteQueue
+}
+
+func newGELFSink(service string, cfg config.LogSinkConfig, baseDir string) (LogSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	host, _ := os.Hostname()
+	s := &gelfSink{host: host, fields: make(map[string]any), close: func() {}}
+	for k, v := range sinkLabels(service, cfg) {
+		s.fields["_"+k] = v
+	}
+
+	switch u.Scheme {
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+		}
+		s.write = func(msg []byte) error { return writeGELFChunks(conn, msg) }
+		s.close = func() { conn.Close() }
+	case "tcp":
+		t := &gelfTCP{addr: u.Host}
+		s.write = t.write
+		s.close = t.close
+	default:
+		client := &http.Client{Timeout: remoteTimeout}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/gelf"
+		}
+		endpoint := u.String()
+		s.write = func(msg []byte) error { return postJSON(client, endpoint, msg) }
+	}
+	s.queue = newRemoteQueue(s.send)
+	return s, nil
+}
+
+func (s *gelfSink) WriteLine(line LogLine) error {
+	s.queue.Send(line)
+	return nil
+}
+
+func (s *gelfSink) Close() error {
+	s.queue.Close()
+	s.close()
+	return nil
+}
+
+// send writes each line of a batch as its own GELF message.
+func (s *gelfSink) send(batch []LogLine) error {
+	var lastErr error
+	for _, line := range batch {
+		msg, err := s.message(line)
+		if err == nil {
+			err = s.write(msg)
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// message returns the GELF 1.1 message of a line.
+func (s *gelfSink) message(line LogLine) ([]byte, error) {
+	level := gelfLevelInfo
+	if line.Stream == "stderr" {
+		level = gelfLevelError
+	}
+	msg := make(map[string]any, len(s.fields)+6)
+	for k, v := range s.fields {
+		msg[k] = v
+	}
+	msg["version"] = "1.1"
+	msg["host"] = s.host
+	msg["short_message"] = line.Line
+	msg["timestamp"] = float64(line.Timestamp.UnixMicro()) / 1e6
+	msg["level"] = level
+	msg["_stream"] = line.Stream
+	return json.Marshal(msg)
+}
+
+// writeGELFChunks writes a message as a single datagram, or split into
+// GELF chunks if it does not fit in one.
+func writeGELFChunks(conn net.Conn, msg []byte) error {
+	if len(msg) <= gelfChunkSize {
+		_, err := conn.Write(msg)
+		return err
+	}
+
+	size := gelfChunkSize - gelfChunkHeader
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("message too large: %d bytes", len(msg))
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	for i := 0; i < count; i++ {
+		chunk := msg[i*size : min((i+1)*size, len(msg))]
+		buf := make([]byte, 0, gelfChunkHeader+len(chunk))
+		buf = append(buf, gelfChunkMagicByte, 0x0f)
+		buf = append(buf, id...)
+		buf = append(buf, byte(i), byte(count))
+		buf = append(buf, chunk...)
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gelfTCP writes null-delimited GELF messages to a TCP connection, which is
+// opened on first use and again after a write fails.
+type gelfTCP struct {
+	addr string
+	conn net.Conn
+}
+
+func (t *gelfTCP) write(msg []byte) error {
+	if t.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.addr, remoteTimeout)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(remoteTimeout))
+	if _, err := t.conn.Write(append(msg, 0)); err != nil {
+		t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (t *gelfTCP) close() {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+}
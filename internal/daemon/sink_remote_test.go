@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestLokiSink(t *testing.T) {
+	var mu sync.Mutex
+	var pushes []struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body struct {
+			Streams []lokiStream `json:"streams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		mu.Lock()
+		pushes = append(pushes, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewLogSink("shop/api", config.LogSinkConfig{
+		Driver:  config.LogDriverLoki,
+		URL:     server.URL,
+		Labels:  map[string]string{"env": "dev"},
+		Project: "shop",
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	ts := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	sink.WriteLine(LogLine{Service: "shop/api", Line: "started", Timestamp: ts, Stream: "stdout"})
+	sink.WriteLine(LogLine{Service: "shop/api", Line: "oops", Timestamp: ts, Stream: "stderr"})
+	// Close sends the queued lines
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushes) != 1 || len(pushes[0].Streams) != 2 {
+		t.Fatalf("expected one push with 2 streams, got %+v", pushes)
+	}
+	stdout := pushes[0].Streams[0]
+	want := map[string]string{"project": "shop", "service": "api", "stream": "stdout", "env": "dev"}
+	for k, v := range want {
+		if stdout.Stream[k] != v {
+			t.Errorf("expected label %s=%s, got %v", k, v, stdout.Stream)
+		}
+	}
+	if len(stdout.Values) != 1 || stdout.Values[0][0] != "1705314600000000000" || stdout.Values[0][1] != "started" {
+		t.Errorf("unexpected values: %v", stdout.Values)
+	}
+	if stderr := pushes[0].Streams[1]; stderr.Stream["stream"] != "stderr" || stderr.Values[0][1] != "oops" {
+		t.Errorf("unexpected stderr stream: %+v", stderr)
+	}
+}
+
+func TestGELFSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewLogSink("api", config.LogSinkConfig{
+		Driver:  config.LogDriverGELF,
+		URL:     "udp://" + conn.LocalAddr().String(),
+		Project: "shop",
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	ts := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	sink.WriteLine(LogLine{Service: "api", Line: "oops", Timestamp: ts, Stream: "stderr"})
+	sink.Close()
+
+	buf := make([]byte, gelfChunkSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		t.Fatalf("invalid message %q: %v", buf[:n], err)
+	}
+	want := map[string]any{
+		"version":       "1.1",
+		"short_message": "oops",
+		"timestamp":     float64(1705314600),
+		"level":         float64(gelfLevelError),
+		"_project":      "shop",
+		"_service":      "api",
+		"_stream":       "stderr",
+	}
+	for k, v := range want {
+		if msg[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, msg[k])
+		}
+	}
+}
+
+func TestWriteGELFChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	msg := []byte(strings.Repeat("x", gelfChunkSize*2))
+	if err := writeGELFChunks(client, msg); err != nil {
+		t.Fatalf("failed to write chunks: %v", err)
+	}
+
+	var got []byte
+	buf := make([]byte, gelfChunkSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 3; i++ {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read chunk %d: %v", i, err)
+		}
+		if buf[0] != 0x1e || buf[1] != 0x0f || buf[10] != byte(i) || buf[11] != 3 {
+			t.Fatalf("unexpected chunk header: % x", buf[:gelfChunkHeader])
+		}
+		got = append(got, buf[gelfChunkHeader:n]...)
+	}
+	if string(got) != string(msg) {
+		t.Errorf("reassembled message differs: %d bytes, expected %d", len(got), len(msg))
+	}
+}
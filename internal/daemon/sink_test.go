@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/logsink"
+)
+
+// memorySink records lines for tests.
+type memorySink struct {
+	mu     sync.Mutex
+	lines  []LogLine
+	closed bool
+}
+
+func (s *memorySink) WriteLine(line LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestLogManager_AddSink(t *testing.T) {
+	mgr := NewLogManager(10)
+	sink := &memorySink{}
+	mgr.AddSink("api", sink)
+
+	mgr.Writer("api").Write([]byte("hello\n"))
+	mgr.Writer("db").Write([]byte("other\n"))
+
+	if len(sink.lines) != 1 || sink.lines[0].Line != "hello" {
+		t.Errorf("expected sink to receive only api's line, got %+v", sink.lines)
+	}
+
+	// The in-memory history is kept regardless of additional sinks
+	if lines := mgr.GetLines([]string{"api"}, 10); len(lines) != 1 {
+		t.Errorf("expected 1 line in history, got %d", len(lines))
+	}
+
+	mgr.Close()
+	if !sink.closed {
+		t.Error("expected sink to be closed")
+	}
+}
+
+func TestLogManager_Mark(t *testing.T) {
+	mgr := NewLogManager(10)
+	sink := &memorySink{}
+	mgr.AddSink("api", sink)
+	ch := mgr.Subscribe([]string{"api"})
+	defer mgr.Unsubscribe(ch)
+
+	mgr.Writer("api").Write([]byte("hello\n"))
+	mgr.Mark("api", "--- api restarted (exit 1, attempt 1) ---")
+
+	lines := mgr.GetLines([]string{"api"}, 10)
+	if len(lines) != 2 || lines[1].Stream != StreamMarker || lines[1].Line != "--- api restarted (exit 1, attempt 1) ---" {
+		t.Errorf("expected the marker in history, got %+v", lines)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 2 lines for followers, got %d", i)
+		}
+	}
+	// Sinks only receive the service's output
+	if len(sink.lines) != 1 || sink.lines[0].Line != "hello" {
+		t.Errorf("expected the marker to be kept from sinks, got %+v", sink.lines)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewLogSink("api", config.LogSinkConfig{Driver: config.LogDriverFile, Path: "logs/api.log"}, dir)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	ts := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	sink.WriteLine(LogLine{Service: "api", Line: "started", Timestamp: ts, Stream: "stdout"})
+	sink.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "logs", "api.log"))
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	expected := "2024-01-15T10:30:00Z stdout started\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, string(data))
+	}
+}
+
+func TestCommandSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewLogSink("api", config.LogSinkConfig{Driver: config.LogDriverCommand, Command: "cat > out.log"}, dir)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	sink.WriteLine(LogLine{Service: "api", Line: "line 1", Timestamp: time.Now(), Stream: "stdout"})
+	sink.WriteLine(LogLine{Service: "api", Line: "line 2", Timestamp: time.Now(), Stream: "stdout"})
+	// Close waits for the command to consume all queued lines and exit
+	sink.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "out.log"))
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !strings.Contains(string(data), "line 1") || !strings.Contains(string(data), "line 2") {
+		t.Errorf("expected both lines in output, got %q", string(data))
+	}
+}
+
+func TestNewLogSink_Registered(t *testing.T) {
+	var got []logsink.Line
+	logsink.Register("test-memory", func(service string, cfg config.LogSinkConfig, baseDir string) (logsink.Sink, error) {
+		return funcSink(func(line logsink.Line) error {
+			got = append(got, line)
+			return nil
+		}), nil
+	})
+
+	// Custom drivers are accepted by config validation once registered
+	cfg, err := config.Parse([]byte(`
+services:
+  api:
+    command: echo hi
+    logging:
+      - driver: test-memory
+`))
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+
+	sink, err := NewLogSink("api", cfg.Services["api"].Logging[0], "")
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	at := time.Now()
+	if err := sink.WriteLine(LogLine{Service: "api", Line: "hi", Timestamp: at, Stream: "stdout", Color: 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := logsink.Line{Service: "api", Line: "hi", Timestamp: at, Stream: "stdout"}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("expected the registered sink to get %+v, got %+v", want, got)
+	}
+}
+
+// funcSink is a logsink.Sink that passes lines to a function.
+type funcSink func(line logsink.Line) error
+
+func (f funcSink) WriteLine(line logsink.Line) error { return f(line) }
+func (f funcSink) Close() error                      { return nil }
+
+func TestNewLogSink_UnknownDriver(t *testing.T) {
+	_, err := NewLogSink("api", config.LogSinkConfig{Driver: "nope"}, "")
+	if err == nil {
+		t.Error("expected error for unknown driver")
+	}
+}
@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// defaultSpillLimit is the maximum size of a subscriber's on-disk overflow
+// queue. Lines are dropped once it is full.
+const defaultSpillLimit = 64 << 20
+
+var errSpillFull = errors.New("spill file is full")
+
+// spillFile is a FIFO queue of log lines stored in an unlinked temporary file.
+// It absorbs bursts that a slow subscriber can't consume in time.
+// It is not safe for concurrent use.
+type spillFile struct {
+	file     *os.File
+	limit    int64
+	sizes    []int // Encoded size of each queued line, oldest first
+	readOff  int64
+	writeOff int64
+}
+
+func newSpillFile(limit int64) (*spillFile, error) {
+	file, err := os.CreateTemp("", "comproc-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	// Unlink right away so the file disappears with the daemon
+	os.Remove(file.Name())
+	return &spillFile{file: file, limit: limit}, nil
+}
+
+// push appends a line to the queue.
+func (q *spillFile) push(line LogLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if q.writeOff+int64(len(data)) > q.limit {
+		return errSpillFull
+	}
+	if _, err := q.file.WriteAt(data, q.writeOff); err != nil {
+		return err
+	}
+	q.writeOff += int64(len(data))
+	q.sizes = append(q.sizes, len(data))
+	return nil
+}
+
+// pop removes and returns the oldest line. The file is truncated whenever
+// the queue becomes empty, so its size only grows during a continuous burst.
+func (q *spillFile) pop() (LogLine, bool) {
+	for len(q.sizes) > 0 {
+		data := make([]byte, q.sizes[0])
+		_, err := q.file.ReadAt(data, q.readOff)
+		q.readOff += int64(len(data))
+		q.sizes = q.sizes[1:]
+		if len(q.sizes) == 0 {
+			q.readOff, q.writeOff = 0, 0
+			q.file.Truncate(0)
+		}
+
+		var line LogLine
+		if err == nil && json.Unmarshal(data, &line) == nil {
+			return line, true
+		}
+		// Skip unreadable entries
+	}
+	return LogLine{}, false
+}
+
+func (q *spillFile) close() error {
+	return q.file.Close()
+}
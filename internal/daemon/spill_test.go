@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSpillFile_FIFO(t *testing.T) {
+	q, err := newSpillFile(defaultSpillLimit)
+	if err != nil {
+		t.Fatalf("failed to create spill file: %v", err)
+	}
+	defer q.close()
+
+	for i := 0; i < 3; i++ {
+		if err := q.push(LogLine{Service: "api", Line: fmt.Sprintf("line %d", i)}); err != nil {
+			t.Fatalf("push failed: %v", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		line, ok := q.pop()
+		if !ok {
+			t.Fatalf("expected line %d", i)
+		}
+		if expected := fmt.Sprintf("line %d", i); line.Line != expected || line.Service != "api" {
+			t.Errorf("expected %q from api, got %+v", expected, line)
+		}
+	}
+
+	if _, ok := q.pop(); ok {
+		t.Error("expected queue to be empty")
+	}
+}
+
+func TestSpillFile_ReusesSpaceWhenDrained(t *testing.T) {
+	q, err := newSpillFile(200)
+	if err != nil {
+		t.Fatalf("failed to create spill file: %v", err)
+	}
+	defer q.close()
+
+	// Repeated bursts that each fit within the limit never fill the file
+	for i := 0; i < 10; i++ {
+		if err := q.push(LogLine{Line: "hello"}); err != nil {
+			t.Fatalf("push %d failed: %v", i, err)
+		}
+		if _, ok := q.pop(); !ok {
+			t.Fatalf("pop %d failed", i)
+		}
+	}
+
+	for {
+		if err := q.push(LogLine{Line: "hello"}); err != nil {
+			if err != errSpillFull {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			break
+		}
+	}
+}
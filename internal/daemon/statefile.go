@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// stateFileInterval is how often the state file is refreshed.
+const stateFileInterval = 500 * time.Millisecond
+
+// StateFilePath returns the path of the state file of the daemon listening
+// on socketPath. It lives next to the socket.
+func StateFilePath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".state.json"
+}
+
+// stateFile is the document written to the state file, for tools such as
+// shell prompts that read the state of the services without connecting to
+// the daemon.
+type stateFile struct {
+	PID       int            `json:"pid"` // PID of the daemon
+	Config    string         `json:"config"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Services  []stateService `json:"services"`
+}
+
+type stateService struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	PID      int    `json:"pid,omitempty"`
+	Health   string `json:"health,omitempty"`
+	Ready    bool   `json:"ready"`
+	Restarts int    `json:"restarts"`
+	Ports    []int  `json:"ports,omitempty"`
+}
+
+// writeStateFile keeps the state file at path up to date until ctx is done,
+// then removes it. The file is only rewritten when a service changes, and
+// is replaced atomically so readers never see a partial document.
+func (d *Daemon) writeStateFile(ctx context.Context, path string) {
+	defer os.Remove(path)
+
+	ticker := time.NewTicker(stateFileInterval)
+	defer ticker.Stop()
+	var last []byte
+	failing := false
+	for {
+		services := d.stateServices()
+		data, _ := json.Marshal(services)
+		if !bytes.Equal(data, last) {
+			if err := d.saveStateFile(path, services); err != nil {
+				// Report once rather than at every tick
+				if !failing {
+					fmt.Fprintf(os.Stderr, "comproc: %v\n", err)
+				}
+				failing = true
+			} else {
+				last = data
+				failing = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stateServices returns the state of each service for the state file.
+func (d *Daemon) stateServices() []stateService {
+	var services []stateService
+	for _, st := range d.GetStatus() {
+		services = append(services, stateService{
+			Name:     st.Name,
+			State:    st.State,
+			PID:      st.PID,
+			Health:   st.Health,
+			Ready:    st.Ready,
+			Restarts: st.Restarts,
+			Ports:    st.Ports,
+		})
+	}
+	return services
+}
+
+// saveStateFile replaces the state file with the given service states.
+func (d *Daemon) saveStateFile(path string, services []stateService) error {
+	data, err := json.MarshalIndent(stateFile{
+		PID:       os.Getpid(),
+		Config:    d.configPath,
+		UpdatedAt: time.Now(),
+		Services:  services,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateFilePath(t *testing.T) {
+	got := StateFilePath("/tmp/comproc-abc.sock")
+	if got != "/tmp/comproc-abc.state.json" {
+		t.Errorf("expected /tmp/comproc-abc.state.json, got %s", got)
+	}
+}
+
+func TestSaveStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comproc.state.json")
+	d := &Daemon{configPath: "/srv/app/comproc.yaml"}
+	services := []stateService{
+		{Name: "api", State: "running", PID: 42, Ready: true, Ports: []int{8080}},
+		{Name: "db", State: "stopped"},
+	}
+	if err := d.saveStateFile(path, services); err != nil {
+		t.Fatalf("saveStateFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got stateFile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid state file: %v\n%s", err, data)
+	}
+	if got.PID != os.Getpid() || got.Config != d.configPath || got.UpdatedAt.IsZero() {
+		t.Errorf("unexpected daemon fields: %+v", got)
+	}
+	if len(got.Services) != 2 || got.Services[0].PID != 42 || got.Services[0].Ports[0] != 8080 || got.Services[1].State != "stopped" {
+		t.Errorf("unexpected services: %+v", got.Services)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("expected the temporary file to be renamed")
+	}
+}
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ryym/comproc/internal/protocol"
+)
+
+// acceptStream starts serving a stream opened by a client. Failures are
+// reported by closing the stream with an error.
+func (s *Server) acceptStream(c *connection, st *protocol.Stream, open protocol.StreamOpen, readOnly bool) {
+	if readOnly {
+		st.CloseWithError(&protocol.Error{
+			Code:    protocol.MethodNotAllowed,
+			Message: fmt.Sprintf("stream %q is not allowed on a read-only socket", open.Kind),
+		})
+		return
+	}
+
+	switch open.Kind {
+	case protocol.StreamKindStdin:
+		go s.serveStream(st, func() error { return s.pipeStdin(st, open.Params) })
+	case protocol.StreamKindAttach:
+		go s.serveStream(st, func() error { return s.pipeAttachedStdin(c, st) })
+	case protocol.StreamKindRun, protocol.StreamKindExec:
+		o, err := acceptOneOff(c, open)
+		go s.serveStream(st, func() error {
+			if err != nil {
+				return err
+			}
+			return s.runOneOff(c, st, o, open.Kind)
+		})
+	case protocol.StreamKindStderr, protocol.StreamKindResize:
+		// Kept for the "run" or "exec" stream that names it
+		c.held[st.ID()] = heldStream{kind: open.Kind, stream: st}
+	default:
+		st.CloseWithError(&protocol.Error{
+			Code:    protocol.MethodNotFound,
+			Message: fmt.Sprintf("unknown stream kind %q", open.Kind),
+		})
+	}
+}
+
+// serveStream runs serve and closes the stream with its error. After a
+// failure, data the client still sends is discarded until it closes its
+// direction too.
+func (s *Server) serveStream(st *protocol.Stream, serve func() error) {
+	defer recoverPanic("stream handler")
+	if err := serve(); err != nil {
+		st.CloseWithError(err)
+		io.Copy(io.Discard, st)
+		return
+	}
+	st.Close()
+}
+
+// pipeStdin writes everything read from a "stdin" stream to the service's
+// stdin.
+func (s *Server) pipeStdin(st *protocol.Stream, rawParams json.RawMessage) error {
+	var params protocol.StdinParams
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return &protocol.Error{Code: protocol.InvalidParams, Message: err.Error()}
+	}
+	if params.Service == "" {
+		return &protocol.Error{Code: protocol.InvalidParams, Message: "service name is required"}
+	}
+
+	scoped, err := s.daemon.ScopeServices(params.ConfigPath, []string{params.Service}, false)
+	if err != nil {
+		return &protocol.Error{Code: scopeErrorCode(err), Message: err.Error()}
+	}
+	if len(scoped) != 1 {
+		return &protocol.Error{
+			Code:    protocol.InvalidParams,
+			Message: fmt.Sprintf("%q matches %d services; stdin takes one service", params.Service, len(scoped)),
+		}
+	}
+
+	buf := make([]byte, protocol.StreamChunkSize)
+	for {
+		n, err := st.Read(buf)
+		if n > 0 {
+			if err := s.daemon.WriteStdin(scoped[0], buf[:n]); err != nil {
+				return &protocol.Error{Code: protocol.ServiceError, Message: fmt.Sprintf("%s: %v", scoped[0], err)}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pipeAttachedStdin writes everything read from an "attach" stream to the
+// stdin of the service the client is attached to. Input is dropped while
+// the client may not send any, or the service is not running, as the
+// client stays attached either way.
+func (s *Server) pipeAttachedStdin(c *connection, st *protocol.Stream) error {
+	if c.attachment == nil {
+		return &protocol.Error{Code: protocol.InvalidRequest, Message: "not attached to a service"}
+	}
+	buf := make([]byte, protocol.StreamChunkSize)
+	for {
+		n, err := st.Read(buf)
+		if n > 0 {
+			s.daemon.WriteAttachedStdin(c.attachment, buf[:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
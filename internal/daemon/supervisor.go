@@ -2,25 +2,41 @@ package daemon
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
 	"sync"
 	"time"
 
-	"github.com/ryym/comproc/internal/config"
+	"github.com/ryym/comproc/config"
 	"github.com/ryym/comproc/internal/process"
 )
 
 const (
 	minBackoff = 1 * time.Second
 	maxBackoff = 30 * time.Second
+	// stableRun is how long a run without a readiness check must last to
+	// end a series of failures
+	stableRun = 10 * time.Second
 )
 
+// StateRestarting is the state reported for a service whose process has
+// exited while the supervisor waits out the backoff before restarting it.
+const StateRestarting = "restarting"
+
 // Supervisor monitors processes and handles restarts according to policy.
 type Supervisor struct {
 	mu sync.Mutex
 
 	daemon   *Daemon
 	monitors map[string]context.CancelFunc
+	pending  map[string]PendingRestart
+}
+
+// PendingRestart describes a restart the supervisor is waiting to make.
+type PendingRestart struct {
+	At      time.Time // When the restart is attempted
+	Attempt int       // Number of the attempt, counting all restarts of the service
 }
 
 // NewSupervisor creates a new supervisor.
@@ -28,9 +44,37 @@ func NewSupervisor(d *Daemon) *Supervisor {
 	return &Supervisor{
 		daemon:   d,
 		monitors: make(map[string]context.CancelFunc),
+		pending:  make(map[string]PendingRestart),
 	}
 }
 
+// Pending returns the restart the supervisor is waiting to make for a
+// service, if any.
+func (s *Supervisor) Pending(name string) (PendingRestart, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[name]
+	return p, ok
+}
+
+// setPending records a pending restart, unless monitoring was stopped. It
+// reports whether the restart was recorded.
+func (s *Supervisor) setPending(ctx context.Context, name string, p PendingRestart) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	s.pending[name] = p
+	return true
+}
+
+func (s *Supervisor) clearPending(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, name)
+}
+
 // StartMonitoring starts monitoring a process for restarts.
 func (s *Supervisor) StartMonitoring(ctx context.Context, name string, proc *process.Process, svc *config.Service) {
 	s.mu.Lock()
@@ -40,6 +84,7 @@ func (s *Supervisor) StartMonitoring(ctx context.Context, name string, proc *pro
 	if cancel, ok := s.monitors[name]; ok {
 		cancel()
 	}
+	delete(s.pending, name)
 
 	monitorCtx, cancel := context.WithCancel(ctx)
 	s.monitors[name] = cancel
@@ -56,12 +101,16 @@ func (s *Supervisor) StopMonitoring(name string) {
 		cancel()
 		delete(s.monitors, name)
 	}
+	delete(s.pending, name)
 }
 
 // monitor watches a process and restarts it according to policy.
 func (s *Supervisor) monitor(ctx context.Context, name string, proc *process.Process, svc *config.Service) {
+	defer recoverPanic(fmt.Sprintf("supervisor of %s", name))
+
 	policy := svc.GetRestartPolicy()
 	consecutiveFailures := 0
+	started := true // Whether the last attempt started a run
 
 	for {
 		// Wait for process to exit
@@ -74,6 +123,14 @@ func (s *Supervisor) monitor(ctx context.Context, name string, proc *process.Pro
 
 		state := proc.GetState()
 		exitCode := proc.GetExitCode()
+		signal := process.SignalName(proc.GetExitSignal())
+		s.daemon.history.Exited(name, exitCode, signal, proc.GetExitedAt())
+		s.daemon.journal.Record(name, journalExited, 0, exitCode, proc.GetRestarts())
+		event := config.PluginEventServiceExited
+		if exitCode != 0 || state == process.StateFailed {
+			event = config.PluginEventServiceFailed
+		}
+		s.daemon.emit(pluginEvent{Event: event, Service: name, ExitCode: exitCode, Signal: signal, Restarts: proc.GetRestarts()})
 
 		// Check if we should restart
 		shouldRestart := false
@@ -90,30 +147,69 @@ func (s *Supervisor) monitor(ctx context.Context, name string, proc *process.Pro
 			return
 		}
 
+		// A run that became ready or lasted came up fine, so the failures
+		// before it don't count towards max_retries
+		if started && (proc.GetHealth() == process.HealthHealthy || proc.GetExitedAt().Sub(proc.GetStartedAt()) >= stableRun) {
+			consecutiveFailures = 0
+		}
+
 		// Calculate backoff
 		consecutiveFailures++
+		if svc.MaxRetries > 0 && consecutiveFailures > svc.MaxRetries {
+			// Leave the service failed until it is started again
+			s.daemon.logMgr.Mark(name, fmt.Sprintf("--- %s gave up after %d retries ---", name, svc.MaxRetries))
+			return
+		}
 		backoff := calculateBackoff(consecutiveFailures)
 
-		// Wait before restart
+		// Wait before restart, reporting the service as restarting
+		pending := PendingRestart{At: time.Now().Add(backoff), Attempt: proc.GetRestarts() + 1}
+		if s.setPending(ctx, name, pending) {
+			s.daemon.emit(pluginEvent{Event: config.PluginEventServiceRestarting, Service: name, Restarts: proc.GetRestarts(), NextRestartAt: pending.At})
+		}
 		select {
 		case <-ctx.Done():
 			return
 		case <-time.After(backoff):
 		}
+		s.clearPending(name)
 
 		// Restart the process
 		proc.IncrementRestarts()
-		logWriter := s.daemon.logMgr.Writer(name)
-		proc.SetOutput(logWriter, logWriter)
+		s.daemon.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (%s, attempt %d) ---", name, exitDescription(exitCode, signal), proc.GetRestarts()))
+		proc.SetOutput(s.daemon.logMgr.Writer(name), s.daemon.logMgr.ErrWriter(name))
 
-		if err := proc.Start(ctx); err != nil {
+		env, err := s.daemon.runtimeEnv(name)
+		if err == nil {
+			proc.SetExtraEnv(env)
+			err = proc.Start(ctx)
+		}
+		if err != nil {
+			s.daemon.history.FailedToStart(name, runReasonPolicy, proc.GetExitCode(), err)
+			s.daemon.emit(pluginEvent{Event: config.PluginEventServiceFailed, Service: name, Restarts: proc.GetRestarts(), Error: err.Error()})
+			var prereqErr *process.PrerequisiteError
+			if errors.As(err, &prereqErr) {
+				// Restarting won't help until the prerequisites are met
+				return
+			}
 			// Failed to restart, will try again
+			started = false
 			continue
 		}
+		started = true
+		s.daemon.history.Started(name, runReasonPolicy, proc.GetStartedAt())
+		s.daemon.journal.Record(name, journalRestarted, proc.PID(), 0, proc.GetRestarts())
+		s.daemon.emit(pluginEvent{Event: config.PluginEventServiceStarted, Service: name, PID: proc.PID(), Restarts: proc.GetRestarts()})
+		s.daemon.restartDependents(name)
+	}
+}
 
-		// Reset failure count on successful start
-		// (we'll increment again if it fails quickly)
+// exitDescription describes how a process exited, for restart markers.
+func exitDescription(exitCode int, signal string) string {
+	if signal != "" {
+		return "killed by " + signal
 	}
+	return fmt.Sprintf("exit %d", exitCode)
 }
 
 // calculateBackoff returns the backoff duration using exponential backoff.
@@ -1,8 +1,11 @@
 package daemon
 
 import (
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ryym/comproc/internal/process"
 )
 
 func TestCalculateBackoff(t *testing.T) {
@@ -29,3 +32,132 @@ func TestCalculateBackoff(t *testing.T) {
 		})
 	}
 }
+
+func TestExitDescription(t *testing.T) {
+	if got := exitDescription(1, ""); got != "exit 1" {
+		t.Errorf("expected exit 1, got %q", got)
+	}
+	if got := exitDescription(-1, "SIGKILL"); got != "killed by SIGKILL" {
+		t.Errorf("expected killed by SIGKILL, got %q", got)
+	}
+}
+
+func TestSupervisor_ReportsPendingRestart(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+services:
+  flaky:
+    command: exit 1
+    restart: on-failure
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	d.StartServices(nil)
+
+	var status ServiceStatus
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		status = d.GetStatus()[0]
+		if status.State == StateRestarting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the restarting state, got %q", status.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if wait := time.Until(status.NextRestart); wait <= 0 || wait > maxBackoff {
+		t.Errorf("expected the next restart within the backoff, got %v", wait)
+	}
+	if status.RestartAttempt != status.Restarts+1 {
+		t.Errorf("expected attempt %d, got %d", status.Restarts+1, status.RestartAttempt)
+	}
+
+	// Stopping the service cancels the restart
+	if stopped := d.StopServices([]string{"flaky"}); len(stopped) != 1 {
+		t.Fatalf("expected flaky to be stopped, got %v", stopped)
+	}
+	if state := d.GetStatus()[0].State; state == StateRestarting {
+		t.Errorf("expected the restart to be cancelled, got %q", state)
+	}
+	restarts := d.GetStatus()[0].Restarts
+	time.Sleep(time.Until(status.NextRestart) + 200*time.Millisecond)
+	if got := d.GetStatus()[0].Restarts; got != restarts {
+		t.Errorf("expected no restart after stop, got %d restarts", got)
+	}
+}
+
+func TestSupervisor_GivesUpAfterMaxRetries(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+services:
+  flaky:
+    command: exit 1
+    restart: on-failure
+    max_retries: 1
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	d.StartServices(nil)
+
+	const marker = "--- flaky gave up after 1 retries ---"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lines := d.GetLogs([]string{"flaky"}, time.Time{}, 10, LogFilter{})
+		if len(lines) > 0 && lines[len(lines)-1].Line == marker {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the supervisor to give up, got %v", lines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := d.GetStatus()[0]
+	if status.State != string(process.StateFailed) || status.Restarts != 1 {
+		t.Errorf("expected failed after 1 restart, got %q after %d", status.State, status.Restarts)
+	}
+	if _, ok := d.supervisor.Pending("flaky"); ok {
+		t.Error("expected no pending restart")
+	}
+}
+
+func TestSupervisor_RecoveryResetsRetries(t *testing.T) {
+	// The first run fails, the second becomes ready and then fails, and
+	// the third keeps running
+	path := writeConfig(t, t.TempDir(), `
+services:
+  flaky:
+    command: sh -c 'case $COMPROC_RESTARTS in 0) exit 1;; 1) echo up; sleep 0.2; exit 1;; *) echo up; sleep 60;; esac'
+    restart: on-failure
+    max_retries: 1
+    ready_log_pattern: up
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+	d.StartServices(nil)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := d.GetStatus()[0]
+		if status.Restarts == 2 && status.State == string(process.StateRunning) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the third run, got %q after %d restarts", status.State, status.Restarts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, line := range d.GetLogs([]string{"flaky"}, time.Time{}, 20, LogFilter{}) {
+		if strings.Contains(line.Line, "gave up") {
+			t.Errorf("expected the supervisor not to give up, got %q", line.Line)
+		}
+	}
+}
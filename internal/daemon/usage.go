@@ -0,0 +1,181 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/config"
+	"github.com/ryym/comproc/internal/process"
+)
+
+// usageSampleInterval is how often the CPU and memory use of running
+// services is sampled.
+const usageSampleInterval = 2 * time.Second
+
+// usageSample is the resource use of a service's process group at a time.
+type usageSample struct {
+	pid   int
+	at    time.Time
+	usage process.Usage
+	cpu   float64 // Percent of one core used since the previous sample
+}
+
+// usageSamples holds the latest sample of each running service.
+type usageSamples struct {
+	mu      sync.Mutex
+	samples map[string]usageSample
+}
+
+// get returns the latest sample of a service, if it was taken from its
+// current process.
+func (s *usageSamples) get(name string, pid int) (usageSample, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample, ok := s.samples[name]
+	return sample, ok && pid != 0 && sample.pid == pid
+}
+
+// memUsage is a sample of a service that uses more memory than its limit.
+type memUsage struct {
+	name   string
+	pid    int
+	memory int64
+	limit  int64
+}
+
+// watchUsage samples the CPU and memory use of running services until ctx
+// is done, for `status`, and restarts services whose memory use exceeds
+// their mem_restart_limit, so that leaky services are contained during long
+// sessions.
+func (d *Daemon) watchUsage(ctx context.Context) {
+	defer recoverPanic("usage watchdog")
+
+	ticker := time.NewTicker(usageSampleInterval)
+	defer ticker.Stop()
+	for {
+		d.sampleUsage(time.Now())
+		for _, u := range d.overMemLimit() {
+			d.restartForMemory(u)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleUsage samples the process groups of all running services at once.
+// The CPU use of a service is measured since its previous sample, or since
+// it started for the first sample of a run.
+func (d *Daemon) sampleUsage(now time.Time) {
+	type running struct {
+		name      string
+		pid       int
+		startedAt time.Time
+	}
+	var procs []running
+	var pids []int
+	d.mu.RLock()
+	for _, name := range d.serviceOrder {
+		proc := d.processes[name]
+		if pid := proc.PID(); pid != 0 && proc.GetState() == process.StateRunning {
+			procs = append(procs, running{name: name, pid: pid, startedAt: proc.GetStartedAt()})
+			pids = append(pids, pid)
+		}
+	}
+	d.mu.RUnlock()
+
+	usages, err := process.GroupUsage(pids)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "comproc: failed to sample resource use: %v\n", err)
+		return
+	}
+
+	d.usage.mu.Lock()
+	defer d.usage.mu.Unlock()
+	samples := make(map[string]usageSample, len(procs))
+	for _, p := range procs {
+		usage, ok := usages[p.pid]
+		if !ok {
+			// The process exited since it was listed
+			continue
+		}
+		sample := usageSample{pid: p.pid, at: now, usage: usage}
+		prev, since, used := d.usage.samples[p.name], p.startedAt, usage.CPU
+		if prev.pid == p.pid {
+			since, used = prev.at, usage.CPU-prev.usage.CPU
+		}
+		if elapsed := now.Sub(since); elapsed > 0 && used > 0 {
+			sample.cpu = float64(used) / float64(elapsed) * 100
+		}
+		samples[p.name] = sample
+	}
+	d.usage.samples = samples
+}
+
+// overMemLimit returns the running services that have a mem_restart_limit
+// and were over it in the latest sample.
+func (d *Daemon) overMemLimit() []memUsage {
+	var over []memUsage
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, name := range d.serviceOrder {
+		proc := d.processes[name]
+		limit := proc.Service.GetMemLimit()
+		if limit <= 0 {
+			continue
+		}
+		sample, ok := d.usage.get(name, proc.PID())
+		if ok && sample.usage.Memory > limit {
+			over = append(over, memUsage{name: name, pid: sample.pid, memory: sample.usage.Memory, limit: limit})
+		}
+	}
+	return over
+}
+
+// restartForMemory restarts a service that uses more memory than its limit,
+// along with its dependents as by `restart`.
+func (d *Daemon) restartForMemory(u memUsage) {
+	msg := fmt.Sprintf("memory use %s over mem_restart_limit %s", formatMemory(u.memory), formatMemory(u.limit))
+	fmt.Fprintf(os.Stderr, "comproc: %s: %s, restarting\n", u.name, msg)
+	d.emit(pluginEvent{Event: config.PluginEventServiceMemLimit, Service: u.name, PID: u.pid, Memory: u.memory, MemLimit: u.limit})
+
+	stopped := d.StopServices([]string{u.name})
+	var dependents []string
+	for _, name := range stopped {
+		if name == u.name {
+			d.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (%s) ---", name, msg))
+		} else {
+			d.logMgr.Mark(name, fmt.Sprintf("--- %s restarted (%s restarted) ---", name, u.name))
+			dependents = append(dependents, name)
+		}
+	}
+	if len(stopped) == len(dependents) {
+		// Stopped by a command in the meantime
+		return
+	}
+	d.mu.RLock()
+	d.processes[u.name].IncrementRestarts()
+	d.mu.RUnlock()
+	d.startServices([]string{u.name}, runReasonMemory)
+	if len(dependents) > 0 {
+		d.startServices(dependents, runReasonDependency)
+	}
+}
+
+// formatMemory formats a byte count with a binary unit, e.g. "1.5 GiB".
+func formatMemory(n int64) string {
+	units := []string{"KiB", "MiB", "GiB"}
+	value := float64(n) / 1024
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
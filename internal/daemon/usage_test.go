@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampleUsage(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+services:
+  api:
+    command: sleep 60
+  once:
+    command: "true"
+`)
+	d, err := New(path, nil, "")
+	if err != nil {
+		t.Fatalf("failed to create daemon: %v", err)
+	}
+	defer d.StopAll()
+
+	// Not sampled before the services run
+	d.sampleUsage(time.Now())
+	if st := d.GetStatus()[0]; st.CPU != nil || st.Memory != 0 {
+		t.Errorf("expected no usage before starting, got %+v", st)
+	}
+
+	if _, failed, _ := d.StartServices(nil); len(failed) > 0 {
+		t.Fatalf("failed to start services: %v", failed)
+	}
+	time.Sleep(100 * time.Millisecond)
+	d.sampleUsage(time.Now())
+
+	api := d.GetStatus()[0]
+	if api.CPU == nil || *api.CPU < 0 || api.Memory == 0 {
+		t.Errorf("expected api to be sampled, got CPU %v, memory %d", api.CPU, api.Memory)
+	}
+	if once := d.GetStatus()[1]; once.CPU != nil || once.Memory != 0 {
+		t.Errorf("expected no usage for an exited service, got %+v", once)
+	}
+
+	// A sample of a previous run is not shown for the next one
+	d.StopServices([]string{"api"})
+	if st := d.GetStatus()[0]; st.CPU != nil || st.Memory != 0 {
+		t.Errorf("expected no usage after stopping, got %+v", st)
+	}
+}
@@ -0,0 +1,63 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+// startExternal "starts" an external service: nothing is run, but the
+// service is considered running until stopped and its address is checked
+// like a readiness check. Called with p.mu held.
+func (p *Process) startExternal(ctx context.Context) {
+	p.startedAt = time.Now()
+	p.State = StateRunning
+	p.settled = make(chan struct{})
+	p.health = HealthStarting
+	go p.checkHealth(ctx, p.settled, p.done)
+
+	done := p.done
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.State = StateStopped
+		close(done)
+	}()
+}
+
+// probeExternal checks once whether the address of an external service is
+// reachable: a TCP connection can be opened, or an HTTP(S) URL responds
+// with a status below 400.
+func probeExternal(ctx context.Context, address string) error {
+	u, err := config.ParseExternal(address)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "tcp" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
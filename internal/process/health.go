@@ -0,0 +1,270 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health represents the result of a service's readiness check.
+type Health string
+
+const (
+	// HealthNone means the service has no readiness check.
+	HealthNone Health = ""
+	// HealthStarting means the check has not passed yet.
+	HealthStarting Health = "starting"
+	// HealthHealthy means the last check passed.
+	HealthHealthy Health = "healthy"
+	// HealthUnhealthy means the check failed too many times in a row.
+	HealthUnhealthy Health = "unhealthy"
+)
+
+// GetHealth returns the readiness check result of the current run.
+func (p *Process) GetHealth() Health {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.health
+}
+
+// IsReady reports whether the process is running and, if the service has a
+// readiness check, the check has passed.
+func (p *Process) IsReady() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.isReady()
+}
+
+func (p *Process) isReady() bool {
+	if p.State != StateRunning {
+		return false
+	}
+	return p.health == HealthNone || p.health == HealthHealthy
+}
+
+// WaitReady blocks until the current run becomes ready. It returns an error
+// if the process exits or becomes unhealthy first, or if ctx is done.
+func (p *Process) WaitReady(ctx context.Context) error {
+	p.mu.RLock()
+	settled, done := p.settled, p.done
+	p.mu.RUnlock()
+
+	if settled == nil {
+		return errors.New("process has not been started")
+	}
+
+	select {
+	case <-settled:
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.isReady() {
+		return nil
+	}
+	if p.health == HealthUnhealthy {
+		return errors.New("readiness check failed")
+	}
+	return fmt.Errorf("process is %s", p.State)
+}
+
+// setHealth updates the health of the run identified by settled, ignoring
+// results that arrive after the process has been restarted.
+func (p *Process) setHealth(settled chan struct{}, health Health) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.settled != settled {
+		return
+	}
+	p.health = health
+	if health != HealthStarting {
+		select {
+		case <-settled:
+		default:
+			close(settled)
+		}
+	}
+}
+
+// checkHealth runs the service's readiness check periodically until the
+// process exits. The first check runs immediately after the process starts.
+func (p *Process) checkHealth(ctx context.Context, settled, done chan struct{}) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	hc := p.Service.ReadinessCheck()
+	failures := 0
+	healthy := false
+	// Failures are not counted until the start period ends or a check passes
+	grace := time.Now().Add(time.Duration(hc.StartPeriod))
+
+	ticker := time.NewTicker(hc.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		if err := p.runCheck(ctx); err == nil {
+			failures = 0
+			grace = time.Time{}
+			if !healthy {
+				healthy = true
+				p.setHealth(settled, HealthHealthy)
+			}
+		} else if ctx.Err() == nil && time.Now().After(grace) {
+			failures++
+			if failures >= hc.GetRetries() {
+				healthy = false
+				p.setHealth(settled, HealthUnhealthy)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runCheck runs the readiness check command once. External services are
+// checked by connecting to their address.
+func (p *Process) runCheck(ctx context.Context) error {
+	hc := p.Service.ReadinessCheck()
+	ctx, cancel := context.WithTimeout(ctx, hc.GetTimeout())
+	defer cancel()
+
+	if hc.WaitForFile != "" {
+		return p.checkFile(hc.WaitForFile)
+	}
+	if p.Service.IsExternal() {
+		return probeExternal(ctx, p.Service.External)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hc.Command)
+	cmd.Dir = p.Service.WorkingDir
+	cmd.Env = p.environ()
+	return cmd.Run()
+}
+
+// checkFile returns an error unless path exists. Variables in path are
+// expanded from the service's environment, and relative paths are resolved
+// against its working directory.
+func (p *Process) checkFile(path string) error {
+	env := make(map[string]string)
+	for _, kv := range p.environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	path = os.Expand(path, func(key string) string { return env[key] })
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.Service.WorkingDir, path)
+	}
+	_, err := os.Stat(path)
+	return err
+}
+
+// maxMatchLine is the length after which a line without a newline is matched
+// as it is, so that output without newlines doesn't grow the buffer.
+const maxMatchLine = 64 * 1024
+
+// ansiEscape matches terminal escape sequences such as colors, which are
+// removed from lines before matching.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// logMatcher marks a run ready once a line of its output matches the
+// service's ready_log_pattern.
+type logMatcher struct {
+	p       *Process
+	pattern *regexp.Regexp
+	settled chan struct{}
+
+	mu      sync.Mutex
+	matched bool
+}
+
+func (p *Process) newLogMatcher(settled chan struct{}) (*logMatcher, error) {
+	pattern, err := regexp.Compile(p.Service.ReadyLogPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ready_log_pattern: %w", err)
+	}
+	return &logMatcher{p: p, pattern: pattern, settled: settled}, nil
+}
+
+// writer returns a writer that passes output through to w, matching each
+// line until a line has matched.
+func (m *logMatcher) writer(w io.Writer) io.Writer {
+	if w == nil {
+		w = io.Discard
+	}
+	return &matchWriter{m: m, w: w}
+}
+
+// match checks a line of output, and marks the run ready if it matches.
+func (m *logMatcher) match(line []byte) {
+	line = ansiEscape.ReplaceAll(line, nil)
+	if !m.pattern.Match(line) {
+		return
+	}
+	m.mu.Lock()
+	m.matched = true
+	m.mu.Unlock()
+	m.p.setHealth(m.settled, HealthHealthy)
+}
+
+func (m *logMatcher) done() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.matched
+}
+
+// matchWriter is one output stream of a logMatcher, which buffers the
+// stream's partial line.
+type matchWriter struct {
+	m    *logMatcher
+	w    io.Writer
+	line []byte
+}
+
+func (mw *matchWriter) Write(data []byte) (int, error) {
+	n, err := mw.w.Write(data)
+	if mw.m.done() {
+		mw.line = nil
+		return n, err
+	}
+
+	mw.line = append(mw.line, data...)
+	for {
+		i := bytes.IndexByte(mw.line, '\n')
+		if i < 0 {
+			break
+		}
+		mw.m.match(bytes.TrimSuffix(mw.line[:i], []byte("\r")))
+		mw.line = mw.line[i+1:]
+	}
+	if len(mw.line) > maxMatchLine {
+		mw.m.match(mw.line)
+		mw.line = nil
+	}
+	// Keep the partial line in a buffer of its own rather than the tail
+	// of everything written so far
+	mw.line = append([]byte(nil), mw.line...)
+	return n, err
+}
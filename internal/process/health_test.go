@@ -0,0 +1,316 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestProcess_ReadyWithoutHealthcheck(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Command: "sleep 10",
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	if err := proc.WaitReady(context.Background()); err != nil {
+		t.Fatalf("expected process to be ready, got %v", err)
+	}
+	if proc.GetHealth() != HealthNone {
+		t.Errorf("expected no health, got %q", proc.GetHealth())
+	}
+}
+
+func TestProcess_HealthcheckBecomesReady(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Command:    "sleep 0.3; touch ready; sleep 10",
+		WorkingDir: dir,
+		Healthcheck: &config.Healthcheck{
+			Command:  "test -f ready",
+			Interval: config.Duration(50 * time.Millisecond),
+			Retries:  100,
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	if proc.IsReady() {
+		t.Error("expected process not to be ready before the check passes")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err != nil {
+		t.Fatalf("expected process to become ready, got %v", err)
+	}
+	if proc.GetHealth() != HealthHealthy {
+		t.Errorf("expected health to be healthy, got %q", proc.GetHealth())
+	}
+	if !proc.IsReady() {
+		t.Error("expected process to be ready")
+	}
+}
+
+func TestProcess_WaitForFile(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Command:    "sleep 0.3; mkdir run; touch run/app.pid; sleep 10",
+		WorkingDir: dir,
+		Env:        map[string]string{"RUN_DIR": "run"},
+		Healthcheck: &config.Healthcheck{
+			WaitForFile: "$RUN_DIR/app.pid",
+			Interval:    config.Duration(50 * time.Millisecond),
+			Retries:     100,
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	if proc.IsReady() {
+		t.Error("expected process not to be ready before the file exists")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err != nil {
+		t.Fatalf("expected process to become ready, got %v", err)
+	}
+}
+
+func TestProcess_ReadyLogPattern(t *testing.T) {
+	var out bytes.Buffer
+	svc := &config.Service{
+		Name: "test",
+		// The matching line is colored and written in two parts
+		Command:         `sleep 0.3; printf 'compiling\n\033[32mListening'; sleep 0.1; printf ' on 8080\033[0m\n'; sleep 10`,
+		ReadyLogPattern: `^Listening on \d+$`,
+	}
+
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	if proc.IsReady() || proc.GetHealth() != HealthStarting {
+		t.Errorf("expected process not to be ready before the line, got %q", proc.GetHealth())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err != nil {
+		t.Fatalf("expected process to become ready, got %v", err)
+	}
+	if !strings.Contains(out.String(), "compiling\n") {
+		t.Errorf("expected output to be passed through, got %q", out.String())
+	}
+}
+
+func TestProcess_ExternalWaitForSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "db.sock")
+	svc := &config.Service{
+		Name:     "db",
+		External: "localhost:1", // Not probed
+		Healthcheck: &config.Healthcheck{
+			WaitForFile: sock,
+			Interval:    config.Duration(50 * time.Millisecond),
+			Retries:     100,
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	time.Sleep(100 * time.Millisecond)
+	if proc.IsReady() {
+		t.Fatal("expected the service not to be ready before the socket exists")
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err != nil {
+		t.Fatalf("expected the service to become ready, got %v", err)
+	}
+}
+
+func TestProcess_HealthcheckUnhealthy(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Command: "sleep 10",
+		Healthcheck: &config.Healthcheck{
+			Command:  "false",
+			Interval: config.Duration(20 * time.Millisecond),
+			Retries:  2,
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err == nil {
+		t.Fatal("expected an error for a failing check")
+	}
+	if proc.GetHealth() != HealthUnhealthy {
+		t.Errorf("expected health to be unhealthy, got %q", proc.GetHealth())
+	}
+	if proc.GetState() != StateRunning {
+		t.Errorf("expected process to keep running, got %s", proc.GetState())
+	}
+}
+
+func TestProcess_HealthcheckStartPeriod(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Command: "sleep 10",
+		Healthcheck: &config.Healthcheck{
+			Command:     "false",
+			Interval:    config.Duration(20 * time.Millisecond),
+			Retries:     2,
+			StartPeriod: config.Duration(300 * time.Millisecond),
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	// Failures within the start period are not counted
+	time.Sleep(150 * time.Millisecond)
+	if proc.GetHealth() != HealthStarting {
+		t.Errorf("expected health to be starting within the start period, got %q", proc.GetHealth())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err == nil {
+		t.Fatal("expected an error for a failing check after the start period")
+	}
+	if proc.GetHealth() != HealthUnhealthy {
+		t.Errorf("expected health to be unhealthy, got %q", proc.GetHealth())
+	}
+}
+
+func TestProcess_WaitReadyExited(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Command: "exit 1",
+		Healthcheck: &config.Healthcheck{
+			Command:  "false",
+			Interval: config.Duration(time.Minute),
+			Retries:  100,
+		},
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err == nil {
+		t.Fatal("expected an error when the process exits before becoming ready")
+	}
+}
+
+func TestProcess_External(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	svc := &config.Service{
+		Name:     "db",
+		External: ln.Addr().String(),
+	}
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start external service: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err != nil {
+		t.Fatalf("expected external service to become ready, got %v", err)
+	}
+	if proc.PID() != 0 {
+		t.Errorf("expected no PID, got %d", proc.PID())
+	}
+
+	if err := proc.Stop(time.Second); err != nil {
+		t.Fatalf("failed to stop external service: %v", err)
+	}
+	if proc.GetState() != StateStopped {
+		t.Errorf("expected stopped, got %s", proc.GetState())
+	}
+}
+
+func TestProcess_ExternalUnreachable(t *testing.T) {
+	// Take a free port and release it so nothing listens there
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	svc := &config.Service{
+		Name:     "db",
+		External: "tcp://" + addr,
+		Healthcheck: &config.Healthcheck{
+			Interval: config.Duration(20 * time.Millisecond),
+			Retries:  2,
+		},
+	}
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start external service: %v", err)
+	}
+	defer proc.Stop(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proc.WaitReady(ctx); err == nil {
+		t.Fatal("expected an error for an unreachable address")
+	}
+	if proc.GetHealth() != HealthUnhealthy {
+		t.Errorf("expected health to be unhealthy, got %q", proc.GetHealth())
+	}
+}
@@ -0,0 +1,38 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ryym/comproc/config"
+)
+
+// IsolateInitCommand is the hidden comproc command that runs as the init
+// process of a service with isolate. It sets up the namespaces it was
+// started in, runs the service's command, and exits with its status, which
+// ends every process left in a PID namespace:
+//
+//	comproc __isolate <namespaces> <stop mode> <path> [args...]
+const IsolateInitCommand = "__isolate"
+
+// RunIsolateInit runs the init process of an isolated service with the
+// arguments following IsolateInitCommand, and returns its exit code.
+func RunIsolateInit(args []string) int {
+	code, err := runIsolateInit(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "comproc: isolate: %v\n", err)
+		return 127
+	}
+	return code
+}
+
+// isolateInitArgs returns the arguments that run the command path with args
+// under the init process of an isolated service.
+func isolateInitArgs(exe string, svc *config.Service, path string, args []string) []string {
+	names := make([]string, len(svc.Isolate))
+	for i, ns := range svc.Isolate {
+		names[i] = string(ns)
+	}
+	return append([]string{exe, IsolateInitCommand, strings.Join(names, ","), string(svc.GetStopMode()), path}, args...)
+}
@@ -0,0 +1,185 @@
+//go:build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/ryym/comproc/config"
+)
+
+// cloneFlags maps namespaces to the flags that create them.
+var cloneFlags = map[config.Namespace]uintptr{
+	config.NamespacePID:   syscall.CLONE_NEWPID,
+	config.NamespaceMount: syscall.CLONE_NEWNS,
+	config.NamespaceNet:   syscall.CLONE_NEWNET,
+}
+
+// Capabilities the init process needs to set up the namespaces.
+const (
+	capNetAdmin = 12
+	capSysAdmin = 21
+)
+
+// isolate makes cmd run under the init process (comproc __isolate) in new
+// namespaces. Users other than root can only create namespaces within a
+// user namespace of their own, in which they keep their IDs; the init
+// process gets the capabilities it needs as ambient ones, which it drops
+// before starting the command.
+func isolate(cmd *exec.Cmd, svc *config.Service) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the comproc executable: %w", err)
+	}
+
+	attr := cmd.SysProcAttr
+	for _, ns := range svc.Isolate {
+		attr.Cloneflags |= cloneFlags[ns]
+	}
+	if uid, gid := os.Geteuid(), os.Getegid(); uid != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+		attr.AmbientCaps = []uintptr{capSysAdmin, capNetAdmin}
+	}
+
+	cmd.Args = isolateInitArgs(exe, svc, cmd.Path, cmd.Args[1:])
+	cmd.Path = exe
+	return nil
+}
+
+// runIsolateInit sets up the namespaces named by args[0] and runs the
+// command in args[2:] until it exits. Stop signals reach the command
+// directly as it stays in the process group of the init process, except
+// with the leader stop mode (args[1]), in which case they are forwarded.
+func runIsolateInit(args []string) (int, error) {
+	if len(args) < 3 {
+		return 0, errors.New("usage: comproc __isolate <namespaces> <stop mode> <path> [args...]")
+	}
+	var namespaces config.Isolation
+	for _, ns := range strings.Split(args[0], ",") {
+		namespaces = append(namespaces, config.Namespace(ns))
+	}
+	leader := config.StopMode(args[1]) == config.StopModeLeader
+
+	if namespaces.Has(config.NamespaceMount) {
+		// Keep the mounts made here from propagating to the host
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			return 0, fmt.Errorf("failed to make mounts private: %w", err)
+		}
+		if namespaces.Has(config.NamespacePID) {
+			if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+				return 0, fmt.Errorf("failed to mount /proc: %w", err)
+			}
+		}
+	}
+	if namespaces.Has(config.NamespaceNet) {
+		if err := loopbackUp(); err != nil {
+			return 0, fmt.Errorf("failed to bring up the loopback interface: %w", err)
+		}
+	}
+	// Capabilities belong to threads, and the command is started by the
+	// thread that drops them
+	runtime.LockOSThread()
+	if err := clearAmbientCaps(); err != nil {
+		return 0, fmt.Errorf("failed to drop capabilities: %w", err)
+	}
+
+	// Catching the signals keeps them from ending the init process before
+	// the command
+	signals := make(chan os.Signal, 8)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	cmd := exec.Command(args[2], args[3:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	child := cmd.Process.Pid
+
+	// As PID 1, the init process also inherits orphaned processes, which
+	// are reaped along with the command
+	exited := make(chan syscall.WaitStatus, 1)
+	go func() {
+		for {
+			var ws syscall.WaitStatus
+			pid, err := syscall.Wait4(-1, &ws, 0, nil)
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			if err != nil || pid == child {
+				exited <- ws
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case sig := <-signals:
+			if leader {
+				syscall.Kill(child, sig.(syscall.Signal))
+			}
+		case ws := <-exited:
+			// PID 1 can't be ended by a signal from inside its namespace,
+			// so a signal is reported as a shell would
+			if ws.Signaled() {
+				return 128 + int(ws.Signal()), nil
+			}
+			return ws.ExitStatus(), nil
+		}
+	}
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace,
+// which starts out down.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq with ifr_flags
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// clearAmbientCaps drops the ambient capabilities of the current thread, so
+// that commands it starts don't inherit those given to the init process.
+func clearAmbientCaps() error {
+	const (
+		prCapAmbient         = 47
+		prCapAmbientClearAll = 4
+	)
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
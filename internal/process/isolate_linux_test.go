@@ -0,0 +1,129 @@
+//go:build linux
+
+package process
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+// TestMain lets the test binary act as the init process of isolated
+// services, which is the comproc executable otherwise.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == IsolateInitCommand {
+		os.Exit(RunIsolateInit(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+// skipIfNoNamespaces skips the test if the kernel doesn't let the current
+// user create namespaces.
+func skipIfNoNamespaces(t *testing.T) {
+	t.Helper()
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		t.Skip("namespaces are not supported")
+	}
+	if data, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(data)) == "0" {
+		t.Skip("user namespaces are disabled")
+	}
+}
+
+func TestProcess_Isolate(t *testing.T) {
+	skipIfNoNamespaces(t)
+
+	svc := &config.Service{
+		Name:    "test",
+		Command: `echo "comm=$(cat /proc/1/comm)"; grep -c : /proc/net/dev; exit 3`,
+		Isolate: config.Isolation{config.NamespacePID, config.NamespaceMount, config.NamespaceNet},
+	}
+
+	var out bytes.Buffer
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+
+	// The init process is PID 1, and the network has only a loopback
+	// interface
+	want := "comm=process.test\n1\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+	if code := proc.GetExitCode(); code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+}
+
+func TestProcess_IsolateKillsEscapedChildren(t *testing.T) {
+	skipIfNoNamespaces(t)
+
+	// The first sleep leaves the process group, so the stop signals don't
+	// reach it
+	svc := &config.Service{
+		Name:    "test",
+		Command: "setsid sleep 60 & sleep 60",
+		Isolate: config.Isolation{config.NamespacePID},
+	}
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", proc.PID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The init process, sh, and both sleeps
+	var members []int
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if members = namespaceMembers(t, ns); len(members) >= 4 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(members) < 4 {
+		t.Fatalf("expected 4 processes in the namespace, got %v", members)
+	}
+
+	proc.Stop(5 * time.Second)
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(namespaceMembers(t, ns)) == 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("expected every process in the namespace to be killed, got %v", namespaceMembers(t, ns))
+}
+
+// namespaceMembers returns the PIDs of the processes in a PID namespace,
+// identified by the target of its /proc/<pid>/ns/pid link.
+func namespaceMembers(t *testing.T, ns string) []int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if link, err := os.Readlink("/proc/" + e.Name() + "/ns/pid"); err == nil && link == ns {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/ryym/comproc/config"
+)
+
+var errIsolateUnsupported = errors.New("isolate is only supported on Linux")
+
+func isolate(cmd *exec.Cmd, svc *config.Service) error {
+	return errIsolateUnsupported
+}
+
+func runIsolateInit(args []string) (int, error) {
+	return 0, errIsolateUnsupported
+}
@@ -3,15 +3,17 @@ package process
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/ryym/comproc/internal/config"
+	"github.com/ryym/comproc/config"
 )
 
 // State represents the current state of a process.
@@ -25,6 +27,10 @@ const (
 	StateFailed   State = "failed"
 )
 
+// ErrAlreadyRunning is returned by Start when the process is already running
+// or being started.
+var ErrAlreadyRunning = errors.New("process already running")
+
 // Process represents a managed process.
 type Process struct {
 	mu sync.RWMutex
@@ -34,13 +40,25 @@ type Process struct {
 
 	cmd       *exec.Cmd
 	startedAt time.Time
+	exitedAt  time.Time
 	exitCode  int
-	restarts  int
+	// exitSignal is the signal that killed the last run, or 0 if it exited
+	// on its own
+	exitSignal syscall.Signal
+	restarts   int
 
 	stdout    io.Writer
 	stderr    io.Writer
 	stdinPipe io.WriteCloser
 
+	// extraEnv is read by health checks without mu, so it has its own lock
+	envMu    sync.Mutex
+	extraEnv map[string]string
+
+	health Health
+	// settled is closed when the current run becomes ready or unhealthy
+	settled chan struct{}
+
 	// done is closed when the process exits
 	done chan struct{}
 	// cancel cancels the process context
@@ -63,36 +81,122 @@ func (p *Process) SetOutput(stdout, stderr io.Writer) {
 	p.stderr = stderr
 }
 
-// Start starts the process.
+// SetExtraEnv sets environment variables passed to the next runs in
+// addition to the service's own environment, which takes precedence.
+func (p *Process) SetExtraEnv(env map[string]string) {
+	p.envMu.Lock()
+	defer p.envMu.Unlock()
+	p.extraEnv = env
+}
+
+// Env returns the environment variables comproc sets for the service's
+// commands, without those inherited from the daemon.
+func (p *Process) Env() map[string]string {
+	p.envMu.Lock()
+	env := maps.Clone(p.extraEnv)
+	p.envMu.Unlock()
+
+	if env == nil {
+		env = make(map[string]string)
+	}
+	maps.Copy(env, p.Service.ResolvedEnv())
+	return env
+}
+
+// Start starts the process. If the service has prerequisites, they are
+// checked first and a *PrerequisiteError is returned if any is not met. If
+// the service has a prepare command, it is run to completion first and the
+// process is not started if it fails.
 func (p *Process) Start(ctx context.Context) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	if p.State == StateRunning || p.State == StateStarting {
-		return fmt.Errorf("process already running")
+		p.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	if p.State == StateStopping {
+		// The last run's monitor still has to finish
+		p.mu.Unlock()
+		return fmt.Errorf("process is stopping")
 	}
 
 	p.State = StateStarting
+	p.exitCode = 0
+	p.exitSignal = 0
+	p.exitedAt = time.Time{}
+	p.health = HealthNone
 
 	// Create a cancellable context
 	procCtx, cancel := context.WithCancel(ctx)
 	p.cancel = cancel
 	p.done = make(chan struct{})
+	p.cmd = nil
 
-	// Build the command
-	cmd := exec.CommandContext(procCtx, "sh", "-c", p.Service.Command)
-	cmd.Dir = p.Service.WorkingDir
+	if p.Service.IsExternal() {
+		p.startExternal(procCtx)
+		p.mu.Unlock()
+		return nil
+	}
+
+	if err := p.checkRequirements(); err != nil {
+		if p.stderr != nil {
+			fmt.Fprintf(p.stderr, "comproc: %v\n", err)
+		}
+		p.failStart()
+		p.mu.Unlock()
+		return err
+	}
+
+	if p.Service.Prepare != "" {
+		// Don't hold the lock while preparing so the state can be
+		// queried and Stop can interrupt it
+		stdout, stderr := p.stdout, p.stderr
+		p.mu.Unlock()
+		err := p.prepare(procCtx, stdout, stderr)
+		p.mu.Lock()
+
+		if p.State == StateStopping {
+			p.State = StateStopped
+			cancel()
+			close(p.done)
+			p.mu.Unlock()
+			return fmt.Errorf("process stopped while preparing")
+		}
+		if err != nil {
+			if stderr != nil {
+				fmt.Fprintf(stderr, "comproc: prepare failed: %v\n", err)
+			}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				p.exitCode = exitErr.ExitCode()
+			}
+			p.failStart()
+			p.mu.Unlock()
+			return fmt.Errorf("prepare failed: %w", err)
+		}
+	}
+	defer p.mu.Unlock()
 
-	// Set environment
-	cmd.Env = os.Environ()
-	for k, v := range p.Service.Env {
-		cmd.Env = append(cmd.Env, k+"="+v)
+	// Build the command
+	cmd, cleanup, err := p.serviceCommand(procCtx)
+	if err != nil {
+		p.failStart()
+		return err
 	}
+	cmd.Dir = p.Service.WorkingDir
+	cmd.Env = p.environ()
 
 	// Set process group so we can kill all children
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
+	if len(p.Service.Isolate) > 0 {
+		if err := isolate(cmd, p.Service); err != nil {
+			cleanup()
+			p.failStart()
+			return fmt.Errorf("failed to isolate process: %w", err)
+		}
+	}
 
 	// Set output
 	if p.stdout != nil {
@@ -101,11 +205,23 @@ func (p *Process) Start(ctx context.Context) error {
 	if p.stderr != nil {
 		cmd.Stderr = p.stderr
 	}
+	settled := make(chan struct{})
+	if p.Service.ReadyLogPattern != "" {
+		m, err := p.newLogMatcher(settled)
+		if err != nil {
+			cleanup()
+			p.failStart()
+			return err
+		}
+		cmd.Stdout = m.writer(cmd.Stdout)
+		cmd.Stderr = m.writer(cmd.Stderr)
+	}
 
 	// Set up stdin pipe
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
-		p.State = StateFailed
+		cleanup()
+		p.failStart()
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
 	p.stdinPipe = stdinPipe
@@ -113,29 +229,58 @@ func (p *Process) Start(ctx context.Context) error {
 	p.cmd = cmd
 
 	if err := cmd.Start(); err != nil {
-		p.State = StateFailed
+		cleanup()
+		p.failStart()
 		return fmt.Errorf("failed to start process: %w", err)
 	}
 
 	p.startedAt = time.Now()
 	p.State = StateRunning
 
+	p.settled = settled
+	switch {
+	case p.Service.Healthcheck != nil:
+		p.health = HealthStarting
+		go p.checkHealth(procCtx, p.settled, p.done)
+	case p.Service.ReadyLogPattern != "":
+		p.health = HealthStarting
+	default:
+		p.health = HealthNone
+		close(p.settled)
+	}
+
 	// Monitor the process in a goroutine
-	go p.monitor()
+	go p.monitor(cleanup)
 
 	return nil
 }
 
-// monitor waits for the process to exit and updates state.
-func (p *Process) monitor() {
+// failStart ends a run that failed to start, as monitor ends one that
+// exited. p.mu must be held.
+func (p *Process) failStart() {
+	p.State = StateFailed
+	p.exitedAt = time.Now()
+	p.cmd = nil
+	p.cancel()
+	close(p.done)
+}
+
+// monitor waits for the process to exit and updates state. cleanup is
+// called once the process has exited.
+func (p *Process) monitor(cleanup func()) {
 	err := p.cmd.Wait()
+	cleanup()
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if p.cmd.ProcessState != nil {
 		p.exitCode = p.cmd.ProcessState.ExitCode()
+		if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			p.exitSignal = ws.Signal()
+		}
 	}
+	p.exitedAt = time.Now()
 
 	if p.State == StateStopping {
 		p.State = StateStopped
@@ -160,33 +305,152 @@ func (p *Process) Stop(timeout time.Duration) error {
 	p.State = StateStopping
 	done := p.done
 	cmd := p.cmd
+	stopMode := p.Service.GetStopMode()
+	cancel := p.cancel
 	p.mu.Unlock()
 
-	// Send SIGTERM to process group
-	if cmd.Process != nil {
-		pgid, err := syscall.Getpgid(cmd.Process.Pid)
-		if err == nil {
-			syscall.Kill(-pgid, syscall.SIGTERM)
-		}
+	if cmd == nil {
+		// Still preparing, or an external service that has nothing to
+		// kill; cancelling ends either
+		cancel()
+		<-done
+		return nil
 	}
 
+	// Send SIGTERM to the process group, or only to the direct child
+	// when it is expected to forward signals itself
+	signalProcess(cmd, syscall.SIGTERM, stopMode == config.StopModeGroup)
+
 	// Wait for graceful shutdown or timeout
 	select {
 	case <-done:
 		return nil
 	case <-time.After(timeout):
-		// Force kill
-		if cmd.Process != nil {
-			pgid, err := syscall.Getpgid(cmd.Process.Pid)
-			if err == nil {
-				syscall.Kill(-pgid, syscall.SIGKILL)
-			}
-		}
+		// Force kill the whole group regardless of stop mode so that
+		// no orphaned children are left behind
+		signalProcess(cmd, syscall.SIGKILL, true)
 		<-done
 		return nil
 	}
 }
 
+// prepare runs the service's prepare command to completion, writing its
+// output to the given writers.
+func (p *Process) prepare(ctx context.Context, stdout, stderr io.Writer) error {
+	cmd, cleanup, err := p.shellCommand(ctx, p.Service.Prepare)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	cmd.Dir = p.Service.WorkingDir
+	cmd.Env = p.environ()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Kill the whole group on cancellation so that children such as
+	// compilers don't keep running (and holding the output pipes)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd.Run()
+}
+
+// OneOff returns a command that runs args in the service's working directory
+// and environment, with its umask, in a process group of its own. The
+// program is looked up as the service's own is.
+func (p *Process) OneOff(args []string) (*exec.Cmd, error) {
+	path := lookExecutable(args[0], getenv(p.Env(), "PATH"), p.Service.WorkingDir)
+	if path == "" {
+		return nil, &exec.Error{Name: args[0], Err: exec.ErrNotFound}
+	}
+	cmd := p.command(context.Background(), path, args[1:]...)
+	cmd.Dir = p.Service.WorkingDir
+	cmd.Env = p.environ()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd, nil
+}
+
+// serviceCommand returns a command that runs the service's command. An
+// exec-form command is run directly, so that the program itself is the
+// service's process; with login_shell, the shell replaces itself with the
+// program once the profile is loaded. Command lines are run by shellCommand.
+func (p *Process) serviceCommand(ctx context.Context) (cmd *exec.Cmd, cleanup func(), err error) {
+	args := p.Service.Args
+	if len(args) == 0 {
+		return p.shellCommand(ctx, p.Service.Command)
+	}
+	if p.Service.LoginShell {
+		shellArgs := append([]string{"-l", "-c", `exec "$@"`, "sh"}, args...)
+		return p.command(ctx, loginShell(), shellArgs...), func() {}, nil
+	}
+	// Look the program up in the service's PATH, which may differ from the
+	// daemon's, and relative to its working directory
+	path := lookExecutable(args[0], getenv(p.Env(), "PATH"), p.Service.WorkingDir)
+	if path == "" {
+		return nil, nil, &exec.Error{Name: args[0], Err: exec.ErrNotFound}
+	}
+	return p.command(ctx, path, args[1:]...), func() {}, nil
+}
+
+// shellCommand returns a command that runs a command line of the service.
+// With login_shell, it is run by the user's shell as a login shell so that
+// version manager shims set up in the profile are available. Commands of
+// several lines are run from a script file, which cleanup removes.
+func (p *Process) shellCommand(ctx context.Context, command string) (cmd *exec.Cmd, cleanup func(), err error) {
+	if isScript(command) {
+		return p.scriptCommand(ctx, command)
+	}
+	if p.Service.LoginShell {
+		return p.command(ctx, loginShell(), "-l", "-c", command), func() {}, nil
+	}
+	return p.command(ctx, "sh", "-c", command), func() {}, nil
+}
+
+// command returns a command that runs name with args. With umask, it is run
+// through sh, which sets the umask and then replaces itself with the
+// command, as a child process can't be given a umask of its own otherwise.
+func (p *Process) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if mask, ok := p.Service.GetUmask(); ok {
+		args = append([]string{"-c", fmt.Sprintf(`umask %04o && exec "$@"`, mask), "sh", name}, args...)
+		name = "sh"
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// loginShell returns the user's shell from $SHELL, or sh if it is not set.
+func loginShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// environ returns the environment for the service's commands.
+func (p *Process) environ() []string {
+	env := os.Environ()
+	for k, v := range p.Env() {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// signalProcess sends sig to the command's process group, or only to the
+// process itself if group is false.
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal, group bool) {
+	if cmd.Process == nil {
+		return
+	}
+	if !group {
+		syscall.Kill(cmd.Process.Pid, sig)
+		return
+	}
+	// Commands run in their own process group, whose ID is the leader's
+	// PID. The group outlives the leader while children remain, so it
+	// can't be looked up from the leader, which may have been reaped.
+	syscall.Kill(-cmd.Process.Pid, sig)
+}
+
 // Wait waits for the process to exit.
 func (p *Process) Wait() <-chan struct{} {
 	p.mu.RLock()
@@ -208,6 +472,22 @@ func (p *Process) GetExitCode() int {
 	return p.exitCode
 }
 
+// GetExitSignal returns the signal that killed the last run, or 0 if it
+// exited on its own. The exit code of a killed process is -1.
+func (p *Process) GetExitSignal() syscall.Signal {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.exitSignal
+}
+
+// GetExitedAt returns when the last run exited, or the zero time if the
+// process has not exited since it was last started.
+func (p *Process) GetExitedAt() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.exitedAt
+}
+
 // GetStartedAt returns when the process was started.
 func (p *Process) GetStartedAt() time.Time {
 	p.mu.RLock()
@@ -229,6 +509,14 @@ func (p *Process) IncrementRestarts() {
 	p.restarts++
 }
 
+// SetRestarts sets the restart counter, e.g. to a count restored from a
+// previous daemon.
+func (p *Process) SetRestarts(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restarts = n
+}
+
 // ResetRestarts resets the restart counter.
 func (p *Process) ResetRestarts() {
 	p.mu.Lock()
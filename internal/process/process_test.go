@@ -3,10 +3,21 @@ package process
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
-	"github.com/ryym/comproc/internal/config"
+	"github.com/ryym/comproc/config"
 )
 
 func TestProcess_StartAndStop(t *testing.T) {
@@ -102,6 +113,55 @@ func TestProcess_ExitCode(t *testing.T) {
 	if proc.GetExitCode() != 42 {
 		t.Errorf("expected exit code 42, got %d", proc.GetExitCode())
 	}
+	if proc.GetExitedAt().IsZero() {
+		t.Error("expected exit time to be set")
+	}
+
+	// A new run clears the previous exit
+	if err := proc.Start(ctx); err != nil {
+		t.Fatalf("failed to restart process: %v", err)
+	}
+	if proc.GetExitCode() != 0 || !proc.GetExitedAt().IsZero() {
+		t.Errorf("expected exit to be cleared on start, got code %d at %v", proc.GetExitCode(), proc.GetExitedAt())
+	}
+	<-proc.Wait()
+}
+
+func TestProcess_ExitSignal(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Command: "kill -KILL $$",
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+
+	if proc.GetState() != StateFailed {
+		t.Errorf("expected state to be failed, got %s", proc.GetState())
+	}
+	if sig := proc.GetExitSignal(); sig != syscall.SIGKILL {
+		t.Errorf("expected exit signal SIGKILL, got %v", sig)
+	}
+	if proc.GetExitCode() != -1 {
+		t.Errorf("expected exit code -1, got %d", proc.GetExitCode())
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	tests := map[syscall.Signal]string{
+		0:               "",
+		syscall.SIGKILL: "SIGKILL",
+		syscall.SIGSEGV: "SIGSEGV",
+		40:              "SIG40",
+	}
+	for sig, want := range tests {
+		if got := SignalName(sig); got != want {
+			t.Errorf("SignalName(%d) = %q, want %q", int(sig), got, want)
+		}
+	}
 }
 
 func TestProcess_WorkingDir(t *testing.T) {
@@ -174,8 +234,8 @@ func TestProcess_DoubleStart(t *testing.T) {
 
 	// Try to start again
 	err = proc.Start(ctx)
-	if err == nil {
-		t.Error("expected error when starting already running process")
+	if !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("expected ErrAlreadyRunning when starting already running process, got %v", err)
 	}
 }
 
@@ -206,3 +266,508 @@ func TestProcess_RestartCounter(t *testing.T) {
 		t.Errorf("expected restart count to be 0 after reset, got %d", proc.GetRestarts())
 	}
 }
+
+func TestProcess_StopModeLeader(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Command:    stopModeTestCommand,
+		WorkingDir: dir,
+		StopMode:   config.StopModeLeader,
+	}
+
+	if signaled := stopAndCheckChildSignaled(t, svc); signaled {
+		t.Error("expected child process not to receive SIGTERM in leader mode")
+	}
+}
+
+func TestProcess_StopModeGroup(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Command:    stopModeTestCommand,
+		WorkingDir: dir,
+	}
+
+	if signaled := stopAndCheckChildSignaled(t, svc); !signaled {
+		t.Error("expected child process to receive SIGTERM in group mode")
+	}
+}
+
+func TestProcess_StopKillsGroupAfterLeaderExits(t *testing.T) {
+	// The outer shell exits on SIGTERM, leaving a child that ignores it
+	svc := &config.Service{
+		Name:    "test",
+		Command: `sh -c 'trap "" TERM; while :; do sleep 0.1; done'; echo unreachable`,
+	}
+	proc := New(svc)
+	// The child keeps the output pipe open, so the process isn't done
+	// when the leader exits
+	proc.SetOutput(io.Discard, io.Discard)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		proc.Stop(200 * time.Millisecond)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the remaining child to be killed after the timeout")
+	}
+}
+
+// stopModeTestCommand runs a child subshell that records whether it received
+// SIGTERM by creating a "term" file in the working directory.
+const stopModeTestCommand = `(trap 'touch term; exit 0' TERM; touch ready; sleep 2 & wait) & wait`
+
+// stopAndCheckChildSignaled starts the service, stops it once the child is
+// ready, and reports whether the child received SIGTERM.
+func stopAndCheckChildSignaled(t *testing.T, svc *config.Service) bool {
+	t.Helper()
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	waitForFile(t, filepath.Join(svc.WorkingDir, "ready"))
+
+	if err := proc.Stop(time.Second); err != nil {
+		t.Fatalf("failed to stop process: %v", err)
+	}
+
+	// Give the child time to run its trap handler
+	time.Sleep(200 * time.Millisecond)
+	_, err := os.Stat(filepath.Join(svc.WorkingDir, "term"))
+	return err == nil
+}
+
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %s", path)
+}
+
+func TestProcess_Prepare(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Prepare:    "echo preparing; touch prepared",
+		Command:    "test -f prepared && echo started",
+		WorkingDir: dir,
+	}
+
+	var out bytes.Buffer
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+
+	if proc.GetExitCode() != 0 {
+		t.Errorf("expected command to run after prepare, got exit code %d", proc.GetExitCode())
+	}
+	if out.String() != "preparing\nstarted\n" {
+		t.Errorf("expected prepare output before command output, got %q", out.String())
+	}
+}
+
+func TestProcess_Script(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	tests := []struct {
+		name    string
+		prepare string
+		command string
+		want    string
+	}{
+		{"shell", "echo preparing\necho ready\n", "for i in 1 2; do\n  echo \"line $i\"\ndone\n", "preparing\nready\nline 1\nline 2\n"},
+		{"shebang", "", "#!/bin/cat\nprinted as it is\n", "#!/bin/cat\nprinted as it is\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			proc := New(&config.Service{Name: "app/web", Prepare: tt.prepare, Command: tt.command})
+			proc.SetOutput(&out, &out)
+			if err := proc.Start(context.Background()); err != nil {
+				t.Fatalf("failed to start process: %v", err)
+			}
+			<-proc.Wait()
+
+			if proc.GetExitCode() != 0 || out.String() != tt.want {
+				t.Errorf("expected %q, got %q (exit code %d)", tt.want, out.String(), proc.GetExitCode())
+			}
+			if files, _ := os.ReadDir(tmp); len(files) != 0 {
+				t.Errorf("expected scripts to be removed, got %v", files)
+			}
+		})
+	}
+}
+
+func TestProcess_PrepareFailure(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Prepare:    "exit 3",
+		Command:    "touch started",
+		WorkingDir: dir,
+	}
+
+	proc := New(svc)
+	if err := proc.Start(context.Background()); err == nil {
+		t.Fatal("expected start to fail when prepare fails")
+	}
+
+	if proc.GetState() != StateFailed {
+		t.Errorf("expected state to be failed, got %s", proc.GetState())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "started")); !os.IsNotExist(err) {
+		t.Error("expected command not to run")
+	}
+	select {
+	case <-proc.Wait():
+	default:
+		t.Error("expected Wait to be released after prepare failure")
+	}
+}
+
+func TestProcess_Requires(t *testing.T) {
+	dir := t.TempDir()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	svc := &config.Service{
+		Name:       "test",
+		Command:    "touch started",
+		WorkingDir: dir,
+		Env:        map[string]string{"SET_BY_SERVICE": "1"},
+		Requires: []config.Requirement{
+			{Binary: "sh"},
+			{Binary: "comproc-no-such-binary"},
+			{File: "config.json"},
+			{Env: "SET_BY_SERVICE"},
+			{Env: "COMPROC_NO_SUCH_ENV"},
+			{Port: port},
+		},
+	}
+
+	var out bytes.Buffer
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+	err = proc.Start(context.Background())
+
+	var prereqErr *PrerequisiteError
+	if !errors.As(err, &prereqErr) {
+		t.Fatalf("expected a PrerequisiteError, got %v", err)
+	}
+	want := []string{
+		`binary "comproc-no-such-binary" not found in PATH`,
+		`file "config.json" does not exist`,
+		"env COMPROC_NO_SUCH_ENV is not set",
+		fmt.Sprintf("port %d is already in use", port),
+	}
+	if !slices.Equal(prereqErr.Missing, want) {
+		t.Errorf("expected missing %q, got %q", want, prereqErr.Missing)
+	}
+	if !strings.Contains(out.String(), "missing prerequisite: ") {
+		t.Errorf("expected the error in the output, got %q", out.String())
+	}
+	if proc.GetState() != StateFailed {
+		t.Errorf("expected state to be failed, got %s", proc.GetState())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "started")); !os.IsNotExist(err) {
+		t.Error("expected command not to run with missing prerequisites")
+	}
+
+	// Once the prerequisites are met, the service starts
+	l.Close()
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0644)
+	svc.Requires = []config.Requirement{{Binary: "sh"}, {File: "config.json"}, {Port: port}}
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+	if _, err := os.Stat(filepath.Join(dir, "started")); err != nil {
+		t.Error("expected command to run once the prerequisites are met")
+	}
+}
+
+func TestProcess_MemoryUsage(t *testing.T) {
+	proc := New(&config.Service{Name: "test", Command: "sleep 10 & sleep 10; wait"})
+	if _, err := proc.MemoryUsage(); err == nil {
+		t.Error("expected an error before the process starts")
+	}
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+	time.Sleep(50 * time.Millisecond)
+
+	memory, err := proc.MemoryUsage()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The shell and both sleeps take at least a few hundred KiB
+	if memory < 256<<10 {
+		t.Errorf("expected the memory of the process group, got %d bytes", memory)
+	}
+}
+
+func TestGroupUsage(t *testing.T) {
+	busy := New(&config.Service{Name: "busy", Command: "i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done; sleep 10"})
+	idle := New(&config.Service{Name: "idle", Command: "sleep 10"})
+	for _, proc := range []*Process{busy, idle} {
+		if err := proc.Start(context.Background()); err != nil {
+			t.Fatalf("failed to start process: %v", err)
+		}
+		defer proc.Stop(time.Second)
+	}
+
+	// The busy loop takes a few hundred milliseconds of CPU time
+	var usages map[int]Usage
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		if usages, err = GroupUsage([]int{busy.PID(), idle.PID()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if usages[busy.PID()].CPU >= 100*time.Millisecond {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if u := usages[busy.PID()]; u.CPU < 100*time.Millisecond || u.Memory == 0 {
+		t.Errorf("expected the busy group to use CPU time, got %+v", u)
+	}
+	if u, ok := usages[idle.PID()]; !ok || u.Memory == 0 || u.CPU >= 100*time.Millisecond {
+		t.Errorf("expected the idle group to use memory but little CPU time, got %+v", u)
+	}
+	if len(usages) != 2 {
+		t.Errorf("expected only the given groups, got %v", usages)
+	}
+}
+
+func TestProcess_StopWhilePreparing(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Prepare: "sleep 10",
+		Command: "sleep 10",
+	}
+
+	proc := New(svc)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- proc.Start(context.Background())
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if proc.GetState() != StateStarting {
+		t.Fatalf("expected state to be starting while preparing, got %s", proc.GetState())
+	}
+
+	start := time.Now()
+	proc.Stop(5 * time.Second)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected stop to interrupt prepare, took %v", elapsed)
+	}
+
+	if err := <-errCh; err == nil {
+		t.Error("expected start to fail when stopped while preparing")
+	}
+	if proc.GetState() != StateStopped {
+		t.Errorf("expected state to be stopped, got %s", proc.GetState())
+	}
+}
+
+func TestProcess_LoginShell(t *testing.T) {
+	// A fake shell that reports its arguments and runs the command with sh
+	dir := t.TempDir()
+	shell := filepath.Join(dir, "fake-shell")
+	script := "#!/bin/sh\necho \"shell: $1 $2\"\nshift 2\nexec sh -c \"$1\"\n"
+	if err := os.WriteFile(shell, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SHELL", shell)
+
+	svc := &config.Service{
+		Name:       "test",
+		Prepare:    "echo preparing",
+		Command:    "echo started",
+		LoginShell: true,
+	}
+
+	var out bytes.Buffer
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+
+	expected := "shell: -l -c\npreparing\nshell: -l -c\nstarted\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestProcess_Umask(t *testing.T) {
+	svc := &config.Service{
+		Name:    "test",
+		Prepare: "umask",
+		Command: "umask",
+		Umask:   "0027",
+	}
+
+	var out bytes.Buffer
+	proc := New(svc)
+	proc.SetOutput(&out, &out)
+
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+
+	if out.String() != "0027\n0027\n" {
+		t.Errorf("expected the umask to be set for prepare and command, got %q", out.String())
+	}
+}
+
+func TestProcess_ExecForm(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "args.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\nprintf '[%s]' \"$@\"; echo\n"), 0755)
+
+	// Arguments are passed as they are, without a shell to interpret them
+	var out bytes.Buffer
+	proc := New(&config.Service{Name: "test", Args: []string{"./args.sh", "$HOME", "a b", "*"}, WorkingDir: dir})
+	proc.SetOutput(&out, &out)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+	if out.String() != "[$HOME][a b][*]\n" {
+		t.Errorf("expected the arguments as given, got %q", out.String())
+	}
+
+	// With login_shell, the shell passes them on as well
+	t.Setenv("SHELL", "sh")
+	out.Reset()
+	proc = New(&config.Service{Name: "test", Args: []string{"./args.sh", "$HOME", "a b"}, WorkingDir: dir, LoginShell: true})
+	proc.SetOutput(&out, &out)
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	<-proc.Wait()
+	if out.String() != "[$HOME][a b]\n" {
+		t.Errorf("expected the arguments as given through the login shell, got %q", out.String())
+	}
+
+	// The program is the service's process, found in the service's PATH
+	os.WriteFile(filepath.Join(dir, "napper"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755)
+	proc = New(&config.Service{Name: "test", Args: []string{"napper"}, WorkingDir: t.TempDir(), Env: map[string]string{"PATH": dir + ":/bin:/usr/bin"}})
+	if err := proc.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer proc.Stop(time.Second)
+	if runtime.GOOS == "linux" {
+		var exe string
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && filepath.Base(exe) != "sleep"; {
+			exe, _ = os.Readlink(fmt.Sprintf("/proc/%d/exe", proc.PID()))
+			time.Sleep(10 * time.Millisecond)
+		}
+		if filepath.Base(exe) != "sleep" {
+			t.Errorf("expected the program to be the service's process, got %q", exe)
+		}
+	}
+
+	proc = New(&config.Service{Name: "test", Args: []string{"no-such-program"}})
+	if err := proc.Start(context.Background()); err == nil || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected a missing program to fail, got %v", err)
+	}
+	// The failed run has ended, so whoever waits for it isn't blocked
+	select {
+	case <-proc.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("expected Wait to return after a failed start")
+	}
+	if proc.GetState() != StateFailed || proc.GetExitedAt().IsZero() {
+		t.Errorf("expected the run to have failed, got %q exited at %v", proc.GetState(), proc.GetExitedAt())
+	}
+}
+
+func TestProcess_OneOff(t *testing.T) {
+	dir := t.TempDir()
+	svc := &config.Service{
+		Name:       "test",
+		Command:    "sleep 60",
+		WorkingDir: dir,
+		Env:        map[string]string{"FROM_SERVICE": "yes"},
+		Umask:      "0027",
+	}
+	proc := New(svc)
+	proc.SetExtraEnv(map[string]string{"FROM_DAEMON": "also"})
+
+	cmd, err := proc.OneOff([]string{"sh", "-c", `pwd; echo "$FROM_SERVICE $FROM_DAEMON"; umask`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if want := dir + "\nyes also\n0027\n"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Setpgid {
+		t.Error("expected the command to run in a process group of its own")
+	}
+}
+
+func TestProcess_OneOffUsesServicePath(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "greet"), []byte("#!/bin/sh\necho hello from $0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	svc := &config.Service{
+		Name:       "test",
+		Command:    "sleep 60",
+		WorkingDir: t.TempDir(),
+		Env:        map[string]string{"PATH": bin + ":/usr/bin:/bin"},
+	}
+	proc := New(svc)
+
+	cmd, err := proc.OneOff([]string{"greet"})
+	if err != nil {
+		t.Fatalf("expected greet to be found in the service's PATH: %v", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if want := "hello from " + filepath.Join(bin, "greet") + "\n"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	if _, err := proc.OneOff([]string{"comproc-missing-program"}); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected a missing program to be reported, got %v", err)
+	}
+}
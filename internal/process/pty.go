@@ -0,0 +1,72 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// StartPTY starts cmd in a new session whose controlling terminal is a new
+// pseudo-terminal of the given size, and returns the terminal's master side,
+// which reads the command's output and writes its input. The master reads
+// fail with EIO once the command and all processes it left behind have
+// closed the terminal.
+func StartPTY(cmd *exec.Cmd, rows, cols uint16) (*os.File, error) {
+	master, slavePath, err := openPTY()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a pseudo-terminal: %w", err)
+	}
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open a pseudo-terminal: %w", err)
+	}
+	// The parent's copy would keep the master from reporting the end
+	defer slave.Close()
+
+	if err := ResizePTY(master, rows, cols); err != nil {
+		master.Close()
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	// A new session has no controlling terminal, which the command's stdin
+	// becomes. The session's process group is led by the command, so it
+	// can still be signaled as a group.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+	return master, nil
+}
+
+// ResizePTY sets the size of the pseudo-terminal whose master side is
+// master, which sends SIGWINCH to its foreground process group.
+func ResizePTY(master *os.File, rows, cols uint16) error {
+	ws := struct{ rows, cols, x, y uint16 }{rows, cols, 0, 0}
+	if err := ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return fmt.Errorf("failed to resize the pseudo-terminal: %w", err)
+	}
+	return nil
+}
+
+// ioctl performs an ioctl on f. Unlike with f.Fd(), f stays in non-blocking
+// mode, so closing it interrupts pending reads.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build darwin
+
+package process
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a new pseudo-terminal and returns its master side and the
+// path of its slave side.
+func openPTY() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, req := range []uintptr{syscall.TIOCPTYGRANT, syscall.TIOCPTYUNLK} {
+		if err := ioctl(master, req, nil); err != nil {
+			master.Close()
+			return nil, "", err
+		}
+	}
+	var name [128]byte
+	if err := ioctl(master, syscall.TIOCPTYGNAME, unsafe.Pointer(&name)); err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	return master, string(name[:bytes.IndexByte(name[:], 0)]), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package process
+
+import (
+	"errors"
+	"os"
+)
+
+func openPTY() (*os.File, string, error) {
+	return nil, "", errors.New("pseudo-terminals are only supported on Linux and macOS")
+}
@@ -0,0 +1,56 @@
+//go:build linux || darwin
+
+package process
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestStartPTY(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `test -t 0 && echo tty; stty size; read line; echo "got $line"`)
+	master, err := StartPTY(cmd, 30, 100)
+	if err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer master.Close()
+
+	if _, err := master.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	// Reads fail with EIO once the command exits
+	out, _ := io.ReadAll(master)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+
+	// The terminal echoes the input and translates newlines
+	got := strings.ReplaceAll(string(out), "\r\n", "\n")
+	for _, want := range []string{"tty\n", "30 100\n", "got hello\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got %q", want, got)
+		}
+	}
+}
+
+func TestResizePTY(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `read line; stty size`)
+	master, err := StartPTY(cmd, 24, 80)
+	if err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer master.Close()
+
+	if err := ResizePTY(master, 50, 120); err != nil {
+		t.Fatalf("failed to resize: %v", err)
+	}
+	master.Write([]byte("\n"))
+	out, _ := io.ReadAll(master)
+	cmd.Wait()
+
+	if !strings.Contains(string(out), "50 120") {
+		t.Errorf("expected the new size, got %q", out)
+	}
+}
@@ -0,0 +1,110 @@
+package process
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PrerequisiteError is returned by Start when prerequisites of the service
+// (its requires entries) are not met, so the command was not run.
+type PrerequisiteError struct {
+	Missing []string // Descriptions of the unmet prerequisites
+}
+
+func (e *PrerequisiteError) Error() string {
+	return "missing prerequisite: " + strings.Join(e.Missing, "; ")
+}
+
+// checkRequirements checks the service's prerequisites and returns a
+// *PrerequisiteError describing all that are not met, if any.
+func (p *Process) checkRequirements() error {
+	if len(p.Service.Requires) == 0 {
+		return nil
+	}
+	env := p.Env()
+
+	var missing []string
+	for _, req := range p.Service.Requires {
+		switch {
+		case req.Binary != "":
+			if lookExecutable(req.Binary, getenv(env, "PATH"), p.Service.WorkingDir) == "" {
+				missing = append(missing, req.String()+" not found in PATH")
+			}
+		case req.File != "":
+			path := req.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(p.Service.WorkingDir, path)
+			}
+			if _, err := os.Stat(path); err != nil {
+				missing = append(missing, req.String()+" does not exist")
+			}
+		case req.Env != "":
+			if getenv(env, req.Env) == "" {
+				missing = append(missing, req.String()+" is not set")
+			}
+		case req.Port != 0:
+			if !PortFree(req.Port) {
+				missing = append(missing, req.String()+" is already in use")
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &PrerequisiteError{Missing: missing}
+	}
+	return nil
+}
+
+// getenv returns a variable of the service's environment env, or of the
+// daemon's if env does not set it.
+func getenv(env map[string]string, name string) string {
+	if v, ok := env[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// lookExecutable returns the path of the executable file name, looked up in
+// the directories of path, or relative to dir if name contains a slash. It
+// returns an empty string if there is none.
+func lookExecutable(name, path, dir string) string {
+	if strings.Contains(name, "/") {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		if isExecutable(name) {
+			return name
+		}
+		return ""
+	}
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			d = "."
+		}
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(dir, d)
+		}
+		if file := filepath.Join(d, name); isExecutable(file) {
+			return file
+		}
+	}
+	return ""
+}
+
+// isExecutable reports whether path is a file that anyone may execute.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// PortFree reports whether nothing listens on a TCP port.
+func PortFree(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
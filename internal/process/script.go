@@ -0,0 +1,51 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// isScript reports whether a command spans several lines, as written with
+// a YAML block scalar (`command: |`). A single trailing newline, which
+// block scalars add, doesn't make a script.
+func isScript(command string) bool {
+	return strings.Contains(strings.TrimRight(command, "\n"), "\n")
+}
+
+// scriptCommand writes a command of several lines to a temporary script and
+// returns a command that runs it. A script starting with "#!" is executed
+// directly so that it can use another interpreter; others are run by the
+// shell like single-line commands. cleanup removes the script.
+func (p *Process) scriptCommand(ctx context.Context, script string) (cmd *exec.Cmd, cleanup func(), err error) {
+	name := strings.ReplaceAll(p.Service.Name, "/", "-")
+	f, err := os.CreateTemp("", "comproc-"+name+"-*.sh")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create script: %w", err)
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+
+	_, err = f.WriteString(script)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0700)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write script: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(script, "#!"):
+		cmd = p.command(ctx, f.Name())
+	case p.Service.LoginShell:
+		cmd = p.command(ctx, loginShell(), "-l", f.Name())
+	default:
+		cmd = p.command(ctx, "sh", f.Name())
+	}
+	return cmd, cleanup, nil
+}
@@ -0,0 +1,39 @@
+package process
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// signalNames holds the names of signals that commonly end a process.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// SignalName returns the name of a signal, such as "SIGKILL", or "" for 0.
+// Other signals are named by number, such as "SIG40".
+func SignalName(sig syscall.Signal) string {
+	if sig == 0 {
+		return ""
+	}
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
@@ -0,0 +1,38 @@
+package process
+
+import (
+	"errors"
+	"time"
+)
+
+// Usage is the resource use of a process group.
+type Usage struct {
+	Memory int64         // Resident memory in bytes
+	CPU    time.Duration // CPU time used so far, in user and system mode
+}
+
+// MemoryUsage returns the resident memory of the running process and the
+// processes it started, in bytes: the sum over its process group, so that
+// the children of a shell or a dev server's workers are counted too.
+func (p *Process) MemoryUsage() (int64, error) {
+	pid := p.PID()
+	if pid == 0 {
+		return 0, errors.New("process is not running")
+	}
+	usages, err := GroupUsage([]int{pid})
+	if err != nil {
+		return 0, err
+	}
+	return usages[pid].Memory, nil
+}
+
+// GroupUsage returns the resource use of each of the given process groups,
+// by process group ID, reading the process table once for all of them.
+// Groups without processes are left out.
+func GroupUsage(pgids []int) (map[int]Usage, error) {
+	wanted := make(map[int]bool, len(pgids))
+	for _, pgid := range pgids {
+		wanted[pgid] = true
+	}
+	return groupUsage(wanted)
+}
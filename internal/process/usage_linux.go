@@ -0,0 +1,59 @@
+//go:build linux
+
+package process
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// clockTicks is the unit of CPU times in /proc, USER_HZ, which Linux fixes
+// at 100 for user space.
+const clockTicks = 100
+
+// groupUsage sums the resident set sizes and CPU times of the processes in
+// the wanted process groups, as read from /proc.
+func groupUsage(wanted map[int]bool) (map[int]Usage, error) {
+	dirs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	usages := make(map[int]Usage)
+	for _, dir := range dirs {
+		if _, err := strconv.Atoi(dir.Name()); err != nil {
+			continue
+		}
+		// Processes may exit while being read
+		stat, err := os.ReadFile(filepath.Join("/proc", dir.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name in parentheses may contain spaces, so fields
+		// are counted from after it: state, ppid, pgrp, ..., utime (12th),
+		// stime (13th), ..., rss (22nd)
+		i := bytes.LastIndexByte(stat, ')')
+		if i < 0 {
+			continue
+		}
+		fields := bytes.Fields(stat[i+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		group, _ := strconv.Atoi(string(fields[2]))
+		if !wanted[group] {
+			continue
+		}
+		utime, _ := strconv.ParseInt(string(fields[11]), 10, 64)
+		stime, _ := strconv.ParseInt(string(fields[12]), 10, 64)
+		pages, _ := strconv.ParseInt(string(fields[21]), 10, 64)
+
+		u := usages[group]
+		u.Memory += pages * int64(os.Getpagesize())
+		u.CPU += time.Duration(utime+stime) * time.Second / clockTicks
+		usages[group] = u
+	}
+	return usages, nil
+}
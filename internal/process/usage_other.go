@@ -0,0 +1,70 @@
+//go:build !linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// groupUsage sums the resident set sizes and CPU times of the processes in
+// the wanted process groups, as reported by ps.
+func groupUsage(wanted map[int]bool) (map[int]Usage, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pgid=,rss=,time=").Output()
+	if err != nil {
+		return nil, err
+	}
+	usages := make(map[int]Usage)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		group, _ := strconv.Atoi(fields[0])
+		if !wanted[group] {
+			continue
+		}
+		kib, _ := strconv.ParseInt(fields[1], 10, 64)
+
+		u := usages[group]
+		u.Memory += kib << 10
+		u.CPU += parseCPUTime(fields[2])
+		usages[group] = u
+	}
+	return usages, nil
+}
+
+// parseCPUTime parses a CPU time printed by ps, "[[dd-]hh:]mm:ss[.ss]".
+// Invalid times are taken as zero.
+func parseCPUTime(s string) time.Duration {
+	var total time.Duration
+	if days, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0
+		}
+		total += time.Duration(n) * 24 * time.Hour
+		s = rest
+	}
+	parts := strings.Split(s, ":")
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0
+	}
+	total += time.Duration(seconds * float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0
+		}
+		total += time.Duration(n) * unit
+		unit *= 60
+	}
+	return total
+}
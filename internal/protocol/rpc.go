@@ -2,8 +2,10 @@
 package protocol
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"unicode/utf8"
 )
 
 const JSONRPCVersion = "2.0"
@@ -46,8 +48,12 @@ const (
 
 // Application-specific error codes
 const (
-	ServiceNotFound = -32000
-	ServiceError    = -32001
+	ServiceNotFound  = -32000
+	ServiceError     = -32001
+	MethodNotAllowed = -32002
+	ConfigError      = -32003 // A project's config file can't be loaded
+	StreamError      = -32004 // A stream failed without a more specific code
+	Unauthorized     = -32005 // A TCP client didn't authenticate with the daemon's token
 )
 
 // NewRequest creates a new JSON-RPC request.
@@ -119,37 +125,97 @@ func NewErrorResponse(code int, message string, id *int) *Response {
 
 // Method names
 const (
-	MethodUp       = "up"
-	MethodDown     = "down"
-	MethodShutdown = "shutdown"
-	MethodStatus   = "status"
-	MethodRestart  = "restart"
-	MethodLogs     = "logs"
-	MethodLog      = "log"   // Server-sent log notification
-	MethodAttach   = "attach"
-	MethodStdin    = "stdin" // Client-sent stdin data notification
+	MethodUp          = "up"
+	MethodDown        = "down"
+	MethodShutdown    = "shutdown" // Also sent by the daemon as a notification to each client before it exits
+	MethodStatus      = "status"
+	MethodRestart     = "restart"
+	MethodReload      = "reload"
+	MethodScale       = "scale" // Responds with a ReloadResult
+	MethodLogs        = "logs"
+	MethodLog         = "log"         // Server-sent log notification
+	MethodLogBatch    = "log_batch"   // Server-sent notification carrying several log entries
+	MethodLogDropped  = "log.dropped" // Server-sent notification when log lines were dropped for a slow follower
+	MethodAttach      = "attach"
+	MethodStdin       = "stdin"        // Writes data to a service's stdin without attaching to it
+	MethodAttachState = "attach_state" // Server-sent notification when another client attaches or detaches
+	MethodVersion     = "version"
+	MethodPing        = "ping"
+	MethodAuth        = "auth" // Must be the first request on a connection to a daemon's TCP address
+	MethodStats       = "daemon.stats"
+	MethodHistory     = "history"
+	MethodInspect     = "inspect"
 )
 
+// IsReadOnly reports whether a method only reads the daemon's state, so it
+// is allowed on read-only listeners.
+func IsReadOnly(method string) bool {
+	switch method {
+	case MethodStatus, MethodLogs, MethodVersion, MethodPing, MethodStats, MethodHistory, MethodInspect:
+		return true
+	default:
+		return false
+	}
+}
+
+// Requests that take a list of services also carry the absolute config path
+// of the client's project. A daemon may host several projects; service names
+// are interpreted relative to that project, and "up" loads the project into
+// the daemon if it is not loaded yet.
+
 // UpParams represents parameters for the "up" method.
 type UpParams struct {
-	Services []string `json:"services,omitempty"`
+	Services      []string `json:"services,omitempty"`
+	ConfigPath    string   `json:"config_path,omitempty"`
+	Wait          bool     `json:"wait,omitempty"`           // Return only after the services are ready
+	RemoveOrphans bool     `json:"remove_orphans,omitempty"` // Remove services no longer in the config file
+	Env           string   `json:"env,omitempty"`            // Config overlay the client selected, which must be the daemon's
+	Overrides     []string `json:"overrides,omitempty"`      // Files merged onto the config file, which must be the daemon's for its primary project
 }
 
 // DownParams represents parameters for the "down" method.
 type DownParams struct {
-	Services []string `json:"services,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	ConfigPath string   `json:"config_path,omitempty"`
 }
 
 // RestartParams represents parameters for the "restart" method.
 type RestartParams struct {
-	Services []string `json:"services,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	ConfigPath string   `json:"config_path,omitempty"`
+	Rolling    bool     `json:"rolling,omitempty"` // One service at a time, each after the previous is ready
+}
+
+// ReloadParams represents parameters for the "reload" method.
+type ReloadParams struct {
+	ConfigPath string   `json:"config_path,omitempty"`
+	Env        string   `json:"env,omitempty"`       // Config overlay the client selected, which must be the daemon's
+	Overrides  []string `json:"overrides,omitempty"` // Files merged onto the config file, which must be the daemon's for its primary project
+}
+
+// AuthParams represents parameters for the "auth" method.
+type AuthParams struct {
+	Token string `json:"token"`
+}
+
+// ScaleParams represents parameters for the "scale" method.
+type ScaleParams struct {
+	Replicas   map[string]int `json:"replicas"` // Number of replicas by service, named as in the config file
+	ConfigPath string         `json:"config_path,omitempty"`
+	Env        string         `json:"env,omitempty"`
+	Overrides  []string       `json:"overrides,omitempty"`
 }
 
 // LogsParams represents parameters for the "logs" method.
 type LogsParams struct {
-	Services []string `json:"services,omitempty"`
-	Follow   bool     `json:"follow,omitempty"`
-	Lines    int      `json:"lines,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	Follow     bool     `json:"follow,omitempty"`
+	Lines      int      `json:"lines,omitempty"`
+	Since      string   `json:"since,omitempty"`  // RFC 3339 time of the oldest line
+	Stream     string   `json:"stream,omitempty"` // Only lines of "stdout" or "stderr", plus markers
+	Grep       string   `json:"grep,omitempty"`   // Only lines matching a regexp (RE2 syntax), plus markers
+	ConfigPath string   `json:"config_path,omitempty"`
+	Batch      bool     `json:"batch,omitempty"` // Accept "log_batch" notifications
 }
 
 // ServiceStatus represents the status of a single service.
@@ -160,17 +226,152 @@ type ServiceStatus struct {
 	Restarts  int    `json:"restarts"`
 	StartedAt string `json:"started_at,omitempty"`
 	ExitCode  int    `json:"exit_code,omitempty"`
+	Signal    string `json:"signal,omitempty"`    // Signal that killed the last run, e.g. "SIGKILL"
+	ExitedAt  string `json:"exited_at,omitempty"` // When the last run exited, if it is not running
+	Health    string `json:"health,omitempty"`
+	Ready     bool   `json:"ready"`
+	External  string `json:"external,omitempty"` // Address of an external service
+	Color     int    `json:"color"`              // Color index assigned by the daemon
+	Ports     []int  `json:"ports,omitempty"`    // Ports of the last run, including picked "auto" ports
+
+	// Resource use of a running service's process group, sampled every few
+	// seconds; absent until the first sample
+	CPU    *float64 `json:"cpu,omitempty"`    // Percent of one core since the previous sample
+	Memory int64    `json:"memory,omitempty"` // Resident memory in bytes
+
+	// While the state is "restarting", when the next restart is attempted
+	// (RFC 3339) and its number, counting all restarts of the service
+	NextRestartAt  string `json:"next_restart_at,omitempty"`
+	RestartAttempt int    `json:"restart_attempt,omitempty"`
+
+	// Configuration the service is run with
+	Command    string   `json:"command,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty"`
+	Restart    string   `json:"restart,omitempty"`
+	DependsOn  []string `json:"depends_on,omitempty"`
 }
 
 // StatusResult represents the result of a "status" request.
 type StatusResult struct {
 	Services []ServiceStatus `json:"services"`
+	Env      string          `json:"env,omitempty"` // Config overlay the daemon runs with
 }
 
 // UpResult represents the result of an "up" request.
 type UpResult struct {
-	Started []string `json:"started,omitempty"`
-	Failed  []string `json:"failed,omitempty"`
+	Removed  []string          `json:"removed,omitempty"` // Orphans removed with RemoveOrphans
+	Started  []string          `json:"started,omitempty"`
+	Failed   []string          `json:"failed,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"` // Why each failed service failed, by name
+	NotReady []string          `json:"not_ready,omitempty"`
+}
+
+// VersionResult represents the result of a "version" request.
+type VersionResult struct {
+	Version string `json:"version"`
+}
+
+// PingResult represents the result of a "ping" request.
+type PingResult struct {
+	PID int `json:"pid"` // Process ID of the daemon
+}
+
+// StatsResult represents the result of a "daemon.stats" request.
+type StatsResult struct {
+	Version        string   `json:"version"`
+	PID            int      `json:"pid"`
+	StartedAt      string   `json:"started_at"`
+	UptimeSeconds  float64  `json:"uptime_seconds"`
+	ConfigPath     string   `json:"config_path"`
+	Projects       []string `json:"projects,omitempty"` // Config paths of additional projects
+	EventsPath     string   `json:"events_path,omitempty"`
+	Goroutines     int      `json:"goroutines"`
+	Connections    int      `json:"connections"` // Open client connections, including this one
+	LogLines       int      `json:"log_lines"`
+	LogBytes       int      `json:"log_bytes"`        // Size of the lines in the in-memory log buffers
+	LogMemoryLimit int64    `json:"log_memory_limit"` // Limit of log_bytes (0: unlimited)
+	LogEvicted     int64    `json:"log_evicted"`      // Lines evicted to stay within the limit
+	LogDropped     int64    `json:"log_dropped"`      // Lines dropped for followers that fell behind
+	LogSubscribers int      `json:"log_subscribers"`
+}
+
+// HistoryParams represents parameters for the "history" method.
+type HistoryParams struct {
+	Service    string `json:"service"`
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+// RunInfo represents a single run of a service.
+type RunInfo struct {
+	StartedAt string `json:"started_at"`
+	ExitedAt  string `json:"exited_at,omitempty"` // Empty while the run is in progress
+	ExitCode  int    `json:"exit_code"`
+	Signal    string `json:"signal,omitempty"` // Signal that killed the run, e.g. "SIGKILL"
+	Reason    string `json:"reason"`           // What started the run: "up", "restart", or "policy"
+	Error     string `json:"error,omitempty"`  // Why the run failed to start, if it did
+}
+
+// HistoryResult represents the result of a "history" request.
+type HistoryResult struct {
+	Service string    `json:"service"`
+	Runs    []RunInfo `json:"runs"` // Oldest first
+}
+
+// InspectParams represents parameters for the "inspect" method.
+type InspectParams struct {
+	Service    string `json:"service"`
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+// InspectResult represents the result of an "inspect" request.
+type InspectResult struct {
+	Service string            `json:"service"`
+	Config  ServiceConfig     `json:"config"`
+	Status  ServiceStatus     `json:"status"`
+	History []RunInfo         `json:"history"` // Oldest first
+	Logs    LogBufferInfo     `json:"logs"`
+	Env     map[string]string `json:"env"` // Variables comproc sets for the service, with secrets masked
+}
+
+// ServiceConfig is the resolved config of a service, with defaults applied.
+type ServiceConfig struct {
+	Command         string             `json:"command,omitempty"`
+	External        string             `json:"external,omitempty"`
+	Prepare         string             `json:"prepare,omitempty"`
+	WorkingDir      string             `json:"working_dir,omitempty"`
+	Restart         string             `json:"restart"`
+	StopMode        string             `json:"stop_mode"`
+	AttachStdin     string             `json:"attach_stdin"`
+	DependsOn       []string           `json:"depends_on,omitempty"`
+	Ports           []string           `json:"ports,omitempty"`
+	LoginShell      bool               `json:"login_shell,omitempty"`
+	Umask           string             `json:"umask,omitempty"`
+	Isolate         []string           `json:"isolate,omitempty"`
+	Requires        []string           `json:"requires,omitempty"` // Such as `binary "node"`
+	MemRestartLimit string             `json:"mem_restart_limit,omitempty"`
+	Logging         []string           `json:"logging,omitempty"` // Drivers of the log sinks
+	LogFile         string             `json:"log_file,omitempty"`
+	Healthcheck     *HealthcheckConfig `json:"healthcheck,omitempty"`
+	ReadyLogPattern string             `json:"ready_log_pattern,omitempty"`
+}
+
+// HealthcheckConfig is the resolved healthcheck of a service.
+type HealthcheckConfig struct {
+	Command     string `json:"command,omitempty"`
+	WaitForFile string `json:"wait_for_file,omitempty"`
+	Interval    string `json:"interval"`
+	Timeout     string `json:"timeout"`
+	Retries     int    `json:"retries"`
+	StartPeriod string `json:"start_period,omitempty"`
+}
+
+// LogBufferInfo describes the in-memory log buffer of a service.
+type LogBufferInfo struct {
+	Lines    int    `json:"lines"`
+	Bytes    int    `json:"bytes"`    // Size of the buffered lines
+	Capacity int    `json:"capacity"` // Lines the buffer holds at most
+	Sinks    int    `json:"sinks"`    // Additional log sinks from logging
+	History  string `json:"history"`  // Where older lines are kept: "memory", "store", "file", or "none"
 }
 
 // DownResult represents the result of a "down" request.
@@ -182,6 +383,17 @@ type DownResult struct {
 type RestartResult struct {
 	Restarted []string `json:"restarted,omitempty"`
 	Failed    []string `json:"failed,omitempty"`
+	Skipped   []string `json:"skipped,omitempty"` // Left as they were after a rolling restart failed
+}
+
+// ReloadResult represents the result of a "reload" request.
+type ReloadResult struct {
+	Added   []string          `json:"added,omitempty"`
+	Removed []string          `json:"removed,omitempty"`
+	Changed []string          `json:"changed,omitempty"`
+	Started []string          `json:"started,omitempty"` // Added services and restarted services
+	Failed  []string          `json:"failed,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"` // Why each failed service failed, by name
 }
 
 // ShutdownResult represents the result of a "shutdown" request.
@@ -190,26 +402,125 @@ type ShutdownResult struct {
 }
 
 // LogEntry represents a single log entry sent as a notification.
+// Use SetLine and RawLine to access the line, which may be encoded.
 type LogEntry struct {
 	Service   string `json:"service"`
 	Line      string `json:"line"`
+	Encoding  string `json:"encoding,omitempty"` // "" (plain text) or "base64"
 	Timestamp string `json:"timestamp"`
-	Stream    string `json:"stream"` // "stdout" or "stderr"
+	Stream    string `json:"stream"` // "stdout", "stderr", or LogStreamMarker
+	Color     int    `json:"color"`  // Color index of the service, as in ServiceStatus
+}
+
+// LogStreamMarker is the stream of lines added by comproc rather than the
+// service, such as the markers written when a service restarts.
+const LogStreamMarker = "marker"
+
+// LogEncodingBase64 marks a LogEntry whose Line is base64-encoded.
+const LogEncodingBase64 = "base64"
+
+// SetLine stores a raw log line. Lines that are not valid UTF-8 are
+// base64-encoded, because JSON would otherwise replace the invalid bytes.
+// Control characters need no special handling as JSON escapes them.
+func (e *LogEntry) SetLine(line string) {
+	if utf8.ValidString(line) {
+		e.Line = line
+		e.Encoding = ""
+		return
+	}
+	e.Line = base64.StdEncoding.EncodeToString([]byte(line))
+	e.Encoding = LogEncodingBase64
+}
+
+// RawLine returns the original log line, decoding it if necessary.
+// A line that fails to decode is returned as is.
+func (e *LogEntry) RawLine() string {
+	if e.Encoding != LogEncodingBase64 {
+		return e.Line
+	}
+	data, err := base64.StdEncoding.DecodeString(e.Line)
+	if err != nil {
+		return e.Line
+	}
+	return string(data)
+}
+
+// LogBatch represents several log entries sent as one notification.
+type LogBatch struct {
+	Entries []LogEntry `json:"entries"`
+}
+
+// LogDropped reports log lines that the daemon dropped instead of sending
+// them to a follower that fell behind. It is sent where the lines would have
+// been.
+type LogDropped struct {
+	Count int `json:"count"` // Lines dropped since the previous notification
+	Total int `json:"total"` // Lines dropped since the follower subscribed
 }
 
 // AttachParams represents parameters for the "attach" method.
 type AttachParams struct {
-	Service string `json:"service"`
+	Service    string `json:"service"`
+	ConfigPath string `json:"config_path,omitempty"`
+	Batch      bool   `json:"batch,omitempty"`     // Accept "log_batch" notifications
+	ReadOnly   bool   `json:"read_only,omitempty"` // Watch without sending input
 }
 
 // AttachResult represents the result of an "attach" request.
 type AttachResult struct {
 	Lines []LogEntry `json:"lines"`
+	AttachState
+}
+
+// AttachState describes the clients attached to a service, as seen by one
+// of them.
+type AttachState struct {
+	Clients int  `json:"clients"` // Attached clients, including this one
+	Stdin   bool `json:"stdin"`   // Whether this client's input reaches the service
+}
+
+// StdinParams represents parameters for the "stdin" request, which writes
+// data to a service's stdin without attaching to it.
+type StdinParams struct {
+	Service    string `json:"service"`
+	Data       []byte `json:"data"`
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+// StdinResult represents the result of a "stdin" request.
+type StdinResult struct {
+	Written int `json:"written"`
+}
+
+// RunParams represents the params of a "run" stream, which runs a one-off
+// command in a service's working directory and environment.
+type RunParams struct {
+	Service    string   `json:"service"`
+	Command    []string `json:"command"` // Program and arguments, run without a shell
+	ConfigPath string   `json:"config_path,omitempty"`
+	Stderr     int      `json:"stderr,omitempty"` // Channel of a "stderr" stream; without one, stderr is sent as stdout
+}
+
+// ExecParams represents the params of an "exec" stream, which is like "run"
+// but requires the service to be running and may run the command in a
+// pseudo-terminal.
+type ExecParams struct {
+	RunParams
+	TTY    *TerminalSize `json:"tty,omitempty"`    // Size of the pseudo-terminal, if one is wanted
+	Resize int           `json:"resize,omitempty"` // Channel of a "resize" stream for the pseudo-terminal
+}
+
+// TerminalSize represents the size of a terminal in characters.
+type TerminalSize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
 }
 
-// StdinData represents stdin data sent from client to daemon.
-type StdinData struct {
-	Data string `json:"data"`
+// RunExit represents the exit status of the command of a "run" or "exec"
+// stream, the result its stream is closed with.
+type RunExit struct {
+	ExitCode int    `json:"exit_code"`        // 128 plus the signal number if killed by a signal
+	Signal   string `json:"signal,omitempty"` // Name of the signal that killed the command
 }
 
 // ParseParams unmarshals request params into the given struct.
@@ -176,3 +176,44 @@ func TestParseResult_NilResult(t *testing.T) {
 		t.Errorf("unexpected error for nil result: %v", err)
 	}
 }
+
+func TestLogEntry_SetLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		encoding string
+	}{
+		{"plain text", "hello world", ""},
+		{"control characters", "\x1b[31mred\x1b[0m\ttab\x00nul", ""},
+		{"invalid UTF-8", "bad \xff\xfe byte", LogEncodingBase64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry LogEntry
+			entry.SetLine(tt.line)
+			if entry.Encoding != tt.encoding {
+				t.Errorf("expected encoding %q, got %q", tt.encoding, entry.Encoding)
+			}
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			var decoded LogEntry
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if got := decoded.RawLine(); got != tt.line {
+				t.Errorf("expected %q after round trip, got %q", tt.line, got)
+			}
+		})
+	}
+}
+
+func TestLogEntry_RawLineInvalidBase64(t *testing.T) {
+	entry := LogEntry{Line: "not base64!", Encoding: LogEncodingBase64}
+	if got := entry.RawLine(); got != "not base64!" {
+		t.Errorf("expected line to be returned as is, got %q", got)
+	}
+}
@@ -0,0 +1,416 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Streams are byte channels multiplexed over a connection alongside regular
+// requests. Either side opens a stream with a "stream.open" notification
+// that names its kind, such as StreamKindStdin, and a channel ID. Both sides
+// then send "stream.data" notifications on the channel, and each side ends
+// its direction with "stream.close", optionally carrying a Result or an
+// Error. Data is base64-encoded in JSON, so streams are binary-safe.
+
+// Stream method names
+const (
+	MethodStreamOpen  = "stream.open"
+	MethodStreamData  = "stream.data"
+	MethodStreamClose = "stream.close"
+)
+
+// Stream kinds
+const (
+	// StreamKindStdin writes the data sent by the client to a service's
+	// stdin. Its params are StdinParams without data. The daemon closes
+	// its direction once all data is written, with an error if it failed.
+	StreamKindStdin = "stdin"
+
+	// StreamKindAttach carries the input of a client attached with
+	// "attach" to the service's stdin, as far as the service's
+	// attach_stdin policy lets it through. It has no params and is opened
+	// once the "attach" request succeeds, on the same connection.
+	StreamKindAttach = "attach"
+
+	// StreamKindRun runs a one-off command in a service's environment. Its
+	// params are RunParams. The data sent by the client is the command's
+	// stdin, which ends when the client closes its direction, and the
+	// daemon sends the command's stdout. The daemon closes its direction
+	// once the command exits, with a RunExit result, or with an error if
+	// the command can't be run. The command is stopped if the client
+	// disconnects first.
+	StreamKindRun = "run"
+
+	// StreamKindExec is like StreamKindRun, with ExecParams, but requires
+	// the service to be running and may run the command in a
+	// pseudo-terminal, whose output is all sent as stdout.
+	StreamKindExec = "exec"
+
+	// StreamKindStderr carries the stderr of the command of the "run" or
+	// "exec" stream that names it in its params. The client opens it
+	// first, without params, and the daemon closes its direction once the
+	// command's stderr ends.
+	StreamKindStderr = "stderr"
+
+	// StreamKindResize carries the sizes of the client's terminal to the
+	// pseudo-terminal of the "exec" stream that names it in its params, as
+	// JSON-encoded TerminalSize values. The client opens it first, without
+	// params.
+	StreamKindResize = "resize"
+)
+
+// StreamChunkSize is the largest amount of data sent in one "stream.data"
+// notification.
+const StreamChunkSize = 32 << 10
+
+// StreamOpen represents the params of a "stream.open" notification.
+type StreamOpen struct {
+	Channel int             `json:"channel"`
+	Kind    string          `json:"kind"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// StreamData represents the params of a "stream.data" notification.
+type StreamData struct {
+	Channel int    `json:"channel"`
+	Data    []byte `json:"data"`
+}
+
+// StreamClose represents the params of a "stream.close" notification.
+type StreamClose struct {
+	Channel int             `json:"channel"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// IsStreamMethod reports whether a method is one of the stream methods.
+func IsStreamMethod(method string) bool {
+	switch method {
+	case MethodStreamOpen, MethodStreamData, MethodStreamClose:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrStreamClosed is returned when writing to a stream whose direction has
+// been closed, or whose connection is gone.
+var ErrStreamClosed = errors.New("stream is closed")
+
+// StreamMux keeps track of the streams of one connection. Incoming stream
+// notifications are passed to Handle by whoever reads the connection, and
+// streams write their notifications to the connection directly.
+type StreamMux struct {
+	mu      sync.Mutex
+	wmu     sync.Mutex // Serializes writes of notifications
+	w       io.Writer
+	streams map[int]*Stream
+	nextID  int
+	closed  bool
+	accept  func(*Stream, StreamOpen)
+}
+
+// NewStreamMux creates a stream multiplexer writing to w. The two sides of
+// a connection pick channel IDs of their own: odd ones on the client side
+// and even ones on the daemon side. accept is called with streams opened by
+// the peer; it must not block. If accept is nil, such streams are refused.
+func NewStreamMux(w io.Writer, client bool, accept func(*Stream, StreamOpen)) *StreamMux {
+	m := &StreamMux{
+		w:       w,
+		streams: make(map[int]*Stream),
+		nextID:  2,
+		accept:  accept,
+	}
+	if client {
+		m.nextID = 1
+	}
+	return m
+}
+
+// Open opens a stream of the given kind.
+func (m *StreamMux) Open(kind string, params any) (*Stream, error) {
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+		raw = data
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrStreamClosed
+	}
+	s := newStream(m, m.nextID)
+	m.nextID += 2
+	m.streams[s.id] = s
+	m.mu.Unlock()
+
+	if err := m.send(MethodStreamOpen, StreamOpen{Channel: s.id, Kind: kind, Params: raw}); err != nil {
+		m.remove(s.id)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handle processes a stream notification read from the connection. It
+// returns false if req is not a stream notification.
+func (m *StreamMux) Handle(req *Request) bool {
+	if req.ID != nil || !IsStreamMethod(req.Method) {
+		return false
+	}
+
+	switch req.Method {
+	case MethodStreamOpen:
+		var open StreamOpen
+		if err := req.ParseParams(&open); err != nil {
+			return true
+		}
+		m.mu.Lock()
+		if _, ok := m.streams[open.Channel]; ok || m.closed {
+			m.mu.Unlock()
+			return true
+		}
+		s := newStream(m, open.Channel)
+		m.streams[s.id] = s
+		m.mu.Unlock()
+
+		if m.accept == nil {
+			s.CloseWithError(errors.New("streams are not accepted"))
+			return true
+		}
+		m.accept(s, open)
+
+	case MethodStreamData:
+		var data StreamData
+		if err := req.ParseParams(&data); err != nil {
+			return true
+		}
+		if s := m.stream(data.Channel); s != nil {
+			s.receive(data.Data)
+		}
+
+	case MethodStreamClose:
+		var c StreamClose
+		if err := req.ParseParams(&c); err != nil {
+			return true
+		}
+		if s := m.stream(c.Channel); s != nil {
+			var err error = io.EOF
+			if c.Error != nil {
+				err = c.Error
+			}
+			s.remoteClose(err, c.Result)
+		}
+	}
+	return true
+}
+
+// Close ends all streams as the connection is gone. Pending reads return
+// ErrStreamClosed.
+func (m *StreamMux) Close() {
+	m.mu.Lock()
+	m.closed = true
+	streams := m.streams
+	m.streams = make(map[int]*Stream)
+	m.mu.Unlock()
+
+	for _, s := range streams {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		s.remoteClose(ErrStreamClosed, nil)
+	}
+}
+
+func (m *StreamMux) stream(id int) *Stream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.streams[id]
+}
+
+func (m *StreamMux) remove(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, id)
+}
+
+func (m *StreamMux) send(method string, params any) error {
+	notification, err := NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	return json.NewEncoder(m.w).Encode(notification)
+}
+
+// Stream is one channel of a StreamMux. Reads return the data sent by the
+// peer, and io.EOF or the peer's error once the peer has closed its
+// direction. Data arriving before it is read is buffered, so a slow reader
+// doesn't hold up other traffic on the connection.
+type Stream struct {
+	mux *StreamMux
+	id  int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	rerr    error           // Set once the peer has closed its direction
+	rresult json.RawMessage // The result the peer closed its direction with
+	closed  bool            // Whether this side has closed its direction
+}
+
+func newStream(m *StreamMux, id int) *Stream {
+	s := &Stream{mux: m, id: id}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// ID returns the stream's channel ID.
+func (s *Stream) ID() int {
+	return s.id
+}
+
+// Read reads data sent by the peer.
+func (s *Stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.buf) == 0 && s.rerr == nil {
+		s.cond.Wait()
+	}
+	if len(s.buf) == 0 {
+		return 0, s.rerr
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// Write sends data to the peer in chunks of up to StreamChunkSize.
+func (s *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return written, ErrStreamClosed
+		}
+
+		chunk := p[:min(len(p), StreamChunkSize)]
+		if err := s.mux.send(MethodStreamData, StreamData{Channel: s.id, Data: chunk}); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Close closes this side's direction of the stream.
+func (s *Stream) Close() error {
+	return s.CloseWithError(nil)
+}
+
+// CloseWithError closes this side's direction of the stream, passing err to
+// the peer's reads instead of io.EOF if it is not nil. The peer receives err
+// as an *Error, with the StreamError code unless err is an *Error itself.
+func (s *Stream) CloseWithError(err error) error {
+	c := StreamClose{Channel: s.id}
+	if err != nil {
+		if !errors.As(err, &c.Error) {
+			c.Error = &Error{Code: StreamError, Message: err.Error()}
+		}
+	}
+	return s.close(c)
+}
+
+// CloseWithResult closes this side's direction of the stream like Close,
+// passing result to the peer, which gets it with Result.
+func (s *Stream) CloseWithResult(result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	return s.close(StreamClose{Channel: s.id, Result: data})
+}
+
+func (s *Stream) close(c StreamClose) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	done := s.rerr != nil
+	s.mu.Unlock()
+
+	if done {
+		s.mux.remove(s.id)
+	}
+	return s.mux.send(MethodStreamClose, c)
+}
+
+// Done reports whether the peer has closed its direction of the stream.
+func (s *Stream) Done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rerr != nil
+}
+
+// Err returns the error the peer closed its direction of the stream with.
+// It returns nil while the direction is open or if it was closed without
+// an error.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rerr == io.EOF {
+		return nil
+	}
+	return s.rerr
+}
+
+// Result unmarshals the result the peer closed its direction of the stream
+// with into v. It leaves v unchanged if there is none.
+func (s *Stream) Result(v any) error {
+	s.mu.Lock()
+	result := s.rresult
+	s.mu.Unlock()
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(result, v)
+}
+
+func (s *Stream) receive(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rerr != nil {
+		return
+	}
+	s.buf = append(s.buf, data...)
+	s.cond.Broadcast()
+}
+
+func (s *Stream) remoteClose(err error, result json.RawMessage) {
+	s.mu.Lock()
+	if s.rerr != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.rerr = err
+	s.rresult = result
+	done := s.closed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if done {
+		s.mux.remove(s.id)
+	}
+}
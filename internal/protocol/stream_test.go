@@ -0,0 +1,227 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// connectMuxes connects a client and a daemon side StreamMux over a pipe,
+// with a goroutine on each side passing incoming notifications to Handle.
+// Regular requests read on the daemon side are sent to requests.
+func connectMuxes(t *testing.T, accept func(*Stream, StreamOpen)) (client *StreamMux, requests <-chan *Request) {
+	t.Helper()
+	clientConn, daemonConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		daemonConn.Close()
+	})
+
+	client = NewStreamMux(clientConn, true, nil)
+	daemon := NewStreamMux(daemonConn, false, accept)
+	reqs := make(chan *Request, 10)
+
+	serve := func(conn net.Conn, m *StreamMux, reqs chan<- *Request) {
+		defer m.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				t.Errorf("invalid line: %s", line)
+				return
+			}
+			if !m.Handle(&req) && reqs != nil {
+				reqs <- &req
+			}
+		}
+	}
+	go serve(clientConn, client, nil)
+	go serve(daemonConn, daemon, reqs)
+	return client, reqs
+}
+
+func TestStreamMux_Echo(t *testing.T) {
+	client, _ := connectMuxes(t, func(st *Stream, open StreamOpen) {
+		if open.Kind != "echo" || string(open.Params) != `{"n":1}` {
+			st.CloseWithError(errors.New("unexpected open"))
+			return
+		}
+		go func() {
+			io.Copy(st, st)
+			st.Close()
+		}()
+	})
+
+	st, err := client.Open("echo", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if st.ID()%2 != 1 {
+		t.Errorf("expected an odd channel ID on the client side, got %d", st.ID())
+	}
+
+	// Binary data larger than a chunk
+	data := make([]byte, StreamChunkSize*2+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go func() {
+		st.Write(data)
+		st.Close()
+	}()
+
+	got, err := io.ReadAll(st)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %d echoed bytes, got %d", len(data), len(got))
+	}
+	if st.Err() != nil {
+		t.Errorf("expected no error, got %v", st.Err())
+	}
+}
+
+func TestStreamMux_CloseWithError(t *testing.T) {
+	client, _ := connectMuxes(t, func(st *Stream, open StreamOpen) {
+		st.CloseWithError(&Error{Code: ServiceError, Message: "boom"})
+	})
+
+	st, err := client.Open("fail", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	_, err = io.ReadAll(st)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != ServiceError || rpcErr.Message != "boom" {
+		t.Fatalf("expected the service error, got %v", err)
+	}
+	if !errors.Is(st.Err(), err) {
+		t.Errorf("expected Err to return %v, got %v", err, st.Err())
+	}
+}
+
+func TestStreamMux_CloseWithResult(t *testing.T) {
+	client, _ := connectMuxes(t, func(st *Stream, open StreamOpen) {
+		go func() {
+			st.Write([]byte("done"))
+			st.CloseWithResult(RunExit{ExitCode: 3})
+		}()
+	})
+
+	st, err := client.Open("result", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, err := io.ReadAll(st)
+	if err != nil || string(data) != "done" {
+		t.Fatalf("expected the data before the result, got %q, %v", data, err)
+	}
+	var exit RunExit
+	if err := st.Result(&exit); err != nil || exit.ExitCode != 3 {
+		t.Errorf("expected the result, got %+v, %v", exit, err)
+	}
+}
+
+func TestStreamMux_Refused(t *testing.T) {
+	// The client side accepts no streams
+	clientConn, daemonConn := net.Pipe()
+	defer clientConn.Close()
+	defer daemonConn.Close()
+	client := NewStreamMux(clientConn, true, nil)
+	daemon := NewStreamMux(daemonConn, false, nil)
+
+	go func() {
+		reader := bufio.NewReader(clientConn)
+		line, _ := reader.ReadBytes('\n')
+		var req Request
+		json.Unmarshal(line, &req)
+		client.Handle(&req)
+	}()
+	go func() {
+		reader := bufio.NewReader(daemonConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var req Request
+			json.Unmarshal(line, &req)
+			daemon.Handle(&req)
+		}
+	}()
+
+	st, err := daemon.Open("push", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if st.ID()%2 != 0 {
+		t.Errorf("expected an even channel ID on the daemon side, got %d", st.ID())
+	}
+	_, err = io.ReadAll(st)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != StreamError {
+		t.Fatalf("expected a stream error, got %v", err)
+	}
+}
+
+func TestStreamMux_InterleavedWithRequests(t *testing.T) {
+	received := make(chan []byte, 1)
+	client, requests := connectMuxes(t, func(st *Stream, open StreamOpen) {
+		go func() {
+			data, _ := io.ReadAll(st)
+			received <- data
+			st.Close()
+		}()
+	})
+
+	st, err := client.Open("sink", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	st.Write([]byte("before "))
+	// A regular request sent in the middle of the stream
+	client.send(MethodStatus, nil)
+	st.Write([]byte("after"))
+	st.Close()
+
+	req := <-requests
+	if req.Method != MethodStatus {
+		t.Errorf("expected the %q request, got %q", MethodStatus, req.Method)
+	}
+	if got := string(<-received); got != "before after" {
+		t.Errorf("expected %q, got %q", "before after", got)
+	}
+}
+
+func TestStreamMux_ConnectionClosed(t *testing.T) {
+	clientConn, daemonConn := net.Pipe()
+	defer daemonConn.Close()
+	client := NewStreamMux(clientConn, true, nil)
+	go io.Copy(io.Discard, daemonConn)
+
+	st, err := client.Open("any", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	client.Close()
+	clientConn.Close()
+
+	if _, err := st.Read(make([]byte, 1)); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("expected ErrStreamClosed from Read, got %v", err)
+	}
+	if _, err := st.Write([]byte("x")); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("expected ErrStreamClosed from Write, got %v", err)
+	}
+	if _, err := client.Open("any", nil); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("expected ErrStreamClosed from Open, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package suggest finds close matches for mistyped names, to offer
+// "did you mean" hints in error messages.
+package suggest
+
+import (
+	"slices"
+	"strings"
+)
+
+// Closest returns the candidate closest to name by edit distance, or ""
+// if none is close enough to be a likely typo. Ties are broken by the
+// order of candidates.
+func Closest(name string, candidates []string) string {
+	if similar := Similar(name, candidates); len(similar) > 0 {
+		return similar[0]
+	}
+	return ""
+}
+
+// Similar returns the candidates close enough to name by edit distance to
+// be likely typos, closest first. Ties are broken by the order of
+// candidates.
+func Similar(name string, candidates []string) []string {
+	// Allow about one typo per three characters, and at least one
+	limit := max(1, len(name)/3)
+	type match struct {
+		candidate string
+		dist      int
+	}
+	var matches []match
+	for _, c := range candidates {
+		if d := distance(strings.ToLower(name), strings.ToLower(c)); d <= limit {
+			matches = append(matches, match{c, d})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int { return a.dist - b.dist })
+
+	var similar []string
+	for _, m := range matches {
+		similar = append(similar, m.candidate)
+	}
+	return similar
+}
+
+// Prefixed returns the candidates that start with prefix.
+func Prefixed(prefix string, candidates []string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// distance returns the optimal string alignment distance between a and b:
+// the number of insertions, deletions, substitutions, and transpositions
+// of adjacent characters needed to turn one into the other.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] is the distance between ra[:i] and rb[:j]
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,72 @@
+package suggest
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"api", "db", "worker", "web"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"aip", "api"}, // Transposition
+		{"wroker", "worker"},
+		{"workr", "worker"},
+		{"API", "api"},
+		{"wbe", "web"},
+		{"xyz", ""},
+		{"postgres", ""},
+	}
+	for _, tt := range tests {
+		if got := Closest(tt.name, candidates); got != tt.want {
+			t.Errorf("Closest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	candidates := []string{"stop", "status", "stats", "start"}
+	if got := Similar("stauts", candidates); !slices.Equal(got, []string{"status", "stats", "start"}) {
+		t.Errorf("unexpected matches: %v", got)
+	}
+	if got := Similar("strat", candidates); !slices.Equal(got, []string{"start"}) {
+		t.Errorf("unexpected matches: %v", got)
+	}
+	if got := Similar("xyz", candidates); got != nil {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
+
+func TestPrefixed(t *testing.T) {
+	candidates := []string{"api", "api-gateway", "db"}
+	if got := Prefixed("api", candidates); !slices.Equal(got, []string{"api", "api-gateway"}) {
+		t.Errorf("unexpected matches: %v", got)
+	}
+	if got := Prefixed("d", candidates); !slices.Equal(got, []string{"db"}) {
+		t.Errorf("unexpected matches: %v", got)
+	}
+	if got := Prefixed("x", candidates); got != nil {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"api", "api", 0},
+		{"api", "aip", 1},
+		{"api", "ap", 1},
+		{"api", "apix", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package version reports the version of the comproc binary.
+package version
+
+import (
+	"runtime/debug"
+)
+
+// Version is the release version. It is set at build time with
+//
+//	go build -ldflags "-X github.com/ryym/comproc/internal/version.Version=v1.2.3"
+//
+// When empty, the version is derived from the Go build information.
+var Version = ""
+
+// String returns the version of the running binary.
+func String() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		// Installed with `go install module@version`
+		return v
+	}
+	return develVersion(info.Settings)
+}
+
+// develVersion builds a version for development builds from the VCS
+// information embedded by the Go toolchain, such as "devel+1a2b3c4d5e6f-dirty".
+func develVersion(settings []debug.BuildSetting) string {
+	var revision string
+	var dirty bool
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+
+	v := "devel"
+	if revision != "" {
+		if len(revision) > 12 {
+			revision = revision[:12]
+		}
+		v += "+" + revision
+		if dirty {
+			v += "-dirty"
+		}
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package version
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestString_Override(t *testing.T) {
+	orig := Version
+	defer func() { Version = orig }()
+
+	Version = "v1.2.3"
+	if got := String(); got != "v1.2.3" {
+		t.Errorf("expected v1.2.3, got %q", got)
+	}
+}
+
+func TestDevelVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []debug.BuildSetting
+		expected string
+	}{
+		{"no vcs info", nil, "devel"},
+		{
+			"clean",
+			[]debug.BuildSetting{{Key: "vcs.revision", Value: "1a2b3c4d5e6f7a8b9c0d"}, {Key: "vcs.modified", Value: "false"}},
+			"devel+1a2b3c4d5e6f",
+		},
+		{
+			"dirty",
+			[]debug.BuildSetting{{Key: "vcs.revision", Value: "1a2b3c4d5e6f7a8b9c0d"}, {Key: "vcs.modified", Value: "true"}},
+			"devel+1a2b3c4d5e6f-dirty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := develVersion(tt.settings); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
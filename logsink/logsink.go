@@ -0,0 +1,67 @@
+// Package logsink adds log drivers to comproc, which services can then use
+// in their logging config next to the built-in file, syslog, command, loki,
+// and gelf drivers:
+//
+//	func init() {
+//		logsink.Register("kafka", func(service string, cfg config.LogSinkConfig, baseDir string) (logsink.Sink, error) {
+//			return newKafkaSink(cfg.URL, service)
+//		})
+//	}
+//
+// Drivers are registered by a program that runs comproc with app.Main, so
+// that both the CLI, which validates the config, and the daemon it spawns
+// from the same binary know them.
+package logsink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ryym/comproc/config"
+)
+
+// Line is a line of output captured from a service.
+type Line struct {
+	Service   string
+	Line      string
+	Timestamp time.Time
+	Stream    string // "stdout", "stderr", or "marker" for lines added by comproc itself
+}
+
+// Sink receives the log lines of a service. Sinks must be safe for use from
+// multiple goroutines, and must not block for long, as they are called as
+// the service writes output.
+type Sink interface {
+	// WriteLine delivers a single log line to the sink.
+	WriteLine(line Line) error
+	// Close flushes and releases any resources held by the sink.
+	Close() error
+}
+
+// Factory creates a sink for a service from its logging config. baseDir is
+// the directory of the config file, used to resolve relative paths.
+type Factory func(service string, cfg config.LogSinkConfig, baseDir string) (Sink, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register registers a factory for a log driver so that it can be referenced
+// from the logging config of services. It must be called before comproc
+// runs, such as from an init function. A driver registered later for the
+// same name replaces the earlier one.
+func Register(driver string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[driver] = factory
+	config.RegisterLogDriver(driver)
+}
+
+// Lookup returns the factory registered for driver.
+func Lookup(driver string) (Factory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	factory, ok := factories[driver]
+	return factory, ok
+}
@@ -0,0 +1,25 @@
+package logsink
+
+import (
+	"testing"
+
+	"github.com/ryym/comproc/config"
+)
+
+func TestRegister(t *testing.T) {
+	if _, ok := Lookup("test-nowhere"); ok {
+		t.Fatal("expected no factory before registering")
+	}
+	Register("test-nowhere", func(service string, cfg config.LogSinkConfig, baseDir string) (Sink, error) {
+		return nil, nil
+	})
+	if _, ok := Lookup("test-nowhere"); !ok {
+		t.Error("expected the registered factory")
+	}
+
+	// The driver is accepted in the logging config once registered
+	_, err := config.Parse([]byte("services:\n  api:\n    command: ./api\n    logging:\n      - driver: test-nowhere\n"))
+	if err != nil {
+		t.Errorf("unexpected config error: %v", err)
+	}
+}
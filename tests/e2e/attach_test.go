@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 22.1: `attach --record` saves the lines sent and the output received during the session with timestamps.
+func TestAttach_Record(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  repl:
+    command: echo "before attach"; while read line; do echo "got $line"; done
+`)
+	f.Up()
+
+	// Input is recorded as it is sent
+	inputPath := filepath.Join(f.TempDir, "input.log")
+	if _, stderr, err := f.RunWithInput("hello\n", "attach", "--record", inputPath, "repl"); err != nil {
+		t.Fatalf("attach failed: %v\n%s", err, stderr)
+	}
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("failed to read transcript: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if fields := strings.Fields(lines[0]); len(fields) != 3 || fields[1] != "stdin" || fields[2] != "hello" {
+		t.Errorf("expected the input in the transcript, got:\n%s", data)
+	}
+	if _, err := time.Parse("2006-01-02T15:04:05.000Z07:00", strings.Fields(lines[0])[0]); err != nil {
+		t.Errorf("expected a timestamp, got %q: %v", lines[0], err)
+	}
+
+	// Output is recorded as it arrives, without the lines shown on attaching
+	outputPath := filepath.Join(f.TempDir, "output.log")
+	cmd, outBuf, err := f.RunAsync("attach", "--read-only", "--record", outputPath, "repl")
+	if err != nil {
+		t.Fatalf("RunAsync attach failed: %v", err)
+	}
+	if err := WaitForContent(outBuf, "got hello", 5*time.Second); err != nil {
+		t.Fatalf("expected recent output on attaching: %v", err)
+	}
+	if _, stderr, err := f.RunWithInput("again\n", "stdin", "repl"); err != nil {
+		t.Fatalf("stdin failed: %v\n%s", err, stderr)
+	}
+	if err := WaitForContent(outBuf, "got again", 5*time.Second); err != nil {
+		t.Errorf("expected streamed output: %v", err)
+	}
+	InterruptAndWait(cmd)
+
+	data, err = os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read transcript: %v", err)
+	}
+	if !strings.Contains(string(data), " stdout got again\n") {
+		t.Errorf("expected the output in the transcript, got:\n%s", data)
+	}
+	if strings.Contains(string(data), "before attach") || strings.Contains(string(data), " stdin ") {
+		t.Errorf("expected only the output of the session, got:\n%s", data)
+	}
+}
+
+// 22.2: `attach` fails for an unknown service, suggesting a similar name.
+func TestAttach_UnknownService(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+`)
+	f.Up()
+
+	_, stderr, err := f.Run("attach", "aip")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected attach to fail with exit code 1, got %v:\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, "service not found: aip (did you mean api?)") {
+		t.Errorf("expected service error, got:\n%s", stderr)
+	}
+}
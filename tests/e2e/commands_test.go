@@ -0,0 +1,157 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 19.1: A command may be abbreviated to a prefix that matches only one command.
+func TestCommands_Abbreviation(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+
+	stdout, stderr, err := f.Run("vers")
+	if err != nil {
+		t.Fatalf("vers failed: %v\n%s", err, stderr)
+	}
+	if !strings.HasPrefix(stdout, "Client: ") {
+		t.Errorf("expected the output of version, got:\n%s", stdout)
+	}
+
+	_, stderr, err = f.Run("st")
+	if err == nil {
+		t.Fatal("expected an error for an ambiguous command")
+	}
+	if !strings.Contains(stderr, "command st is ambiguous (matches stop, status, stdin)") {
+		t.Errorf("expected the matching commands, got:\n%s", stderr)
+	}
+}
+
+// 19.2: An unknown command suggests similar commands and shows a usage hint.
+func TestCommands_Unknown(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+
+	_, stderr, err := f.Run("stauts")
+	if err == nil {
+		t.Fatal("expected an error for an unknown command")
+	}
+	if !strings.Contains(stderr, "unknown command: stauts (did you mean status?)") {
+		t.Errorf("expected a suggestion, got:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "Usage: comproc") {
+		t.Errorf("expected a usage hint, got:\n%s", stderr)
+	}
+}
+
+// 19.3: comproc exits with a distinct code for each kind of failure.
+func TestCommands_ExitCodes(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	exitCode := func(err error) int {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return 0
+	}
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  ok:
+    command: sleep 60
+  bad:
+    command: exit 1
+`)
+
+	if _, _, err := f.Run("unknowncmd"); exitCode(err) != 2 {
+		t.Errorf("expected exit code 2 for an unknown command, got %v", err)
+	}
+	if _, _, err := f.Run("attach", "ok"); exitCode(err) != 4 {
+		t.Errorf("expected exit code 4 without a daemon, got %v", err)
+	}
+	if _, _, err := f.Run("up", "bad"); exitCode(err) != 6 {
+		t.Errorf("expected exit code 6 when all services fail, got %v", err)
+	}
+	if _, _, err := f.Run("up"); exitCode(err) != 5 {
+		t.Errorf("expected exit code 5 when some services fail, got %v", err)
+	}
+
+	invalid := NewFixture(t)
+	invalid.WriteConfig(`
+services:
+  app:
+    restart: always
+`)
+	if _, _, err := invalid.Run("up"); exitCode(err) != 3 {
+		t.Errorf("expected exit code 3 for an invalid config, got %v", err)
+	}
+}
+
+// 19.4: With `--output json`, results and errors are printed as JSON.
+func TestCommands_OutputJSON(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  ok:
+    command: sleep 60
+  bad:
+    command: exit 1
+`)
+
+	stdout, stderr, err := f.Run("--output", "json", "up")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	var result struct {
+		Started []string          `json:"started"`
+		Failed  []string          `json:"failed"`
+		Errors  map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("expected the result as JSON, got %q: %v", stdout, err)
+	}
+	if !slices.Equal(result.Started, []string{"ok"}) || !slices.Equal(result.Failed, []string{"bad"}) || result.Errors["bad"] == "" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	var errOut struct {
+		Code     int      `json:"code"`
+		Message  string   `json:"message"`
+		Services []string `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &errOut); err != nil {
+		t.Fatalf("expected the error as JSON, got %q: %v", stderr, err)
+	}
+	if errOut.Code != 5 || errOut.Message != "some services failed to start" || !slices.Equal(errOut.Services, []string{"bad"}) {
+		t.Errorf("unexpected error: %+v", errOut)
+	}
+
+	stdout, _, err = f.Run("--output", "json", "stop", "ok")
+	if err != nil || strings.TrimSpace(stdout) != `{"stopped":["ok"]}` {
+		t.Errorf("expected the stopped services as JSON, got %q (%v)", stdout, err)
+	}
+}
@@ -1,8 +1,12 @@
 package e2e
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -133,3 +137,444 @@ services:
 		t.Errorf("expected 'circular dependency' error, got: %s", stderr)
 	}
 }
+
+// 8.5: COMPROC_FILE selects the config file when -f is not given.
+func TestConfig_ComprocFileEnv(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	configPath := filepath.Join(f.TempDir, "custom.yaml")
+	err := os.WriteFile(configPath, []byte(`
+services:
+  from-env-file:
+    command: sleep 60
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	stdout, stderr, err := f.RunWithEnv([]string{"COMPROC_FILE=" + configPath}, "status")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "from-env-file") {
+		t.Errorf("expected service from COMPROC_FILE config, got:\n%s", stdout)
+	}
+}
+
+// 8.6: COMPROC_PROJECT selects comproc.yaml in the given directory.
+func TestConfig_ComprocProjectEnv(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	projectDir := filepath.Join(f.TempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("failed to create project dir: %v", err)
+	}
+	err := os.WriteFile(filepath.Join(projectDir, "comproc.yaml"), []byte(`
+services:
+  from-project:
+    command: sleep 60
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	stdout, stderr, err := f.RunWithEnv([]string{"COMPROC_PROJECT=" + projectDir}, "status")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "from-project") {
+		t.Errorf("expected service from COMPROC_PROJECT config, got:\n%s", stdout)
+	}
+}
+
+// 8.7: A service extends a service from another file and overrides some fields.
+func TestConfig_Extends(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	sharedDir := filepath.Join(f.TempDir, "shared")
+	if err := os.MkdirAll(sharedDir, 0755); err != nil {
+		t.Fatalf("failed to create shared dir: %v", err)
+	}
+	err := os.WriteFile(filepath.Join(sharedDir, "comproc.base.yaml"), []byte(`
+services:
+  app:
+    command: sh -c 'echo "GREETING=$GREETING NAME=$NAME"; sleep 60'
+    env:
+      GREETING: hello
+      NAME: base
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write base config: %v", err)
+	}
+	f.WriteConfig(`
+services:
+  app:
+    extends:
+      file: ./shared/comproc.base.yaml
+      service: app
+    env:
+      NAME: local
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, err = f.Run("logs", "-n", "10")
+		if err == nil && strings.Contains(stdout, "GREETING=") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !strings.Contains(stdout, "GREETING=hello NAME=local") {
+		t.Errorf("expected inherited command with overridden env, got:\n%s", stdout)
+	}
+}
+
+// 8.8: `socket.path` and `socket.mode` set where the daemon listens and the socket's permissions.
+func TestConfig_Socket(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	// The path is the fixture's socket so that the cleanup can reach the daemon
+	f.WriteConfig(`
+socket:
+  path: comproc.sock
+  mode: "0660"
+services:
+  app:
+    command: sleep 60
+`)
+	// Clear COMPROC_SOCKET so the path comes from the config
+	if _, stderr, err := f.RunWithEnv([]string{"COMPROC_SOCKET="}, "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	info, err := os.Stat(f.SocketPath)
+	if err != nil {
+		t.Fatalf("expected the socket at the configured path: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("expected socket mode 0660, got %o", perm)
+	}
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 8.9: A `socket.read_only` socket serves status and logs but rejects commands that change services.
+func TestConfig_ReadOnlySocket(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+socket:
+  read_only:
+    path: readonly.sock
+services:
+  app:
+    command: sh -c 'echo hello; sleep 60'
+`)
+	f.Up()
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	roSocket := filepath.Join(f.TempDir, "readonly.sock")
+	stdout, stderr, err := f.Run("--socket", roSocket, "status")
+	if err != nil {
+		t.Fatalf("status on the read-only socket failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "running") {
+		t.Errorf("expected app to be shown as running, got:\n%s", stdout)
+	}
+
+	_, stderr, err = f.Run("--socket", roSocket, "stop", "app")
+	if err == nil {
+		t.Fatal("expected stop on the read-only socket to fail")
+	}
+	if !strings.Contains(stderr, "not allowed on a read-only socket") {
+		t.Errorf("expected a read-only error, got:\n%s", stderr)
+	}
+	if err := f.WaitForState("app", "running", time.Second); err != nil {
+		t.Errorf("expected app to keep running: %v", err)
+	}
+}
+
+// 8.10: `umask` sets the permissions of files the service creates.
+func TestConfig_Umask(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  shared:
+    command: touch shared.txt && sleep 60
+    umask: "0002"
+  private:
+    command: touch private.txt && sleep 60
+    umask: "0077"
+`)
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	for file, want := range map[string]os.FileMode{"shared.txt": 0664, "private.txt": 0600} {
+		path := filepath.Join(f.TempDir, file)
+		var info os.FileInfo
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if i, err := os.Stat(path); err == nil {
+				info = i
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if info == nil {
+			t.Fatalf("expected %s to be created", file)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("expected %s to have mode %04o, got %04o", file, want, got)
+		}
+	}
+}
+
+// 8.11: With `isolate: pid`, stopping a service also kills the processes that left its process group.
+func TestConfig_Isolate(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	// A duration that no other test sleeps for, to find the escaped process
+	f.WriteConfig(`
+services:
+  app:
+    command: setsid sleep 3171 & echo "pid=$$"; sleep 60
+    isolate: pid
+`)
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	escaped := func() bool {
+		entries, _ := os.ReadDir("/proc")
+		for _, e := range entries {
+			cmdline, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+			if err == nil && string(cmdline) == "sleep\x003171\x00" {
+				return true
+			}
+		}
+		return false
+	}
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs")
+		if strings.Contains(stdout, "pid=") && escaped() {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !escaped() {
+		t.Fatal("expected the escaped process to be running")
+	}
+	// PID 1 is comproc's init process, and PIDs of the service's own
+	// namespace are small
+	if !regexp.MustCompile(`pid=\d{1,2}\n`).MatchString(stdout) {
+		t.Errorf("expected a PID from a new namespace, got:\n%s", stdout)
+	}
+
+	if _, stderr, err := f.Run("stop", "app"); err != nil {
+		t.Fatalf("stop failed: %v\n%s", err, stderr)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && escaped() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if escaped() {
+		t.Error("expected the escaped process to be killed with the service")
+	}
+}
+
+// 8.12: `--env` merges the named overlay onto the config, and a daemon rejects `up` with another overlay.
+func TestConfig_EnvOverlay(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    env:
+      LEVEL: base
+      NAME: app
+`)
+	overlay := "services:\n  app:\n    env:\n      LEVEL: staging\n"
+	if err := os.WriteFile(filepath.Join(f.TempDir, "comproc.staging.yaml"), []byte(overlay), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("--env", "staging", "env", "app")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "LEVEL=staging") || !strings.Contains(stdout, "NAME=app") {
+		t.Errorf("expected the overlay's env merged onto the base's, got:\n%s", stdout)
+	}
+
+	if _, stderr, err := f.Run("--env", "staging", "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	stdout, _, err = f.Run("status")
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(stdout, "Env: staging") {
+		t.Errorf("expected status to show the overlay, got:\n%s", stdout)
+	}
+
+	_, stderr, err = f.Run("up")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 || !strings.Contains(stderr, `the daemon runs with env "staging", not no env`) {
+		t.Errorf("expected up without the overlay to fail with a config error, got %v\n%s", err, stderr)
+	}
+}
+
+// 8.13: A second `-f` merges an override file onto the config, and a daemon rejects `up` without it.
+func TestConfig_OverrideFiles(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    env:
+      LEVEL: base
+      NAME: app
+`)
+	override := filepath.Join(f.TempDir, "comproc.override.yaml")
+	content := "services:\n  app:\n    env:\n      LEVEL: local\n  worker:\n    command: sleep 60\n"
+	if err := os.WriteFile(override, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("-f", override, "env", "app")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "LEVEL=local") || !strings.Contains(stdout, "NAME=app") {
+		t.Errorf("expected the override's env merged onto the base's, got:\n%s", stdout)
+	}
+
+	if _, stderr, err := f.Run("-f", override, "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForState("worker", "running", 5*time.Second); err != nil {
+		t.Error(err)
+	}
+
+	_, stderr, err = f.Run("up")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 || !strings.Contains(stderr, "the daemon runs with override files "+override+", not no override files") {
+		t.Errorf("expected up without the override file to fail with a config error, got %v\n%s", err, stderr)
+	}
+}
+
+// 8.14: `include` adds the services of other files, which run in the directory of the file that defines them.
+func TestConfig_Include(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	apiDir := filepath.Join(f.TempDir, "services", "api")
+	if err := os.MkdirAll(apiDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	api := "services:\n  api:\n    command: sh -c 'echo \"cwd=$(pwd)\"; sleep 60'\n"
+	if err := os.WriteFile(filepath.Join(apiDir, "comproc.yaml"), []byte(api), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteConfig(`
+include:
+  - services/api/comproc.yaml
+services:
+  proxy:
+    command: sleep 60
+    depends_on: [api]
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "-n", "10", "api")
+		if strings.Contains(stdout, "cwd=") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(stdout, "cwd="+apiDir) {
+		t.Errorf("expected api to run in %s, got:\n%s", apiDir, stdout)
+	}
+	if err := f.WaitForState("proxy", "running", 5*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// 8.15: A `command` written as a list runs the program directly, with its arguments as given.
+func TestConfig_ExecFormCommand(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	script := "#!/bin/sh\nprintf 'arg=%s\\n' \"$@\"\nexec sleep 60\n"
+	if err := os.WriteFile(filepath.Join(f.TempDir, "app.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteConfig(`
+services:
+  app:
+    command: ["./app.sh", "it's $HOME", "*"]
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "--raw", "app")
+		if strings.Count(stdout, "arg=") == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stdout != "arg=it's $HOME\narg=*\n" {
+		t.Errorf("expected the arguments as given, got %q", stdout)
+	}
+
+	// The program replaced itself with sleep, which is the service's process
+	st, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", st.PID)); err == nil && strings.TrimSpace(string(comm)) != "sleep" {
+		t.Errorf("expected the service's PID to be the program's, got %q", comm)
+	}
+
+	stdout, _, _ = f.Run("status", "--wide")
+	if !strings.Contains(stdout, `./app.sh 'it'\''s $HOME' '*'`) {
+		t.Errorf("expected the command quoted for a shell, got:\n%s", stdout)
+	}
+}
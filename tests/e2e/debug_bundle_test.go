@@ -0,0 +1,116 @@
+package e2e
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readBundle returns the files of a debug bundle by their path below its
+// top-level directory.
+func readBundle(t *testing.T, bundlePath string) map[string]string {
+	t.Helper()
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to read bundle: %v", err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		dir, name, _ := strings.Cut(hdr.Name, "/")
+		if !strings.HasPrefix(dir, "comproc-debug-") {
+			t.Errorf("expected files below a comproc-debug- directory, got %s", hdr.Name)
+		}
+		files[name] = string(data)
+	}
+	return files
+}
+
+// 23.1: `debug-bundle` packages the masked config, status, logs, daemon output, and events into a tarball.
+func TestDebugBundle(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: echo "api listening"; sleep 60
+    env:
+      API_TOKEN: s3cr3t-value
+`)
+	f.Up()
+
+	bundlePath := filepath.Join(f.TempDir, "bundle.tar.gz")
+	stdout, stderr, err := f.Run("debug-bundle", "-o", bundlePath)
+	if err != nil {
+		t.Fatalf("debug-bundle failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Wrote "+bundlePath) {
+		t.Errorf("expected the bundle path in the output, got: %s", stdout)
+	}
+
+	files := readBundle(t, bundlePath)
+	for _, name := range []string{"config.yaml", "status.json", "logs/api.log", "version.txt", "daemon.log", "events.jsonl"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the bundle, got %v", name, files)
+		}
+	}
+	if strings.Contains(files["config.yaml"], "s3cr3t-value") || !strings.Contains(files["config.yaml"], "API_TOKEN: '********'") {
+		t.Errorf("expected the token to be masked, got:\n%s", files["config.yaml"])
+	}
+	if !strings.Contains(files["status.json"], `"state": "running"`) {
+		t.Errorf("expected the status of api, got:\n%s", files["status.json"])
+	}
+	if !strings.Contains(files["logs/api.log"], "stdout api listening") {
+		t.Errorf("expected the output of api, got:\n%s", files["logs/api.log"])
+	}
+	if !strings.Contains(files["events.jsonl"], `"event":"service.started"`) {
+		t.Errorf("expected the events, got:\n%s", files["events.jsonl"])
+	}
+}
+
+// 23.2: Without a daemon, `debug-bundle` still packages the config.
+func TestDebugBundle_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+`)
+	bundlePath := filepath.Join(f.TempDir, "bundle.tar.gz")
+	_, stderr, err := f.Run("debug-bundle", "-o", bundlePath)
+	if err != nil {
+		t.Fatalf("debug-bundle failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Daemon is not running") {
+		t.Errorf("expected a note about the daemon, got: %s", stderr)
+	}
+	files := readBundle(t, bundlePath)
+	if !strings.Contains(files["config.yaml"], "command: sleep 60") {
+		t.Errorf("expected the config in the bundle, got %v", files)
+	}
+	if _, ok := files["status.json"]; ok {
+		t.Error("expected no status without a daemon")
+	}
+}
@@ -0,0 +1,278 @@
+package e2e
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 9.1: Prints the service's env vars in the requested format without a daemon.
+func TestEnv_Formats(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    env:
+      PORT: "8080"
+      GREETING: it's me
+`)
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"plain", "GREETING=it's me\nPORT=8080\n"},
+		{"dotenv", "GREETING=\"it's me\"\nPORT=\"8080\"\n"},
+		{"export", "export GREETING='it'\\''s me'\nexport PORT='8080'\n"},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, err := f.Run("env", "--format", tt.format, "app")
+		if err != nil {
+			t.Fatalf("env --format %s failed: %v\n%s", tt.format, err, stderr)
+		}
+		if stdout != tt.expected {
+			t.Errorf("env --format %s:\ngot:\n%s\nwant:\n%s", tt.format, stdout, tt.expected)
+		}
+	}
+}
+
+// 9.2: Unknown service name is rejected with an error.
+func TestEnv_UnknownService(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+
+	_, _, err := f.Run("env", "nope")
+	if err == nil {
+		t.Error("expected error for unknown service")
+	}
+}
+
+// 9.3: port_base assigns PORT to each service in config order.
+func TestEnv_PortBase(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+port_base: 5000
+services:
+  web:
+    command: sleep 60
+  worker:
+    command: sleep 60
+`)
+
+	for service, expected := range map[string]string{"web": "PORT=5000\n", "worker": "PORT=5100\n"} {
+		stdout, stderr, err := f.Run("env", service)
+		if err != nil {
+			t.Fatalf("env %s failed: %v\n%s", service, err, stderr)
+		}
+		if stdout != expected {
+			t.Errorf("env %s: got %q, want %q", service, stdout, expected)
+		}
+	}
+}
+
+// 9.4: Services receive the addresses and states of their dependencies.
+func TestEnv_Dependencies(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+port_base: 5000
+services:
+  db:
+    command: sleep 60
+  web:
+    command: sh -c 'echo "$DB_HOST:$DB_PORT $DB_SERVICE_STATE"; sleep 60'
+    depends_on:
+      - db
+`)
+
+	stdout, stderr, err := f.Run("env", "web")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if expected := "DB_HOST=localhost\nDB_PORT=5000\nPORT=5100\n"; stdout != expected {
+		t.Errorf("env web: got %q, want %q", stdout, expected)
+	}
+
+	f.Up()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "--raw", "web")
+		if stdout != "" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stdout != "localhost:5000 running\n" {
+		t.Errorf("expected web to see db's address and state, got %q", stdout)
+	}
+}
+
+// 9.5: "auto" ports are picked when services start and kept across restarts.
+func TestEnv_AutoPorts(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  web:
+    command: sh -c 'echo "port $PORT"; sleep 60'
+    ports: [auto]
+  app:
+    command: sh -c 'echo "web $WEB_PORT"; sleep 60'
+    depends_on:
+      - web
+`)
+
+	// Nothing is known before the daemon picks the port
+	stdout, stderr, err := f.Run("env", "web")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("env web: expected no PORT, got %q", stdout)
+	}
+
+	f.Up()
+	waitLogs := func(service string, n int) []string {
+		t.Helper()
+		var lines []string
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			stdout, _, _ := f.Run("logs", "--raw", service)
+			if lines = strings.Fields(stdout); len(lines) >= 2*n {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return lines
+	}
+
+	web := waitLogs("web", 1)
+	if len(web) != 2 || web[1] == "" {
+		t.Fatalf("expected web to get a port, got %q", web)
+	}
+	port := web[1]
+	if app := waitLogs("app", 1); len(app) != 2 || app[1] != port {
+		t.Errorf("expected app to see web's port %s, got %q", port, app)
+	}
+
+	stdout, _, _ = f.Run("status", "--wide")
+	if !strings.Contains(stdout, port) {
+		t.Errorf("expected status to show port %s, got:\n%s", port, stdout)
+	}
+
+	if _, stderr, err := f.Run("restart", "web"); err != nil {
+		t.Fatalf("restart failed: %v\n%s", err, stderr)
+	}
+	if web := waitLogs("web", 2); len(web) != 4 || web[3] != port {
+		t.Errorf("expected web to keep port %s, got %q", port, web)
+	}
+}
+
+// 9.6: Each run gets the service's name, project, config path, and restart count.
+func TestEnv_ServiceMetadata(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+name: shop
+services:
+  app:
+    command: sh -c 'echo "$COMPROC_SERVICE $COMPROC_PROJECT $COMPROC_CONFIG_PATH $COMPROC_RESTARTS"; [ "$COMPROC_RESTARTS" = 1 ] && sleep 60'
+    restart: on-failure
+`)
+	f.Run("up") // Reports app as failed, as the first run exits at once
+
+	want := []string{
+		"app shop " + f.ConfigPath + " 0",
+		"app shop " + f.ConfigPath + " 1",
+	}
+	var lines []string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ := f.Run("logs", "--raw", "app")
+		if lines = strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) >= 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("expected %q, got %q", want, lines)
+	}
+}
+
+// 9.7: With a running daemon, env adds the variables set when the service started.
+func TestEnv_RuntimeVariables(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  worker:
+    command: sh -c 'echo $PORT; sleep 60'
+    ports: [auto]
+    replicas: 2
+    env:
+      COMPROC_PROJECT: mine
+`)
+
+	stdout, stderr, err := f.Run("env", "worker-2")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if stdout != "COMPROC_PROJECT=mine\n" || !strings.Contains(stderr, "the daemon is not running") {
+		t.Errorf("expected only the config's variables and a note, got %q and %q", stdout, stderr)
+	}
+
+	f.Up()
+	stdout, stderr, err = f.Run("env", "worker-2")
+	if err != nil {
+		t.Fatalf("env failed: %v\n%s", err, stderr)
+	}
+	if stderr != "" {
+		t.Errorf("expected no note, got %q", stderr)
+	}
+	env := make(map[string]string)
+	for line := range strings.Lines(stdout) {
+		k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+		env[k] = v
+	}
+	var port string
+	deadline := time.Now().Add(5 * time.Second)
+	for port == "" && time.Now().Before(deadline) {
+		stdout, _, _ := f.Run("logs", "--raw", "worker-2")
+		port = strings.TrimSpace(stdout)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if port == "" || env["PORT"] != port {
+		t.Errorf("expected PORT to be the picked port %q, got %v", port, env)
+	}
+	if env["COMPROC_REPLICA"] != "2" || env["COMPROC_SERVICE"] != "worker-2" {
+		t.Errorf("expected the replica's metadata, got %v", env)
+	}
+	// The config file takes precedence, as for the service itself
+	if env["COMPROC_PROJECT"] != "mine" {
+		t.Errorf("expected COMPROC_PROJECT from the config, got %v", env)
+	}
+}
@@ -0,0 +1,71 @@
+package e2e
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 20.1: Service state transitions are appended to an events file next to the socket, which is kept after the daemon shuts down.
+func TestEvents_File(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  job:
+    command: sh -c 'exit 3'
+    restart: on-failure
+`)
+	f.Run("up", "app", "job") // Reports job as failed
+
+	path := strings.TrimSuffix(f.SocketPath, ".sock") + ".events.jsonl"
+	var events string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(path)
+		events = string(data)
+		if strings.Contains(events, "service.restarting") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	stdout, stderr, err := f.Run("daemon", "stats")
+	if err != nil {
+		t.Fatalf("daemon stats failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Events:         "+path+"\n") {
+		t.Errorf("expected the events file in daemon stats, got:\n%s", stdout)
+	}
+
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForSocketGone(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the events file to be kept: %v", err)
+	}
+	events = string(data)
+
+	want := []string{
+		`"event":"daemon.up"`,
+		`"event":"service.started","service":"app"`,
+		`"event":"service.failed","service":"job","exit_code":3`,
+		`"event":"service.restarting","service":"job","next_restart_at":`,
+		`"event":"service.stopped","service":"app"`,
+		`"event":"daemon.down"`,
+	}
+	for _, w := range want {
+		if !strings.Contains(events, w) {
+			t.Errorf("expected %s in events, got:\n%s", w, events)
+		}
+	}
+}
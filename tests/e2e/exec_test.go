@@ -0,0 +1,66 @@
+package e2e
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// 25.1: `exec` runs a command in a running service's environment, and exits with its exit code.
+func TestExec(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+    env:
+      GREETING: hello
+`)
+	f.Up()
+
+	stdout, stderr, err := f.Run("exec", "-T", "api", "sh", "-c", `echo "$GREETING"; test -t 0 || echo "no tty"; exit 3`)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got %v\n%s", err, stderr)
+	}
+	if stdout != "hello\nno tty\n" {
+		t.Errorf("expected the command's output, got %q", stdout)
+	}
+
+	// Without a terminal for stdin, exec reads input from a pipe like run
+	stdout, stderr, err = f.RunWithInput("one\ntwo\n", "exec", "api", "--", "wc", "-l")
+	if err != nil {
+		t.Fatalf("exec failed: %v\n%s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "2" {
+		t.Errorf("expected the command to read the input, got %q", stdout)
+	}
+}
+
+// 25.2: `exec` fails for a service that is not running.
+func TestExec_NotRunning(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+  worker:
+    command: sleep 60
+`)
+	f.Up("api")
+
+	_, stderr, err := f.Run("exec", "worker", "true")
+	if err == nil {
+		t.Fatal("expected exec to fail")
+	}
+	if !strings.Contains(stderr, "worker is not running") {
+		t.Errorf("expected a not-running error, got %q", stderr)
+	}
+}
@@ -0,0 +1,111 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 15.1: `export vscode` writes tasks for all services and keeps the user's own tasks.
+func TestExport_VSCode(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+  db:
+    command: sleep 60
+`)
+	tasksPath := filepath.Join(f.TempDir, ".vscode", "tasks.json")
+	if err := os.MkdirAll(filepath.Dir(tasksPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(tasksPath, []byte(`{"version": "2.0.0", "tasks": [{"label": "build", "command": "make"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exporting twice replaces the generated tasks instead of duplicating them
+	for range 2 {
+		stdout, stderr, err := f.Run("export", "vscode")
+		if err != nil {
+			t.Fatalf("export failed: %v\n%s", err, stderr)
+		}
+		if !strings.Contains(stdout, "Wrote 12 tasks") {
+			t.Errorf("expected 12 tasks to be written, got:\n%s", stdout)
+		}
+	}
+
+	data, err := os.ReadFile(tasksPath)
+	if err != nil {
+		t.Fatalf("failed to read tasks: %v", err)
+	}
+	var doc struct {
+		Tasks []struct {
+			Label string   `json:"label"`
+			Args  []string `json:"args"`
+		} `json:"tasks"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid tasks.json: %v\n%s", err, data)
+	}
+	if len(doc.Tasks) != 13 {
+		t.Fatalf("expected 13 tasks, got %d:\n%s", len(doc.Tasks), data)
+	}
+	if doc.Tasks[0].Label != "build" {
+		t.Errorf("expected user task to be kept first, got %q", doc.Tasks[0].Label)
+	}
+	if got := strings.Join(doc.Tasks[len(doc.Tasks)-1].Args, " "); got != "-f ${workspaceFolder}/comproc.yaml logs -f db" {
+		t.Errorf("unexpected args of last task: %s", got)
+	}
+}
+
+// 15.2: `export launchd` writes a LaunchAgent plist per service and refuses to overwrite them.
+func TestExport_Launchd(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+name: shop
+services:
+  api:
+    command: sleep 60
+    restart: always
+  db:
+    command: sleep 60
+`)
+	env := []string{"HOME=" + f.TempDir}
+	agentsDir := filepath.Join(f.TempDir, "Library", "LaunchAgents")
+
+	stdout, stderr, err := f.RunWithEnv(env, "export", "launchd")
+	if err != nil {
+		t.Fatalf("export failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "launchctl bootstrap") {
+		t.Errorf("expected load instructions, got:\n%s", stdout)
+	}
+
+	data, err := os.ReadFile(filepath.Join(agentsDir, "com.comproc.shop.api.plist"))
+	if err != nil {
+		t.Fatalf("failed to read plist: %v", err)
+	}
+	if !strings.Contains(string(data), "<key>KeepAlive</key>\n  <true/>") {
+		t.Errorf("expected KeepAlive for restart: always, got:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(agentsDir, "com.comproc.shop.db.plist")); err != nil {
+		t.Errorf("expected plist for db: %v", err)
+	}
+
+	if _, _, err := f.RunWithEnv(env, "export", "launchd"); err == nil {
+		t.Error("expected export to refuse to overwrite existing plists")
+	}
+	if _, stderr, err := f.RunWithEnv(env, "export", "launchd", "--force"); err != nil {
+		t.Errorf("export --force failed: %v\n%s", err, stderr)
+	}
+}
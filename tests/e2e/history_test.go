@@ -0,0 +1,119 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// 16.1: `history` fails when no daemon is running.
+func TestHistory_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("history", "app")
+	if err == nil {
+		t.Fatal("expected history to fail without a daemon")
+	}
+	if !strings.Contains(stderr, "daemon is not running") {
+		t.Errorf("expected daemon error, got:\n%s", stderr)
+	}
+}
+
+// 16.2: `history` lists each run with its exit code and what started it.
+func TestHistory_Runs(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  crash:
+    command: sh -c 'exit 4'
+    restart: on-failure
+  app:
+    command: sleep 60
+`)
+	f.Run("up") // Reports crash as failed
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := f.GetServiceStatus("crash")
+		if err == nil && status.Restarts >= 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if _, stderr, err := f.Run("restart", "app"); err != nil {
+		t.Fatalf("restart failed: %v\n%s", err, stderr)
+	}
+
+	// Each run: STARTED (date time) EXITED (date time) DURATION EXIT CODE REASON ERROR
+	history := func(service string) [][]string {
+		t.Helper()
+		stdout, stderr, err := f.Run("history", service)
+		if err != nil {
+			t.Fatalf("history failed: %v\n%s", err, stderr)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if !strings.HasPrefix(lines[0], "STARTED") {
+			t.Fatalf("expected a header, got:\n%s", stdout)
+		}
+		var runs [][]string
+		for _, line := range lines[1:] {
+			runs = append(runs, strings.Fields(line))
+		}
+		return runs
+	}
+
+	crash := history("crash")
+	if len(crash) < 2 {
+		t.Fatalf("expected at least 2 runs of crash, got %v", crash)
+	}
+	if len(crash[0]) != 8 || crash[0][5] != "4" || crash[0][6] != "up" {
+		t.Errorf("expected the first run of crash to be started by up and exit with 4, got %v", crash[0])
+	}
+	if len(crash[1]) < 7 || crash[1][len(crash[1])-2] != "policy" {
+		t.Errorf("expected the second run of crash to be started by the restart policy, got %v", crash[1])
+	}
+
+	app := history("app")
+	if len(app) != 2 {
+		t.Fatalf("expected 2 runs of app, got %v", app)
+	}
+	if len(app[0]) != 8 || app[0][6] != "up" {
+		t.Errorf("expected the first run of app to be started by up and exited, got %v", app[0])
+	}
+	// EXITED and EXIT CODE are "-" while the run is in progress
+	if len(app[1]) != 7 || app[1][2] != "-" || app[1][5] != "restart" {
+		t.Errorf("expected the second run of app to be started by restart and running, got %v", app[1])
+	}
+}
+
+// 16.3: `history` fails for an unknown service.
+func TestHistory_UnknownService(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	f.Up()
+
+	_, stderr, err := f.Run("history", "nope")
+	if err == nil {
+		t.Fatal("expected history to fail for an unknown service")
+	}
+	if !strings.Contains(stderr, "service not found: nope") {
+		t.Errorf("expected service error, got:\n%s", stderr)
+	}
+}
@@ -0,0 +1,66 @@
+package e2e
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// 18.1: `lint` prints warnings and exits with status 1.
+func TestLint_Warnings(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+port_bsae: 5000
+services:
+  web:
+    command: npm run dev
+    env:
+      API_TOKEN: 0123456789abcdef
+`)
+
+	stdout, stderr, err := f.Run("lint")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got: %v\n%s", err, stderr)
+	}
+	expected := []string{
+		"port_bsae: unknown key, ignored by comproc (did you mean port_base?)",
+		"services.web: no restart policy",
+		"services.web.env.API_TOKEN: value looks like a secret",
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d warnings, got:\n%s", len(expected), stdout)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("warning %d: expected %q, got %q", i, expected[i], line)
+		}
+	}
+}
+
+// 18.2: `lint` prints nothing and succeeds for a config without problems.
+func TestLint_Clean(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  web:
+    command: npm run dev
+    restart: on-failure
+`)
+
+	stdout, stderr, err := f.Run("lint")
+	if err != nil {
+		t.Fatalf("lint failed: %v\n%s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("expected no warnings, got:\n%s", stdout)
+	}
+}
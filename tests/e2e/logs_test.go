@@ -1,6 +1,8 @@
 package e2e
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -169,3 +171,391 @@ services:
 
 	InterruptAndWait(cmd)
 }
+
+// 6.6: Lines with invalid UTF-8 are shown with their original bytes.
+func TestLogs_BinaryOutput(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'printf "bad \377 byte\n"; sleep 60'
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, err = f.Run("logs")
+		if err == nil && strings.Contains(stdout, "byte") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !strings.Contains(stdout, "bad \xff byte") {
+		t.Errorf("expected original bytes in output, got:\n%q", stdout)
+	}
+}
+
+// 6.7: `logs -f` reports that the daemon is shutting down and exits cleanly on `down`.
+func TestLogs_FollowDaemonShutdown(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo started; sleep 60'
+`)
+	f.Up()
+
+	cmd, outBuf, err := f.RunAsync("logs", "-f")
+	if err != nil {
+		t.Fatalf("RunAsync logs -f failed: %v", err)
+	}
+	if err := WaitForContent(outBuf, "started", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Errorf("expected logs -f to exit cleanly, got %v\n%s", err, outBuf.String())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for logs -f to exit")
+	}
+	if !strings.Contains(outBuf.String(), "Daemon shutting down") {
+		t.Errorf("expected a shutdown message, got:\n%s", outBuf.String())
+	}
+}
+
+// 6.8: `logs --raw` prints lines without service prefixes or colors.
+func TestLogs_Raw(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo "first | line"; echo second; sleep 60'
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		stdout, _, err = f.Run("logs", "--raw", "app")
+		if err == nil && strings.Contains(stdout, "second") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if stdout != "first | line\nsecond\n" {
+		t.Errorf("expected the lines exactly as written, got:\n%q", stdout)
+	}
+}
+
+// 6.9: `logs -f --output` also writes followed lines to a file, split per service with {service}.
+func TestLogs_FollowOutputFile(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sh -c 'sleep 0.5; echo api line; sleep 60'
+  worker:
+    command: sh -c 'sleep 0.5; echo worker line; sleep 60'
+`)
+	f.Up()
+
+	combined := filepath.Join(f.TempDir, "out", "all.log")
+	split := filepath.Join(f.TempDir, "out", "{service}.log")
+	for _, output := range []string{combined, split} {
+		cmd, outBuf, err := f.RunAsync("logs", "-f", "--output", output)
+		if err != nil {
+			t.Fatalf("RunAsync logs -f failed: %v", err)
+		}
+		if err := WaitForContent(outBuf, "worker line", 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if err := WaitForContent(outBuf, "api line", 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		InterruptAndWait(cmd)
+	}
+
+	data, err := os.ReadFile(combined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "api    | api line\n") || !strings.Contains(string(data), "worker | worker line\n") {
+		t.Errorf("expected prefixed lines without colors, got:\n%q", data)
+	}
+	for service, expected := range map[string]string{"api": "api line\n", "worker": "worker line\n"} {
+		data, err := os.ReadFile(filepath.Join(f.TempDir, "out", service+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", service, expected, data)
+		}
+	}
+}
+
+// 6.10: `logs --dedup` collapses identical consecutive lines into a repeat count.
+func TestLogs_Dedup(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'for i in 1 2 3 4 5; do echo retrying; done; echo done; sleep 60'
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		stdout, _, err = f.Run("logs", "--raw", "--dedup", "app")
+		if err == nil && strings.Contains(stdout, "done") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	expected := "retrying\nlast message repeated 4 times\ndone\n"
+	if stdout != expected {
+		t.Errorf("expected repeats to be collapsed, got:\n%q", stdout)
+	}
+}
+
+// 6.11: With log_store, `logs` reaches past the in-memory history and `--since` filters by time.
+func TestLogs_StoreAndSince(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+log_store:
+  dir: logs
+services:
+  app:
+    command: sh -c 'seq 1 1500; sleep 60'
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		stdout, _, err = f.Run("logs", "--raw", "-n", "2000", "app")
+		if err == nil && strings.HasSuffix(stdout, "\n1500\n") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The daemon keeps 1000 lines per service in memory
+	if lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n"); len(lines) != 1500 || lines[0] != "1" {
+		t.Errorf("expected all 1500 lines from the store, got %d lines", len(lines))
+	}
+	if _, err := os.Stat(filepath.Join(f.TempDir, "logs", "app")); err != nil {
+		t.Errorf("expected the store in the configured directory: %v", err)
+	}
+
+	stdout, _, err := f.Run("logs", "--raw", "--since", "1h", "-n", "5", "app")
+	if err != nil || stdout != "1496\n1497\n1498\n1499\n1500\n" {
+		t.Errorf("expected the last 5 lines of the last hour, got %q (%v)", stdout, err)
+	}
+	stdout, _, err = f.Run("logs", "--raw", "--since", time.Now().Add(time.Hour).Format(time.RFC3339), "app")
+	if err != nil || stdout != "" {
+		t.Errorf("expected no lines after a future time, got %q (%v)", stdout, err)
+	}
+}
+
+// 6.12: log_file routes a service's history to its own file or discards it
+func TestLogs_LogFile(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo app-line; sleep 60'
+    log_file: logs/app.log
+  noisy:
+    command: sh -c 'echo noisy-line; sleep 60'
+    log_file: /dev/null
+`)
+	f.Up()
+
+	logPath := filepath.Join(f.TempDir, "logs", "app.log")
+	var content []byte
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		content, _ = os.ReadFile(logPath)
+		if strings.Contains(string(content), "stdout app-line") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(string(content), "stdout app-line") {
+		t.Errorf("expected app's line in its log file, got %q", content)
+	}
+
+	stdout, _, err := f.Run("logs", "--raw", "app")
+	if err != nil || stdout != "app-line\n" {
+		t.Errorf("expected app's recent lines, got %q (%v)", stdout, err)
+	}
+	stdout, _, err = f.Run("logs", "--raw", "noisy")
+	if err != nil || stdout != "" {
+		t.Errorf("expected no history for noisy, got %q (%v)", stdout, err)
+	}
+}
+
+// 6.13: --stdout and --stderr show only the lines of one stream
+func TestLogs_StreamFilter(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo out-1; echo err-1 >&2; echo out-2; echo err-2 >&2; sleep 60'
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "--raw", "--stderr", "app")
+		if stdout == "err-1\nerr-2\n" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stdout != "err-1\nerr-2\n" {
+		t.Errorf("expected only stderr lines, got %q", stdout)
+	}
+
+	stdout, _, err := f.Run("logs", "--raw", "--stdout", "-n", "1", "app")
+	if err != nil || stdout != "out-2\n" {
+		t.Errorf("expected the last stdout line, got %q (%v)", stdout, err)
+	}
+
+	_, stderr, err := f.Run("logs", "--stdout", "--stderr", "app")
+	if err == nil || !strings.Contains(stderr, "cannot be used together") {
+		t.Errorf("expected the flags to be rejected together, got %q (%v)", stderr, err)
+	}
+}
+
+// 6.14: COMPROC_COLORS sets the colors of service names
+func TestLogs_Colors(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: echo api-ready; sleep 60
+  db:
+    command: echo db-ready; sleep 60
+`)
+	f.Up()
+
+	colors := []string{"COMPROC_COLORS=208,api=#ff8800"}
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.RunWithEnv(colors, "logs")
+		if strings.Contains(stdout, "api-ready") && strings.Contains(stdout, "db-ready") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(stdout, "\033[38;2;255;136;0mapi") {
+		t.Errorf("expected api in its fixed color, got %q", stdout)
+	}
+	if !strings.Contains(stdout, "\033[38;5;208mdb") {
+		t.Errorf("expected db in the palette's color, got %q", stdout)
+	}
+
+	_, stderr, err := f.RunWithEnv([]string{"COMPROC_COLORS=pink"}, "logs")
+	if err == nil || !strings.Contains(stderr, `invalid COMPROC_COLORS: invalid color "pink"`) {
+		t.Errorf("expected an invalid color to be rejected, got %q (%v)", stderr, err)
+	}
+}
+
+// 6.15: --grep shows only matching lines, both recent and followed
+func TestLogs_Grep(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo error-1; echo info-1; echo error-2; sleep 2; echo info-2; echo error-3; sleep 60'
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "--raw", "--grep", "^error", "app")
+		if stdout == "error-1\nerror-2\n" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stdout != "error-1\nerror-2\n" {
+		t.Errorf("expected only matching lines, got %q", stdout)
+	}
+
+	stdout, _, err := f.Run("logs", "--raw", "--grep", "error", "-n", "1", "app")
+	if err != nil || stdout != "error-2\n" {
+		t.Errorf("expected the last matching line, got %q (%v)", stdout, err)
+	}
+
+	cmd, outBuf, err := f.RunAsync("logs", "-f", "--raw", "--grep", "^error", "app")
+	if err != nil {
+		t.Fatalf("RunAsync logs -f failed: %v", err)
+	}
+	if err := WaitForContent(outBuf, "error-3", 10*time.Second); err != nil {
+		t.Errorf("expected followed lines to contain error-3: %v", err)
+	}
+	InterruptAndWait(cmd)
+	if strings.Contains(outBuf.String(), "info") {
+		t.Errorf("expected no unmatched lines while following, got %q", outBuf.String())
+	}
+
+	_, stderr, err := f.Run("logs", "--grep", "(", "app")
+	if err == nil || !strings.Contains(stderr, "invalid grep") {
+		t.Errorf("expected an invalid regexp to be rejected, got %q (%v)", stderr, err)
+	}
+}
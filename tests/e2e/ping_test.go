@@ -0,0 +1,57 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// 11.1: `ping` fails when no daemon is running.
+func TestPing_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("ping")
+	if err == nil {
+		t.Fatal("expected ping to fail without a daemon")
+	}
+	if !strings.Contains(stderr, "daemon is not reachable") {
+		t.Errorf("expected unreachable error, got:\n%s", stderr)
+	}
+}
+
+// 11.2: `ping -c 2` reports the daemon's PID and latency for each ping.
+func TestPing_WithDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	stdout, stderr, err := f.Run("ping", "-c", "2", "-i", "10ms")
+	if err != nil {
+		t.Fatalf("ping failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 responses, got:\n%s", stdout)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Response from daemon (pid ") || !strings.Contains(line, "time=") {
+			t.Errorf("unexpected ping output: %q", line)
+		}
+	}
+}
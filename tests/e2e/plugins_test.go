@@ -0,0 +1,102 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 13.1: Plugins receive daemon and service lifecycle events as JSON lines.
+func TestPlugins_LifecycleEvents(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  job:
+    command: sh -c 'exit 3'
+plugins:
+  - command: cat >> events.log
+`)
+	f.Run("up", "app", "job") // Reports job as failed
+	if err := f.WaitForState("job", "failed", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForSocketGone(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daemon waits for plugins to exit before it exits, but the socket
+	// is removed a little earlier
+	path := filepath.Join(f.TempDir, "events.log")
+	want := []string{
+		`"event":"daemon.up"`,
+		`"event":"service.started","service":"app"`,
+		`"event":"service.failed","service":"job","exit_code":3`,
+		`"event":"service.stopped","service":"app"`,
+		`"event":"daemon.down"`,
+	}
+	var events string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(path)
+		events = string(data)
+		if strings.Contains(events, "daemon.down") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for _, w := range want {
+		if !strings.Contains(events, w) {
+			t.Errorf("expected %s in events, got:\n%s", w, events)
+		}
+	}
+}
+
+// 13.2: A plugin subscribed to specific events receives only those.
+func TestPlugins_EventFilter(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  job:
+    command: sh -c 'exit 3'
+plugins:
+  - command: cat >> failures.log
+    events: [service.failed]
+`)
+	f.Run("up", "app", "job") // Reports job as failed
+	if err := f.WaitForState("job", "failed", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(f.TempDir, "failures.log")
+	var events string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(path)
+		events = string(data)
+		if strings.Contains(events, "service.failed") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(events, `"service":"job"`) {
+		t.Fatalf("expected failure of job, got:\n%s", events)
+	}
+	if strings.Count(strings.TrimSpace(events), "\n") != 0 {
+		t.Errorf("expected a single event, got:\n%s", events)
+	}
+}
@@ -0,0 +1,115 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// 26.1: `reload` starts added services, removes removed ones, and restarts changed ones, leaving the others running.
+func TestReload(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sleep 60
+  api:
+    command: sleep 60
+  old:
+    command: sleep 60
+`)
+	f.Up()
+	db, err := f.GetServiceStatus("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteConfig(`
+services:
+  db:
+    command: sleep 60
+  api:
+    command: sleep 61
+  worker:
+    command: sleep 60
+`)
+	stdout, stderr, err := f.Run("reload")
+	if err != nil {
+		t.Fatalf("reload failed: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{"Added: [worker]", "Removed: [old]", "Changed: [api]", "Started: [api worker]"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, stdout)
+		}
+	}
+
+	statuses, err := f.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range statuses {
+		names = append(names, s.Name)
+		if s.State != "running" {
+			t.Errorf("expected %s to be running, got %s", s.Name, s.State)
+		}
+		switch s.Name {
+		case "db":
+			if s.PID != db.PID {
+				t.Error("expected db to keep running")
+			}
+		case "api":
+			if s.PID == api.PID {
+				t.Error("expected api to be restarted")
+			}
+		}
+	}
+	if strings.Join(names, " ") != "db api worker" {
+		t.Errorf("expected the services of the new config, got %v", names)
+	}
+
+	stdout, stderr, err = f.Run("reload")
+	if err != nil {
+		t.Fatalf("reload failed: %v\n%s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "No changes" {
+		t.Errorf("expected no changes, got:\n%s", stdout)
+	}
+}
+
+// 26.2: `reload` of an invalid config fails and leaves the services as they were.
+func TestReload_InvalidConfig(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	f.Up()
+
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    depends_on: [missing]
+`)
+	_, stderr, err := f.Run("reload")
+	if err == nil {
+		t.Fatal("expected reload to fail")
+	}
+	if !strings.Contains(stderr, "missing") {
+		t.Errorf("expected the config error, got:\n%s", stderr)
+	}
+	if s, err := f.GetServiceStatus("app"); err != nil || s.State != "running" {
+		t.Errorf("expected app to keep running, got %+v (%v)", s, err)
+	}
+}
@@ -0,0 +1,250 @@
+package e2e
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local TCP address that nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// 28.1: A daemon started with `--listen` and `--token` is controlled over TCP by clients using `--host` and the token.
+func TestRemote_Listen(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo hello from app; exec sleep 60'
+`)
+	addr := freeAddr(t)
+	if _, stderr, err := f.Run("--listen", addr, "--token", "secret", "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	// The socket is out of reach, so the client must use the address
+	remote := []string{"COMPROC_HOST=" + addr, "COMPROC_TOKEN=secret", "COMPROC_SOCKET=" + filepath.Join(t.TempDir(), "missing.sock")}
+	stdout, stderr, err := f.RunWithEnv(remote, "status")
+	if err != nil {
+		t.Fatalf("remote status failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "app") || !strings.Contains(stdout, "running") {
+		t.Errorf("expected app to be running, got:\n%s", stdout)
+	}
+	if stdout, _, err = f.RunWithEnv(remote, "logs", "--raw", "app"); err != nil || !strings.Contains(stdout, "hello from app") {
+		t.Errorf("expected the logs of app, got %v:\n%s", err, stdout)
+	}
+	if _, stderr, err = f.RunWithEnv(remote, "stop", "app"); err != nil {
+		t.Fatalf("remote stop failed: %v\n%s", err, stderr)
+	}
+	if s, err := f.GetServiceStatus("app"); err != nil || s.State != "stopped" {
+		t.Errorf("expected app to be stopped, got %+v (%v)", s, err)
+	}
+}
+
+// 28.2: `up` with `--host` fails instead of spawning a daemon when nothing listens on the address.
+func TestRemote_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("--host", freeAddr(t), "up")
+	if err == nil || !strings.Contains(stderr, "no daemon is listening on") {
+		t.Errorf("expected up to fail, got %v:\n%s", err, stderr)
+	}
+	if _, err := os.Stat(f.SocketPath); err == nil {
+		t.Error("expected no local daemon to be started")
+	}
+}
+
+// 28.3: The TCP address requires a token: a daemon won't listen without one, and clients without the right one are refused.
+func TestRemote_Token(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	addr := freeAddr(t)
+	_, stderr, err := f.Run("--listen", addr, "up")
+	if err == nil || !strings.Contains(stderr, "listening on TCP requires a token") {
+		t.Fatalf("expected the daemon to refuse to listen without a token, got %v:\n%s", err, stderr)
+	}
+
+	if err := os.WriteFile(filepath.Join(f.TempDir, "token"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteConfig(`
+socket:
+  token_file: token
+services:
+  app:
+    command: sleep 60
+`)
+	if _, stderr, err := f.Run("--listen", addr, "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	tests := []struct {
+		token   string
+		wantErr string
+	}{
+		{"", "authentication required"},
+		{"guess", "invalid token"},
+	}
+	for _, tt := range tests {
+		_, stderr, err := f.RunWithEnv([]string{"COMPROC_HOST=" + addr, "COMPROC_TOKEN=" + tt.token}, "status")
+		if err == nil || !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("token %q: expected %q error, got %v:\n%s", tt.token, tt.wantErr, err, stderr)
+		}
+	}
+	if _, stderr, err := f.RunWithEnv([]string{"COMPROC_HOST=" + addr, "COMPROC_TOKEN=secret"}, "status"); err != nil {
+		t.Errorf("expected the token of token_file to be accepted, got %v:\n%s", err, stderr)
+	}
+}
+
+// 28.4: With `socket.tls`, clients connect with TLS, verifying the daemon's certificate with `--tls-ca`.
+func TestRemote_TLS(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	writeCertificate(t, f.TempDir)
+	f.WriteConfig(`
+socket:
+  tls:
+    cert: cert.pem
+    key: key.pem
+services:
+  app:
+    command: sleep 60
+`)
+	addr := freeAddr(t)
+	if _, stderr, err := f.Run("--listen", addr, "--token", "secret", "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	remote := []string{"COMPROC_HOST=" + addr, "COMPROC_TOKEN=secret"}
+	stdout, stderr, err := f.RunWithEnv(remote, "--tls-ca", filepath.Join(f.TempDir, "cert.pem"), "status")
+	if err != nil || !strings.Contains(stdout, "running") {
+		t.Fatalf("expected status over TLS, got %v:\n%s%s", err, stdout, stderr)
+	}
+	if _, stderr, err := f.RunWithEnv(remote, "--tls", "status"); err == nil || !strings.Contains(stderr, "certificate") {
+		t.Errorf("expected an unknown certificate to be refused, got %v:\n%s", err, stderr)
+	}
+	if _, _, err := f.RunWithEnv(append(remote, "COMPROC_TLS=false"), "status"); err == nil {
+		t.Error("expected a client without TLS to fail")
+	}
+	if _, stderr, err := f.RunWithEnv(append(remote, "COMPROC_TLS=maybe"), "status"); err == nil || !strings.Contains(stderr, "invalid COMPROC_TLS") {
+		t.Errorf("expected an invalid COMPROC_TLS to be rejected, got %v:\n%s", err, stderr)
+	}
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 to
+// cert.pem and its key to key.pem in dir.
+func writeCertificate(t *testing.T, dir string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "comproc test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: cert},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 28.5: A `socket.read_only` listener serves status to clients with its own token but rejects `stop`.
+func TestRemote_ReadOnlyListen(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	if err := os.WriteFile(filepath.Join(f.TempDir, "ro-token"), []byte("viewer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	f.WriteConfig(`
+socket:
+  read_only:
+    listen: ` + addr + `
+    token_file: ro-token
+services:
+  app:
+    command: sleep 60
+`)
+	f.Up()
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := []string{"COMPROC_HOST=" + addr, "COMPROC_TOKEN=viewer", "COMPROC_SOCKET=" + filepath.Join(t.TempDir(), "missing.sock")}
+	stdout, stderr, err := f.RunWithEnv(remote, "status")
+	if err != nil {
+		t.Fatalf("status on the read-only listener failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "running") {
+		t.Errorf("expected app to be shown as running, got:\n%s", stdout)
+	}
+
+	_, stderr, err = f.RunWithEnv(remote, "stop", "app")
+	if err == nil || !strings.Contains(stderr, "not allowed on a read-only socket") {
+		t.Errorf("expected stop on the read-only listener to be rejected, got %v:\n%s", err, stderr)
+	}
+	if err := f.WaitForState("app", "running", time.Second); err != nil {
+		t.Errorf("expected app to keep running: %v", err)
+	}
+}
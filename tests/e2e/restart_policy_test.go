@@ -1,6 +1,8 @@
 package e2e
 
 import (
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -51,10 +53,7 @@ services:
     command: sh -c 'echo failing; exit 1'
     restart: on-failure
 `)
-	_, stderr, err := f.Run("up")
-	if err != nil {
-		t.Fatalf("up failed: %v\n%s", err, stderr)
-	}
+	f.Run("up") // Reports app as failed, as it exits at once
 
 	deadline := time.Now().Add(10 * time.Second)
 	for time.Now().Before(deadline) {
@@ -145,10 +144,7 @@ services:
     command: sh -c 'exit 1'
     restart: on-failure
 `)
-	_, stderr, err := f.Run("up")
-	if err != nil {
-		t.Fatalf("up failed: %v\n%s", err, stderr)
-	}
+	f.Run("up") // Reports app as failed, as it exits at once
 
 	// Wait for restarts counter to reach at least 2
 	deadline := time.Now().Add(10 * time.Second)
@@ -175,3 +171,231 @@ services:
 	status, _ := f.GetServiceStatus("app")
 	t.Errorf("expected restarts counter to increment beyond %d, got %d", prevRestarts, status.Restarts)
 }
+
+// 7.6: A marker line separating the runs is added to the logs on each restart.
+func TestRestartPolicy_RestartMarker(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo failing; exit 1'
+    restart: on-failure
+`)
+	f.Run("up") // Reports app as failed, as it exits at once
+
+	marker := "--- app restarted (exit 1, attempt 1) ---"
+	var stdout string
+	var err error
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if stdout, _, err = f.Run("logs"); err == nil && strings.Contains(stdout, marker) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if !strings.Contains(stdout, marker) {
+		t.Fatalf("expected %q in logs, got:\n%s", marker, stdout)
+	}
+	if strings.Index(stdout, "failing") > strings.Index(stdout, marker) {
+		t.Errorf("expected the first run's output before the marker, got:\n%s", stdout)
+	}
+
+	// Raw output only holds the service's own lines
+	raw, _, err := f.Run("logs", "--raw")
+	if err != nil {
+		t.Fatalf("logs --raw failed: %v", err)
+	}
+	if strings.Contains(raw, "restarted") {
+		t.Errorf("expected no markers in raw output, got:\n%s", raw)
+	}
+}
+
+// 7.7: Services depending on a service with `restart_dependents` are restarted after its restart policy restarts it.
+func TestRestartPolicy_RestartDependents(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sleep 60
+    restart: on-failure
+  api:
+    command: sleep 60
+    depends_on:
+      - service: db
+        restart_dependents: true
+  worker:
+    command: sleep 60
+    depends_on: [db]
+`)
+	f.Up()
+	pids := make(map[string]int)
+	for _, name := range []string{"db", "api", "worker"} {
+		st, err := f.GetServiceStatus(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pids[name] = st.PID
+	}
+
+	// Kill the whole group, as the output pipes stay open while sleep runs
+	if err := syscall.Kill(-pids["db"], syscall.SIGKILL); err != nil {
+		t.Fatalf("failed to kill db: %v", err)
+	}
+	var api *ServiceStatus
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		api, _ = f.GetServiceStatus("api")
+		if api != nil && api.State == "running" && api.PID != pids["api"] {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if api == nil || api.State != "running" || api.PID == pids["api"] {
+		t.Fatalf("expected api to be restarted, got %+v", api)
+	}
+	if db, _ := f.GetServiceStatus("db"); db == nil || db.Restarts != 1 {
+		t.Errorf("expected db to be restarted once, got %+v", db)
+	}
+	if worker, _ := f.GetServiceStatus("worker"); worker == nil || worker.PID != pids["worker"] {
+		t.Errorf("expected worker to keep running, got %+v", worker)
+	}
+
+	stdout, _, _ := f.Run("logs", "api")
+	if !strings.Contains(stdout, "--- api restarted (db restarted) ---") {
+		t.Errorf("expected a restart marker in api's logs, got:\n%s", stdout)
+	}
+}
+
+// 7.8: A service waiting out the restart backoff is shown as restarting; stopping it cancels the restart.
+func TestRestartPolicy_RestartingState(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'exit 1'
+    restart: on-failure
+`)
+	f.Run("up") // Reports app as failed, as it exits at once
+
+	var app *ServiceStatus
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		app, _ = f.GetServiceStatus("app")
+		if app != nil && strings.HasPrefix(app.State, "restarting(") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if app == nil || !strings.HasPrefix(app.State, "restarting(") {
+		t.Fatalf("expected app to be restarting, got %+v", app)
+	}
+
+	if _, stderr, err := f.Run("stop", "app"); err != nil {
+		t.Fatalf("stop failed: %v\n%s", err, stderr)
+	}
+	app, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The service keeps the state of its last exit
+	if app.State != "failed" {
+		t.Fatalf("expected app to be failed, got %+v", app)
+	}
+
+	// The backoff would be over by now
+	time.Sleep(2500 * time.Millisecond)
+	if after, _ := f.GetServiceStatus("app"); after == nil || after.State != "failed" || after.Restarts != app.Restarts {
+		t.Errorf("expected no more restarts after stop, got %+v", after)
+	}
+}
+
+// 7.9: A service using more memory than its `mem_restart_limit` is restarted with a marker in its logs, even without a restart policy.
+func TestRestartPolicy_MemRestartLimit(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    mem_restart_limit: 1k
+  other:
+    command: sleep 60
+`)
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	var logs string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if logs, _, _ = f.Run("logs", "app"); strings.Contains(logs, "--- app restarted (memory use ") {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if !strings.Contains(logs, " over mem_restart_limit 1.0 KiB) ---") {
+		t.Fatalf("expected a memory restart marker, got:\n%s", logs)
+	}
+
+	history, _, err := f.Run("history", "app")
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if !strings.Contains(history, "memory") {
+		t.Errorf("expected a run started for memory, got:\n%s", history)
+	}
+	if other, err := f.GetServiceStatus("other"); err != nil || other.Restarts != 0 {
+		t.Errorf("expected other not to be restarted, got %+v (%v)", other, err)
+	}
+}
+
+// 7.10: A service failing more often than its `max_retries` is left failed with a marker in its logs.
+func TestRestartPolicy_MaxRetries(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo failing; exit 1'
+    restart: on-failure
+    max_retries: 1
+`)
+	f.Run("up") // Reports app as failed, as it exits at once
+
+	marker := "--- app gave up after 1 retries ---"
+	var stdout string
+	var err error
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if stdout, _, err = f.Run("logs"); err == nil && strings.Contains(stdout, marker) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if !strings.Contains(stdout, marker) {
+		t.Fatalf("expected %q in logs, got:\n%s", marker, stdout)
+	}
+
+	// Well past the next backoff, the service is still failed
+	time.Sleep(2500 * time.Millisecond)
+	status, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if status.State != "failed" || status.Restarts != 1 {
+		t.Errorf("expected failed after 1 restart, got %s after %d", status.State, status.Restarts)
+	}
+}
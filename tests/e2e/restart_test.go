@@ -1,6 +1,9 @@
 package e2e
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -233,3 +236,136 @@ func TestRestart_NoDaemon(t *testing.T) {
 		t.Errorf("expected 'No services running', got: %s", stdout)
 	}
 }
+
+// 4.6: `restart 'worker-*'` restarts the services matching the pattern.
+func TestRestart_Pattern(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+  worker-mail:
+    command: sleep 60
+  worker-image:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	for _, svc := range []string{"api", "worker-mail", "worker-image"} {
+		if err := f.WaitForState(svc, "running", 5*time.Second); err != nil {
+			t.Fatalf("WaitForState %s failed: %v", svc, err)
+		}
+	}
+
+	stdout, stderr, err := f.Run("restart", "worker-*")
+	if err != nil {
+		t.Fatalf("restart failed: %v\n%s", err, stderr)
+	}
+	restarted := ParseRestartedServices(stdout)
+	if len(restarted) != 2 || !ContainsAll(restarted, []string{"worker-mail", "worker-image"}) {
+		t.Errorf("expected only the workers to be restarted, got: %v", restarted)
+	}
+
+	_, stderr, err = f.Run("restart", "db-*")
+	if err == nil {
+		t.Fatal("expected restart to fail when nothing matches")
+	}
+	if !strings.Contains(stderr, `no services match "db-*"`) {
+		t.Errorf("expected no match error, got: %s", stderr)
+	}
+}
+
+// 4.7: `restart --rolling` restarts services one at a time, each after the previous one is ready, and stops at a failure.
+func TestRestart_Rolling(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	service := func(name string) string {
+		return `
+  ` + name + `:
+    command: test -f ` + name + `.broken && exit 1; echo "start ` + name + `" >> events; sleep 0.3; echo "ready ` + name + `" >> events; echo ready; sleep 60
+    ready_log_pattern: ^ready$`
+	}
+	f.WriteConfig("services:" + service("web-1") + service("web-2") + service("web-3") + "\n")
+	if _, stderr, err := f.Run("up", "--wait"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	eventsPath := filepath.Join(f.TempDir, "events")
+	os.Remove(eventsPath)
+
+	stdout, stderr, err := f.Run("restart", "--rolling")
+	if err != nil {
+		t.Fatalf("restart failed: %v\n%s", err, stderr)
+	}
+	if restarted := ParseRestartedServices(stdout); len(restarted) != 3 {
+		t.Errorf("expected all services to be restarted, got: %v", restarted)
+	}
+	events, _ := os.ReadFile(eventsPath)
+	want := "start web-1\nready web-1\nstart web-2\nready web-2\nstart web-3\nready web-3\n"
+	if string(events) != want {
+		t.Errorf("expected each service to start after the previous one is ready, got:\n%s", events)
+	}
+
+	// A service that fails stops the rollout, leaving the rest running
+	web3, err := f.GetServiceStatus("web-3")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(f.TempDir, "web-2.broken"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err = f.Run("restart", "--rolling")
+	if err == nil {
+		t.Fatal("expected restart to fail")
+	}
+	for _, want := range []string{"Restarted: [web-1]", "Failed: [web-2]", "Skipped: [web-3]"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in the output, got:\n%s", want, stdout)
+		}
+	}
+	if status, err := f.GetServiceStatus("web-3"); err != nil || status.PID != web3.PID {
+		t.Errorf("expected web-3 to keep running as PID %d, got %+v (%v)", web3.PID, status, err)
+	}
+}
+
+// 4.8: `restart --rolling` leaves the dependents of the restarted services running.
+func TestRestart_RollingKeepsDependents(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  web:
+    command: echo ready; sleep 60
+    replicas: 2
+    ready_log_pattern: ^ready$
+  proxy:
+    command: sleep 60
+    depends_on: [web]
+`)
+	if _, stderr, err := f.Run("up", "--wait"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	proxy, err := f.GetServiceStatus("proxy")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+
+	stdout, stderr, err := f.Run("restart", "--rolling", "web")
+	if err != nil {
+		t.Fatalf("restart failed: %v\n%s", err, stderr)
+	}
+	if restarted := ParseRestartedServices(stdout); !slices.Equal(restarted, []string{"web-1", "web-2"}) {
+		t.Errorf("expected only the replicas of web to be restarted, got: %v", restarted)
+	}
+	if status, err := f.GetServiceStatus("proxy"); err != nil || status.State != "running" || status.PID != proxy.PID {
+		t.Errorf("expected proxy to keep running as PID %d, got %+v (%v)", proxy.PID, status, err)
+	}
+}
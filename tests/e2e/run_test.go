@@ -0,0 +1,84 @@
+package e2e
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 24.1: `run` runs a one-off command in the service's working directory and environment, and exits with its exit code.
+func TestRun(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	if err := os.Mkdir(filepath.Join(f.TempDir, "backend"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+    working_dir: ./backend
+    env:
+      GREETING: hello
+`)
+	f.Up()
+
+	stdout, stderr, err := f.Run("run", "api", "sh", "-c", `pwd; echo "$GREETING"; echo oops >&2; exit 3`)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got %v\n%s", err, stderr)
+	}
+	if want := filepath.Join(f.TempDir, "backend") + "\nhello\n"; stdout != want {
+		t.Errorf("expected %q on stdout, got %q", want, stdout)
+	}
+	if stderr != "oops\n" {
+		t.Errorf("expected the command's stderr, got %q", stderr)
+	}
+
+	// Input is forwarded until it ends
+	stdout, stderr, err = f.RunWithInput("one\ntwo\n", "run", "api", "--", "wc", "-l")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "2" {
+		t.Errorf("expected the command to read the input, got %q", stdout)
+	}
+}
+
+// 24.2: Interrupting `run` stops the command.
+func TestRun_Interrupt(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+`)
+	f.Up()
+
+	cmd, buf, err := f.RunAsync("run", "api", "sh", "-c", `trap 'touch stopped; exit 1' TERM; echo started; sleep 30 & wait`)
+	if err != nil {
+		t.Fatalf("failed to start run: %v", err)
+	}
+	if err := WaitForContent(buf, "started", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	InterruptAndWait(cmd)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(f.TempDir, "stopped")); err == nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("expected the command to be stopped with SIGTERM")
+}
@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// 27.1: Each replica of a service with `replicas` runs as its own service, and `scale` adds and removes replicas.
+func TestScale(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  worker:
+    command: sh -c 'echo "replica $COMPROC_REPLICA"; exec sleep 60'
+    replicas: 2
+`)
+	f.Up()
+	first, err := f.GetServiceStatus("worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("scale", "worker=3")
+	if err != nil {
+		t.Fatalf("scale failed: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{"Added: [worker-3]", "Started: [worker-3]"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, stdout)
+		}
+	}
+	statuses, err := f.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range statuses {
+		names = append(names, s.Name)
+		if s.State != "running" {
+			t.Errorf("expected %s to be running, got %s", s.Name, s.State)
+		}
+		if s.Name == "worker-1" && s.PID != first.PID {
+			t.Error("expected worker-1 to keep running")
+		}
+	}
+	if strings.Join(names, " ") != "worker-1 worker-2 worker-3" {
+		t.Errorf("expected three replicas, got %v", names)
+	}
+
+	// The service's name selects all of its replicas
+	stdout, _, err = f.Run("logs", "--raw", "worker")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	for _, want := range []string{"replica 1", "replica 2", "replica 3"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in logs, got:\n%s", want, stdout)
+		}
+	}
+
+	stdout, stderr, err = f.Run("scale", "worker=1")
+	if err != nil {
+		t.Fatalf("scale failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Removed: [worker-2 worker-3]") {
+		t.Errorf("expected worker-2 and worker-3 to be removed, got:\n%s", stdout)
+	}
+	if statuses, err = f.GetStatus(); err != nil || len(statuses) != 1 || statuses[0].Name != "worker-1" {
+		t.Errorf("expected only worker-1 to be left, got %+v (%v)", statuses, err)
+	}
+}
+
+// 27.2: `scale` with an unknown service or an invalid count fails.
+func TestScale_Invalid(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  worker:
+    command: sleep 60
+`)
+	f.Up()
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"api=2", "service not found: api"},
+		{"worker=0", "invalid replica count"},
+		{"worker", "invalid scale argument"},
+	}
+	for _, tt := range tests {
+		_, stderr, err := f.Run("scale", tt.arg)
+		if err == nil || !strings.Contains(stderr, tt.want) {
+			t.Errorf("scale %s: expected %q error, got %v:\n%s", tt.arg, tt.want, err, stderr)
+		}
+	}
+	if s, err := f.GetServiceStatus("worker"); err != nil || s.State != "running" {
+		t.Errorf("expected worker to keep running, got %+v (%v)", s, err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+
+	"github.com/ryym/comproc/comproctest"
 )
 
 var binPath string
@@ -22,6 +24,7 @@ func TestMain(m *testing.M) {
 	if err := cmd.Run(); err != nil {
 		panic("failed to build binary: " + err.Error())
 	}
+	comproctest.Binary = binPath
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,236 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 12.1: `daemon stats` fails when no daemon is running.
+func TestDaemonStats_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("daemon", "stats")
+	if err == nil {
+		t.Fatal("expected daemon stats to fail without a daemon")
+	}
+	if !strings.Contains(stderr, "daemon is not reachable") {
+		t.Errorf("expected unreachable error, got:\n%s", stderr)
+	}
+}
+
+// 12.2: `daemon stats` reports the config path, connections, and buffered log lines.
+func TestDaemonStats_WithDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo hello; sleep 60'
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	// Poll until the echoed line has been collected
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, stderr, err = f.Run("daemon", "stats")
+		if err != nil {
+			t.Fatalf("daemon stats failed: %v\n%s", err, stderr)
+		}
+		if strings.Contains(stdout, "Log lines:      1 ") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, want := range []string{f.ConfigPath, "Connections:    1", "Log lines:      1 (5 B of 64.0 MiB)", "Uptime:"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, stdout)
+		}
+	}
+}
+
+// 12.3: Lines over `log_memory_limit` are evicted and counted in `daemon stats`.
+func TestDaemonStats_LogMemoryLimit(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+log_memory_limit: 1KiB
+services:
+  app:
+    command: sh -c 'for i in $(seq 1 100); do echo "line $i with some padding"; done; sleep 60'
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, stderr, err = f.Run("daemon", "stats")
+		if err != nil {
+			t.Fatalf("daemon stats failed: %v\n%s", err, stderr)
+		}
+		if strings.Contains(stdout, "Log evicted:") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(stdout, "of 1.0 KiB)") || !strings.Contains(stdout, "Log evicted:") {
+		t.Fatalf("expected evicted lines within the limit, got:\n%s", stdout)
+	}
+
+	// The newest lines are kept
+	logs, _, err := f.Run("logs", "--raw", "app")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	if !strings.Contains(logs, "line 100 ") || strings.Contains(logs, "line 1 ") {
+		t.Errorf("expected only the newest lines, got:\n%s", logs)
+	}
+}
+
+// 12.4: The daemon runs detached with a pidfile, and `daemon stop` stops it and removes the pidfile.
+func TestDaemonStop(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	pid := f.DaemonPID()
+	pidPath := strings.TrimSuffix(f.SocketPath, ".sock") + ".pid"
+	data, err := os.ReadFile(pidPath)
+	if err != nil {
+		t.Fatalf("expected a pidfile: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != strconv.Itoa(pid) {
+		t.Errorf("expected pid %d in the pidfile, got %s", pid, got)
+	}
+
+	// The daemon leads a session of its own and runs in "/"
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		t.Fatalf("failed to read the daemon's stat: %v", err)
+	}
+	// Fields after the command: state, ppid, pgrp, session
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if fields[3] != strconv.Itoa(pid) {
+		t.Errorf("expected the daemon to lead its session, got session %s", fields[3])
+	}
+	if cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid)); err != nil || cwd != "/" {
+		t.Errorf("expected the daemon to run in /, got %q, %v", cwd, err)
+	}
+
+	stdout, stderr, err := f.Run("daemon", "stop")
+	if err != nil {
+		t.Fatalf("daemon stop failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Stopped: [app]") || !strings.Contains(stdout, "Daemon stopped") {
+		t.Errorf("expected the stopped services, got:\n%s", stdout)
+	}
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Errorf("expected the pidfile to be removed, got %v", err)
+	}
+	if err := exec.Command("kill", "-0", strconv.Itoa(pid)).Run(); err == nil {
+		t.Errorf("expected the daemon process %d to have exited", pid)
+	}
+}
+
+// 12.5: `daemon stop` removes a pidfile left behind by a daemon that is gone.
+func TestDaemonStop_StalePidfile(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	// The PID of a process that has exited
+	gone := exec.Command("true")
+	if err := gone.Run(); err != nil {
+		t.Fatal(err)
+	}
+	pidPath := strings.TrimSuffix(f.SocketPath, ".sock") + ".pid"
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(gone.Process.Pid)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("daemon", "stop")
+	if err != nil {
+		t.Fatalf("daemon stop failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "removed the stale pidfile") {
+		t.Errorf("expected the stale pidfile to be reported, got:\n%s", stdout)
+	}
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Errorf("expected the stale pidfile to be removed, got %v", err)
+	}
+}
+
+// 12.6: `daemon stop` doesn't signal a live process whose PID is in a pidfile left behind by a daemon that is gone.
+func TestDaemonStop_ReusedPID(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	// An unrelated process that got the PID of the old daemon
+	other := exec.Command("sleep", "60")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Process.Kill()
+	exited := make(chan error, 1)
+	go func() { exited <- other.Wait() }()
+
+	pidPath := strings.TrimSuffix(f.SocketPath, ".sock") + ".pid"
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(other.Process.Pid)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("daemon", "stop")
+	if err != nil {
+		t.Fatalf("daemon stop failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "removed the stale pidfile") {
+		t.Errorf("expected the stale pidfile to be reported, got:\n%s", stdout)
+	}
+	select {
+	case err := <-exited:
+		t.Errorf("expected the unrelated process to keep running, but it exited: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
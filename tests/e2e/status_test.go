@@ -1,9 +1,17 @@
 package e2e
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/ryym/comproc/comproctest"
 )
 
 // 5.1: Shows correct NAME, STATE=running, PID, RESTARTS for live service.
@@ -142,7 +150,7 @@ services:
 
 	stdout, _, _ := f.Run("status")
 
-	statuses := parseStatusOutput(stdout)
+	statuses := comproctest.ParseStatus(stdout)
 	if len(statuses) != 2 {
 		t.Fatalf("expected 2 services, got %d\noutput:\n%s", len(statuses), stdout)
 	}
@@ -200,7 +208,7 @@ services:
 	}
 }
 
-// 5.7: Process exits with 1 (restart:never) -> state=failed.
+// 5.7: Process exits with 1 (restart:never) -> state=failed, and up reports it as failed.
 func TestStatus_FailedExit(t *testing.T) {
 	skipIfShort(t)
 	t.Parallel()
@@ -212,9 +220,12 @@ services:
     command: "false"
     restart: never
 `)
-	_, stderr, err := f.Run("up")
-	if err != nil {
-		t.Fatalf("up failed: %v\n%s", err, stderr)
+	stdout, _, err := f.Run("up")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	if !strings.Contains(stdout, "app: exited with code 1") {
+		t.Errorf("expected the exit code in the output, got:\n%s", stdout)
 	}
 
 	err = f.WaitForState("app", "failed", 5*time.Second)
@@ -231,3 +242,392 @@ services:
 		t.Errorf("expected state=failed after non-zero exit, got %s", status.State)
 	}
 }
+
+// 5.8: An unresponsive daemon results in a timeout error instead of hanging (`--timeout`).
+func TestStatus_DaemonTimeout(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+
+	// Accept connections on the daemon socket but never respond
+	ln, err := net.Listen("unix", f.SocketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	defer func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	start := time.Now()
+	_, stderr, err := f.Run("--timeout", "500ms", "status")
+	if err == nil {
+		t.Fatal("expected status to fail")
+	}
+	if !strings.Contains(stderr, "timed out after 500ms") {
+		t.Errorf("expected timeout error, got:\n%s", stderr)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected status to give up quickly, took %v", elapsed)
+	}
+}
+
+// 5.9: `status --wide` shows each service's restart policy, working directory, and command.
+func TestStatus_Wide(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    restart: on-failure
+  idle:
+    command: sh -c 'echo idle'
+`)
+	f.Up("app")
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("status", "--wide")
+	if err != nil {
+		t.Fatalf("status --wide failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got:\n%s", stdout)
+	}
+	if fields := strings.Fields(lines[0]); !slices.Equal(fields[len(fields)-4:], []string{"POLICY", "PORTS", "WORKDIR", "COMMAND"}) {
+		t.Errorf("expected wide columns, got header %q", lines[0])
+	}
+	wantApp := "on-failure  -      " + f.TempDir + "  sleep 60"
+	if !strings.HasSuffix(lines[1], wantApp) {
+		t.Errorf("expected app row to end with %q, got %q", wantApp, lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "sh -c 'echo idle'") {
+		t.Errorf("expected the command of the stopped service, got %q", lines[2])
+	}
+}
+
+// 5.10: A stopped or failed service shows its EXIT CODE and EXITED time.
+func TestStatus_ExitColumns(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  job:
+    command: sh -c 'exit 3'
+  app:
+    command: sleep 60
+`)
+	f.Run("up") // Reports job as failed
+	if err := f.WaitForState("job", "failed", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("status")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if !strings.Contains(lines[0], "EXIT CODE  EXITED") {
+		t.Errorf("expected exit columns in the header, got %q", lines[0])
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "job":
+			// NAME STATE PID RESTARTS STARTED (date time) EXIT CODE EXITED (date time) CPU MEM
+			if code := fields[6]; code != "3" {
+				t.Errorf("expected exit code 3 for job, got %q in %q", code, line)
+			}
+			if _, err := time.Parse("2006-01-02 15:04:05", strings.Join(fields[7:9], " ")); err != nil {
+				t.Errorf("expected an exit time for job, got %q", line)
+			}
+		case "app":
+			if fields[6] != "-" || fields[7] != "-" {
+				t.Errorf("expected no exit for running app, got %q", line)
+			}
+		}
+	}
+}
+
+// 5.11: A service killed by a signal shows the signal's name as its EXIT CODE.
+func TestStatus_ExitSignal(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  job:
+    command: kill -KILL $$
+`)
+	f.Run("up") // Reports job as failed
+	if err := f.WaitForState("job", "failed", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := f.Run("status")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one service, got:\n%s", stdout)
+	}
+	// NAME STATE PID RESTARTS STARTED (date time) EXIT CODE ...
+	fields := strings.Fields(lines[1])
+	if code := fields[6]; code != "SIGKILL" {
+		t.Errorf("expected SIGKILL as the exit code, got %q in %q", code, lines[1])
+	}
+}
+
+// 5.12: `status --tree` shows services below the dependencies they start after.
+func TestStatus_Tree(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  web:
+    command: sleep 60
+    depends_on: [api]
+  api:
+    command: sleep 60
+    depends_on: [db]
+  db:
+    command: sleep 60
+  worker:
+    command: sleep 60
+`)
+
+	// Without a daemon, the tree is built from the config file
+	stdout, stderr, err := f.Run("status", "--tree")
+	if err != nil {
+		t.Fatalf("status --tree failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and 4 rows, got:\n%s", stdout)
+	}
+	want := []string{"db ", "└─ api ", "   └─ web ", "worker "}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i+1], prefix) {
+			t.Errorf("expected row %d to start with %q, got %q", i+1, prefix, lines[i+1])
+		}
+	}
+	// Columns stay aligned despite the tree characters
+	stateCol := strings.Index(lines[0], "STATE")
+	if col := strings.Index(lines[3], "stopped"); len([]rune(lines[3][:col])) != stateCol {
+		t.Errorf("expected STATE to be aligned, got:\n%s", stdout)
+	}
+}
+
+// 5.13: The daemon keeps a JSON state file next to the socket and removes it on shutdown.
+func TestStatus_StateFile(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  idle:
+    command: sleep 60
+`)
+	f.Up("app")
+	st, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := strings.TrimSuffix(f.SocketPath, ".sock") + ".state.json"
+	type state struct {
+		PID      int `json:"pid"`
+		Services []struct {
+			Name  string `json:"name"`
+			State string `json:"state"`
+			PID   int    `json:"pid"`
+		} `json:"services"`
+	}
+	// waitState waits until the state file shows app in the given state
+	waitState := func(want string) state {
+		t.Helper()
+		var s state
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			data, err := os.ReadFile(path)
+			if err == nil && json.Unmarshal(data, &s) == nil && len(s.Services) == 2 && s.Services[0].State == want {
+				return s
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("expected app to be %s in the state file, got %+v", want, s)
+		return s
+	}
+
+	s := waitState("running")
+	if s.PID != f.DaemonPID() {
+		t.Errorf("expected the daemon PID %d, got %d", f.DaemonPID(), s.PID)
+	}
+	if s.Services[0].Name != "app" || s.Services[0].PID != st.PID || s.Services[1].State != "stopped" {
+		t.Errorf("unexpected services: %+v", s.Services)
+	}
+
+	if _, stderr, err := f.Run("stop", "app"); err != nil {
+		t.Fatalf("stop failed: %v\n%s", err, stderr)
+	}
+	waitState("stopped")
+
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForSocketGone(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("expected state file %s to be removed after down", path)
+}
+
+// 5.14: status --format json and yaml print the raw status, with or without a daemon
+func TestStatus_Format(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  worker:
+    command: sleep 60
+    depends_on: [app]
+`)
+
+	var result struct {
+		Services []struct {
+			Name      string   `json:"name"`
+			State     string   `json:"state"`
+			PID       int      `json:"pid"`
+			DependsOn []string `json:"depends_on"`
+		} `json:"services"`
+	}
+	stdout, stderr, err := f.Run("status", "--format", "json")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", stdout, err)
+	}
+	if len(result.Services) != 2 || result.Services[0].State != "stopped" {
+		t.Errorf("expected stopped services without a daemon, got %+v", result.Services)
+	}
+
+	f.Up()
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	app, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err = f.Run("status", "--format", "json")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", stdout, err)
+	}
+	if result.Services[0].Name != "app" || result.Services[0].PID != app.PID || !slices.Equal(result.Services[1].DependsOn, []string{"app"}) {
+		t.Errorf("unexpected services: %+v", result.Services)
+	}
+
+	stdout, stderr, err = f.Run("status", "--format", "yaml")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	want := fmt.Sprintf("services:\n  - name: app\n    state: running\n    pid: %d\n", app.PID)
+	if !strings.HasPrefix(stdout, want) || !strings.Contains(stdout, "    depends_on:\n      - app\n") {
+		t.Errorf("expected YAML starting with %q, got %q", want, stdout)
+	}
+
+	_, stderr, err = f.Run("status", "--format", "xml")
+	if err == nil || !strings.Contains(stderr, "invalid status format") {
+		t.Errorf("expected an unknown format to be rejected, got %q (%v)", stderr, err)
+	}
+}
+
+// 5.15: Running services show their sampled CPU and MEM use
+func TestStatus_Usage(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  job:
+    command: "true"
+`)
+	f.Up()
+
+	// The daemon samples every 2 seconds
+	var lines []string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ := f.Run("status")
+		lines = strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) == 3 && strings.HasSuffix(lines[1], " MiB") {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if len(lines) != 3 || !slices.Equal(strings.Fields(lines[0])[8:], []string{"CPU", "MEM"}) {
+		t.Fatalf("expected CPU and MEM columns, got %q", lines)
+	}
+	// NAME STATE PID RESTARTS STARTED (date time) EXIT CODE EXITED CPU MEM (value unit)
+	if fields := strings.Fields(lines[1]); len(fields) != 11 || !strings.HasSuffix(fields[8], "%") || fields[10] != "MiB" {
+		t.Errorf("expected the CPU and memory use of app, got %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); !slices.Equal(fields[len(fields)-2:], []string{"-", "-"}) {
+		t.Errorf("expected no usage for the exited job, got %q", lines[2])
+	}
+}
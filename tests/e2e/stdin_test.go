@@ -0,0 +1,67 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// 17.1: `stdin` writes its input to a service's stdin, in order.
+func TestStdin_WritesInput(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  repl:
+    command: sh -c 'while read line; do echo "got $line"; done'
+`)
+	f.Up()
+	if err := f.WaitForState("repl", "running", 5*time.Second); err != nil {
+		t.Fatalf("WaitForState failed: %v", err)
+	}
+
+	if _, stderr, err := f.RunWithInput("one\ntwo\nthree\n", "stdin", "repl"); err != nil {
+		t.Fatalf("stdin failed: %v\n%s", err, stderr)
+	}
+
+	expected := "got one\ngot two\ngot three\n"
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stdout, _, _ = f.Run("logs", "--raw", "repl")
+		if stdout == expected {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("expected the service to read each line, got:\n%q", stdout)
+}
+
+// 17.2: `stdin` fails when the service is not running.
+func TestStdin_NotRunning(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  repl:
+    command: cat
+  app:
+    command: sleep 60
+`)
+	f.Up("app")
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatalf("WaitForState failed: %v", err)
+	}
+
+	_, stderr, err := f.RunWithInput("hello\n", "stdin", "repl")
+	if err == nil {
+		t.Fatal("expected stdin to fail for a stopped service")
+	}
+	if !strings.Contains(stderr, "not running") {
+		t.Errorf("expected not running error, got:\n%s", stderr)
+	}
+}
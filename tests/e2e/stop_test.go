@@ -1,6 +1,11 @@
 package e2e
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -261,3 +266,149 @@ func TestStop_NoDaemon(t *testing.T) {
 		t.Errorf("expected stop to succeed when no daemon, got error: %v", err)
 	}
 }
+
+// 3.8: An unambiguous prefix selects a service; a mistyped name is rejected with a suggestion.
+func TestStop_PrefixAndSuggestion(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+  worker:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("up")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	for _, svc := range []string{"api", "worker"} {
+		if err := f.WaitForState(svc, "running", 5*time.Second); err != nil {
+			t.Fatalf("WaitForState %s failed: %v", svc, err)
+		}
+	}
+
+	stdout, stderr, err := f.Run("stop", "wor")
+	if err != nil {
+		t.Fatalf("stop failed: %v\n%s", err, stderr)
+	}
+	if stopped := ParseStoppedServices(stdout); len(stopped) != 1 || stopped[0] != "worker" {
+		t.Errorf("expected only worker to be stopped, got: %v", stopped)
+	}
+
+	_, stderr, err = f.Run("stop", "aip")
+	if err == nil {
+		t.Fatal("expected stop to fail for an unknown service")
+	}
+	if !strings.Contains(stderr, "service not found: aip (did you mean api?)") {
+		t.Errorf("expected a suggestion, got: %s", stderr)
+	}
+	status, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if status.State != "running" {
+		t.Errorf("expected api to still be running, got: %s", status.State)
+	}
+}
+
+// 3.9: Independent services stop concurrently; a service still stops after its dependents.
+func TestStop_Concurrent(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	order := filepath.Join(f.TempDir, "order")
+	// Each service takes a second to exit after SIGTERM
+	slow := func(name string) string {
+		return fmt.Sprintf(`sh -c 'trap "sleep 1; echo %s >> %s; exit 0" TERM; while :; do sleep 0.1; done'`, name, order)
+	}
+	f.WriteConfig(fmt.Sprintf(`
+services:
+  db:
+    command: %s
+  api:
+    command: %s
+    depends_on:
+      - db
+  worker1:
+    command: %s
+  worker2:
+    command: %s
+`, slow("db"), slow("api"), slow("worker1"), slow("worker2")))
+	f.Up()
+	for _, svc := range []string{"db", "api", "worker1", "worker2"} {
+		if err := f.WaitForState(svc, "running", 5*time.Second); err != nil {
+			t.Fatalf("WaitForState %s failed: %v", svc, err)
+		}
+	}
+
+	start := time.Now()
+	if _, stderr, err := f.Run("stop"); err != nil {
+		t.Fatalf("stop failed: %v\n%s", err, stderr)
+	}
+	// Stopping one at a time would take at least 4 seconds
+	if elapsed := time.Since(start); elapsed > 3500*time.Millisecond {
+		t.Errorf("expected services to stop concurrently, took %v", elapsed)
+	}
+
+	data, err := os.ReadFile(order)
+	if err != nil {
+		t.Fatalf("failed to read stop order: %v", err)
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) != 4 || slices.Index(lines, "api") > slices.Index(lines, "db") {
+		t.Errorf("expected api to stop before db, got %v", lines)
+	}
+}
+
+// 3.10: Services that ignore SIGTERM are killed after the graceful timeout, which `--graceful-timeout` overrides.
+func TestStop_GracefulTimeout(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+graceful_timeout: 500ms
+services:
+  stubborn:
+    command: sh -c 'trap "" TERM; while :; do sleep 0.1; done'
+`)
+	stop := func() time.Duration {
+		t.Helper()
+		if err := f.WaitForState("stubborn", "running", 5*time.Second); err != nil {
+			t.Fatalf("WaitForState failed: %v", err)
+		}
+		start := time.Now()
+		if _, stderr, err := f.Run("stop"); err != nil {
+			t.Fatalf("stop failed: %v\n%s", err, stderr)
+		}
+		return time.Since(start)
+	}
+
+	f.Up()
+	if elapsed := stop(); elapsed > 3*time.Second {
+		t.Errorf("expected the service to be killed after 500ms, took %v", elapsed)
+	}
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForSocketGone(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteConfig(`
+graceful_timeout: 1m
+services:
+  stubborn:
+    command: sh -c 'trap "" TERM; while :; do sleep 0.1; done'
+`)
+	if _, stderr, err := f.Run("--graceful-timeout", "500ms", "up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	if elapsed := stop(); elapsed > 3*time.Second {
+		t.Errorf("expected --graceful-timeout to take precedence, took %v", elapsed)
+	}
+}
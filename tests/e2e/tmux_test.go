@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// runTmux runs tmux against the server of the given TMUX_TMPDIR, so tests
+// don't touch the developer's tmux sessions.
+func runTmux(t *testing.T, tmpDir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("tmux", args...)
+	cmd.Env = append(cmd.Environ(), "TMUX_TMPDIR="+tmpDir, "TMUX=")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("tmux %v failed: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+// 14.1: `tmux -d` creates a session with a window per service following its logs.
+func TestTmux_Windows(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+  db:
+    command: sleep 60
+`)
+	env := []string{"TMUX_TMPDIR=" + f.TempDir, "TMUX="}
+	t.Cleanup(func() {
+		cmd := exec.Command("tmux", "kill-server")
+		cmd.Env = append(cmd.Environ(), env...)
+		cmd.Run()
+	})
+
+	f.Up()
+	stdout, stderr, err := f.RunWithEnv(env, "tmux", "-d", "--session", "stack")
+	if err != nil {
+		t.Fatalf("tmux failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Created tmux session stack") {
+		t.Errorf("expected session to be created, got:\n%s", stdout)
+	}
+
+	windows := runTmux(t, f.TempDir, "list-windows", "-t", "=stack", "-F", "#{window_name}")
+	if got := strings.Fields(windows); len(got) != 2 || got[0] != "api" || got[1] != "db" {
+		t.Errorf("expected windows api and db, got %v", got)
+	}
+	panes := runTmux(t, f.TempDir, "list-panes", "-s", "-t", "=stack", "-F", "#{pane_start_command}")
+	if !strings.Contains(panes, "logs -f 'api'") || !strings.Contains(panes, "logs -f 'db'") {
+		t.Errorf("expected panes following logs, got:\n%s", panes)
+	}
+}
+
+// 14.2: `tmux` fails when no daemon is running.
+func TestTmux_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("tmux", "-d")
+	if err == nil {
+		t.Fatal("expected tmux to fail without a daemon")
+	}
+	if !strings.Contains(stderr, "daemon is not running") {
+		t.Errorf("expected daemon error, got:\n%s", stderr)
+	}
+}
@@ -1,7 +1,14 @@
 package e2e
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -396,3 +403,795 @@ services:
 		t.Errorf("expected app1 PID to remain %d, got %d", app1PID, status1After.PID)
 	}
 }
+
+// 1.11: `up --no-daemon` runs services in the foreground without a socket; Ctrl-C stops them.
+func TestUp_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sh -c 'echo "hello from app"; sleep 60'
+`)
+	cmd, outBuf, err := f.RunAsync("up", "--no-daemon")
+	if err != nil {
+		t.Fatalf("failed to start up --no-daemon: %v", err)
+	}
+
+	if err := WaitForContent(outBuf, "hello from app", 5*time.Second); err != nil {
+		t.Fatalf("expected log output: %v", err)
+	}
+
+	if _, err := os.Stat(f.SocketPath); !os.IsNotExist(err) {
+		t.Errorf("expected no socket to be created, got: %v", err)
+	}
+
+	if err := InterruptAndWait(cmd); err != nil {
+		t.Fatalf("expected clean exit after Ctrl-C, got: %v\n%s", err, outBuf.String())
+	}
+
+	stopped := ParseStoppedServices(outBuf.String())
+	if !ContainsAll(stopped, []string{"app"}) {
+		t.Errorf("expected app in stopped list, got %v\n%s", stopped, outBuf.String())
+	}
+}
+
+// 1.12: `up --exit-code-from svc` stops all services when svc exits and uses its exit code.
+func TestUp_ExitCodeFrom(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sleep 60
+  tests:
+    command: sh -c 'sleep 0.5; echo "tests done"; exit 3'
+    depends_on:
+      - db
+`)
+	stdout, stderr, err := f.Run("up", "--exit-code-from", "tests")
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "tests done") {
+		t.Errorf("expected output of tests service, got:\n%s", stdout)
+	}
+	stopped := ParseStoppedServices(stdout)
+	if !ContainsAll(stopped, []string{"db"}) {
+		t.Errorf("expected db in stopped list, got %v", stopped)
+	}
+}
+
+// 1.13: `up --exit-code-from svc` exits with 0 when svc succeeds.
+func TestUp_ExitCodeFromSuccess(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sleep 60
+  tests:
+    command: "true"
+`)
+	_, stderr, err := f.Run("up", "--exit-code-from", "tests")
+	if err != nil {
+		t.Fatalf("expected success, got: %v\n%s", err, stderr)
+	}
+}
+
+// 1.14: A second project sharing the daemon socket is namespaced as project/service.
+func TestUp_SharedDaemonMultipleProjects(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  api:
+    command: sleep 60
+`)
+	otherDir := filepath.Join(f.TempDir, "shop")
+	if err := os.MkdirAll(otherDir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	otherConfig := filepath.Join(otherDir, "comproc.yaml")
+	err := os.WriteFile(otherConfig, []byte(`
+services:
+  api:
+    command: sleep 60
+`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	// A second -f would be merged onto the fixture's config instead
+	runOther := func(args ...string) (string, string, error) {
+		primary := f.ConfigPath
+		f.ConfigPath = otherConfig
+		defer func() { f.ConfigPath = primary }()
+		return f.Run(args...)
+	}
+	if _, stderr, err := runOther("up"); err != nil {
+		t.Fatalf("up for second project failed: %v\n%s", err, stderr)
+	}
+
+	for _, svc := range []string{"api", "shop/api"} {
+		if err := f.WaitForState(svc, "running", 5*time.Second); err != nil {
+			t.Errorf("WaitForState %s failed: %v", svc, err)
+		}
+	}
+
+	// Stopping from the second project only affects its own services
+	if _, stderr, err := runOther("stop"); err != nil {
+		t.Fatalf("stop for second project failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForState("shop/api", "stopped", 5*time.Second); err != nil {
+		t.Errorf("WaitForState shop/api failed: %v", err)
+	}
+	status, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if status.State != "running" {
+		t.Errorf("expected primary project's api to keep running, got %s", status.State)
+	}
+}
+
+// 1.15: `up --wait` returns once services are ready; dependents start only after their dependencies' readiness checks pass.
+func TestUp_WaitReady(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sh -c 'sleep 1; touch db.ready; sleep 60'
+    healthcheck:
+      command: test -f db.ready
+      interval: 100ms
+      retries: 100
+  api:
+    command: sh -c 'test -f db.ready && echo "db was ready"; sleep 60'
+    depends_on:
+      - db
+`)
+	stdout, stderr, err := f.Run("up", "--wait")
+	if err != nil {
+		t.Fatalf("up --wait failed: %v\n%s%s", err, stdout, stderr)
+	}
+
+	db, err := f.GetServiceStatus("db")
+	if err != nil {
+		t.Fatalf("GetServiceStatus db failed: %v", err)
+	}
+	if db.State != "ready" {
+		t.Errorf("expected db to be ready, got %s", db.State)
+	}
+
+	// Services without a readiness check are shown as running
+	api, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatalf("GetServiceStatus api failed: %v", err)
+	}
+	if api.State != "running" {
+		t.Errorf("expected api to be running, got %s", api.State)
+	}
+
+	logs, _, err := f.Run("logs", "api")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	if !strings.Contains(logs, "db was ready") {
+		t.Errorf("expected api to start after db became ready, got logs:\n%s", logs)
+	}
+}
+
+// 1.16: `up --wait` fails when a service's readiness check keeps failing; status shows it as unhealthy.
+func TestUp_WaitNotReady(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    healthcheck:
+      command: "false"
+      interval: 100ms
+      retries: 2
+`)
+	stdout, _, err := f.Run("up", "--wait")
+	if err == nil {
+		t.Fatal("expected up --wait to fail")
+	}
+	if !strings.Contains(stdout, "Not ready: [app]") {
+		t.Errorf("expected app to be reported as not ready, got:\n%s", stdout)
+	}
+
+	status, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatalf("GetServiceStatus app failed: %v", err)
+	}
+	if status.State != "unhealthy" {
+		t.Errorf("expected app to be unhealthy, got %s", status.State)
+	}
+}
+
+// 1.17: `prepare` runs to completion before the command, with its output in the service's logs.
+func TestUp_Prepare(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    prepare: sh -c 'echo "building app"; sleep 0.5; touch app.bin'
+    command: sh -c 'test -f app.bin && echo "app started"; sleep 60'
+`)
+	_, stderr, err := f.Run("up", "app")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatalf("WaitForState failed: %v", err)
+	}
+
+	cmd, outBuf, err := f.RunAsync("logs", "-f", "app")
+	if err != nil {
+		t.Fatalf("RunAsync failed: %v", err)
+	}
+	defer InterruptAndWait(cmd)
+
+	if err := WaitForContent(outBuf, "app started", 5*time.Second); err != nil {
+		t.Fatalf("expected command output after prepare: %v", err)
+	}
+	output := outBuf.String()
+	if !strings.Contains(output, "building app") {
+		t.Errorf("expected prepare output in logs, got:\n%s", output)
+	}
+	if strings.Index(output, "building app") > strings.Index(output, "app started") {
+		t.Errorf("expected prepare output before command output, got:\n%s", output)
+	}
+}
+
+// 1.18: A failing `prepare` prevents the service from starting.
+func TestUp_PrepareFailure(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    prepare: sh -c 'echo "build error" >&2; exit 1'
+    command: sh -c 'echo "app started"; sleep 60'
+`)
+	stdout, _, err := f.Run("up", "app")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	if !strings.Contains(stdout, "Failed: [app]") {
+		t.Errorf("expected app to be reported as failed, got:\n%s", stdout)
+	}
+
+	status, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if status.State != "failed" {
+		t.Errorf("expected app to be failed, got %s", status.State)
+	}
+
+	logs, _, err := f.Run("logs", "app")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	if !strings.Contains(logs, "build error") {
+		t.Errorf("expected prepare output in logs, got:\n%s", logs)
+	}
+	if strings.Contains(logs, "app started") {
+		t.Errorf("expected command not to run, got:\n%s", logs)
+	}
+}
+
+// 1.19: When the spawned daemon fails during startup, `up` reports the daemon's output instead of waiting for the timeout.
+func TestUp_DaemonStartFailure(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	// The log directory can't be created because a file is in the way.
+	// This passes config validation but makes the daemon fail to start.
+	if err := os.WriteFile(filepath.Join(f.TempDir, "logs"), nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+    logging:
+      - driver: file
+        path: logs/app.log
+`)
+
+	start := time.Now()
+	_, stderr, err := f.Run("--start-timeout", "20s", "up")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected up to fail as soon as the daemon exits, took %v", elapsed)
+	}
+	if !strings.Contains(stderr, "daemon exited during startup") {
+		t.Errorf("expected daemon exit to be reported, got:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "failed to create file log sink") {
+		t.Errorf("expected daemon output in the error, got:\n%s", stderr)
+	}
+}
+
+// 1.20: With `--respawn-daemon`, a crashed daemon is restarted along with the services that were running.
+func TestUp_RespawnDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  idle:
+    command: sleep 60
+`)
+	_, stderr, err := f.Run("up", "--respawn-daemon", "app")
+	if err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	before, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemonPID := f.DaemonPID()
+
+	// Let the watchdog record the running services, then crash the daemon
+	time.Sleep(1500 * time.Millisecond)
+	if err := syscall.Kill(daemonPID, syscall.SIGKILL); err != nil {
+		t.Fatalf("failed to kill daemon: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	var after *ServiceStatus
+	for time.Now().Before(deadline) {
+		after, err = f.GetServiceStatus("app")
+		if err == nil && after.State == "running" && after.PID != before.PID {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if after == nil || after.State != "running" || after.PID == before.PID {
+		t.Fatalf("expected app to run again in a new daemon, got %+v", after)
+	}
+	if newPID := f.DaemonPID(); newPID == daemonPID {
+		t.Errorf("expected a new daemon process, still %d", newPID)
+	}
+
+	// The orphaned process of the crashed daemon has been stopped
+	if err := syscall.Kill(before.PID, 0); err == nil {
+		t.Errorf("expected old process %d to be gone", before.PID)
+	}
+	// Services that were not running stay stopped
+	if idle, err := f.GetServiceStatus("idle"); err != nil || idle.State != "stopped" {
+		t.Errorf("expected idle to stay stopped, got %+v (%v)", idle, err)
+	}
+}
+
+// 1.21: After a daemon crash, the next daemon stops the processes left running and keeps restart counts.
+func TestUp_RecoverAfterDaemonCrash(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  flaky:
+    command: sh -c 'sleep 0.2; exit 1'
+    restart: on-failure
+`)
+	f.Run("up") // Reports flaky as failed, as it exits at once
+
+	// Wait for flaky to be restarted at least once
+	var flaky *ServiceStatus
+	var err error
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		flaky, err = f.GetServiceStatus("flaky")
+		if err == nil && flaky.Restarts >= 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if flaky == nil || flaky.Restarts < 1 {
+		t.Fatalf("expected flaky to be restarted, got %+v", flaky)
+	}
+	app, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(f.DaemonPID(), syscall.SIGKILL); err != nil {
+		t.Fatalf("failed to kill daemon: %v", err)
+	}
+
+	_, stderr, err := f.Run("up", "app")
+	if err != nil {
+		t.Fatalf("up after crash failed: %v\n%s", err, stderr)
+	}
+
+	if err := syscall.Kill(app.PID, 0); err == nil {
+		t.Errorf("expected process %d of the crashed daemon to be stopped", app.PID)
+	}
+	restored, err := f.GetServiceStatus("flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Restarts < flaky.Restarts {
+		t.Errorf("expected at least %d restarts to be kept, got %d", flaky.Restarts, restored.Restarts)
+	}
+
+	// A clean shutdown removes the journal
+	if _, stderr, err := f.Run("down"); err != nil {
+		t.Fatalf("down failed: %v\n%s", err, stderr)
+	}
+	if err := f.WaitForSocketGone(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	journal := strings.TrimSuffix(f.SocketPath, ".sock") + ".journal"
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(journal); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("expected journal %s to be removed after down", journal)
+}
+
+// 1.22: An `external` dependency is waited for until its address accepts connections, and is shown as a pseudo-service in status.
+func TestUp_WaitsForExternal(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	// Reserve a port and release it so nothing listens there yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	f := NewFixture(t)
+	f.WriteConfig(fmt.Sprintf(`
+services:
+  db:
+    external: %s
+    healthcheck:
+      interval: 100ms
+      retries: 100
+  app:
+    command: sleep 60
+    depends_on:
+      - db
+`, addr))
+	cmd, out, err := f.RunAsync("up", "--wait")
+	if err != nil {
+		t.Fatalf("failed to start up: %v", err)
+	}
+	if err := f.WaitForState("db", "waiting", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if app, err := f.GetServiceStatus("app"); err != nil || app.State != "stopped" {
+		t.Fatalf("expected app to wait for db, got %+v (%v)", app, err)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+	defer ln.Close()
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("up --wait failed: %v\n%s", err, out.String())
+	}
+	db, err := f.GetServiceStatus("db")
+	if err != nil {
+		t.Fatalf("GetServiceStatus db failed: %v", err)
+	}
+	if db.State != "ready" || db.PID != 0 {
+		t.Errorf("expected db to be ready without a PID, got %+v", db)
+	}
+	if err := f.WaitForState("app", "running", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 1.23: A dependency with `wait_for_file` is ready once the file exists.
+func TestUp_WaitForFile(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sh -c 'sleep 0.5; mkdir -p run; touch run/db.sock; sleep 60'
+    healthcheck:
+      wait_for_file: run/db.sock
+      interval: 100ms
+      retries: 50
+  api:
+    command: sh -c 'test -e run/db.sock && sleep 60'
+    depends_on:
+      - db
+`)
+
+	if _, stderr, err := f.Run("up", "--wait"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	// api exits at once if it starts before the file exists
+	time.Sleep(200 * time.Millisecond)
+	st, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "running" {
+		t.Errorf("expected api to start after db's file exists, got %s", st.State)
+	}
+}
+
+// 1.24: A dependency with `ready_log_pattern` is ready once its output matches.
+func TestUp_ReadyLogPattern(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  web:
+    command: sh -c 'echo compiling; sleep 0.5; touch started; echo "Listening on 8080"; sleep 60'
+    ready_log_pattern: Listening on \d+
+  e2e:
+    command: sh -c 'test -e started && sleep 60'
+    depends_on:
+      - web
+`)
+
+	if _, stderr, err := f.Run("up", "--wait"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	web, err := f.GetServiceStatus("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web.State != "ready" {
+		t.Errorf("expected web to be ready, got %s", web.State)
+	}
+	// e2e exits at once if it starts before the line is printed
+	time.Sleep(200 * time.Millisecond)
+	st, err := f.GetServiceStatus("e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "running" {
+		t.Errorf("expected e2e to start after web's line, got %s", st.State)
+	}
+}
+
+// 1.25: A service that exits with an error right after starting is reported as failed with its output.
+func TestUp_ReportsQuickExit(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+  broken:
+    command: echo unknown flag --prot >&2; exit 2
+  job:
+    command: "true"
+`)
+
+	stdout, _, err := f.Run("up")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	for _, want := range []string{"Started: [app job]", "Failed: [broken]", "broken: exited with code 2", "    unknown flag --prot"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in the output, got:\n%s", want, stdout)
+		}
+	}
+}
+
+// 1.26: A multi-line `command: |` block runs as a script.
+func TestUp_ScriptCommand(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: |
+      greeting="hello"
+      if [ -n "$greeting" ]; then
+        echo "$greeting from a script"
+      fi
+      exec sleep 60
+`)
+	f.Up()
+
+	var stdout string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stdout, _, _ = f.Run("logs", "--raw", "app"); stdout != "" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stdout != "hello from a script\n" {
+		t.Errorf("expected the script's output, got %q", stdout)
+	}
+}
+
+// 1.27: `up --remove-orphans` stops and removes services that were removed from the config.
+func TestUp_RemoveOrphans(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  old:
+    command: sleep 60
+  app:
+    command: sleep 60
+    depends_on:
+      - old
+`)
+	f.Up()
+	app, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	stdout, stderr, err := f.Run("up", "--remove-orphans")
+	if err != nil {
+		t.Fatalf("up --remove-orphans failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Removed: [old]") {
+		t.Errorf("expected old to be removed, got:\n%s", stdout)
+	}
+
+	statuses, err := f.GetStatus()
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "app" {
+		t.Errorf("expected only app in status, got %+v", statuses)
+	}
+	// Dependents of orphans keep running
+	if statuses[0].State != "running" || statuses[0].PID != app.PID {
+		t.Errorf("expected app to keep running as PID %d, got %+v", app.PID, statuses[0])
+	}
+}
+
+// 1.28: A service whose `requires` entries are not met fails with the missing prerequisites and is not restarted.
+func TestUp_Requires(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: touch started; sleep 60
+    restart: always
+    env:
+      APP_MODE: dev
+    requires:
+      - binary: sh
+      - file: app.conf
+      - env: APP_MODE
+      - env: COMPROC_TEST_UNSET
+`)
+	stdout, _, err := f.Run("up", "app")
+	if err == nil {
+		t.Fatal("expected up to fail")
+	}
+	for _, want := range []string{"Failed: [app]", `missing prerequisite: file "app.conf" does not exist; env COMPROC_TEST_UNSET is not set`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in the output, got:\n%s", want, stdout)
+		}
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	status, err := f.GetServiceStatus("app")
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if status.State != "failed" || status.Restarts != 0 {
+		t.Errorf("expected app to stay failed without restarts, got %+v", status)
+	}
+	if _, err := os.Stat(filepath.Join(f.TempDir, "started")); !os.IsNotExist(err) {
+		t.Error("expected the command not to run")
+	}
+}
+
+// 1.29: A dependent with `condition: service_healthy` starts once the dependency's health check passes, and one with `service_started` without waiting for it.
+func TestUp_DependsOnCondition(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  db:
+    command: sh -c 'sleep 1; touch ready; sleep 60'
+    healthcheck:
+      command: test -e ready
+      interval: 100ms
+      retries: 50
+  worker:
+    command: sh -c 'test -e ready || touch worker-early; sleep 60'
+    depends_on:
+      - service: db
+        condition: service_started
+  api:
+    command: sh -c 'test -e ready && sleep 60'
+    depends_on:
+      - service: db
+        condition: service_healthy
+`)
+
+	if _, stderr, err := f.Run("up", "--wait"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+	// api exits at once if it starts before db is healthy
+	time.Sleep(200 * time.Millisecond)
+	st, err := f.GetServiceStatus("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "running" {
+		t.Errorf("expected api to start after db is healthy, got %s", st.State)
+	}
+	if _, err := os.Stat(filepath.Join(f.TempDir, "worker-early")); err != nil {
+		t.Errorf("expected worker to start before db is healthy: %v", err)
+	}
+}
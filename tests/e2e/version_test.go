@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 10.1: `version` prints the CLI version and reports that no daemon is running.
+func TestVersion_NoDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	stdout, stderr, err := f.Run("version")
+	if err != nil {
+		t.Fatalf("version failed: %v\n%s", err, stderr)
+	}
+	if !strings.HasPrefix(stdout, "Client: ") {
+		t.Errorf("expected client version, got:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "Daemon: not running") {
+		t.Errorf("expected daemon to be reported as not running, got:\n%s", stdout)
+	}
+}
+
+// 10.2: `version` prints the daemon's version, which matches the CLI that spawned it.
+func TestVersion_WithDaemon(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+	if _, stderr, err := f.Run("up"); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, stderr)
+	}
+
+	stdout, stderr, err := f.Run("version")
+	if err != nil {
+		t.Fatalf("version failed: %v\n%s", err, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got:\n%s", stdout)
+	}
+	client := strings.TrimPrefix(lines[0], "Client: ")
+	daemon := strings.TrimPrefix(lines[1], "Daemon: ")
+	if client != daemon {
+		t.Errorf("expected matching versions, got client %q and daemon %q", client, daemon)
+	}
+	if strings.Contains(stderr, "Warning") {
+		t.Errorf("expected no warning, got:\n%s", stderr)
+	}
+}
+
+// 10.3: Commands warn when the running daemon was built with a different version.
+func TestVersion_MismatchWarning(t *testing.T) {
+	skipIfShort(t)
+	t.Parallel()
+
+	f := NewFixture(t)
+	f.WriteConfig(`
+services:
+  app:
+    command: sleep 60
+`)
+
+	// Start the daemon with a binary that reports another version
+	oldBin := filepath.Join(f.TempDir, "comproc-old")
+	build := exec.Command("go", "build",
+		"-ldflags", "-X github.com/ryym/comproc/internal/version.Version=v0.0.0-old",
+		"-o", oldBin, "../../cmd/comproc")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build binary: %v\n%s", err, out)
+	}
+	up := exec.Command(oldBin, "-f", f.ConfigPath, "up")
+	up.Env = append(os.Environ(), "COMPROC_SOCKET="+f.SocketPath)
+	if out, err := up.CombinedOutput(); err != nil {
+		t.Fatalf("up failed: %v\n%s", err, out)
+	}
+
+	_, stderr, err := f.Run("status")
+	if err != nil {
+		t.Fatalf("status failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, "daemon version v0.0.0-old differs") {
+		t.Errorf("expected version mismatch warning, got:\n%s", stderr)
+	}
+}